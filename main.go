@@ -3,6 +3,10 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/n-ulricksen/nes-emulator/nes"
 
@@ -14,58 +18,94 @@ import (
 var (
 	flagDebug   bool
 	flagLogging bool
+	flagScript  bool
+	flagLogDir  string
+	flagLogSize int64
+	flagBench   time.Duration
+	flagFPS     float64
+	flagRegion  string
+	flagMemAddr string
+	flagPalette string
 )
 
 func main() {
 	parseFlags()
 
 	fmt.Println("Starting NES...")
-	nesEmulator := nes.NewBus(flagDebug, flagLogging)
+	nesEmulator := nes.NewBus(flagDebug, false)
 
-	// Load a test cartridge
-	cart := nes.NewCartridge("./roms/DK.nes")
-	//cart := nes.NewCartridge("./roms/SMB.nes")
-	//cart := nes.NewCartridge("./external_tests/nestest/nestest.nes")
-	nesEmulator.InsertCartridge(cart)
+	if flagLogging {
+		logConfig := nes.LogConfig{Dir: flagLogDir, MaxSize: flagLogSize}
+		if err := nesEmulator.EnableLogging(logConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if flagPalette != "" {
+		if err := nesEmulator.Ppu.LoadPaletteFile(flagPalette); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	nesEmulator.Cpu.Disassemble(0x0000, 0xFFFF)
+	// Load a test cartridge
+	if err := nesEmulator.Load("./roms/DK.nes"); err != nil {
+		//if err := nesEmulator.Load("./roms/SMB.nes"); err != nil {
+		//if err := nesEmulator.Load("./external_tests/nestest/nestest.nes"); err != nil {
+		log.Fatal(err)
+	}
 
 	fmt.Println("Resetting NES...")
 	nesEmulator.Cpu.Reset()
 
+	if flagBench > 0 {
+		fmt.Println("Benchmark:", nesEmulator.Benchmark(flagBench))
+		return
+	}
+
+	if flagScript {
+		if err := nesEmulator.RunScripted(os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	switch flagRegion {
+	case "":
+	case "ntsc":
+		nesEmulator.SetRegion(nes.RegionNTSC)
+	case "pal":
+		nesEmulator.SetRegion(nes.RegionPAL)
+	default:
+		log.Fatalf("unknown region %q", flagRegion)
+	}
+	if flagMemAddr != "" {
+		addr, err := strconv.ParseUint(flagMemAddr, 16, 16)
+		if err != nil {
+			log.Fatalf("invalid memory address %q", flagMemAddr)
+		}
+		nesEmulator.SetMemoryDumpAddr(uint16(addr))
+	}
+	if flagFPS != 0 {
+		nesEmulator.SetTargetFPS(flagFPS)
+	}
 	pixelgl.Run(nesEmulator.Run)
 }
 
 func parseFlags() {
 	flag.BoolVar(&flagDebug, "d", false, "enable debug panel")
 	flag.BoolVar(&flagLogging, "l", false, "enable logging")
+	flag.StringVar(&flagLogDir, "logdir", "./logs", "directory to write logs to")
+	flag.Int64Var(&flagLogSize, "logsize", 0, "start a new log file after this many bytes (0 = never)")
+	flag.DurationVar(&flagBench, "bench", 0, "run without a display as fast as possible for the given duration, and report the speed")
+	flag.BoolVar(&flagScript, "s", false, "run without a display, reading controller input from stdin")
+	flag.Float64Var(&flagFPS, "fps", 0, "frames per second to run at (default: the region's frame rate, -1 = as fast as possible)")
+	flag.StringVar(&flagRegion, "region", "", "run as an \"ntsc\" or \"pal\" console (default: the game's region)")
+	flag.StringVar(&flagPalette, "palette", "", "64 color .pal file to use instead of the built-in NTSC palette")
+	flag.StringVar(&flagMemAddr, "mem", "", "hex address of the memory page shown in the debug panel, such as 0300")
 
 	flag.Parse()
 }
 
-func printDebugMem(t *text.Text, nesEmu *nes.Bus) {
-	// Print 16 bytes per line.
-	ramRowLimit := 0x0010
-
-	// RAM: 0x0000-0x00FF
-	ram1Base := 0x0000
-	ram1Limit := ram1Base + 0x100
-	for i := ram1Base; i < ram1Limit; i += ramRowLimit {
-		fmt.Fprintf(t, "$%04X: % x\n", i,
-			nesEmu.Ram[i:i+ramRowLimit])
-	}
-
-	fmt.Fprintf(t, "\n\n")
-
-	// RAM: 0x8000-0x80FF
-	ram2Base := 0xC000
-	ram2Limit := ram2Base + 0x100
-	for i := ram2Base; i < ram2Limit; i += ramRowLimit {
-		fmt.Fprintf(t, "$%04X: % x\n", i,
-			nesEmu.Ram[i:i+ramRowLimit])
-	}
-}
-
 // XXX: remove
 func printDebugCpu(t *text.Text, nesEmu *nes.Bus) {
 	fmt.Fprintf(t, "Flags: %08b\n", nesEmu.Cpu.Status)
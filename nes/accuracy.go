@@ -0,0 +1,63 @@
+package nes
+
+import (
+	"bytes"
+	"sort"
+)
+
+// AccuracyReport lists emulation accuracy features, and whether each one is
+// currently implemented and enabled. Include it in bug reports.
+func (b *Bus) AccuracyReport() map[string]bool {
+	return map[string]bool{
+		// Settings
+		"CPU open bus":            b.openBusEmulation,
+		"OAMDATA reads":           b.Ppu.accurateOamReads,
+		"Sprite zero hit":         b.Ppu.spriteZeroHitEnabled,
+		"OAM DMA timing":          b.dmaTiming == DMAAccurate,
+		"Random clock alignment":  b.randomClockAlignment,
+		"PPU open bus decay":      b.Ppu.openBusDecay,
+		"Dot-based PPU":           b.Ppu.renderMode == DotAccurate,
+		"Sprite overflow bug":     b.Ppu.spriteOverflowBug,
+		"DMC/controller conflict": b.dmcConflict,
+
+		// Always emulated
+		"PPU open bus":                 true,
+		"CPU dummy reads":              true,
+		"Sprite overflow flag":         true,
+		"Sprite evaluation at OAMADDR": true,
+		"Odd frame dot skip":           true,
+		"Palette backdrop hack":        true,
+		"APU":                          true,
+		"PAL timing":                   true,
+
+		// Not emulated yet
+		"Cycle-accurate CPU": false,
+		"OAM decay":          false,
+	}
+}
+
+// accuracyDebugString lists the accuracy report, one feature per line, marked
+// + if enabled or - if not.
+func (b *Bus) accuracyDebugString() string {
+	report := b.AccuracyReport()
+
+	features := make([]string, 0, len(report))
+	for feature := range report {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+
+	var buf bytes.Buffer
+	buf.WriteString("Accuracy:\n")
+	for _, feature := range features {
+		if report[feature] {
+			buf.WriteString("+ ")
+		} else {
+			buf.WriteString("- ")
+		}
+		buf.WriteString(feature)
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,30 @@
+package nes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAccuracyReport(t *testing.T) {
+	bus := NewBus(false, false)
+
+	if bus.AccuracyReport()["CPU open bus"] {
+		t.Error("CPU open bus reported enabled by default")
+	}
+
+	bus.SetOpenBusEmulation(true)
+	bus.SetDMATiming(DMAInstant)
+
+	report := bus.AccuracyReport()
+	if !report["CPU open bus"] {
+		t.Error("CPU open bus not reported after enabling it")
+	}
+	if report["OAM DMA timing"] {
+		t.Error("OAM DMA timing reported accurate with instant DMA")
+	}
+
+	debug := bus.accuracyDebugString()
+	if !strings.Contains(debug, "+ CPU open bus\n") || !strings.Contains(debug, "- OAM DMA timing\n") {
+		t.Errorf("debug panel text missing settings:\n%s", debug)
+	}
+}
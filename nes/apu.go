@@ -0,0 +1,357 @@
+package nes
+
+// Audio processing unit, built into the NES CPU. Each channel is controlled
+// through its own registers:
+//
+//	$4000-$4003 - pulse 1
+//	$4004-$4007 - pulse 2
+//	$4008-$400B - triangle
+//	$4010-$4013 - delta modulation channel (DMC)
+//	$4015       - channel enable (write), channel status (read)
+//	$4017       - frame counter
+//
+// reference: https://wiki.nesdev.com/w/index.php/APU
+type Apu struct {
+	pulse1   *apuPulse
+	pulse2   *apuPulse
+	triangle *apuTriangle
+	dmc      *apuDmc
+
+	cycles uint64 // Total number of CPU cycles run
+	region Region // TV system, which sets the frame counter and DMC timing
+
+	// Frame counter
+	frameFiveStep   bool // 5-step sequence, instead of 4-step
+	frameIrqInhibit bool // Never set the frame interrupt flag
+	frameIrq        bool // Frame interrupt flag, set at the end of the 4-step sequence
+	frameCycle      int  // CPU cycle of the sequence
+
+	// Output accumulated since the last Sample
+	outputSum   float64
+	outputCount int
+
+	audio       *AudioBackend // Where samples are pushed, nil if none
+	sampleClock int           // Counts towards the next sample pushed to audio
+	muted       bool          // Don't push samples to audio
+}
+
+const (
+	// APU registers
+	apuMinAddr          uint16 = 0x4000
+	apuMaxAddr          uint16 = 0x4013
+	apuStatusAddr       uint16 = 0x4015
+	apuFrameCounterAddr uint16 = 0x4017
+)
+
+// CPU cycles at which the frame counter clocks the channels (NTSC).
+const (
+	apuFrameStep1 = 7457
+	apuFrameStep2 = 14913
+	apuFrameStep3 = 22371
+	apuFrameStep4 = 29829 // Last step of the 4-step sequence
+	apuFrameStep5 = 37281 // Last step of the 5-step sequence
+)
+
+// Frame counter steps for each region.
+var apuFrameSteps = [...][5]int{
+	RegionNTSC: {apuFrameStep1, apuFrameStep2, apuFrameStep3, apuFrameStep4, apuFrameStep5},
+	RegionPAL:  {8313, 16627, 24939, 33252, 41565},
+}
+
+// Length counter values, indexed by the 5 bit value written to a channel's
+// length counter load register.
+var apuLengthTable = [32]byte{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+func NewApu() *Apu {
+	return &Apu{
+		pulse1:   newApuPulse(1),
+		pulse2:   newApuPulse(2),
+		triangle: new(apuTriangle),
+		dmc:      newApuDmc(),
+	}
+}
+
+// Reset the APU to its power-up state, with every channel silenced. The audio
+// backend stays connected, and stays muted if it was. The region is kept.
+func (a *Apu) Reset() {
+	audio, muted, region := a.audio, a.muted, a.region
+	*a = *NewApu()
+	a.audio, a.muted = audio, muted
+	a.setRegion(region)
+}
+
+// Set the TV system the frame counter and DMC are timed for.
+func (a *Apu) setRegion(r Region) {
+	a.region = r
+	a.dmc.setRegion(r)
+}
+
+// ConnectAudio sets the audio backend the APU pushes samples to, or none if
+// nil.
+func (a *Apu) ConnectAudio(backend *AudioBackend) {
+	a.audio = backend
+	a.sampleClock = 0
+}
+
+// SetMuted stops pushing samples to the audio backend, or starts again. The
+// backend plays silence while nothing is pushed.
+func (a *Apu) SetMuted(muted bool) {
+	a.muted = muted
+}
+
+// 1 APU clock cycle, run at the CPU clock rate.
+func (a *Apu) Clock() {
+	a.clockFrameCounter()
+
+	a.triangle.clockTimer()
+	a.dmc.clockTimer()
+
+	// Pulse timers are clocked every other CPU cycle.
+	if a.cycles%2 == 1 {
+		a.pulse1.clockTimer()
+		a.pulse2.clockTimer()
+	}
+
+	a.outputSum += float64(a.mixerOutput())
+	a.outputCount++
+
+	// Downsample to the backend's sample rate, averaging the output since the
+	// last sample.
+	if a.audio != nil {
+		a.sampleClock += a.audio.SampleRate
+		if a.sampleClock >= a.region.cpuClockRate() {
+			a.sampleClock -= a.region.cpuClockRate()
+			sample := a.Sample()
+			if !a.muted {
+				a.audio.PushSample(sample)
+			}
+		}
+	}
+
+	a.cycles++
+}
+
+// The frame counter clocks the channels' envelopes, length counters, and sweep
+// units about 240 times a second. The 4-step sequence also sets the frame
+// interrupt flag once per sequence.
+//
+// reference: https://wiki.nesdev.com/w/index.php/APU_Frame_Counter
+func (a *Apu) clockFrameCounter() {
+	steps := &apuFrameSteps[a.region]
+
+	switch a.frameCycle {
+	case steps[0], steps[2]:
+		a.quarterFrame()
+	case steps[1]:
+		a.quarterFrame()
+		a.halfFrame()
+	case steps[3] - 1, steps[3] + 1:
+		if !a.frameFiveStep {
+			a.setFrameIrq()
+		}
+	case steps[3]:
+		if !a.frameFiveStep {
+			a.quarterFrame()
+			a.halfFrame()
+			a.setFrameIrq()
+		}
+	case steps[4]:
+		a.quarterFrame()
+		a.halfFrame()
+	}
+
+	a.frameCycle++
+
+	// Start the sequence again.
+	if (!a.frameFiveStep && a.frameCycle > steps[3]+1) || a.frameCycle > steps[4] {
+		a.frameCycle = 0
+	}
+}
+
+func (a *Apu) setFrameIrq() {
+	if !a.frameIrqInhibit {
+		a.frameIrq = true
+	}
+}
+
+// Set the frame counter mode through $4017. The sequence is restarted, and the
+// 5-step mode clocks the channels straight away.
+func (a *Apu) writeFrameCounter(data byte) {
+	a.frameFiveStep = data&0x80 > 0
+	a.frameIrqInhibit = data&0x40 > 0
+	if a.frameIrqInhibit {
+		a.frameIrq = false
+	}
+
+	a.frameCycle = 0
+	if a.frameFiveStep {
+		a.quarterFrame()
+		a.halfFrame()
+	}
+}
+
+// Clock the envelopes and the triangle's linear counter, 4 times per frame.
+func (a *Apu) quarterFrame() {
+	a.pulse1.envelope.clock()
+	a.pulse2.envelope.clock()
+	a.triangle.clockLinear()
+}
+
+// Clock the length counters and sweep units, twice per frame.
+func (a *Apu) halfFrame() {
+	a.pulse1.length.clock()
+	a.pulse1.clockSweep()
+	a.pulse2.length.clock()
+	a.pulse2.clockSweep()
+	a.triangle.length.clock()
+}
+
+// Sample returns the average output of the APU since the last call, from 0 to
+// 1. It is called for every sample pushed to the audio backend, so don't call
+// it while one is connected.
+func (a *Apu) Sample() float32 {
+	if a.outputCount == 0 {
+		return a.mixerOutput()
+	}
+
+	sample := float32(a.outputSum / float64(a.outputCount))
+	a.outputSum = 0
+	a.outputCount = 0
+
+	return sample
+}
+
+// irq returns whether the APU is requesting an interrupt.
+func (a *Apu) irq() bool {
+	return a.frameIrq || a.dmc.irq
+}
+
+// Used by the CPU to read the APU status register. The other APU registers are
+// write-only.
+func (a *Apu) cpuRead(addr uint16) byte {
+	var data byte
+
+	if addr == apuStatusAddr {
+		// Channels with their length counter above 0
+		if a.pulse1.length.value > 0 {
+			data |= 0x01
+		}
+		if a.pulse2.length.value > 0 {
+			data |= 0x02
+		}
+		if a.triangle.length.value > 0 {
+			data |= 0x04
+		}
+		if a.dmc.bytesRemaining > 0 {
+			data |= 0x10
+		}
+
+		// Interrupt flags. Reading clears the frame interrupt flag.
+		if a.frameIrq {
+			data |= 0x40
+			a.frameIrq = false
+		}
+		if a.dmc.irq {
+			data |= 0x80
+		}
+	}
+
+	return data
+}
+
+// Used by the CPU to write to an APU register.
+func (a *Apu) cpuWrite(addr uint16, data byte) {
+	switch {
+	case addr >= 0x4000 && addr <= 0x4003:
+		a.pulse1.write(addr&0x3, data)
+	case addr >= 0x4004 && addr <= 0x4007:
+		a.pulse2.write(addr&0x3, data)
+	case addr >= 0x4008 && addr <= 0x400B:
+		a.triangle.write(addr&0x3, data)
+	case addr >= 0x4010 && addr <= 0x4013:
+		a.dmc.write(addr&0x3, data)
+	case addr == apuStatusAddr:
+		a.pulse1.length.setEnabled(data&0x01 > 0)
+		a.pulse2.length.setEnabled(data&0x02 > 0)
+		a.triangle.length.setEnabled(data&0x04 > 0)
+		a.dmc.setEnabled(data&0x10 > 0)
+	case addr == apuFrameCounterAddr:
+		a.writeFrameCounter(data)
+	}
+}
+
+// Length counters silence a channel once the time set by the game has passed.
+type apuLengthCounter struct {
+	enabled bool // Cleared through $4015, which holds the counter at 0
+	halt    bool // Stop counting down, keeping the channel playing
+	value   byte
+}
+
+// Load the counter from the length table, if the channel is enabled.
+func (l *apuLengthCounter) load(index byte) {
+	if l.enabled {
+		l.value = apuLengthTable[index&0x1F]
+	}
+}
+
+func (l *apuLengthCounter) setEnabled(enabled bool) {
+	l.enabled = enabled
+	if !enabled {
+		l.value = 0
+	}
+}
+
+func (l *apuLengthCounter) clock() {
+	if !l.halt && l.value > 0 {
+		l.value--
+	}
+}
+
+// Envelopes fade a channel's volume out from 15, or hold a constant volume.
+type apuEnvelope struct {
+	start    bool // Restart the fade on the next clock
+	loop     bool // Restart the fade from 15 once it reaches 0
+	constant bool // Use period as the volume, instead of fading
+	period   byte // Divider period, or the volume if constant
+
+	divider byte
+	decay   byte // Fading volume, 15 to 0
+}
+
+// Set the envelope from bits 0-5 of the channel's first register.
+func (e *apuEnvelope) write(data byte) {
+	e.loop = data&0x20 > 0
+	e.constant = data&0x10 > 0
+	e.period = data & 0x0F
+}
+
+func (e *apuEnvelope) clock() {
+	if e.start {
+		e.start = false
+		e.decay = 15
+		e.divider = e.period
+		return
+	}
+
+	if e.divider > 0 {
+		e.divider--
+		return
+	}
+
+	e.divider = e.period
+	if e.decay > 0 {
+		e.decay--
+	} else if e.loop {
+		e.decay = 15
+	}
+}
+
+func (e *apuEnvelope) volume() byte {
+	if e.constant {
+		return e.period
+	}
+	return e.decay
+}
@@ -0,0 +1,168 @@
+package nes
+
+// Delta modulation channel registers:
+//
+//	$4010: IL-- RRRR - IRQ enable, loop, rate index
+//	$4011: -DDD DDDD - direct load of the output level
+//	$4012: AAAA AAAA - sample address, $C000 + A * 64
+//	$4013: LLLL LLLL - sample length, L * 16 + 1 bytes
+//
+// Samples are read from CPU memory 1 byte at a time by DMA, suspending the
+// CPU. Each bit of a sample moves the 7 bit output level up or down by 2.
+//
+// reference: https://wiki.nesdev.com/w/index.php/APU_DMC
+type apuDmc struct {
+	irqEnabled bool
+	loop       bool // Restart the sample once it ends
+	irq        bool // Interrupt flag, set when a sample ends without looping
+
+	timer       uint16
+	timerPeriod uint16 // CPU cycles per sample bit
+	rate        byte   // Index into the region's rate table
+	region      Region
+
+	level byte // Output level, 0-127
+
+	// Memory reader
+	sampleAddr     uint16
+	sampleLength   uint16
+	currentAddr    uint16
+	bytesRemaining uint16
+	buffer         byte
+	bufferFull     bool
+
+	// Output unit
+	shifter       byte
+	bitsRemaining byte
+	silence       bool // Set while there is no sample byte to play
+}
+
+// CPU cycles per sample bit for each rate index, for each region.
+var apuDmcRateTable = [...][16]uint16{
+	RegionNTSC: {428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54},
+	RegionPAL:  {398, 354, 316, 298, 276, 236, 210, 198, 176, 148, 132, 118, 98, 78, 66, 50},
+}
+
+// CPU cycles suspended by DMA for each sample byte read. Hardware takes 1 to 4
+// cycles, depending on what the CPU is doing.
+const dmcDmaCycles = 4
+
+// Returns a DMC with its registers set as if written with 0.
+func newApuDmc() *apuDmc {
+	return &apuDmc{
+		timerPeriod:  apuDmcRateTable[RegionNTSC][0],
+		sampleAddr:   0xC000,
+		sampleLength: 1,
+		silence:      true,
+	}
+}
+
+// Write to one of the channel's 4 registers.
+func (d *apuDmc) write(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		d.irqEnabled = data&0x80 > 0
+		if !d.irqEnabled {
+			d.irq = false
+		}
+		d.loop = data&0x40 > 0
+		d.rate = data & 0x0F
+		d.timerPeriod = apuDmcRateTable[d.region][d.rate]
+	case 1:
+		d.level = data & 0x7F
+	case 2:
+		d.sampleAddr = 0xC000 | uint16(data)<<6
+	case 3:
+		d.sampleLength = uint16(data)<<4 | 1
+	}
+}
+
+// Use the region's rate table.
+func (d *apuDmc) setRegion(r Region) {
+	d.region = r
+	d.timerPeriod = apuDmcRateTable[r][d.rate]
+}
+
+// Start or stop the sample through $4015. The interrupt flag is cleared either
+// way.
+func (d *apuDmc) setEnabled(enabled bool) {
+	d.irq = false
+
+	if !enabled {
+		d.bytesRemaining = 0
+	} else if d.bytesRemaining == 0 {
+		d.restart()
+	}
+}
+
+// Play the sample from the start.
+func (d *apuDmc) restart() {
+	d.currentAddr = d.sampleAddr
+	d.bytesRemaining = d.sampleLength
+}
+
+// sampleRequest returns the address of the next sample byte when the sample
+// buffer needs filling by DMA.
+func (d *apuDmc) sampleRequest() (uint16, bool) {
+	return d.currentAddr, !d.bufferFull && d.bytesRemaining > 0
+}
+
+// Fill the sample buffer with the byte read from sampleRequest's address.
+func (d *apuDmc) loadSample(data byte) {
+	d.buffer = data
+	d.bufferFull = true
+
+	// The address wraps around to $8000.
+	if d.currentAddr == 0xFFFF {
+		d.currentAddr = 0x8000
+	} else {
+		d.currentAddr++
+	}
+
+	d.bytesRemaining--
+	if d.bytesRemaining == 0 {
+		if d.loop {
+			d.restart()
+		} else if d.irqEnabled {
+			d.irq = true
+		}
+	}
+}
+
+// Play the next bit of the sample each time the timer counts down to 0.
+func (d *apuDmc) clockTimer() {
+	if d.timer > 0 {
+		d.timer--
+		return
+	}
+	d.timer = d.timerPeriod - 1
+
+	if !d.silence {
+		if d.shifter&0x01 > 0 {
+			if d.level <= 125 {
+				d.level += 2
+			}
+		} else if d.level >= 2 {
+			d.level -= 2
+		}
+	}
+	d.shifter >>= 1
+
+	if d.bitsRemaining > 0 {
+		d.bitsRemaining--
+	}
+	if d.bitsRemaining == 0 {
+		// Start playing the next byte, or stay silent until there is one.
+		d.bitsRemaining = 8
+		d.silence = !d.bufferFull
+		if d.bufferFull {
+			d.shifter = d.buffer
+			d.bufferFull = false
+		}
+	}
+}
+
+// output returns the channel's level, from 0 to 127.
+func (d *apuDmc) output() byte {
+	return d.level
+}
@@ -0,0 +1,44 @@
+package nes
+
+// The channels are mixed nonlinearly, as they are on hardware. Pulse 1 and 2
+// share one output, and the triangle, noise, and DMC share the other:
+//
+//	pulse_out = 95.88 / (8128 / (pulse1 + pulse2) + 100)
+//	tnd_out   = 159.79 / (1 / (triangle/8227 + noise/12241 + dmc/22638) + 100)
+//
+// Both are approximated with lookup tables, so mixing is cheap enough to run
+// every CPU cycle.
+//
+// reference: https://wiki.nesdev.com/w/index.php/APU_Mixer
+var (
+	apuPulseTable = newApuPulseTable()
+	apuTndTable   = newApuTndTable()
+)
+
+// Pulse output for each sum of the pulse channels' volumes, 0-30.
+func newApuPulseTable() [31]float32 {
+	table := [31]float32{}
+	for n := 1; n < len(table); n++ {
+		table[n] = float32(95.52 / (8128.0/float64(n) + 100))
+	}
+	return table
+}
+
+// Triangle, noise, and DMC output, indexed by 3 * triangle + 2 * noise + dmc,
+// 0-202.
+func newApuTndTable() [203]float32 {
+	table := [203]float32{}
+	for n := 1; n < len(table); n++ {
+		table[n] = float32(163.67 / (24329.0/float64(n) + 100))
+	}
+	return table
+}
+
+// mixerOutput returns the mixed output of all channels, from 0 to 1. There is
+// no noise channel yet, so it is always silent.
+func (a *Apu) mixerOutput() float32 {
+	pulse := apuPulseTable[a.pulse1.output()+a.pulse2.output()]
+	tnd := apuTndTable[3*int(a.triangle.output())+int(a.dmc.output())]
+
+	return pulse + tnd
+}
@@ -0,0 +1,122 @@
+package nes
+
+// Pulse channel registers:
+//
+//	0: DDLC VVVV - duty, length counter halt/envelope loop, constant volume, volume/envelope period
+//	1: EPPP NSSS - sweep enabled, period, negate, shift
+//	2: TTTT TTTT - timer low
+//	3: LLLL LTTT - length counter load, timer high
+//
+// reference: https://wiki.nesdev.com/w/index.php/APU_Pulse
+type apuPulse struct {
+	channel byte // 1 or 2, the channels' sweep units negate differently
+
+	duty     byte // Duty cycle, index into apuDutyTable
+	dutyStep byte // Step (0-7) of the duty cycle being output
+
+	timer       uint16
+	timerPeriod uint16 // 11 bits
+
+	length   apuLengthCounter
+	envelope apuEnvelope
+
+	// Sweep unit
+	sweepEnabled bool
+	sweepPeriod  byte
+	sweepNegate  bool
+	sweepShift   byte
+	sweepDivider byte
+	sweepReload  bool
+}
+
+// Pulse waveforms for each duty cycle: 12.5%, 25%, 50%, and 25% negated.
+var apuDutyTable = [4][8]byte{
+	{0, 1, 0, 0, 0, 0, 0, 0},
+	{0, 1, 1, 0, 0, 0, 0, 0},
+	{0, 1, 1, 1, 1, 0, 0, 0},
+	{1, 0, 0, 1, 1, 1, 1, 1},
+}
+
+func newApuPulse(channel byte) *apuPulse {
+	return &apuPulse{channel: channel}
+}
+
+// Write to one of the channel's 4 registers.
+func (p *apuPulse) write(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		p.duty = data >> 6
+		p.length.halt = data&0x20 > 0
+		p.envelope.write(data)
+	case 1:
+		p.sweepEnabled = data&0x80 > 0
+		p.sweepPeriod = (data >> 4) & 0x07
+		p.sweepNegate = data&0x08 > 0
+		p.sweepShift = data & 0x07
+		p.sweepReload = true
+	case 2:
+		p.timerPeriod = p.timerPeriod&0x0700 | uint16(data)
+	case 3:
+		p.timerPeriod = p.timerPeriod&0x00FF | uint16(data&0x07)<<8
+		p.length.load(data >> 3)
+
+		// Restart the waveform and the envelope.
+		p.dutyStep = 0
+		p.envelope.start = true
+	}
+}
+
+// Step the duty cycle each time the timer counts down to 0.
+func (p *apuPulse) clockTimer() {
+	if p.timer == 0 {
+		p.timer = p.timerPeriod
+		p.dutyStep = (p.dutyStep + 1) & 0x07
+	} else {
+		p.timer--
+	}
+}
+
+// Bend the pitch by adjusting the timer period, twice per frame.
+func (p *apuPulse) clockSweep() {
+	if p.sweepDivider == 0 && p.sweepEnabled && p.sweepShift > 0 && !p.sweepMuted() {
+		p.timerPeriod = p.sweepTarget()
+	}
+
+	if p.sweepDivider == 0 || p.sweepReload {
+		p.sweepDivider = p.sweepPeriod
+		p.sweepReload = false
+	} else {
+		p.sweepDivider--
+	}
+}
+
+// sweepTarget returns the timer period the sweep unit is moving towards.
+func (p *apuPulse) sweepTarget() uint16 {
+	change := p.timerPeriod >> p.sweepShift
+	if !p.sweepNegate {
+		return p.timerPeriod + change
+	}
+
+	// Pulse 1 subtracts with ones' complement, 1 more than pulse 2.
+	if p.channel == 1 {
+		change++
+	}
+	if change > p.timerPeriod {
+		return 0
+	}
+	return p.timerPeriod - change
+}
+
+// sweepMuted returns whether the sweep unit silences the channel, for periods
+// too high or too low to play. This happens even with the sweep disabled.
+func (p *apuPulse) sweepMuted() bool {
+	return p.timerPeriod < 8 || p.sweepTarget() > 0x07FF
+}
+
+// output returns the channel's volume, from 0 to 15.
+func (p *apuPulse) output() byte {
+	if p.length.value == 0 || p.sweepMuted() || apuDutyTable[p.duty][p.dutyStep] == 0 {
+		return 0
+	}
+	return p.envelope.volume()
+}
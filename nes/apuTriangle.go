@@ -0,0 +1,78 @@
+package nes
+
+// Triangle channel registers:
+//
+//	$4008: CRRR RRRR - length counter halt/linear counter control, linear counter reload
+//	$400A: TTTT TTTT - timer low
+//	$400B: LLLL LTTT - length counter load, timer high
+//
+// reference: https://wiki.nesdev.com/w/index.php/APU_Triangle
+type apuTriangle struct {
+	step byte // Step (0-31) of the triangle sequence being output
+
+	timer       uint16
+	timerPeriod uint16 // 11 bits
+
+	length apuLengthCounter
+
+	// Linear counter, a second, finer length counter
+	linearControl bool // Keep reloading the linear counter
+	linearReload  bool // Reload the linear counter on the next clock
+	linearPeriod  byte // 7 bits
+	linearValue   byte
+}
+
+// Triangle waveform, 15 down to 0 and back up.
+var apuTriangleTable = [32]byte{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// Write to one of the channel's 4 registers. The second register is unused.
+func (t *apuTriangle) write(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		t.linearControl = data&0x80 > 0
+		t.length.halt = data&0x80 > 0
+		t.linearPeriod = data & 0x7F
+	case 2:
+		t.timerPeriod = t.timerPeriod&0x0700 | uint16(data)
+	case 3:
+		t.timerPeriod = t.timerPeriod&0x00FF | uint16(data&0x07)<<8
+		t.length.load(data >> 3)
+		t.linearReload = true
+	}
+}
+
+// Step the sequence each time the timer counts down to 0, while both counters
+// are above 0. Unlike the pulse channels, the timer runs at the CPU rate.
+func (t *apuTriangle) clockTimer() {
+	if t.timer > 0 {
+		t.timer--
+		return
+	}
+
+	t.timer = t.timerPeriod
+	if t.length.value > 0 && t.linearValue > 0 {
+		t.step = (t.step + 1) & 0x1F
+	}
+}
+
+// Clock the linear counter, 4 times per frame.
+func (t *apuTriangle) clockLinear() {
+	if t.linearReload {
+		t.linearValue = t.linearPeriod
+	} else if t.linearValue > 0 {
+		t.linearValue--
+	}
+
+	if !t.linearControl {
+		t.linearReload = false
+	}
+}
+
+// output returns the channel's level, from 0 to 15. The triangle has no volume
+// control, and holds its last level when silenced by either counter.
+func (t *apuTriangle) output() byte {
+	return apuTriangleTable[t.step]
+}
@@ -0,0 +1,513 @@
+package nes
+
+import (
+	"math"
+	"testing"
+)
+
+// clockApuCycles runs the APU for n CPU cycles.
+func clockApuCycles(apu *Apu, n int) {
+	for i := 0; i < n; i++ {
+		apu.Clock()
+	}
+}
+
+func TestApuPulseDuty(t *testing.T) {
+	apu := NewApu()
+	apu.cpuWrite(0x4015, 0x01)
+	apu.cpuWrite(0x4000, 0b10_1_1_1010) // 50% duty, halt, constant volume 10
+	apu.cpuWrite(0x4002, 0x08)          // timer period 8
+	apu.cpuWrite(0x4003, 0x00)
+
+	// Each step of the waveform lasts 9 APU cycles, 18 CPU cycles.
+	var wave []byte
+	for step := 0; step < 8; step++ {
+		clockApuCycles(apu, 18)
+		wave = append(wave, apu.pulse1.output())
+	}
+
+	want := []byte{10, 10, 10, 10, 0, 0, 0, 0}
+	for i := range want {
+		if wave[i] != want[i] {
+			t.Fatalf("waveform = %v, want %v", wave, want)
+		}
+	}
+}
+
+func TestApuLengthCounter(t *testing.T) {
+	apu := NewApu()
+
+	// Disabled channels don't load their length counter.
+	apu.cpuWrite(0x4007, 0x08)
+	if got := apu.cpuRead(0x4015); got != 0x00 {
+		t.Errorf("status = %02b with pulse 2 disabled, want 00", got)
+	}
+
+	apu.cpuWrite(0x4015, 0x03)
+	apu.cpuWrite(0x4003, 0x08) // length index 1: 254
+	apu.cpuWrite(0x4007, 0x18) // length index 3: 2
+	if got := apu.cpuRead(0x4015); got != 0x03 {
+		t.Errorf("status = %02b, want 11", got)
+	}
+
+	apu.halfFrame()
+	apu.halfFrame()
+	if got := apu.cpuRead(0x4015); got != 0x01 {
+		t.Errorf("status = %02b after pulse 2 length ran out, want 01", got)
+	}
+	if got := apu.pulse1.length.value; got != 252 {
+		t.Errorf("pulse 1 length = %d, want 252", got)
+	}
+
+	// Halted counters keep their value.
+	apu.cpuWrite(0x4000, 0x20)
+	apu.halfFrame()
+	if got := apu.pulse1.length.value; got != 252 {
+		t.Errorf("halted pulse 1 length = %d, want 252", got)
+	}
+
+	// Disabling a channel clears its length counter.
+	apu.cpuWrite(0x4015, 0x00)
+	if got := apu.cpuRead(0x4015); got != 0x00 {
+		t.Errorf("status = %02b after disabling, want 00", got)
+	}
+}
+
+func TestApuStatus(t *testing.T) {
+	// Each enable bit only clears its own channel's length counter.
+	for i, bit := range []byte{0x01, 0x02, 0x04} {
+		apu := NewApu()
+		apu.cpuWrite(0x4015, 0x07)
+		apu.cpuWrite(0x4003, 0x08) // length index 1: 254
+		apu.cpuWrite(0x4007, 0x08)
+		apu.cpuWrite(0x400B, 0x08)
+
+		apu.cpuWrite(0x4015, 0x07&^bit)
+		lengths := []byte{apu.pulse1.length.value, apu.pulse2.length.value, apu.triangle.length.value}
+		for j, length := range lengths {
+			want := byte(254)
+			if j == i {
+				want = 0
+			}
+			if length != want {
+				t.Errorf("channel %d disabled: channel %d length = %d, want %d", i, j, length, want)
+			}
+		}
+		if got, want := apu.cpuRead(0x4015), 0x07&^bit; got != want {
+			t.Errorf("channel %d disabled: status = %03b, want %03b", i, got, want)
+		}
+	}
+
+	// Reading the status clears the frame interrupt flag.
+	apu := NewApu()
+	apu.frameIrq = true
+	if got := apu.cpuRead(0x4015); got != 0x40 {
+		t.Errorf("status = %08b, want 01000000", got)
+	}
+	if got := apu.cpuRead(0x4015); got != 0x00 {
+		t.Errorf("status = %08b on the second read, want 00000000", got)
+	}
+
+	// The DMC interrupt flag is bit 7. Reads leave it set, writes clear it.
+	apu.dmc.irq = true
+	for i := 0; i < 2; i++ {
+		if got := apu.cpuRead(0x4015); got != 0x80 {
+			t.Errorf("read %d: status = %08b, want 10000000", i, got)
+		}
+	}
+	apu.cpuWrite(0x4015, 0x00)
+	if got := apu.cpuRead(0x4015); got != 0x00 {
+		t.Errorf("status = %08b after writing $4015, want 00000000", got)
+	}
+}
+
+func TestApuEnvelope(t *testing.T) {
+	apu := NewApu()
+	apu.cpuWrite(0x4015, 0x01)
+	apu.cpuWrite(0x4000, 0x01) // decaying volume, divider period 1
+	apu.cpuWrite(0x4003, 0x00)
+
+	env := &apu.pulse1.envelope
+	apu.quarterFrame()
+	if got := env.volume(); got != 15 {
+		t.Fatalf("volume = %d after restart, want 15", got)
+	}
+
+	// The volume drops every 2 clocks, and stays at 0 without looping.
+	for i := 0; i < 40; i++ {
+		apu.quarterFrame()
+	}
+	if got := env.volume(); got != 0 {
+		t.Errorf("volume = %d after decay, want 0", got)
+	}
+
+	// Looping restarts the fade from 15.
+	apu.cpuWrite(0x4000, 0x21)
+	apu.quarterFrame()
+	apu.quarterFrame()
+	if got := env.volume(); got != 15 {
+		t.Errorf("looping volume = %d, want 15", got)
+	}
+
+	apu.cpuWrite(0x4000, 0x17)
+	if got := env.volume(); got != 7 {
+		t.Errorf("constant volume = %d, want 7", got)
+	}
+}
+
+func TestApuSweep(t *testing.T) {
+	tests := []struct {
+		channel uint16 // base address
+		sweep   byte
+		period  uint16
+		want    uint16
+	}{
+		{0x4000, 0b1000_0_001, 0x100, 0x180}, // up, shift 1
+		{0x4000, 0b1000_1_001, 0x100, 0x07F}, // pulse 1 down, ones' complement
+		{0x4004, 0b1000_1_001, 0x100, 0x080}, // pulse 2 down
+		{0x4000, 0b0000_0_001, 0x100, 0x100}, // disabled
+		{0x4000, 0b1000_0_001, 0x600, 0x600}, // target too high, muted
+	}
+
+	for _, test := range tests {
+		apu := NewApu()
+		apu.cpuWrite(0x4015, 0x03)
+		apu.cpuWrite(test.channel+1, test.sweep)
+		apu.cpuWrite(test.channel+2, byte(test.period))
+		apu.cpuWrite(test.channel+3, byte(test.period>>8))
+
+		pulse := apu.pulse1
+		if test.channel == 0x4004 {
+			pulse = apu.pulse2
+		}
+
+		apu.halfFrame()
+		if pulse.timerPeriod != test.want {
+			t.Errorf("sweep %08b: period $%03X, want $%03X", test.sweep, pulse.timerPeriod, test.want)
+		}
+	}
+
+	// Periods below 8 are muted.
+	apu := NewApu()
+	apu.cpuWrite(0x4015, 0x01)
+	apu.cpuWrite(0x4000, 0x1F)
+	apu.cpuWrite(0x4002, 0x07)
+	apu.cpuWrite(0x4003, 0x00)
+	for i := 0; i < 32; i++ {
+		apu.Clock()
+		if got := apu.pulse1.output(); got != 0 {
+			t.Fatalf("output %d with period 7, want 0", got)
+		}
+	}
+}
+
+func TestApuBus(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+
+	bus.CpuWrite(0x4015, 0x02)
+	bus.CpuWrite(0x4004, 0xBF)
+	bus.CpuWrite(0x4006, 0x40)
+	bus.CpuWrite(0x4007, 0x08)
+	if got := bus.CpuRead(0x4015); got != 0x02 {
+		t.Errorf("status = %02b, want 10", got)
+	}
+
+	// The APU is clocked once per CPU cycle.
+	for i := 0; i < 300; i++ {
+		bus.Clock()
+	}
+	if got := bus.Apu.cycles; got != 100 {
+		t.Errorf("APU ran %d cycles in 300 PPU cycles, want 100", got)
+	}
+	if got := bus.Apu.Sample(); got <= 0 {
+		t.Errorf("sample = %v, want above 0", got)
+	}
+
+	bus.Reset()
+	if got := bus.CpuRead(0x4015); got != 0x00 {
+		t.Errorf("status = %02b after reset, want 00", got)
+	}
+}
+
+func TestApuTriangle(t *testing.T) {
+	apu := NewApu()
+	apu.cpuWrite(0x4015, 0x04)
+	apu.cpuWrite(0x4008, 0x02) // linear counter 2
+	apu.cpuWrite(0x400A, 0x01) // timer period 1
+	apu.cpuWrite(0x400B, 0x08)
+	if got := apu.cpuRead(0x4015); got != 0x04 {
+		t.Errorf("status = %03b, want 100", got)
+	}
+
+	// The sequence holds until the linear counter is loaded.
+	clockApuCycles(apu, 10)
+	if got := apu.triangle.output(); got != 15 {
+		t.Errorf("output = %d before linear counter loaded, want 15", got)
+	}
+
+	// The timer runs at the CPU rate, stepping every 2 cycles.
+	apu.quarterFrame()
+	var wave []byte
+	for i := 0; i < 32; i++ {
+		clockApuCycles(apu, 2)
+		wave = append(wave, apu.triangle.output())
+	}
+	for i, got := range wave {
+		if want := apuTriangleTable[(i+1)%32]; got != want {
+			t.Fatalf("waveform = %v, want steps 1-32 of the triangle", wave)
+		}
+	}
+
+	// Once the linear counter runs out, the level is held.
+	apu.quarterFrame()
+	apu.quarterFrame()
+	held := apu.triangle.output()
+	clockApuCycles(apu, 10)
+	if got := apu.triangle.output(); got != held {
+		t.Errorf("output = %d after linear counter ran out, want %d held", got, held)
+	}
+
+	// The control flag keeps reloading the linear counter, and halts the
+	// length counter.
+	apu.cpuWrite(0x4008, 0x82)
+	apu.cpuWrite(0x400B, 0x08)
+	for i := 0; i < 4; i++ {
+		apu.quarterFrame()
+		apu.halfFrame()
+	}
+	if got := apu.triangle.linearValue; got != 2 {
+		t.Errorf("linear counter = %d with control set, want 2", got)
+	}
+	if got := apu.triangle.length.value; got != 254 {
+		t.Errorf("length = %d with control set, want 254", got)
+	}
+}
+
+func TestApuDmcOutput(t *testing.T) {
+	apu := NewApu()
+	apu.cpuWrite(0x4010, 0x0F) // rate 54
+	apu.cpuWrite(0x4011, 0x40)
+	apu.cpuWrite(0x4013, 0x00) // 1 byte
+	apu.cpuWrite(0x4015, 0x10)
+
+	addr, ok := apu.dmc.sampleRequest()
+	if !ok || addr != 0xC000 {
+		t.Fatalf("sample request = $%04X, %v, want $C000, true", addr, ok)
+	}
+	apu.dmc.loadSample(0x0F) // 4 bits up, 4 bits down
+	if _, ok := apu.dmc.sampleRequest(); ok {
+		t.Error("sample requested after the last byte was read")
+	}
+
+	// The byte starts playing on the first timer clock, one bit every 54
+	// cycles.
+	var levels []byte
+	for i := 0; i < 9; i++ {
+		clockApuCycles(apu, 54)
+		levels = append(levels, apu.dmc.output())
+	}
+
+	want := []byte{0x40, 0x42, 0x44, 0x46, 0x48, 0x46, 0x44, 0x42, 0x40}
+	for i := range want {
+		if levels[i] != want[i] {
+			t.Fatalf("levels = %v, want %v", levels, want)
+		}
+	}
+
+	// The level is held while silent.
+	clockApuCycles(apu, 54*4)
+	if got := apu.dmc.output(); got != 0x40 {
+		t.Errorf("level = %d while silent, want %d", got, 0x40)
+	}
+}
+
+func TestApuDmcBus(t *testing.T) {
+	rom := newTestRom(1, 1, 0x00, 0x00)
+	prg := rom[16:]
+	prg[0x0040] = 0xAA // sample at $C040
+	prg[0x0041] = 0x55
+
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, rom))
+
+	bus.CpuWrite(0x4010, 0x8F) // IRQ, rate 54
+	bus.CpuWrite(0x4012, 0x01)
+	bus.CpuWrite(0x4013, 0x00) // 1 byte
+	bus.CpuWrite(0x4015, 0x10)
+	if got := bus.CpuRead(0x4015); got != 0x10 {
+		t.Errorf("status = %08b while playing, want 00010000", got)
+	}
+
+	// The first CPU cycle reads the sample byte, and suspends the CPU.
+	for bus.Apu.cycles == 0 {
+		bus.Clock()
+	}
+	if !bus.Apu.dmc.bufferFull || bus.Apu.dmc.buffer != 0xAA {
+		t.Errorf("sample buffer = $%02X, %v, want $AA", bus.Apu.dmc.buffer, bus.Apu.dmc.bufferFull)
+	}
+	if bus.dmcStall != dmcDmaCycles {
+		t.Errorf("CPU suspended for %d cycles, want %d", bus.dmcStall, dmcDmaCycles)
+	}
+
+	// The sample has ended, which requests an IRQ.
+	if got := bus.CpuRead(0x4015); got != 0x80 {
+		t.Errorf("status = %08b after the sample, want 10000000", got)
+	}
+	if !bus.irq() {
+		t.Error("IRQ line not held after the sample")
+	}
+
+	// Writing $4015 acknowledges the IRQ.
+	bus.CpuWrite(0x4015, 0x00)
+	if bus.irq() {
+		t.Error("IRQ line held after writing $4015")
+	}
+
+	// Looping samples play again, without an IRQ.
+	bus.CpuWrite(0x4010, 0xCF)
+	bus.CpuWrite(0x4015, 0x10)
+	for i := 0; i < 3*54*8*2; i++ {
+		bus.Clock()
+	}
+	if bus.irq() {
+		t.Error("IRQ line held by a looping sample")
+	}
+	if got := bus.CpuRead(0x4015); got != 0x10 {
+		t.Errorf("status = %08b while looping, want 00010000", got)
+	}
+}
+
+func TestApuFrameCounter(t *testing.T) {
+	apu := NewApu()
+	apu.cpuWrite(0x4015, 0x01)
+	apu.cpuWrite(0x4003, 0x08) // length 254
+
+	// 4-step: length counters are clocked on steps 2 and 4, and the frame
+	// interrupt flag is set at the end.
+	clockApuCycles(apu, apuFrameStep2)
+	if got := apu.pulse1.length.value; got != 254 {
+		t.Errorf("length = %d before step 2, want 254", got)
+	}
+	clockApuCycles(apu, 1)
+	if got := apu.pulse1.length.value; got != 253 {
+		t.Errorf("length = %d after step 2, want 253", got)
+	}
+	if apu.irq() {
+		t.Error("frame IRQ before step 4")
+	}
+
+	clockApuCycles(apu, apuFrameStep4-apuFrameStep2)
+	if got := apu.pulse1.length.value; got != 252 {
+		t.Errorf("length = %d after step 4, want 252", got)
+	}
+	if !apu.irq() {
+		t.Error("no frame IRQ after step 4")
+	}
+
+	// Reading $4015 clears the flag, but it is set again on the next cycle.
+	if got := apu.cpuRead(0x4015); got&0x40 == 0 {
+		t.Errorf("status = %08b, want frame IRQ flag set", got)
+	}
+	if apu.irq() {
+		t.Error("frame IRQ after reading $4015")
+	}
+	clockApuCycles(apu, 1)
+	if !apu.irq() {
+		t.Error("no frame IRQ on the last cycle of the sequence")
+	}
+
+	// The inhibit flag clears the frame IRQ and stops it being set.
+	apu.cpuWrite(0x4017, 0x40)
+	if apu.irq() {
+		t.Error("frame IRQ after setting the inhibit flag")
+	}
+	clockApuCycles(apu, apuFrameStep4+2)
+	if apu.irq() {
+		t.Error("frame IRQ with the inhibit flag set")
+	}
+
+	// 5-step: writing $4017 clocks the channels straight away, and there is
+	// no frame IRQ.
+	apu.cpuWrite(0x4003, 0x08)
+	apu.cpuWrite(0x4017, 0x80)
+	if got := apu.pulse1.length.value; got != 253 {
+		t.Errorf("length = %d after 5-step write, want 253", got)
+	}
+	clockApuCycles(apu, apuFrameStep5+1)
+	if got := apu.pulse1.length.value; got != 251 {
+		t.Errorf("length = %d after 5-step sequence, want 251", got)
+	}
+	if apu.irq() {
+		t.Error("frame IRQ in 5-step mode")
+	}
+
+	// The sequence starts again.
+	clockApuCycles(apu, apuFrameStep2+1)
+	if got := apu.pulse1.length.value; got != 250 {
+		t.Errorf("length = %d after next step 2, want 250", got)
+	}
+}
+
+func TestApuMixer(t *testing.T) {
+	// The lookup tables stay close to the exact formulas.
+	for n := 1; n <= 30; n++ {
+		exact := 95.88 / (8128/float64(n) + 100)
+		if got := float64(apuPulseTable[n]); math.Abs(got-exact) > 0.01 {
+			t.Errorf("pulse table[%d] = %.4f, want about %.4f", n, got, exact)
+		}
+	}
+	for triangle := 0; triangle <= 15; triangle++ {
+		for dmc := 0; dmc <= 127; dmc++ {
+			if triangle == 0 && dmc == 0 {
+				continue
+			}
+			exact := 159.79 / (1/(float64(triangle)/8227+float64(dmc)/22638) + 100)
+			if got := float64(apuTndTable[3*triangle+dmc]); math.Abs(got-exact) > 0.02 {
+				t.Errorf("tnd table for triangle %d, dmc %d = %.4f, want about %.4f", triangle, dmc, got, exact)
+			}
+		}
+	}
+
+	// The triangle holds its first level, 15, until it is played.
+	apu := NewApu()
+	silent := apu.mixerOutput()
+	if want := apuTndTable[3*15]; silent != want {
+		t.Errorf("output = %v before playing, want %v", silent, want)
+	}
+
+	// Mixing is not linear: two pulses at 15 are quieter than twice one.
+	apu.cpuWrite(0x4015, 0x03)
+	apu.cpuWrite(0x4000, 0b11_1_1_1111) // 75% duty, constant volume 15
+	apu.cpuWrite(0x4002, 0x40)
+	apu.cpuWrite(0x4003, 0x08)
+	one := apu.mixerOutput() - silent
+	apu.cpuWrite(0x4004, 0b11_1_1_1111)
+	apu.cpuWrite(0x4006, 0x40)
+	apu.cpuWrite(0x4007, 0x08)
+	two := apu.mixerOutput() - silent
+	if one <= 0 || two >= 2*one {
+		t.Errorf("output = %v for one pulse, %v for two, want less than double", one, two)
+	}
+
+	// Full volume on every channel stays within 0 to 1.
+	apu.cpuWrite(0x4011, 0x7F)
+	if got := apu.mixerOutput(); got > 1 {
+		t.Errorf("loudest output = %v, want at most 1", got)
+	}
+}
+
+func TestApuFrameCounterPAL(t *testing.T) {
+	apu := NewApu()
+	apu.setRegion(RegionPAL)
+
+	// The 4-step sequence is longer on PAL.
+	clockApuCycles(apu, apuFrameStep4+2)
+	if apu.irq() {
+		t.Error("frame IRQ at the NTSC step 4")
+	}
+	clockApuCycles(apu, apuFrameSteps[RegionPAL][3]-apuFrameStep4)
+	if !apu.irq() {
+		t.Error("no frame IRQ at the PAL step 4")
+	}
+}
@@ -0,0 +1,123 @@
+package nes
+
+import (
+	"encoding/binary"
+	"math"
+	"sync/atomic"
+)
+
+// AudioBackend carries APU samples from the emulation to a sound library. The
+// APU pushes samples at the backend's sample rate, and the sound library pulls
+// them through Read, usually from its own goroutine. Neither side blocks: when
+// the emulation runs ahead, new samples are dropped, and when it falls behind,
+// Read plays silence.
+type AudioBackend struct {
+	SampleRate int // Samples per second
+
+	ring audioRing
+
+	// DC blocking filter state. The APU output is never below 0, so the
+	// backend centers it around 0.
+	prevIn  float32
+	prevOut float32
+
+	recorder *wavRecorder // Where samples are also written, nil if not recording
+}
+
+const (
+	// CPU clock rate (NTSC), which the APU produces samples at.
+	apuClockRate = 1789773
+
+	// Samples buffered between the emulation and the sound library, about
+	// 185ms at 44100Hz. Must be a power of 2.
+	audioBufferSize = 8192
+
+	// DC blocking filter pole, a high-pass cutting off at about 30Hz.
+	audioDCBlock = 0.996
+)
+
+// NewAudioBackend returns an audio backend playing at sampleRate samples per
+// second, such as 44100. Connect it to the NES with Bus.SetAudioBackend.
+func NewAudioBackend(sampleRate int) *AudioBackend {
+	return &AudioBackend{
+		SampleRate: sampleRate,
+		ring:       audioRing{buf: make([]float32, audioBufferSize)},
+	}
+}
+
+// PushSample queues a sample of the APU output, from 0 to 1, to be played. It
+// is called by the APU, and never blocks.
+func (a *AudioBackend) PushSample(sample float32) {
+	out := sample - a.prevIn + audioDCBlock*a.prevOut
+	a.prevIn = sample
+	a.prevOut = out
+
+	a.ring.push(out)
+	if a.recorder != nil {
+		a.recorder.record(out)
+	}
+}
+
+// Read fills p with queued samples as mono, signed 16 bit little endian PCM,
+// the format most sound libraries (such as oto) read. Missing samples are
+// filled with silence, so Read always fills p and never blocks.
+func (a *AudioBackend) Read(p []byte) (int, error) {
+	n := len(p) / 2
+	for i := 0; i < n; i++ {
+		sample, _ := a.ring.pop()
+		sample = float32(math.Max(-1, math.Min(1, float64(sample))))
+		binary.LittleEndian.PutUint16(p[i*2:], uint16(int16(sample*math.MaxInt16)))
+	}
+
+	return n * 2, nil
+}
+
+// Buffered returns the number of samples waiting to be read.
+func (a *AudioBackend) Buffered() int {
+	return a.ring.len()
+}
+
+// audioRing is a ring buffer safe for 1 goroutine pushing and 1 goroutine
+// popping at the same time, without locks.
+type audioRing struct {
+	read  uint64 // Total samples popped, accessed atomically
+	write uint64 // Total samples pushed, accessed atomically
+
+	buf []float32 // Length is a power of 2
+}
+
+// push adds a sample, or drops it if the ring is full.
+func (r *audioRing) push(sample float32) bool {
+	write := atomic.LoadUint64(&r.write)
+	if write-atomic.LoadUint64(&r.read) == uint64(len(r.buf)) {
+		return false
+	}
+
+	r.buf[write&uint64(len(r.buf)-1)] = sample
+	atomic.StoreUint64(&r.write, write+1)
+
+	return true
+}
+
+// pop removes the oldest sample, or returns false if the ring is empty.
+func (r *audioRing) pop() (float32, bool) {
+	read := atomic.LoadUint64(&r.read)
+	if read == atomic.LoadUint64(&r.write) {
+		return 0, false
+	}
+
+	sample := r.buf[read&uint64(len(r.buf)-1)]
+	atomic.StoreUint64(&r.read, read+1)
+
+	return sample, true
+}
+
+func (r *audioRing) len() int {
+	return int(atomic.LoadUint64(&r.write) - atomic.LoadUint64(&r.read))
+}
+
+// SetAudioBackend connects an audio backend to the APU, or disconnects it when
+// nil. Samples are pushed to it as the NES runs.
+func (b *Bus) SetAudioBackend(backend *AudioBackend) {
+	b.Apu.ConnectAudio(backend)
+}
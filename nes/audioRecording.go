@@ -0,0 +1,172 @@
+package nes
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Audio recordings are mono, 16 bit PCM WAV files of the samples pushed to the
+// audio backend, at its sample rate. The header sizes are updated about once a
+// second while recording, so the file stays playable if the emulator is
+// interrupted before the recording is stopped.
+
+const (
+	// Sample rate of the audio backend connected to record, when none is.
+	defaultRecordingSampleRate = 44100
+
+	wavHeaderSize = 44
+)
+
+// wavRecorder writes samples to a WAV file.
+type wavRecorder struct {
+	f          *os.File
+	w          *bufio.Writer
+	sampleRate int
+	samples    int   // Samples written
+	unpatched  int   // Samples written since the header sizes were updated
+	err        error // First write error, returned when stopped
+}
+
+func newWavRecorder(path string, sampleRate int) (*wavRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to record audio: %w", err)
+	}
+
+	r := &wavRecorder{f: f, w: bufio.NewWriter(f), sampleRate: sampleRate}
+	if _, err := r.w.Write(wavHeader(sampleRate, 0)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("unable to record audio: %w", err)
+	}
+
+	return r, nil
+}
+
+// wavHeader returns the header of a mono, 16 bit PCM WAV file holding the
+// given number of samples.
+//
+// reference: http://soundfile.sapp.org/doc/WaveFormat/
+func wavHeader(sampleRate, samples int) []byte {
+	const (
+		channels      = 1
+		bitsPerSample = 16
+		blockAlign    = channels * bitsPerSample / 8
+	)
+	dataSize := uint32(samples * blockAlign)
+
+	h := make([]byte, wavHeaderSize)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], wavHeaderSize-8+dataSize)
+	copy(h[8:], "WAVE")
+	copy(h[12:], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16) // fmt chunk size
+	binary.LittleEndian.PutUint16(h[20:], 1)  // PCM
+	binary.LittleEndian.PutUint16(h[22:], channels)
+	binary.LittleEndian.PutUint32(h[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(h[32:], blockAlign)
+	binary.LittleEndian.PutUint16(h[34:], bitsPerSample)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], dataSize)
+
+	return h
+}
+
+// record writes a sample, from -1 to 1, clamped like Read does for the sound
+// library.
+func (r *wavRecorder) record(sample float32) {
+	if r.err != nil {
+		return
+	}
+
+	sample = float32(math.Max(-1, math.Min(1, float64(sample))))
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], uint16(int16(sample*math.MaxInt16)))
+	if _, err := r.w.Write(buf[:]); err != nil {
+		r.err = err
+		return
+	}
+	r.samples++
+
+	// Keep the file playable up to the last second or so.
+	r.unpatched++
+	if r.unpatched >= r.sampleRate {
+		r.err = r.patchHeader()
+	}
+}
+
+// patchHeader flushes the samples written, and updates the header sizes to
+// match them.
+func (r *wavRecorder) patchHeader() error {
+	r.unpatched = 0
+
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := r.f.WriteAt(wavHeader(r.sampleRate, r.samples), 0); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// close finalizes the header and closes the file.
+func (r *wavRecorder) close() error {
+	err := r.err
+	if err == nil {
+		err = r.patchHeader()
+	}
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to record audio: %w", err)
+	}
+
+	return nil
+}
+
+// StartAudioRecording starts writing the audio output to a WAV file at path,
+// at the audio backend's sample rate. If no backend is connected, one is
+// connected at 44100Hz, so audio can be recorded without a sound card. Nothing
+// is recorded while the APU is muted.
+func (b *Bus) StartAudioRecording(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Apu.audio == nil {
+		b.Apu.ConnectAudio(NewAudioBackend(defaultRecordingSampleRate))
+	}
+	audio := b.Apu.audio
+	if audio.recorder != nil {
+		return errors.New("unable to record audio: already recording")
+	}
+
+	r, err := newWavRecorder(path, audio.SampleRate)
+	if err != nil {
+		return err
+	}
+	audio.recorder = r
+
+	return nil
+}
+
+// StopAudioRecording stops the recording started by StartAudioRecording, and
+// finalizes the WAV file.
+func (b *Bus) StopAudioRecording() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Apu.audio == nil || b.Apu.audio.recorder == nil {
+		return errors.New("unable to stop recording audio: not recording")
+	}
+
+	r := b.Apu.audio.recorder
+	b.Apu.audio.recorder = nil
+
+	return r.close()
+}
@@ -0,0 +1,193 @@
+package nes
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestAudioRing(t *testing.T) {
+	ring := audioRing{buf: make([]float32, 4)}
+
+	for i := 0; i < 6; i++ {
+		ok := ring.push(float32(i))
+		if want := i < 4; ok != want {
+			t.Errorf("push %d = %v, want %v", i, ok, want)
+		}
+	}
+
+	// Samples pushed to a full ring are dropped.
+	for i := 0; i < 4; i++ {
+		if got, ok := ring.pop(); !ok || got != float32(i) {
+			t.Errorf("pop = %v, %v, want %d, true", got, ok, i)
+		}
+	}
+	if _, ok := ring.pop(); ok {
+		t.Error("popped from an empty ring")
+	}
+
+	// The ring wraps around.
+	ring.push(7)
+	if got, _ := ring.pop(); got != 7 {
+		t.Errorf("pop after wrapping = %v, want 7", got)
+	}
+}
+
+func TestAudioBackendRead(t *testing.T) {
+	backend := NewAudioBackend(44100)
+	backend.ring.push(0.5)
+	backend.ring.push(-2)
+
+	buf := make([]byte, 8)
+	for i := range buf {
+		buf[i] = 0xFF
+	}
+	if n, err := backend.Read(buf); n != len(buf) || err != nil {
+		t.Fatalf("Read = %d, %v, want %d, nil", n, err, len(buf))
+	}
+
+	// Samples are clamped, and missing samples are silent.
+	want := []int16{16383, -32767, 0, 0}
+	for i, w := range want {
+		if got := int16(binary.LittleEndian.Uint16(buf[i*2:])); got != w {
+			t.Errorf("sample %d = %d, want %d", i, got, w)
+		}
+	}
+}
+
+func TestAudioDownsampling(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+
+	backend := NewAudioBackend(44100)
+	bus.SetAudioBackend(backend)
+
+	// A square wave well below the sample rate.
+	bus.CpuWrite(0x4015, 0x01)
+	bus.CpuWrite(0x4000, 0b10_1_1_1111) // 50% duty, halt, constant volume 15
+	bus.CpuWrite(0x4002, 0xFD)          // about 440Hz
+	bus.CpuWrite(0x4003, 0x00)
+
+	// A frame is about 29780 CPU cycles, 1/60 of a second. The first frame
+	// after power up is 1 scanline short.
+	bus.StepFrame()
+	bus.StepFrame()
+	if got, want := backend.Buffered(), 2*44100/60; got < want-10 || got > want {
+		t.Errorf("%d samples buffered after 2 frames, want about %d", got, want)
+	}
+
+	// The DC blocking filter centers the wave around 0.
+	var min, max float32
+	for backend.Buffered() > 0 {
+		sample, _ := backend.ring.pop()
+		if sample < min {
+			min = sample
+		}
+		if sample > max {
+			max = sample
+		}
+	}
+	if min >= 0 || max <= 0 {
+		t.Errorf("samples from %v to %v, want around 0", min, max)
+	}
+
+	// Power cycling keeps the backend connected.
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+	bus.StepFrame()
+	if backend.Buffered() == 0 {
+		t.Error("no samples pushed after power cycling")
+	}
+}
+
+func TestFastForwardMutesAudio(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+
+	backend := NewAudioBackend(44100)
+	bus.SetAudioBackend(backend)
+
+	bus.SetFastForward(true)
+	if got := bus.frameRate(); got != 0 {
+		t.Errorf("frame rate while fast forwarding = %v, want 0 (uncapped)", got)
+	}
+	for i := 0; i < 10; i++ {
+		bus.StepFrame()
+	}
+	if got := backend.Buffered(); got != 0 {
+		t.Errorf("%d samples buffered while fast forwarding, want 0", got)
+	}
+
+	// Sound picks up again at the normal rate.
+	bus.SetFastForward(false)
+	if got := bus.frameRate(); got != NtscFrameRate {
+		t.Errorf("frame rate after fast forwarding = %v, want %v", got, NtscFrameRate)
+	}
+	bus.StepFrame()
+	if got, want := backend.Buffered(), 44100/60; got < want-10 || got > want+10 {
+		t.Errorf("%d samples buffered after 1 frame, want about %d", got, want)
+	}
+}
+
+func TestAudioRecording(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+
+	// readHeader returns the RIFF and data sizes in the file's header, and the
+	// file size.
+	path := filepath.Join(t.TempDir(), "audio.wav")
+	readHeader := func() (riffSize, dataSize uint32, fileSize int) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) < wavHeaderSize || string(data[0:4]) != "RIFF" || string(data[36:40]) != "data" {
+			t.Fatal("not a WAV file")
+		}
+		if got := binary.LittleEndian.Uint32(data[24:]); got != defaultRecordingSampleRate {
+			t.Errorf("sample rate = %d, want %d", got, defaultRecordingSampleRate)
+		}
+		return binary.LittleEndian.Uint32(data[4:]), binary.LittleEndian.Uint32(data[40:]), len(data)
+	}
+
+	// Recording without a sound card connects a backend.
+	if err := bus.StartAudioRecording(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.StartAudioRecording(path); err == nil {
+		t.Error("started recording twice")
+	}
+
+	// Past the first second, the header has been updated to cover it, in case
+	// the recording is never stopped.
+	for i := 0; i < 70; i++ {
+		bus.StepFrame()
+	}
+	riffSize, dataSize, fileSize := readHeader()
+	if want := uint32(defaultRecordingSampleRate * 2); dataSize != want || riffSize != want+wavHeaderSize-8 {
+		t.Errorf("while recording, RIFF size = %d, data size = %d, want %d, %d",
+			riffSize, dataSize, want+wavHeaderSize-8, want)
+	}
+	if fileSize < int(dataSize)+wavHeaderSize {
+		t.Errorf("while recording, file size = %d, want at least %d", fileSize, dataSize+wavHeaderSize)
+	}
+
+	// Stopping sets the sizes to the whole recording. 70 frames are about
+	// 70*29780 CPU cycles.
+	if err := bus.StopAudioRecording(); err != nil {
+		t.Fatal(err)
+	}
+	riffSize, dataSize, fileSize = readHeader()
+	if want := uint32(fileSize - 8); riffSize != want {
+		t.Errorf("RIFF size = %d, want %d", riffSize, want)
+	}
+	if want := uint32(fileSize - wavHeaderSize); dataSize != want {
+		t.Errorf("data size = %d, want %d", dataSize, want)
+	}
+	if got, want := int(dataSize)/2, 70*29780*defaultRecordingSampleRate/apuClockRate; got < want-10 || got > want+10 {
+		t.Errorf("%d samples recorded in 70 frames, want about %d", got, want)
+	}
+	if err := bus.StopAudioRecording(); err == nil {
+		t.Error("stopped recording twice")
+	}
+}
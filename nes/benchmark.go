@@ -0,0 +1,54 @@
+package nes
+
+import (
+	"fmt"
+	"time"
+)
+
+// BenchResult reports how fast the NES ran during a benchmark.
+type BenchResult struct {
+	Duration  time.Duration // Wall-clock time spent running
+	Frames    int           // Frames completed
+	CpuCycles int           // CPU cycles emulated
+	MHz       float64       // Effective emulated CPU frequency
+	FPS       float64       // Frames completed per second
+}
+
+func (r BenchResult) String() string {
+	return fmt.Sprintf("%d frames, %d CPU cycles in %v: %.2f MHz, %.1f FPS",
+		r.Frames, r.CpuCycles, r.Duration, r.MHz, r.FPS)
+}
+
+// Benchmark runs the inserted cartridge as fast as possible for about d and
+// reports the emulated speed. A real NES CPU runs at about 1.79 MHz and 60 FPS.
+// No window is created, so this can be used without a display. It stops
+// early if a breakpoint or watchpoint is hit.
+func (b *Bus) Benchmark(d time.Duration) BenchResult {
+	// Write a crash report if emulation panics.
+	defer b.recoverCrash()
+
+	startCycles := b.Cpu.CycleCount
+	start := time.Now()
+
+	frames := 0
+	for time.Since(start) < d {
+		b.StepFrame()
+
+		// Stop at breakpoints, without counting the partial frame.
+		if !b.Ppu.frameComplete {
+			break
+		}
+		frames++
+	}
+
+	elapsed := time.Since(start)
+	cpuCycles := int(b.Cpu.CycleCount - startCycles)
+
+	return BenchResult{
+		Duration:  elapsed,
+		Frames:    frames,
+		CpuCycles: cpuCycles,
+		MHz:       float64(cpuCycles) / elapsed.Seconds() / 1e6,
+		FPS:       float64(frames) / elapsed.Seconds(),
+	}
+}
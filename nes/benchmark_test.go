@@ -0,0 +1,42 @@
+package nes
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBenchmark(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newIntegrationRom()))
+
+	result := bus.Benchmark(50 * time.Millisecond)
+
+	if result.Frames == 0 || result.CpuCycles == 0 {
+		t.Fatalf("nothing emulated: %v", result)
+	}
+	if result.MHz <= 0 || result.FPS <= 0 {
+		t.Errorf("bad speed: %v", result)
+	}
+
+	// About 29780 CPU cycles per frame.
+	perFrame := result.CpuCycles / result.Frames
+	if perFrame < 29000 || perFrame > 30500 {
+		t.Errorf("%d CPU cycles per frame, want about 29780", perFrame)
+	}
+}
+
+func TestBenchmarkBreakpoint(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newIntegrationRom()))
+
+	// The NMI handler runs once the game has started up, in the third frame.
+	bus.Cpu.AddBreakpoint(0x8072)
+	result := bus.Benchmark(time.Second)
+
+	if !bus.Paused() || result.Duration >= time.Second {
+		t.Fatalf("benchmark did not stop at the breakpoint: %v", result)
+	}
+	if result.Frames != bus.Ppu.frames {
+		t.Errorf("%d frames counted, %d completed", result.Frames, bus.Ppu.frames)
+	}
+}
@@ -0,0 +1,113 @@
+package nes
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Breakpoints stop emulation when the CPU is about to run the instruction at
+// an address. Watchpoints stop it after the CPU reads or writes an address.
+// When either is hit, Run pauses, so the step keys can be used from there, and
+// the CPU's state is logged.
+
+// Watchpoint stops emulation when the CPU accesses Addr.
+type Watchpoint struct {
+	Addr    uint16
+	OnRead  bool // Stop after the CPU reads Addr
+	OnWrite bool // Stop after the CPU writes Addr
+}
+
+// AddBreakpoint stops emulation when the CPU is about to run the instruction
+// at addr.
+func (cpu *Cpu6502) AddBreakpoint(addr uint16) {
+	if cpu.breakpoints == nil {
+		cpu.breakpoints = make(map[uint16]bool)
+	}
+	cpu.breakpoints[addr] = true
+}
+
+// RemoveBreakpoint removes the breakpoint at addr, if any.
+func (cpu *Cpu6502) RemoveBreakpoint(addr uint16) {
+	delete(cpu.breakpoints, addr)
+}
+
+// Breakpoints returns the addresses of the active breakpoints, in order.
+func (cpu *Cpu6502) Breakpoints() []uint16 {
+	addrs := make([]uint16, 0, len(cpu.breakpoints))
+	for addr := range cpu.breakpoints {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+	return addrs
+}
+
+// AddWatchpoint stops emulation after the CPU reads addr, writes it, or both.
+// It replaces any watchpoint already on addr. Dummy reads and writes made by
+// the CPU count too.
+func (cpu *Cpu6502) AddWatchpoint(addr uint16, onRead, onWrite bool) {
+	if cpu.watchpoints == nil {
+		cpu.watchpoints = make(map[uint16]Watchpoint)
+	}
+	cpu.watchpoints[addr] = Watchpoint{addr, onRead, onWrite}
+}
+
+// RemoveWatchpoint removes the watchpoint on addr, if any.
+func (cpu *Cpu6502) RemoveWatchpoint(addr uint16) {
+	delete(cpu.watchpoints, addr)
+}
+
+// Watchpoints returns the active watchpoints, in address order.
+func (cpu *Cpu6502) Watchpoints() []Watchpoint {
+	watchpoints := make([]Watchpoint, 0, len(cpu.watchpoints))
+	for _, w := range cpu.watchpoints {
+		watchpoints = append(watchpoints, w)
+	}
+	sort.Slice(watchpoints, func(i, j int) bool { return watchpoints[i].Addr < watchpoints[j].Addr })
+
+	return watchpoints
+}
+
+// Check for a breakpoint on the instruction about to run. The instruction at
+// a breakpoint that was already stopped at runs when emulation resumes.
+func (cpu *Cpu6502) checkBreakpoint() {
+	if cpu.Cycles > 0 || cpu.skipBreakpoint || !cpu.breakpoints[cpu.Pc] {
+		return
+	}
+
+	cpu.breakReason = fmt.Sprintf("Breakpoint at $%04X", cpu.Pc)
+	cpu.skipBreakpoint = true
+}
+
+// Check for a watchpoint on a memory access by the CPU.
+func (cpu *Cpu6502) checkWatchpoint(addr uint16, data byte, write bool) {
+	w, ok := cpu.watchpoints[addr]
+	if !ok || cpu.breakReason != "" {
+		return
+	}
+
+	if write && w.OnWrite {
+		cpu.breakReason = fmt.Sprintf("Watchpoint: write $%04X = %02X", addr, data)
+	} else if !write && w.OnRead {
+		cpu.breakReason = fmt.Sprintf("Watchpoint: read $%04X = %02X", addr, data)
+	}
+}
+
+// breakHit returns whether a breakpoint or watchpoint has been hit. If so,
+// Run is paused and the CPU's state is logged.
+func (b *Bus) breakHit() bool {
+	b.Cpu.checkBreakpoint()
+
+	reason := b.Cpu.breakReason
+	if reason == "" {
+		return false
+	}
+	b.Cpu.breakReason = ""
+
+	b.SetPaused(true)
+	b.showMessage(reason)
+	log.Print(b.Cpu.traceLine())
+
+	return true
+}
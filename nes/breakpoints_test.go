@@ -0,0 +1,111 @@
+package nes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newBreakpointTestBus(t *testing.T) *Bus {
+	t.Helper()
+
+	rom := newTestRom(1, 1, 0x00, 0x00)
+	prg := rom[16 : 16+16*1024]
+	copy(prg, []byte{
+		0xE8,             // $C000: INX
+		0xE8,             // $C001: INX
+		0x8E, 0x00, 0x03, // $C002: STX $0300
+		0xAD, 0x01, 0x03, // $C005: LDA $0301
+		0x4C, 0x00, 0xC0, // $C008: JMP $C000
+	})
+	// Reset vector: $C000
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0xC0
+
+	bus := NewBus(false, false)
+	if err := bus.LoadBytes(rom); err != nil {
+		t.Fatal(err)
+	}
+	return bus
+}
+
+func TestBreakpoint(t *testing.T) {
+	bus := newBreakpointTestBus(t)
+	bus.Cpu.AddBreakpoint(0xC001)
+
+	bus.StepFrame()
+	if bus.Cpu.Pc != 0xC001 || bus.Cpu.X != 1 {
+		t.Fatalf("stopped at $%04X with X=%d, want $C001 with X=1", bus.Cpu.Pc, bus.Cpu.X)
+	}
+	if !bus.Paused() {
+		t.Error("not paused at breakpoint")
+	}
+
+	// Resuming runs the instruction at the breakpoint, then stops there again
+	// on the next time around the loop.
+	bus.StepFrame()
+	if bus.Cpu.Pc != 0xC001 || bus.Cpu.X != 3 {
+		t.Fatalf("stopped at $%04X with X=%d, want $C001 with X=3", bus.Cpu.Pc, bus.Cpu.X)
+	}
+
+	bus.Cpu.AddBreakpoint(0xC008)
+	if got, want := bus.Cpu.Breakpoints(), []uint16{0xC001, 0xC008}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Breakpoints() = %X, want %X", got, want)
+	}
+
+	bus.Cpu.RemoveBreakpoint(0xC001)
+	bus.Cpu.RemoveBreakpoint(0xC008)
+	if got := bus.Cpu.Breakpoints(); len(got) != 0 {
+		t.Errorf("Breakpoints() = %X after removing them all", got)
+	}
+	frame := bus.Ppu.frames
+	bus.StepFrame()
+	if bus.Ppu.frames != frame+1 {
+		t.Error("frame didn't complete with no breakpoints")
+	}
+}
+
+func TestWatchpoint(t *testing.T) {
+	bus := newBreakpointTestBus(t)
+	bus.Cpu.AddWatchpoint(0x0300, false, true)
+	bus.Cpu.AddWatchpoint(0x0301, true, false)
+
+	// Stops after the instruction that accessed the address.
+	bus.StepFrame()
+	if bus.Cpu.Pc != 0xC005 || bus.Ram[0x0300] != 2 {
+		t.Fatalf("stopped at $%04X with $0300=%d, want $C005 with $0300=2", bus.Cpu.Pc, bus.Ram[0x0300])
+	}
+	bus.StepFrame()
+	if bus.Cpu.Pc != 0xC008 {
+		t.Fatalf("stopped at $%04X, want $C008 after reading $0301", bus.Cpu.Pc)
+	}
+
+	want := []Watchpoint{{0x0300, false, true}, {0x0301, true, false}}
+	if got := bus.Cpu.Watchpoints(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Watchpoints() = %+v, want %+v", got, want)
+	}
+
+	// A read-only watchpoint doesn't stop on writes.
+	bus.Cpu.AddWatchpoint(0x0300, true, false)
+	bus.Cpu.RemoveWatchpoint(0x0301)
+	frame := bus.Ppu.frames
+	bus.StepFrame()
+	if bus.Ppu.frames != frame+1 {
+		t.Errorf("stopped at $%04X, want the frame to complete", bus.Cpu.Pc)
+	}
+}
+
+func TestRunToVBlankBreakpoint(t *testing.T) {
+	bus := newBreakpointTestBus(t)
+	bus.Cpu.AddBreakpoint(0xC008)
+
+	if bus.RunToVBlank() {
+		t.Fatal("ran to vblank past a breakpoint")
+	}
+	if bus.Cpu.Pc != 0xC008 || !bus.Paused() {
+		t.Errorf("stopped at $%04X, paused %v, want $C008 and paused", bus.Cpu.Pc, bus.Paused())
+	}
+
+	bus.Cpu.RemoveBreakpoint(0xC008)
+	if !bus.RunToVBlank() {
+		t.Error("stopped before vblank with no breakpoints")
+	}
+}
@@ -3,8 +3,9 @@ package nes
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -12,24 +13,77 @@ import (
 type Bus struct {
 	Cpu             *Cpu6502       // NES CPU.
 	Ppu             *Ppu           // Picture processing unit.
+	Apu             *Apu           // Audio processing unit.
 	Ram             [8 * 1024]byte // 8KiB RAM.
 	Cart            *Cartridge     // NES Cartridge.
 	Controller      [2]*Controller // NES Controller.
 	ControllerState [2]byte        // 8 bit shifter representing each button's state
 	Disp            *Display
 
-	ClockCount int
+	controllerStrobe bool // Reload the controller shifters on every read
+
+	ClockCount    int
+	cpuClockCount int // CPU cycles, including those the CPU spent suspended
 
 	// Direct memory access
 	dmaPage byte
 	dmaAddr byte
 	dmaData byte // Memory to be sent from the CPU to the OAM
 
-	dmaTransfer bool // Set to enable DMA transfer
-	dmaNeedSync bool // Set when CPU should wait 1 cycle for DMA
+	dmaTransfer bool      // Set to enable DMA transfer
+	dmaNeedSync bool      // Set when CPU should wait 1 cycle for DMA
+	dmaTiming   DMATiming // How DMA transfers are emulated
+
+	dmcStall          int  // CPU cycles left suspended by a DMC sample read
+	dmcConflict       bool // DMC DMA repeats the CPU's controller reads, see SetDMCConflict
+	dmcReadCorrection bool // Undo the button skipped by the DMC conflict
+
+	openBus          byte // Last value read or written on the CPU data bus
+	openBusEmulation bool // Return openBus for reads of unmapped addresses
+
+	// CPU/PPU clock alignment
+	clockAlignment       int  // PPU cycle (0-2) the CPU is clocked on
+	randomClockAlignment bool // Pick a new alignment every power cycle
+
+	// TV system timing
+	region         Region // Region in use, the cartridge's unless forced
+	forcedRegion   Region // Region used instead, if isRegionForced
+	isRegionForced bool
+	palClock       int // PAL: counts towards the next CPU cycle, in fifths of a PPU cycle
+
+	// VS System
+	isVSSystem  bool // Read DIP switches through the controller ports
+	dipSwitches byte // VS System DIP switches 1-8
 
 	isDebug   bool // Enable debug panel
 	isLogging bool // Enable logging
+
+	frameTimes frameTimer // Real time taken by recent frames
+
+	targetFPS   float64 // Frames per second Run aims for, 0 for uncapped
+	fastForward bool    // Run uncapped and muted, ignoring targetFPS
+	paused      bool    // Run only steps when asked to, see SetPaused
+	videoPaused bool    // Keep showing the same frame while emulation continues
+
+	// Quick saves
+	quickSaveKeys QuickSaveKeys
+	stateSlot     int // Slot (0-9) used by quick save and quick load
+
+	showNametables bool // Show the nametables in the debug panel, instead of the pattern tables
+
+	// Memory dump shown in the debug panel
+	memoryPage     memoryPage
+	memoryDumpAddr uint16 // Start of the user page
+
+	// Message shown in the debug panel until messageExpires
+	message        string
+	messageExpires time.Time
+
+	ramSeeds map[uint16]byte // RAM values written on every reset
+
+	// Held while running a frame, so cartridges can be swapped from another
+	// goroutine between frames.
+	mu sync.Mutex
 }
 
 const (
@@ -43,6 +97,10 @@ const (
 	ppuMaxAddr uint16 = 0x3FFF
 	ppuMirror  uint16 = 0x0007 // mirror every 8 bytes.
 
+	// Cartridge PRG-RAM
+	prgRamMinAddr uint16 = 0x6000
+	prgRamMaxAddr uint16 = 0x7FFF
+
 	// Cartridge
 	cartMinAddr uint16 = 0x8000 // XXX: changing this for now to get disassembler to work
 	cartMaxAddr uint16 = 0xFFFF
@@ -53,40 +111,56 @@ const (
 	// Controller
 	ctrlMinAddr uint16 = 0x4016
 	ctrlMaxAddr uint16 = 0x4017
-
-	// Frames per second
-	fps float64 = 60
 )
 
 func NewBus(isDebug, isLogging bool) *Bus {
 	// Create a new CPU. Here we use a 6502.
-	cpu := NewCpu6502(isLogging)
+	cpu := NewCpu6502()
 
 	controllers := [2]*Controller{}
 	for i := range controllers {
 		controllers[i] = NewController()
 	}
+	controllers[0].useDefaultInput()
 
 	// Attach devices to the bus.
 	bus := &Bus{
 		Cpu:         cpu,
 		Ppu:         NewPpu(),
+		Apu:         NewApu(),
 		Controller:  controllers,
 		dmaTransfer: false,
 		dmaNeedSync: true,
 
-		isDebug:   isDebug,
-		isLogging: isLogging,
+		targetFPS:     NtscFrameRate,
+		quickSaveKeys: DefaultQuickSaveKeys,
+
+		dmcConflict: true,
+
+		isDebug: isDebug,
 	}
 
 	// Connect this bus to the cpu.
 	cpu.ConnectBus(bus)
 
+	// Show the splash screen until a cartridge is inserted.
+	bus.Ppu.loadSplash()
+
+	// Log to the default directory. Use EnableLogging to configure logging.
+	if isLogging {
+		if err := bus.EnableLogging(LogConfig{}); err != nil {
+			log.Println("Unable to enable logging...\n", err)
+		}
+	}
+
 	return bus
 }
 
 // Run the NES.
 func (b *Bus) Run() {
+	// Write a crash report if emulation panics.
+	defer b.recoverCrash()
+
 	// Create a PixelGL display for the PPU to render to.
 	display := NewDisplay(b.isDebug)
 	b.Disp = display
@@ -94,97 +168,410 @@ func (b *Bus) Run() {
 	// PPU needs access to the display.
 	b.Ppu.ConnectDisplay(display)
 
-	intervalInMilli := (1 / fps) * 1000
-	interval := time.Duration(intervalInMilli) * time.Millisecond
-	fmt.Println("Frame refresh time:", interval)
+	// Use the inserted game's picture settings.
+	b.applyDisplayDefaults()
+	display.SetFrozen(b.videoPaused)
 
-	// Use a timer to keep frames rendered steadily at a set FPS.
+	// Keep frames running steadily at the target FPS.
+	var limiter frameLimiter
 	var t time.Time
+	lastAutoSave := time.Now()
 	for !display.window.Closed() {
-		// Run 1 whole frame.
-		t = time.Now()
-		for !b.Ppu.frameComplete {
-			b.Clock()
-		}
-
+		// Read input once per frame, before the frame runs.
 		for i := range b.Controller {
 			b.Controller[i].updateControllerInput(b.Disp.window)
 		}
+		b.updateQuickSaveInput(b.Disp.window)
+		b.updateScreenshotInput(b.Disp.window)
+		b.updateFastForwardInput(b.Disp.window)
+		b.updatePauseInput(b.Disp.window)
+		b.updateMemoryDumpInput(b.Disp.window)
+		b.updateNametableViewInput(b.Disp.window)
+		b.updatePaletteViewInput(b.Disp.window)
+
+		// VSync would hold the frame rate to the monitor's.
+		display.window.SetVSync(b.frameRate() > 0)
+
+		if b.paused {
+			// Keep the window responsive, showing the frame as far as it has
+			// been drawn.
+			display.UpdateScreen()
+		} else {
+			// Run 1 whole frame.
+			t = time.Now()
+			display.presentTime = 0
+			b.StepFrame()
+			b.frameTimes.record(time.Since(t)-display.presentTime, display.presentTime)
+		}
 
 		if b.isDebug {
 			b.DrawDebugPanel()
 		}
 
-		since := time.Since(t)
-		toSleep := interval - since
-		time.Sleep(toSleep)
+		if time.Since(lastAutoSave) >= autoSaveInterval {
+			b.autoSave()
+			lastAutoSave = time.Now()
+		}
+
+		limiter.wait(b.frameRate())
+	}
+
+	// Keep the game's save when the window is closed.
+	if b.Cart != nil {
+		if err := b.Cart.WriteSave(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// StepFrame runs the NES until the PPU completes a frame, or a breakpoint or
+// watchpoint is hit.
+func (b *Bus) StepFrame() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Prepare for new frame
+	b.Ppu.frameComplete = false
 
-		// Prepare for new frame
-		b.Ppu.frameComplete = false
+	for !b.Ppu.frameComplete {
+		// Stop partway through the frame at breakpoints.
+		if b.breakHit() {
+			return
+		}
+		b.Clock()
 	}
 }
 
+// RunToVBlank runs the NES until the PPU enters vertical blank (scanline 241,
+// cycle 1). It returns right after the VBlank flag is set, when the frame has
+// been fully rendered and before the game's NMI handler has run.
+//
+// It stops early if a breakpoint or watchpoint is hit, pausing Run like
+// StepFrame does, and returns whether vertical blank was reached.
+func (b *Bus) RunToVBlank() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for {
+		if b.breakHit() {
+			return false
+		}
+		b.Clock()
+
+		// The PPU has moved on to the next cycle after entering vblank.
+		if b.Ppu.scanline == 241 && b.Ppu.cycle == 2 {
+			return true
+		}
+	}
+}
+
+// StepDot runs the NES for exactly one PPU cycle (dot). The CPU runs on every
+// third dot. Use PpuPosition to see where the PPU is.
+func (b *Bus) StepDot() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Clock()
+}
+
+// StepInstruction runs the NES until the CPU has run exactly one instruction,
+// or taken one interrupt. Any instruction partway through is finished first.
+// It returns with the CPU about to run the next instruction.
+func (b *Bus) StepInstruction() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.Cpu.Cycles > 0 {
+		b.Clock()
+	}
+
+	// The CPU may be suspended by DMA before it starts the instruction.
+	for b.Cpu.Cycles == 0 {
+		b.Clock()
+	}
+	for b.Cpu.Cycles > 0 {
+		b.Clock()
+	}
+
+	// Watchpoints hit by an instruction that was stepped to don't stop the
+	// next frame.
+	b.Cpu.breakReason = ""
+}
+
+// PpuPosition returns the scanline (-1 to 260) and cycle (0 to 340) the PPU
+// will run next.
+func (b *Bus) PpuPosition() (scanline, cycle int) {
+	return b.Ppu.scanline, b.Ppu.cycle
+}
+
 // Used by the CPU to read data from the main bus at a specified address.
 func (b *Bus) CpuRead(addr uint16) byte {
+	// Nothing drives the data bus for unmapped addresses, so the last value on
+	// the bus is read.
 	var data byte
+	if b.openBusEmulation {
+		data = b.openBus
+	}
 
 	if addr >= ramMinAddr && addr <= ramMaxAddr {
 		data = b.Ram[addr&ramMirror]
 	} else if addr >= ppuMinAddr && addr <= ppuMaxAddr {
 		data = b.Ppu.cpuRead(addr & ppuMirror)
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		if b.Cart != nil {
+			data = b.Cart.cpuRead(addr)
+		}
 	} else if addr >= cartMinAddr && addr <= cartMaxAddr {
-		data = b.Cart.cpuRead(addr)
+		if b.Cart != nil {
+			data = b.Cart.cpuRead(addr)
+		}
+	} else if addr == apuStatusAddr {
+		data = b.Apu.cpuRead(addr)
 	} else if addr >= ctrlMinAddr && addr <= ctrlMaxAddr {
+		// While the strobe is high the shifters keep reloading, so only the
+		// first button (A) is read.
+		if b.controllerStrobe {
+			b.latchControllers()
+		}
+
 		data = (b.ControllerState[addr&1] & (1 << 7)) >> 7
-		b.ControllerState[addr&1] <<= 1 // shift
+
+		// Shift in 1s, which standard controllers return after the 8 buttons.
+		b.ControllerState[addr&1] = b.ControllerState[addr&1]<<1 | 1
+
+		if b.isVSSystem {
+			data |= b.vsDipBits(addr)
+		} else if b.openBusEmulation {
+			// The high 3 bits are not driven by the controller ports.
+			data |= b.openBus & 0xE0
+		}
 	}
 
+	b.openBus = data
+
 	return data
 }
 
+// peek reads CPU memory for debugging, without the side effects of CpuRead.
+// Only RAM and the cartridge are read, other addresses read as 0.
+func (b *Bus) peek(addr uint16) byte {
+	if addr >= ramMinAddr && addr <= ramMaxAddr {
+		return b.Ram[addr&ramMirror]
+	}
+	if addr >= prgRamMinAddr && b.Cart != nil {
+		return b.Cart.cpuRead(addr)
+	}
+
+	return 0
+}
+
 // Used by the CPU to write data to the main bus at a specified address.
 func (b *Bus) CpuWrite(addr uint16, data byte) {
+	b.openBus = data
+
 	if addr >= ramMinAddr && addr <= ramMaxAddr {
 		b.Ram[addr&ramMirror] = data
 	} else if addr >= ppuMinAddr && addr <= ppuMaxAddr {
 		b.Ppu.cpuWrite(addr&ppuMirror, data)
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		if b.Cart != nil {
+			b.Cart.cpuWrite(addr, data)
+		}
 	} else if addr >= cartMinAddr && addr <= cartMaxAddr {
-		b.Cart.cpuWrite(addr, data)
+		if b.Cart != nil {
+			b.Cart.cpuWrite(addr, data)
+		}
 	} else if addr == dmaAddr {
 		b.dmaPage = data
 		b.dmaAddr = 0x00
-		b.dmaTransfer = true
-	} else if addr >= ctrlMinAddr && addr <= ctrlMaxAddr {
-		for i, c := range b.Controller {
-			b.ControllerState[i] = c.GetState()
+		if b.dmaTiming == DMAInstant {
+			b.instantDmaTransfer()
+		} else {
+			b.dmaTransfer = true
+		}
+	} else if (addr >= apuMinAddr && addr <= apuMaxAddr) || addr == apuStatusAddr || addr == apuFrameCounterAddr {
+		b.Apu.cpuWrite(addr, data)
+	} else if addr == ctrlMinAddr {
+		// Bit 0 is the strobe, latching both controllers' buttons while high.
+		// $4017 writes go to the APU frame counter.
+		b.controllerStrobe = data&0x01 > 0
+		if b.controllerStrobe {
+			b.latchControllers()
 		}
 	}
 }
 
+// Load the buttons held on each controller into its shifter.
+func (b *Bus) latchControllers() {
+	for i, c := range b.Controller {
+		b.ControllerState[i] = c.GetState()
+	}
+}
+
 // Load a cartridge to the NES. The cartridge is connected to both the CPU and PPU.
+// Any cartridge already inserted is replaced and the NES is power cycled, so
+// this is safe to call while the NES is running.
 func (b *Bus) InsertCartridge(cart *Cartridge) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.connectCartridge(cart)
+	b.powerCycle()
+}
+
+// EjectCartridge removes the inserted cartridge and power cycles the NES. Reads
+// from the cartridge address space return 0 until a new cartridge is inserted.
+func (b *Bus) EjectCartridge() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.connectCartridge(nil)
+	b.powerCycle()
+}
+
+// Connect a cartridge, or nil for no cartridge, to the CPU and PPU and apply
+// its settings.
+func (b *Bus) connectCartridge(cart *Cartridge) {
+	// Save the outgoing game, and load the incoming game's save.
+	if b.Cart != nil {
+		if err := b.Cart.WriteSave(); err != nil {
+			log.Println(err)
+		}
+	}
+	if cart != nil {
+		if err := cart.LoadSave(); err != nil {
+			log.Println(err)
+		}
+	}
+
 	b.Cart = cart
 	b.Ppu.ConnectCartridge(cart)
+
+	b.SetVSSystem(cart != nil && cart.isVSSystem)
+	b.applyDisplayDefaults()
+	b.applyRegion()
+}
+
+// Return the NES to its power-up state, leaving the cartridge inserted.
+func (b *Bus) powerCycle() {
+	b.Ram = [8 * 1024]byte{}
+	b.applyRAMSeeds()
+	b.ControllerState = [2]byte{}
+	b.controllerStrobe = false
+
+	b.dmaPage = 0x00
+	b.dmaAddr = 0x00
+	b.dmaData = 0x00
+	b.dmaTransfer = false
+	b.dmaNeedSync = true
+	b.dmcStall = 0
+
+	b.Ppu.Reset()
+	b.Apu.Reset()
+
+	if b.randomClockAlignment {
+		b.clockAlignment = rand.New(rand.NewSource(time.Now().UnixNano())).Intn(3)
+	}
+	b.palClock = 0
+
+	// The CPU reads its starting address from the cartridge. Without one, show
+	// the splash screen instead.
+	if b.Cart != nil {
+		b.Cpu.Reset()
+	} else {
+		b.Ppu.loadSplash()
+	}
+
+	b.ClockCount = 0
+}
+
+// SetVideoPaused freezes the picture on the current frame while emulation
+// keeps running, or unfreezes it.
+func (b *Bus) SetVideoPaused(paused bool) {
+	b.videoPaused = paused
+
+	if b.Disp != nil {
+		b.Disp.SetFrozen(paused)
+	}
 }
 
 // Reset the NES.
 func (b *Bus) Reset() {
 	b.Cpu.Reset()
 
+	// Reset silences all APU channels.
+	b.Apu.cpuWrite(apuStatusAddr, 0x00)
+	b.applyRAMSeeds()
+
 	b.ClockCount = 0
 }
 
+// SetRAMSeed makes every reset and power cycle write value to the given
+// address in CPU RAM ($0000-$1FFF) before the first instruction runs. Use it to
+// pin the state a game seeds its random number generator from, for
+// reproducible runs. Which addresses matter is different for every game, and
+// a game may overwrite them before using them.
+func (b *Bus) SetRAMSeed(addr uint16, value byte) {
+	if addr > ramMaxAddr {
+		return
+	}
+
+	if b.ramSeeds == nil {
+		b.ramSeeds = make(map[uint16]byte)
+	}
+	b.ramSeeds[addr&ramMirror] = value
+}
+
+// ClearRAMSeeds removes all values set by SetRAMSeed.
+func (b *Bus) ClearRAMSeeds() {
+	b.ramSeeds = nil
+}
+
+// Write the RAM seeds to RAM.
+func (b *Bus) applyRAMSeeds() {
+	for addr, value := range b.ramSeeds {
+		b.Ram[addr] = value
+	}
+}
+
 // 1 NES clock cycle.
 func (b *Bus) Clock() {
 	b.Ppu.Clock()
 
-	// CPU runs 3 times slower than PPU.
-	if b.ClockCount%3 == 0 {
-		if b.dmaTransfer {
+	// CPU runs 3 times slower than PPU, or 3.2 times on PAL.
+	cpuCycle := b.ClockCount%3 == b.clockAlignment
+	if b.region == RegionPAL {
+		b.palClock += palPpuCyclesDen
+		cpuCycle = b.palClock >= palPpuCyclesNum
+		if cpuCycle {
+			b.palClock -= palPpuCyclesNum
+		}
+	}
+
+	if cpuCycle {
+		b.cpuClockCount++
+
+		cpuRan := false
+		if b.dmcStall > 0 {
+			b.dmcStall--
+		} else if b.dmaTransfer {
 			// A DMA transfer suspends the CPU until complete
 			b.initDmaTransfer()
 		} else {
 			b.Cpu.Clock()
+			cpuRan = true
+		}
+
+		// The APU is part of the CPU, and keeps running during DMA.
+		b.Apu.Clock()
+
+		// The DMC reads its samples by DMA, suspending the CPU.
+		if addr, ok := b.Apu.dmc.sampleRequest(); ok {
+			if cpuRan {
+				b.dmcControllerConflict()
+			}
+			b.Apu.dmc.loadSample(b.CpuRead(addr))
+			b.dmcStall = dmcDmaCycles
 		}
 	}
 
@@ -193,22 +580,35 @@ func (b *Bus) Clock() {
 		b.Cpu.NMI()
 	}
 
+	// IRQ is level triggered: it is taken between instructions for as long as
+	// a device holds the line, unless the CPU has interrupts disabled.
+	if b.Cpu.Cycles == 0 && !b.dmaTransfer && b.dmcStall == 0 && b.irq() {
+		b.Cpu.IRQ()
+	}
+
 	b.ClockCount++
 }
 
+// irq returns whether any device is holding the CPU's IRQ line. A device keeps
+// holding it until the CPU acknowledges the interrupt, usually by writing to
+// one of the device's registers.
+func (b *Bus) irq() bool {
+	return b.Apu.irq() || (b.Cart != nil && b.Cart.irqState())
+}
+
 func (b *Bus) initDmaTransfer() {
 	if b.dmaNeedSync {
-		if b.ClockCount%2 == 1 {
+		if b.cpuClockCount%2 == 1 {
 			b.dmaNeedSync = false
 		}
 	} else {
-		if b.ClockCount%2 == 0 {
+		if b.cpuClockCount%2 == 0 {
 			// read from CPU memory
 			addr := uint16(b.dmaPage)<<8 | uint16(b.dmaAddr)
 			b.dmaData = b.CpuRead(addr)
 		} else {
 			// write to OAM memory
-			b.Ppu.oam.write(b.dmaAddr, b.dmaData)
+			b.Ppu.writeOam(b.dmaAddr, b.dmaData)
 			b.dmaAddr++
 
 			if b.dmaAddr == 0x00 {
@@ -220,45 +620,115 @@ func (b *Bus) initDmaTransfer() {
 	}
 }
 
+// DMATiming selects how OAM DMA transfers are emulated.
+type DMATiming int
+
+const (
+	// The CPU is suspended for 513 or 514 cycles while bytes are alternately
+	// read from CPU memory and written to OAM.
+	DMAAccurate DMATiming = iota
+
+	// All 256 bytes are copied as soon as $4014 is written, and the CPU is not
+	// suspended. Faster, but games relying on DMA timing may misbehave.
+	DMAInstant
+)
+
+// SetDMATiming sets how OAM DMA transfers are emulated. Defaults to DMAAccurate.
+func (b *Bus) SetDMATiming(mode DMATiming) {
+	b.dmaTiming = mode
+}
+
+// SetOpenBusEmulation enables or disables open bus emulation. When enabled,
+// reads of unmapped addresses (such as $4018-$401F, or the cartridge space with
+// no cartridge) and the unused high bits of the controller ports return the
+// last value on the CPU data bus, like hardware. When disabled, they read as 0.
+func (b *Bus) SetOpenBusEmulation(enabled bool) {
+	b.openBusEmulation = enabled
+}
+
+// Use a random CPU/PPU clock alignment, picked again every power cycle.
+const ClockAlignmentRandom = -1
+
+// SetClockAlignment sets which of every 3 PPU cycles (0, 1, or 2) the CPU is
+// clocked on, counting from power-up. Real consoles power up with any of the
+// 3 alignments, which a few timing-sensitive games and test ROMs notice. Pass
+// ClockAlignmentRandom to pick one at random on every power cycle. Defaults to
+// 0.
+func (b *Bus) SetClockAlignment(n int) {
+	if n == ClockAlignmentRandom {
+		b.randomClockAlignment = true
+		b.clockAlignment = rand.New(rand.NewSource(time.Now().UnixNano())).Intn(3)
+		return
+	}
+
+	b.randomClockAlignment = false
+	b.clockAlignment = (n%3 + 3) % 3
+}
+
+// Copy a whole page of CPU memory to OAM at once.
+func (b *Bus) instantDmaTransfer() {
+	for {
+		addr := uint16(b.dmaPage)<<8 | uint16(b.dmaAddr)
+		b.Ppu.writeOam(b.dmaAddr, b.CpuRead(addr))
+		b.dmaAddr++
+
+		if b.dmaAddr == 0x00 {
+			break
+		}
+	}
+}
+
 // TODO: move this out of Bus, and into main or something. Also, rewrite this.
 func (b *Bus) DrawDebugPanel() {
-	// Pattern tables
+	// Pattern tables, or the nametables
 	patternTable0 := b.Ppu.GetPatternTable(0)
 	patternTable1 := b.Ppu.GetPatternTable(1)
+	if b.Ppu.trackTileUsage {
+		patternTable0 = b.Ppu.GetTileUsageHeatmap(0)
+		patternTable1 = b.Ppu.GetTileUsageHeatmap(1)
+	}
+	if b.showNametables {
+		nametables := b.Ppu.physicalNametables()
+		patternTable0 = nametableThumbnail(b.Ppu.GetNametable(nametables[0]))
+		patternTable1 = nametableThumbnail(b.Ppu.GetNametable(nametables[1]))
+	}
 
 	b.Disp.DrawDebugRGBA(8, int(gameH)-128-8, patternTable0)
 	b.Disp.DrawDebugRGBA(128+16, int(gameH)-128-8, patternTable1)
 
+	// Palettes
+	b.Disp.DrawDebugRGBA(2*128+24, int(gameH)-2*paletteSwatchSize-8, b.Ppu.GetPaletteImage())
+
 	b.Disp.debugRegText.Clear()
 	debugStr := b.getCpuDebugString()
 	b.Disp.WriteRegDebugString(debugStr)
 
 	// Keyboard input
 	contDebugStr := fmt.Sprintf("Controller status:\n%08b\n\n%08b", b.ControllerState[0], b.ControllerState[1])
-	b.Disp.WriteControllerDebugString(contDebugStr)
 
-	// Disassembly
-	diss := b.getDisassemblyLines()
-	b.Disp.WriteInstDebugString(diss)
-}
+	// Frame times
+	ms := func(d time.Duration) float64 { return d.Seconds() * 1000 }
+	stats := b.FrameTimeStats()
+	contDebugStr += fmt.Sprintf("\n\nFrame ms (mean/p99/max):\nemu  %.1f/%.1f/%.1f\ndraw %.1f/%.1f/%.1f",
+		ms(stats.Emulate.Mean), ms(stats.Emulate.P99), ms(stats.Emulate.Max),
+		ms(stats.Present.Mean), ms(stats.Present.P99), ms(stats.Present.Max))
 
-// getDisassemblyLines returns the last 15 lines of disassembly, separated by
-// new lines, as a string.
-func (b *Bus) getDisassemblyLines() string {
-	var buf bytes.Buffer
+	// Accuracy settings
+	contDebugStr += "\n\n" + b.accuracyDebugString()
 
-	idx := b.Cpu.PrevInstIdx
-	length := len(b.Cpu.PrevInstructions)
+	// Quick saves
+	contDebugStr += fmt.Sprintf("\n\nState slot: %d\n%s", b.stateSlot, b.currentMessage())
 
-	for i := 1; i <= length; i++ {
-		inst := b.Cpu.PrevInstructions[(idx+i)%length]
-		if inst != "" {
-			buf.WriteString(inst)
-			buf.WriteByte('\n')
-		}
-	}
+	b.Disp.WriteControllerDebugString(contDebugStr)
 
-	return buf.String()
+	// Disassembly around the next instruction
+	lines, current := b.Cpu.disassembleAround(b.Cpu.Pc, disassemblyWindowLines, disassemblyWindowLines)
+	b.Disp.WriteInstDebugLines(lines, current)
+
+	// Memory dump
+	name, addr := b.memoryPageAddr()
+	memDebugStr := fmt.Sprintf("Memory: %s\n%s", name, b.DumpMemory(addr, 256/memoryDumpRowSize))
+	b.Disp.WriteMemDebugString(memDebugStr)
 }
 
 func (b *Bus) getCpuDebugString() string {
@@ -277,28 +747,29 @@ func (b *Bus) getCpuDebugString() string {
 	return buf.String()
 }
 
-// Load a ROM to the NES.
-func (b *Bus) Load(filepath string) {
-	data, err := ioutil.ReadFile(filepath)
-
+// Load an iNES ROM file to the NES as a new cartridge, and power cycle it.
+func (b *Bus) Load(filepath string) error {
+	cart, err := NewCartridgeFromFile(filepath)
 	if err != nil {
-		log.Fatalf("Unable to open %v\n%v\n", filepath, err)
+		return err
 	}
 
-	romOffset := 0x8000
+	b.InsertCartridge(cart)
 
-	for i, bte := range data {
-		b.Ram[romOffset+i] = bte
-	}
+	return nil
 }
 
-// Load a slice of bytes to the NES.
-func (b *Bus) LoadBytes(rom []byte) {
-	romOffset := 0x8000
-
-	for i, bte := range rom {
-		b.Ram[romOffset+i] = bte
+// Load the contents of an iNES ROM file to the NES as a new cartridge, and
+// power cycle it.
+func (b *Bus) LoadBytes(rom []byte) error {
+	cart, err := NewCartridgeFromBytes(rom)
+	if err != nil {
+		return err
 	}
+
+	b.InsertCartridge(cart)
+
+	return nil
 }
 
 // Used for testing the emulator with nestest.
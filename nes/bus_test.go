@@ -0,0 +1,495 @@
+package nes
+
+import (
+	"image"
+	"testing"
+)
+
+func TestStepDot(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+
+	// Run to the last dot of a scanline.
+	for {
+		if _, cycle := bus.PpuPosition(); cycle == 340 {
+			break
+		}
+		bus.StepDot()
+	}
+	scanline, _ := bus.PpuPosition()
+	cpuCycles := bus.Cpu.CycleCount
+
+	for dot := 0; dot < 6; dot++ {
+		bus.StepDot()
+
+		if s, c := bus.PpuPosition(); s != scanline+1 || c != dot {
+			t.Errorf("step %d: PPU at scanline %d cycle %d, want scanline %d cycle %d", dot, s, c, scanline+1, dot)
+		}
+	}
+
+	if got := bus.Cpu.CycleCount - cpuCycles; got != 2 {
+		t.Errorf("CPU ran %d cycles in 6 dots, want 2", got)
+	}
+}
+
+func TestStepInstruction(t *testing.T) {
+	rom := newTestRom(1, 1, 0x00, 0x00)
+	prg := rom[16:]
+
+	// $8000: LDA #$01, STA $10, INC $10, JMP $8000
+	copy(prg, []byte{0xA9, 0x01, 0x85, 0x10, 0xE6, 0x10, 0x4C, 0x00, 0x80})
+	copy(prg[0x3FFC:], []byte{0x00, 0x80})
+
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, rom))
+
+	// The reset sequence is finished along with the first instruction.
+	bus.StepInstruction()
+
+	steps := []struct {
+		pc     uint16
+		cycles uint32
+	}{
+		{0x8004, 3}, // STA $10
+		{0x8006, 5}, // INC $10
+		{0x8000, 3}, // JMP $8000
+		{0x8002, 2}, // LDA #$01
+	}
+	for _, step := range steps {
+		cycles := bus.Cpu.CycleCount
+		bus.StepInstruction()
+
+		if bus.Cpu.Pc != step.pc {
+			t.Errorf("PC = %#04x, want %#04x", bus.Cpu.Pc, step.pc)
+		}
+		if got := bus.Cpu.CycleCount - cycles; got != step.cycles {
+			t.Errorf("instruction before %#04x ran %d cycles, want %d", step.pc, got, step.cycles)
+		}
+	}
+	if got := bus.Ram[0x10]; got != 2 {
+		t.Errorf("$10 = %d, want 2", got)
+	}
+}
+
+func TestHotSwapCartridge(t *testing.T) {
+	// Two games with different reset vectors.
+	romA := newTestRom(1, 1, 0x00, 0x00)
+	romA[16+0x3FFC], romA[16+0x3FFD] = 0x00, 0x80
+	romB := newTestRom(1, 1, 0x00, 0x00)
+	romB[16+0x3FFC], romB[16+0x3FFD] = 0x34, 0x92
+
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, romA))
+	if bus.Cpu.Pc != 0x8000 {
+		t.Errorf("game A: PC = %#04x, want 0x8000", bus.Cpu.Pc)
+	}
+
+	bus.StepFrame()
+	bus.Ram[0x0010] = 0xAB
+
+	bus.EjectCartridge()
+	if got := bus.CpuRead(0x8000); got != 0 {
+		t.Errorf("ejected: read %#02x from cartridge space, want 0", got)
+	}
+	bus.CpuWrite(0x6000, 0xFF) // dropped
+
+	bus.InsertCartridge(newTestCartridge(t, romB))
+	if bus.Cpu.Pc != 0x9234 {
+		t.Errorf("game B: PC = %#04x, want 0x9234", bus.Cpu.Pc)
+	}
+	if bus.Ram[0x0010] != 0 {
+		t.Errorf("RAM not cleared after swapping cartridges")
+	}
+	if bus.Ppu.Cart != bus.Cart {
+		t.Errorf("PPU not connected to the new cartridge")
+	}
+}
+
+func TestClockWithoutCartridge(t *testing.T) {
+	bus := NewBus(false, false)
+
+	// Enable rendering so the PPU fetches pattern and nametable data.
+	bus.CpuWrite(0x2001, 0x18)
+
+	bus.StepFrame()
+	bus.StepFrame()
+
+	if got := bus.CpuRead(0x8000); got != 0 {
+		t.Errorf("read %#02x from cartridge space, want 0", got)
+	}
+	bus.CpuWrite(0x8000, 0xFF) // dropped
+	bus.Ppu.ppuWrite(0x0000, 0xFF)
+	if got := bus.Ppu.ppuRead(0x0000); got != 0 {
+		t.Errorf("read %#02x from pattern table, want 0", got)
+	}
+}
+
+func TestSplashScreen(t *testing.T) {
+	bus := NewBus(false, false)
+	disp := &Display{
+		gameRgba: image.NewRGBA(image.Rect(0, 0, int(nesResW), int(nesResH))),
+	}
+	bus.Ppu.ConnectDisplay(disp)
+
+	checkSplash := func(when string) {
+		t.Helper()
+
+		bus.StepFrame()
+		bus.StepFrame()
+
+		pixels := []struct {
+			x, y int
+			want byte // NES color
+		}{
+			{0, 0, 0x0F},     // backdrop
+			{36, 52, 0x16},   // first color bar
+			{212, 200, 0x0F}, // below the color bars
+			{212, 52, 0x20},  // last color bar
+			{81, 184, 0x30},  // "N"
+			{80, 184, 0x0F},  // left of "N"
+		}
+		for _, px := range pixels {
+			want := bus.Ppu.paletteRGBA[px.want]
+			if got := disp.gameRgba.RGBAAt(px.x, px.y); got != want {
+				t.Errorf("%s: pixel (%d, %d) = %v, want %v", when, px.x, px.y, got, want)
+			}
+		}
+	}
+
+	checkSplash("no cartridge")
+
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+	if bus.Ppu.ppuMask.getFlag(maskBgShow) != 0 {
+		t.Error("splash screen still shown with a cartridge inserted")
+	}
+
+	bus.EjectCartridge()
+	checkSplash("ejected")
+}
+
+func TestRunToVBlank(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+
+	for frame := 0; frame < 3; frame++ {
+		if !bus.RunToVBlank() {
+			t.Fatalf("frame %d: stopped before vblank", frame)
+		}
+
+		if bus.Ppu.scanline != 241 {
+			t.Errorf("frame %d: scanline = %d, want 241", frame, bus.Ppu.scanline)
+		}
+		if bus.Ppu.ppuStatus.getFlag(statusVBlank) == 0 {
+			t.Errorf("frame %d: VBlank flag not set", frame)
+		}
+		if bus.Ppu.frames != frame {
+			t.Errorf("frame %d: %d frames completed, want %d", frame, bus.Ppu.frames, frame)
+		}
+	}
+}
+
+func TestDMATiming(t *testing.T) {
+	for _, mode := range []DMATiming{DMAAccurate, DMAInstant} {
+		bus := NewBus(false, false)
+		bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+		bus.SetDMATiming(mode)
+
+		for i := 0; i < 256; i++ {
+			bus.Ram[0x0200+i] = byte(i)
+		}
+		bus.CpuWrite(0x4014, 0x02)
+
+		// Count the CPU cycles spent on the transfer.
+		cpuCycles := 0
+		for bus.dmaTransfer {
+			if bus.ClockCount%3 == 0 {
+				cpuCycles++
+			}
+			bus.Clock()
+		}
+
+		if mode == DMAAccurate && cpuCycles != 513 && cpuCycles != 514 {
+			t.Errorf("accurate DMA took %d CPU cycles, want 513 or 514", cpuCycles)
+		}
+		if mode == DMAInstant && cpuCycles != 0 {
+			t.Errorf("instant DMA took %d CPU cycles, want 0", cpuCycles)
+		}
+
+		for i := 0; i < 256; i++ {
+			if got := bus.Ppu.oam.read(byte(i)); got != byte(i) {
+				t.Fatalf("mode %d: OAM[%d] = %d, want %d", mode, i, got, i)
+			}
+		}
+	}
+}
+
+func TestDMATimingPAL(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+	bus.SetRegion(RegionPAL)
+
+	// PAL CPU cycles are not evenly spaced in PPU cycles, so bytes are only
+	// read and written alternately if DMA counts CPU cycles.
+	for start := 0; start < 16; start++ {
+		for i := 0; i < 256; i++ {
+			bus.Ram[0x0200+i] = byte(i + start)
+		}
+		bus.CpuWrite(0x4014, 0x02)
+
+		startCycles := bus.cpuClockCount
+		for bus.dmaTransfer {
+			bus.Clock()
+		}
+
+		if cpuCycles := bus.cpuClockCount - startCycles; cpuCycles != 513 && cpuCycles != 514 {
+			t.Errorf("start %d: DMA took %d CPU cycles, want 513 or 514", start, cpuCycles)
+		}
+		for i := 0; i < 256; i++ {
+			if got, want := bus.Ppu.oam.read(byte(i)), byte(i+start); got != want {
+				t.Fatalf("start %d: OAM[%d] = %d, want %d", start, i, got, want)
+			}
+		}
+
+		// Start the next transfer on a different PPU cycle.
+		bus.Clock()
+	}
+}
+
+func TestClockAlignment(t *testing.T) {
+	// Returns the clock count on which the CPU was first clocked.
+	firstCpuClock := func(bus *Bus) int {
+		bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+
+		cycles := bus.Cpu.Cycles
+		for i := 0; i < 3; i++ {
+			clock := bus.ClockCount
+			bus.Clock()
+			if bus.Cpu.Cycles != cycles {
+				return clock
+			}
+		}
+
+		return -1
+	}
+
+	for n := 0; n < 3; n++ {
+		bus := NewBus(false, false)
+		bus.SetClockAlignment(n)
+
+		if got := firstCpuClock(bus); got != n {
+			t.Errorf("alignment %d: CPU first clocked on cycle %d", n, got)
+		}
+	}
+
+	bus := NewBus(false, false)
+	bus.SetClockAlignment(ClockAlignmentRandom)
+	for i := 0; i < 10; i++ {
+		if got := firstCpuClock(bus); got < 0 || got > 2 {
+			t.Fatalf("random alignment: CPU first clocked on cycle %d", got)
+		}
+	}
+}
+
+func TestVideoPause(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.Disp = &Display{
+		gameRgba: image.NewRGBA(image.Rect(0, 0, int(nesResW), int(nesResH))),
+	}
+	bus.Ppu.ConnectDisplay(bus.Disp)
+
+	// The splash screen's backdrop.
+	bus.StepFrame()
+	before := bus.Disp.gameRgba.RGBAAt(0, 0)
+
+	bus.SetVideoPaused(true)
+	frames := bus.Ppu.frames
+	bus.Ppu.paletteTable[0x00] = 0x16
+	bus.StepFrame()
+
+	after := bus.Ppu.paletteRGBA[0x16]
+	if bus.Ppu.frames == frames {
+		t.Error("emulation stopped while video is paused")
+	}
+	if got := bus.Disp.gameRgba.RGBAAt(0, 0); got != after {
+		t.Errorf("PPU drew %v while video is paused, want %v", got, after)
+	}
+	if got := bus.Disp.shownFrame().RGBAAt(0, 0); got != before {
+		t.Errorf("paused video shows %v, want frozen %v", got, before)
+	}
+
+	bus.SetVideoPaused(false)
+	if got := bus.Disp.shownFrame().RGBAAt(0, 0); got != after {
+		t.Errorf("unpaused video shows %v, want %v", got, after)
+	}
+}
+
+func TestCpuOpenBus(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+	bus.Ram[0x0010] = 0x33
+
+	// Disabled: unmapped reads return 0.
+	bus.CpuWrite(0x0000, 0x5A)
+	if got := bus.CpuRead(0x4018); got != 0 {
+		t.Errorf("disabled: read $4018 = %#02x, want 0", got)
+	}
+
+	bus.SetOpenBusEmulation(true)
+
+	// The last write is on the bus.
+	bus.CpuWrite(0x0000, 0x5A)
+	if got := bus.CpuRead(0x4018); got != 0x5A {
+		t.Errorf("read $4018 after writing 0x5a = %#02x, want 0x5a", got)
+	}
+
+	// So is the last read.
+	bus.CpuRead(0x0010)
+	for _, addr := range []uint16{0x401F, 0x5000} {
+		if got := bus.CpuRead(addr); got != 0x33 {
+			t.Errorf("read $%04X after reading 0x33 = %#02x, want 0x33", addr, got)
+		}
+	}
+
+	// The controller ports leave the high 3 bits undriven.
+	bus.CpuWrite(0x0000, 0xE0)
+	bus.ControllerState[0] = 0x80
+	if got := bus.CpuRead(0x4016); got != 0xE1 {
+		t.Errorf("read $4016 = %#02x, want 0xe1", got)
+	}
+}
+
+func TestRAMSeed(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.SetRAMSeed(0x0022, 0x42)
+	bus.SetRAMSeed(0x0834, 0x99) // mirror of $0034
+	bus.SetRAMSeed(0x6000, 0xFF) // not RAM, ignored
+
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+	if got := bus.CpuRead(0x0022); got != 0x42 {
+		t.Errorf("after power cycle: $0022 = %#02x, want 0x42", got)
+	}
+	if got := bus.CpuRead(0x0034); got != 0x99 {
+		t.Errorf("after power cycle: $0034 = %#02x, want 0x99", got)
+	}
+	if got := bus.CpuRead(0x6000); got != 0 {
+		t.Errorf("after power cycle: $6000 = %#02x, want 0", got)
+	}
+
+	// Reset keeps RAM, except for the seeds.
+	bus.CpuWrite(0x0022, 0x00)
+	bus.CpuWrite(0x0023, 0x11)
+	bus.Reset()
+	if got := bus.CpuRead(0x0022); got != 0x42 {
+		t.Errorf("after reset: $0022 = %#02x, want 0x42", got)
+	}
+	if got := bus.CpuRead(0x0023); got != 0x11 {
+		t.Errorf("after reset: $0023 = %#02x, want 0x11", got)
+	}
+
+	bus.ClearRAMSeeds()
+	bus.CpuWrite(0x0022, 0x00)
+	bus.Reset()
+	if got := bus.CpuRead(0x0022); got != 0 {
+		t.Errorf("after clearing seeds: $0022 = %#02x, want 0", got)
+	}
+}
+
+// irqTestMapper is an NROM mapper with an IRQ line, acknowledged by any write
+// to the cartridge.
+type irqTestMapper struct {
+	Mapper000
+	asserted bool
+}
+
+func (m *irqTestMapper) CpuMapWrite(addr uint16, data byte) (uint32, bool) {
+	m.asserted = false
+	return 0, false
+}
+
+func (m *irqTestMapper) IrqState() bool { return m.asserted }
+func (m *irqTestMapper) IrqClear()      { m.asserted = false }
+
+func TestIRQ(t *testing.T) {
+	rom := newTestRom(1, 1, 0x00, 0x00)
+	prg := rom[16:]
+
+	// $8000: CLI, then loop forever.
+	copy(prg[0x0000:], []byte{0x58, 0x4C, 0x01, 0x80})
+	// $9000: INC $10, STA $8000 (acknowledge), RTI.
+	copy(prg[0x1000:], []byte{0xE6, 0x10, 0x8D, 0x00, 0x80, 0x40})
+	// Reset vector $8000, IRQ vector $9000.
+	copy(prg[0x3FFC:], []byte{0x00, 0x80, 0x00, 0x90})
+
+	bus := NewBus(false, false)
+	cart := newTestCartridge(t, rom)
+	mapper := &irqTestMapper{Mapper000: NewMapper000(1, 1)}
+	cart.mapper = mapper
+	bus.InsertCartridge(cart)
+
+	// Interrupts are disabled after reset, so the IRQ waits for CLI.
+	mapper.asserted = true
+	if bus.Cpu.IRQ(); bus.Cpu.Pc != 0x8000 {
+		t.Fatalf("IRQ taken with interrupts disabled, PC = %#04x", bus.Cpu.Pc)
+	}
+
+	for i := 0; i < 300; i++ {
+		bus.Clock()
+	}
+	if got := bus.Ram[0x10]; got != 1 {
+		t.Fatalf("IRQ handler ran %d times, want 1", got)
+	}
+	if mapper.asserted {
+		t.Fatal("IRQ not acknowledged")
+	}
+
+	// The status pushed has the break flag clear.
+	status := bus.Ram[0x0100|uint16(bus.Cpu.Sp-2)]
+	if status&byte(StatusFlagB) != 0 {
+		t.Errorf("pushed status = %08b, want break flag clear", status)
+	}
+
+	// RTI re-enabled interrupts, so the next IRQ is taken too.
+	mapper.asserted = true
+	for i := 0; i < 300; i++ {
+		bus.Clock()
+	}
+	if got := bus.Ram[0x10]; got != 2 {
+		t.Errorf("IRQ handler ran %d times, want 2", got)
+	}
+}
+
+func TestDumpMemory(t *testing.T) {
+	bus := NewBus(false, false)
+	cart := newBankedCartridge(t, 1, 8, 2)
+	bus.InsertCartridge(cart)
+	copy(bus.Ram[0x0300:], "Hello, NES!\x00\x01\x7F\xFF~")
+
+	want := "0300: 48 65 6C 6C 6F 2C 20 4E 45 53 21 00 01 7F FF 7E  Hello, NES!....~\n" +
+		"0310: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00  ................\n"
+	if got := bus.DumpMemory(0x0300, 2); got != want {
+		t.Errorf("RAM dump:\ngot\n%swant\n%s", got, want)
+	}
+
+	// Mirrored RAM shows the same bytes.
+	if got := bus.DumpMemory(0x0B00, 1); got[6:] != want[6:72] {
+		t.Errorf("mirrored RAM dump = %q, want %q", got[6:], want[6:72])
+	}
+
+	// I/O registers aren't read.
+	bus.Ppu.ppuStatus.setFlag(statusVBlank)
+	want = "1FF8: 00 00 00 00 00 00 00 00 -- -- -- -- -- -- -- --  ................\n"
+	if got := bus.DumpMemory(0x1FF8, 1); got != want {
+		t.Errorf("I/O dump = %q, want %q", got, want)
+	}
+	if bus.Ppu.ppuStatus.getFlag(statusVBlank) == 0 {
+		t.Error("dump cleared the PPU's vblank flag")
+	}
+
+	// Banked PRG ROM shows the bank switched in.
+	writeMMC1(cart, 0x8000, 0x0C)
+	writeMMC1(cart, 0xE000, 0x05)
+	want = "8000: 05 05 05 05 05 05 05 05 05 05 05 05 05 05 05 05  ................\n"
+	if got := bus.DumpMemory(0x8000, 1); got != want {
+		t.Errorf("PRG dump = %q, want %q", got, want)
+	}
+}
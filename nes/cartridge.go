@@ -1,11 +1,10 @@
 package nes
 
 import (
-	"bytes"
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io/ioutil"
-	"log"
 )
 
 // NES Cartridge. Connected to both main bus and PPU bus.
@@ -13,136 +12,339 @@ import (
 type Cartridge struct {
 	prgMem []byte // Program memory (PRG)
 	chrMem []byte // Character memory (CHR)
+	prgRam []byte // Program RAM (PRG-RAM) at 0x6000-0x7FFF
 
 	mapper Mapper // Cartridge mapper used to configure CPU/PPU read/write addresses.
 
-	mirroring MirrorMode
-}
+	mirroring         MirrorMode // Mirroring set by the header or mapper
+	forcedMirroring   MirrorMode // Mirroring used instead, if isMirroringForced
+	isMirroringForced bool
+
+	mapperId   byte   // iNES mapper number
+	isChrRam   bool   // CHR memory is RAM, not ROM
+	hasBattery bool   // Battery-backed PRG-RAM, saved to savePath
+	region     Region // TV system the game was made for
+	isVSSystem bool   // VS System arcade cartridge
+
+	hash uint32 // CRC32 of PRG and CHR memory, used to identify the game
 
-// iNES file header
-// reference: https://wiki.nesdev.com/w/index.php/INES
-type CartridgeHeader struct {
-	Name         [4]byte // Constant "NES" followed by MS-DOS end of file
-	PrgRomChunks byte    // Program memory size in 16KB chunks
-	ChrRomChunks byte    // Character memory size in 8KB chunks
-	Mapper1      byte    // Flags 6
-	Mapper2      byte    // Flags 7
-	PrgRamSize   byte    // Flags 8
-	TvSystem1    byte    // Flags 9
-	TvSystem2    byte    // Flags 10
-	Unused       [5]byte // Unused padding
+	savePath  string // File battery-backed PRG-RAM is saved to
+	saveDirty bool   // Battery-backed PRG-RAM changed since it was last saved
+	statePath string // Quick save slot files are named after this, see SetStatePath
 }
 
-// Creates a new NES Cartridge using the file at the given path.
-func NewCartridge(filepath string) *Cartridge {
-	// Load the NES file.
+// Creates a new NES Cartridge using the iNES file at the given path.
+func NewCartridgeFromFile(filepath string) (*Cartridge, error) {
 	data, err := ioutil.ReadFile(filepath)
 	if err != nil {
-		log.Fatalf("Unable to open %v\n%v\n", filepath, err)
+		return nil, fmt.Errorf("unable to open ROM: %w", err)
 	}
-	fmt.Printf("Header data: % x\n", data[:16])
-	buf := bytes.NewBuffer(data)
 
-	// Read/decode the NES header.
-	header := new(CartridgeHeader)
-	err = binary.Read(buf, binary.BigEndian, header)
+	cartridge, err := NewCartridgeFromBytes(data)
 	if err != nil {
-		log.Fatalf("Unable to parse header\n%v\n", err)
+		return nil, fmt.Errorf("%v: %w", filepath, err)
 	}
-	fmt.Printf("Parsed cartridge header: %+v\n", header)
+	cartridge.savePath = defaultSavePath(filepath)
+	cartridge.statePath = defaultStatePath(filepath)
 
-	// Check if trainer is used (bit 3 of mapper1 flags).
-	if (header.Mapper1 & (0x1 << 3)) > 0 {
-		// 512-byte trainer
-		// XXX: ignoring trainer data for now
-		err = binary.Read(buf, binary.BigEndian, make([]byte, 512))
-		if err != nil {
-			log.Fatalf("Unable to read trainer data\n%v\n", err)
+	// Many PAL ROMs only say so in their file name, with the header left at
+	// the NTSC default.
+	if cartridge.region == RegionNTSC {
+		if region, ok := regionFromFilename(filepath); ok {
+			cartridge.region = region
 		}
 	}
 
-	// TODO: determine iNES version (0/1/2)
+	return cartridge, nil
+}
 
-	cartridge := new(Cartridge)
+// Creates a new NES Cartridge from the contents of an iNES file.
+func NewCartridgeFromBytes(data []byte) (*Cartridge, error) {
+	header, err := ParseINesHeader(data)
+	if err != nil {
+		return nil, err
+	}
 
-	// Determine mapper ID from high 4 bits of mapper flags.
-	mapperLo := header.Mapper1 >> 4
-	mapperHi := header.Mapper2 >> 4
-	mapperId := (mapperHi << 4) | mapperLo
+	prgBanks, chrBanks, err := romBanks(header.PrgRomSize, header.ChrRomSize)
+	if err != nil {
+		return nil, err
+	}
+	if header.Mapper > 0xFF || NewMapper(byte(header.Mapper), prgBanks, chrBanks) == nil {
+		return nil, fmt.Errorf("unsupported mapper %d", header.Mapper)
+	}
 
-	// Set Mapper
-	var mapper Mapper
-	switch mapperId {
-	case 0:
-		mapper = NewMapper000(header.PrgRomChunks, header.ChrRomChunks)
-	}
-	if mapper == nil {
-		log.Fatal("No suitable mapper found for this ROM file.")
-	}
-	cartridge.mapper = mapper
-	fmt.Println("Mapper ID:", mapperId)
-	fmt.Println("Mapper:", mapper)
-
-	// Read/load PRG memory (16KB chunks).
-	cartridge.prgMem = make([]byte, 16*1024*int(header.PrgRomChunks))
-	fmt.Printf("PRG ROM size: %v\n", len(cartridge.prgMem))
-	err = binary.Read(buf, binary.BigEndian, cartridge.prgMem)
+	// The header is followed by the trainer, PRG ROM, CHR ROM, and
+	// PlayChoice INST-ROM (ignored).
+	trainerLen := 0
+	if header.HasTrainer {
+		trainerLen = trainerSize
+	}
+	trainer := data[inesHeaderSize : inesHeaderSize+trainerLen]
+	prgStart := inesHeaderSize + trainerLen
+	prg := make([]byte, header.PrgRomSize)
+	copy(prg, data[prgStart:])
+	chr := make([]byte, header.ChrRomSize)
+	copy(chr, data[prgStart+header.PrgRomSize:])
+
+	cartridge, err := NewCartridge(prg, chr, header.Mapper, header.Mirroring)
 	if err != nil {
-		log.Fatalf("Unable to read PRG memory\n%v\n", err)
+		return nil, err
+	}
+
+	// NES 2.0 headers may ask for more RAM than the usual 8KB.
+	if size := header.PrgRamSize + header.PrgNvramSize; size > len(cartridge.prgRam) {
+		cartridge.prgRam = make([]byte, size)
+	}
+	if size := header.ChrRamSize + header.ChrNvramSize; cartridge.isChrRam && size > len(cartridge.chrMem) {
+		cartridge.chrMem = make([]byte, size)
+	}
+
+	// 512-byte trainer, loaded to PRG-RAM at 0x7000-0x71FF.
+	copy(cartridge.prgRam[trainerAddr-prgRamMinAddr:], trainer)
+
+	cartridge.hasBattery = header.HasBattery
+	cartridge.region = header.Region
+	cartridge.isVSSystem = header.IsVSSystem
+
+	return cartridge, nil
+}
+
+// Creates a new NES Cartridge from PRG and CHR memory, without any file. PRG
+// memory is a multiple of 16KB, and CHR memory a multiple of 8KB. Empty CHR
+// memory gives the cartridge 8KB of CHR RAM instead. An error is returned for
+// other sizes, empty PRG memory, or a mapper that is not supported.
+func NewCartridge(prg, chr []byte, mapperID int, mirroring MirrorMode) (*Cartridge, error) {
+	cartridge := &Cartridge{
+		prgMem:    prg,
+		chrMem:    chr,
+		mirroring: mirroring,
+		mapperId:  byte(mapperID),
 	}
 
-	// Read/load CHR memory (8KB chunks).
-	cartridge.chrMem = make([]byte, 8*1024*int(header.ChrRomChunks))
-	fmt.Printf("CHR ROM size: %v\n", len(cartridge.chrMem))
-	err = binary.Read(buf, binary.BigEndian, cartridge.chrMem)
+	// PRG-RAM is always present. It is only saved if battery-backed.
+	cartridge.prgRam = make([]byte, prgRamSize)
+
+	// Games without CHR ROM have 8KB of CHR RAM instead.
+	if len(chr) == 0 {
+		cartridge.chrMem = make([]byte, chrRamSize)
+		cartridge.isChrRam = true
+	}
+
+	// Set Mapper
+	prgBanks, chrBanks, err := romBanks(len(prg), len(chr))
 	if err != nil {
-		log.Fatalf("Unable to read CHR memory\n%v\n", err)
+		return nil, err
+	}
+	if mapperID <= 0xFF {
+		cartridge.mapper = NewMapper(byte(mapperID), prgBanks, chrBanks)
+	}
+	if cartridge.mapper == nil {
+		return nil, fmt.Errorf("unsupported mapper %d", mapperID)
 	}
 
-	// TODO: determine and set mirroring mode
+	// Identify the game by its PRG and CHR memory, ignoring the header.
+	cartridge.hash = crc32.ChecksumIEEE(cartridge.prgMem)
+	if !cartridge.isChrRam {
+		cartridge.hash = crc32.Update(cartridge.hash, crc32.IEEETable, cartridge.chrMem)
+	}
 
-	// Determine if PlayChoice INST-ROM (bit 2 of mapper2 flags).
-	if (header.Mapper2 & (0x1 << 2)) > 0 {
-		// 8192-bytes
-		// XXX: ignoring INST-ROM data for now
-		err = binary.Read(buf, binary.BigEndian, make([]byte, 8192))
-		if err != nil {
-			log.Fatalf("Unable to read PlayChoice INST-ROM data\n%v\n", err)
-		}
+	return cartridge, nil
+}
+
+// romBanks returns the number of 16KB PRG ROM banks and 8KB CHR ROM banks in
+// PRG and CHR ROM of the given sizes in bytes. An error is returned if either
+// is not a whole number of banks, there is no PRG ROM, or either has more banks
+// than a mapper can hold.
+func romBanks(prgSize, chrSize int) (prgBanks, chrBanks byte, err error) {
+	const prgBankSize, chrBankSize = 16 * 1024, 8 * 1024
+
+	switch {
+	case prgSize == 0:
+		return 0, 0, errors.New("no PRG ROM")
+	case prgSize%prgBankSize != 0:
+		return 0, 0, fmt.Errorf("PRG ROM size %d is not a multiple of 16KB", prgSize)
+	case chrSize%chrBankSize != 0:
+		return 0, 0, fmt.Errorf("CHR ROM size %d is not a multiple of 8KB", chrSize)
+	case prgSize/prgBankSize > 0xFF:
+		return 0, 0, fmt.Errorf("PRG ROM too large: %d KB", prgSize/1024)
+	case chrSize/chrBankSize > 0xFF:
+		return 0, 0, fmt.Errorf("CHR ROM too large: %d KB", chrSize/1024)
+	}
+
+	return byte(prgSize / prgBankSize), byte(chrSize / chrBankSize), nil
+}
+
+const (
+	// PRG-RAM
+	prgRamSize = 8 * 1024
+
+	// CHR-RAM, used when the cartridge has no CHR ROM
+	chrRamSize = 8 * 1024
+
+	// Trainer
+	trainerAddr uint16 = 0x7000
+	trainerSize        = 512
+)
+
+// CartInfo describes a loaded ROM.
+type CartInfo struct {
+	MapperID   int
+	MapperName string
+	PrgRomSize int // Bytes
+	ChrSize    int // Bytes, of either CHR ROM or CHR RAM
+	IsChrRam   bool
+	Mirroring  MirrorMode
+	HasBattery bool
+	Region     Region
+}
+
+// Info returns the mapper and features used by the cartridge.
+func (c *Cartridge) Info() CartInfo {
+	return CartInfo{
+		MapperID:   int(c.mapperId),
+		MapperName: mapperName(c.mapperId),
+		PrgRomSize: len(c.prgMem),
+		ChrSize:    len(c.chrMem),
+		IsChrRam:   c.isChrRam,
+		Mirroring:  c.mirroring,
+		HasBattery: c.hasBattery,
+		Region:     c.region,
+	}
+}
+
+// Hash returns the CRC32 of the cartridge's PRG and CHR memory.
+func (c *Cartridge) Hash() uint32 {
+	return c.hash
+}
+
+// SetMirroring forces the nametable mirroring mode, ignoring the mode set by
+// the header or mapper until RestoreMirroring is called.
+func (c *Cartridge) SetMirroring(mode MirrorMode) {
+	c.forcedMirroring = mode
+	c.isMirroringForced = true
+}
+
+// RestoreMirroring hands nametable mirroring back to the header or mapper.
+func (c *Cartridge) RestoreMirroring() {
+	c.isMirroringForced = false
+}
+
+// Mirroring returns the nametable mirroring mode currently in use. Four-screen
+// cartridges wire their extra VRAM in directly, so mappers can't change it.
+func (c *Cartridge) Mirroring() MirrorMode {
+	if c.isMirroringForced {
+		return c.forcedMirroring
+	}
+	if c.mirroring == MirrorFourScreen {
+		return c.mirroring
+	}
+	if m, ok := c.mapper.(mirroringMapper); ok {
+		return m.Mirroring()
+	}
+	return c.mirroring
+}
+
+// countScanline tells the mapper the PPU rendered a scanline.
+func (c *Cartridge) countScanline() {
+	if m, ok := c.mapper.(scanlineMapper); ok {
+		m.countScanline()
 	}
+}
 
-	return cartridge
+// irqState returns whether the mapper is requesting an IRQ.
+func (c *Cartridge) irqState() bool {
+	if m, ok := c.mapper.(irqMapper); ok {
+		return m.IrqState()
+	}
+	return false
 }
 
 // Communicate with main (CPU) bus.
 func (c *Cartridge) cpuRead(addr uint16) byte {
-	mappedAddr := c.mapper.cpuMapRead(addr)
+	if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		return c.prgRam[addr-prgRamMinAddr]
+	}
 
-	return c.prgMem[mappedAddr]
+	if mappedAddr, ok := c.mapper.CpuMapRead(addr); ok {
+		return c.prgMem[mappedAddr]
+	}
+
+	return 0
 }
 
 func (c *Cartridge) cpuWrite(addr uint16, data byte) {
-	mappedAddr := c.mapper.cpuMapWrite(addr)
-	c.prgMem[mappedAddr] = data
+	if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		if c.hasBattery && c.prgRam[addr-prgRamMinAddr] != data {
+			c.saveDirty = true
+		}
+		c.prgRam[addr-prgRamMinAddr] = data
+		return
+	}
+
+	if m, ok := c.mapper.(busConflictMapper); ok && m.busConflicts() {
+		data &= c.cpuRead(addr)
+	}
+
+	if mappedAddr, ok := c.mapper.CpuMapWrite(addr, data); ok {
+		c.prgMem[mappedAddr] = data
+	}
 }
 
 // Communicate with PPU bus.
 func (c *Cartridge) ppuRead(addr uint16) byte {
-	mappedAddr := c.mapper.ppuMapRead(addr)
+	if mappedAddr, ok := c.mapper.PpuMapRead(addr); ok {
+		return c.chrMem[mappedAddr]
+	}
 
-	return c.chrMem[mappedAddr]
+	return 0
 }
 
 func (c *Cartridge) ppuWrite(addr uint16, data byte) {
-	mappedAddr := c.mapper.ppuMapWrite(addr)
-	c.chrMem[mappedAddr] = data
+	if mappedAddr, ok := c.mapper.PpuMapWrite(addr); ok {
+		c.chrMem[mappedAddr] = data
+	}
 }
 
 type MirrorMode int
 
 const (
-	mirrorHorizontal MirrorMode = iota
-	mirrorVertical
-	mirrorOnescreenLo
-	mirrorOnescreenHi
+	MirrorHorizontal MirrorMode = iota
+	MirrorVertical
+	MirrorOnescreenLo
+	MirrorOnescreenHi
+	MirrorFourScreen
 )
+
+func (m MirrorMode) String() string {
+	switch m {
+	case MirrorHorizontal:
+		return "horizontal"
+	case MirrorVertical:
+		return "vertical"
+	case MirrorOnescreenLo:
+		return "single-screen (low)"
+	case MirrorOnescreenHi:
+		return "single-screen (high)"
+	case MirrorFourScreen:
+		return "four-screen"
+	}
+	return fmt.Sprintf("MirrorMode(%d)", int(m))
+}
+
+// Region is the TV system a game was made for.
+type Region int
+
+const (
+	RegionNTSC Region = iota
+	RegionPAL
+)
+
+func (r Region) String() string {
+	switch r {
+	case RegionNTSC:
+		return "NTSC"
+	case RegionPAL:
+		return "PAL"
+	}
+	return fmt.Sprintf("Region(%d)", int(r))
+}
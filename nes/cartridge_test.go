@@ -1,12 +1,173 @@
 package nes
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
-//const testRom = "../roms/LegendOfZelda.nes"
-const testRom = "../roms/DK.nes"
+//const testRom = "./roms/LegendOfZelda.nes"
+const testRom = "./roms/DK.nes"
+
+func TestNewCartridgeFromFile(t *testing.T) {
+	if _, err := os.Stat(testRom); err != nil {
+		t.Skipf("test ROM not found: %v", testRom)
+	}
+
+	if _, err := NewCartridgeFromFile(testRom); err != nil {
+		t.Fatal(err)
+	}
+}
 
 func TestNewCartridge(t *testing.T) {
-	_ = NewCartridge(testRom)
+	prg := make([]byte, 16*1024)
+	prg[0x0000] = 0xEA
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0x80
+
+	// CHR RAM
+	cart, err := NewCartridge(prg, nil, 0, MirrorVertical)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 16KB of PRG memory is mirrored.
+	if got := cart.cpuRead(0xC000); got != 0xEA {
+		t.Errorf("read $C000 = %#02x, want 0xea", got)
+	}
+	if got := cart.cpuRead(0xFFFD); got != 0x80 {
+		t.Errorf("read $FFFD = %#02x, want 0x80", got)
+	}
+
+	cart.ppuWrite(0x1FFF, 0x42)
+	if got := cart.ppuRead(0x1FFF); got != 0x42 {
+		t.Errorf("CHR RAM read $1FFF = %#02x, want 0x42", got)
+	}
+
+	want := CartInfo{
+		MapperID:   0,
+		MapperName: "NROM",
+		PrgRomSize: 16 * 1024,
+		ChrSize:    8 * 1024,
+		IsChrRam:   true,
+		Mirroring:  MirrorVertical,
+	}
+	if info := cart.Info(); info != want {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+}
+
+func TestNewCartridgeUnsupportedMapper(t *testing.T) {
+	for _, id := range []int{0xFF, 0x100} {
+		if cart, err := NewCartridge(make([]byte, 16*1024), nil, id, MirrorVertical); err == nil || cart != nil {
+			t.Errorf("mapper %d: got %v, %v, want an error", id, cart, err)
+		}
+	}
+}
+
+func TestNewCartridgeRomSizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		prg, chr int
+	}{
+		{"no PRG", 0, 8 * 1024},
+		{"1KB PRG", 1024, 8 * 1024},
+		{"24KB PRG", 24 * 1024, 8 * 1024},
+		{"4KB CHR", 16 * 1024, 4 * 1024},
+		{"12KB CHR", 16 * 1024, 12 * 1024},
+	}
+
+	for _, tt := range tests {
+		cart, err := NewCartridge(make([]byte, tt.prg), make([]byte, tt.chr), 0, MirrorVertical)
+		if err == nil || cart != nil {
+			t.Errorf("%s: got %v, %v, want an error", tt.name, cart, err)
+		}
+	}
+}
+
+func TestNewCartridgeFromBytesRomSizes(t *testing.T) {
+	// NES 2.0 sizes that are not a whole number of banks, or too many banks.
+	nes2 := func(prgLsb, chrLsb, msb byte) []byte {
+		rom := newTestRom(prgLsb, chrLsb, 0x00, 0x08)
+		rom[9] = msb
+		return append(rom, make([]byte, 0x100*16*1024+0x100*8*1024)...)
+	}
+
+	tests := map[string][]byte{
+		"1KB PRG":     nes2(0x28, 0x00, 0x0F), // 2^10 bytes
+		"24KB PRG":    nes2(0x35, 0x00, 0x0F), // 2^13 * 3 bytes
+		"4KB CHR":     nes2(0x01, 0x30, 0xF0), // 2^12 bytes
+		"4MB PRG":     nes2(0x00, 0x00, 0x01), // 0x100 x 16KB
+		"2MB CHR":     nes2(0x01, 0x00, 0x10), // 0x100 x 8KB
+		"4MB PRG exp": nes2(0x58, 0x00, 0x0F), // 2^22 bytes
+	}
+
+	for name, rom := range tests {
+		if cart, err := NewCartridgeFromBytes(rom); err == nil || cart != nil {
+			t.Errorf("%s: got %v, %v, want an error", name, cart, err)
+		}
+	}
+
+	// The largest sizes the mappers can hold.
+	cart, err := NewCartridgeFromBytes(nes2(0xFF, 0xFF, 0x00))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := cart.Info(); info.PrgRomSize != 0xFF*16*1024 || info.ChrSize != 0xFF*8*1024 {
+		t.Errorf("PRG ROM %d bytes, CHR %d bytes", info.PrgRomSize, info.ChrSize)
+	}
+}
+
+func TestCartridgeTrainer(t *testing.T) {
+	trainer := make([]byte, trainerSize)
+	for i := range trainer {
+		trainer[i] = byte(i)
+	}
+
+	// Header, 512-byte trainer, then PRG and CHR memory.
+	rom := newTestRom(1, 1, 0x04, 0x00)
+	rom = append(rom[:16], append(trainer, rom[16:]...)...)
+	rom[16+len(trainer)] = 0xEA // first byte of PRG memory
+
+	path := filepath.Join(t.TempDir(), "trainer.nes")
+	if err := os.WriteFile(path, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cart, err := NewCartridgeFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range trainer {
+		addr := trainerAddr + uint16(i)
+		if got := cart.cpuRead(addr); got != want {
+			t.Fatalf("trainer byte at %#04X: got %#02X, want %#02X\n", addr, got, want)
+		}
+	}
+
+	if got := cart.cpuRead(0x8000); got != 0xEA {
+		t.Errorf("PRG memory after trainer: got %#02X, want %#02X\n", got, 0xEA)
+	}
+}
+
+func TestCartridgeInfo(t *testing.T) {
+	// NROM, vertical mirroring, battery, CHR RAM, PAL.
+	rom := newTestRom(2, 0, 0x03, 0x00)
+	rom[9] = 0x01
+
+	info := newTestCartridge(t, rom).Info()
+
+	want := CartInfo{
+		MapperID:   0,
+		MapperName: "NROM",
+		PrgRomSize: 32 * 1024,
+		ChrSize:    8 * 1024,
+		IsChrRam:   true,
+		Mirroring:  MirrorVertical,
+		HasBattery: true,
+		Region:     RegionPAL,
+	}
+	if info != want {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
 }
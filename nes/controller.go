@@ -6,26 +6,30 @@ import (
 
 type Controller struct {
 	buttonState []bool // Key press state: on/off
+
+	keyBindings map[Button]pixelgl.Button // Keyboard key for each button
+
+	// Gamepad input
+	gamepad          pixelgl.Joystick                 // Joystick read, if gamepadEnabled
+	gamepadEnabled   bool                             // Read buttons from the gamepad
+	gamepadConnected bool                             // Whether the gamepad was connected last frame
+	gamepadBindings  map[Button]pixelgl.GamepadButton // Gamepad button for each button
 }
 
 func NewController() *Controller {
+	gamepadBindings := make(map[Button]pixelgl.GamepadButton)
+	for b, button := range defaultGamepadBindings {
+		gamepadBindings[b] = button
+	}
+
 	return &Controller{
-		buttonState: make([]bool, len(controllerKeys)),
+		buttonState:     make([]bool, buttonCount),
+		keyBindings:     make(map[Button]pixelgl.Button),
+		gamepadBindings: gamepadBindings,
 	}
 }
 
-// Available NES controller buttons and their keyboard binds
-// Keyboard binds:
-/*
-	0: Right  ---> D
-	1: Left   ---> A
-	2: Down   ---> S
-	3: Up     ---> W
-	4: Start  ---> Enter
-	5: Select ---> Right Shift
-	6: B      ---> K
-	7: A      ---> J
-*/
+// Available NES controller buttons, in the order of their bits in GetState.
 const (
 	keyRight int = iota
 	keyLeft
@@ -35,18 +39,35 @@ const (
 	keySelect
 	keyB
 	keyA
+
+	buttonCount
+)
+
+// Button is a button on the NES controller.
+type Button int
+
+// NES controller buttons, usable with Controller.SetButton.
+const (
+	ButtonRight  = Button(keyRight)
+	ButtonLeft   = Button(keyLeft)
+	ButtonDown   = Button(keyDown)
+	ButtonUp     = Button(keyUp)
+	ButtonStart  = Button(keyStart)
+	ButtonSelect = Button(keySelect)
+	ButtonB      = Button(keyB)
+	ButtonA      = Button(keyA)
 )
 
-// TODO: add 2nd controller keys
-var controllerKeys = map[int]pixelgl.Button{
-	keyRight:  pixelgl.KeyD,
-	keyLeft:   pixelgl.KeyA,
-	keyDown:   pixelgl.KeyS,
-	keyUp:     pixelgl.KeyW,
-	keyStart:  pixelgl.KeyEnter,
-	keySelect: pixelgl.KeyRightShift,
-	keyB:      pixelgl.KeyK,
-	keyA:      pixelgl.KeyJ,
+// Keyboard keys bound to controller 1 by default.
+var defaultKeyBindings = map[Button]pixelgl.Button{
+	ButtonRight:  pixelgl.KeyRight,
+	ButtonLeft:   pixelgl.KeyLeft,
+	ButtonDown:   pixelgl.KeyDown,
+	ButtonUp:     pixelgl.KeyUp,
+	ButtonStart:  pixelgl.KeyEnter,
+	ButtonSelect: pixelgl.KeyRightShift,
+	ButtonB:      pixelgl.KeyZ,
+	ButtonA:      pixelgl.KeyX,
 }
 
 // GetState returns a byte, with each bit representing the state of a button on
@@ -63,17 +84,56 @@ func (c *Controller) GetState() byte {
 	return state
 }
 
+// SetButton presses or releases a button directly, without keyboard input.
+// Values that are not one of the Button constants are ignored.
+func (c *Controller) SetButton(b Button, pressed bool) {
+	if b < 0 || int(b) >= len(c.buttonState) {
+		return
+	}
+	c.buttonState[b] = pressed
+}
+
+// SetKeyBinding binds a keyboard key to a button, replacing the button's
+// current key. Controller 1 starts with the arrow keys, Z (B), X (A), Enter
+// (Start), and Right Shift (Select). Controller 2 starts with no keys.
+func (c *Controller) SetKeyBinding(b Button, key pixelgl.Button) {
+	c.keyBindings[b] = key
+}
+
+// Bind the default keys to the controller's buttons, and read Joystick1 as its
+// gamepad. Used for controller 1.
+func (c *Controller) useDefaultInput() {
+	for b, key := range defaultKeyBindings {
+		c.keyBindings[b] = key
+	}
+	c.SetGamepad(pixelgl.Joystick1)
+}
+
+// Release all buttons.
+func (c *Controller) releaseAll() {
+	for i := range c.buttonState {
+		c.buttonState[i] = false
+	}
+}
+
+// Press each button whose key is held down on the keyboard or gamepad, and
+// release the others. Without a gamepad connected, buttons without a key are
+// left as they are.
 func (c *Controller) updateControllerInput(win *pixelgl.Window) {
-	// Key down
-	for idx, key := range controllerKeys {
-		if win.JustPressed(key) {
-			c.buttonState[idx] = true
+	gamepad := c.pollGamepad(win)
+
+	for i := range c.buttonState {
+		b := Button(i)
+
+		key, hasKey := c.keyBindings[b]
+		if !hasKey && !gamepad {
+			continue
 		}
-	}
-	// Key up
-	for idx, key := range controllerKeys {
-		if win.JustReleased(key) {
-			c.buttonState[idx] = false
+
+		pressed := hasKey && win.Pressed(key)
+		if gamepad && !pressed {
+			pressed = c.gamepadPressed(win, b)
 		}
+		c.buttonState[b] = pressed
 	}
 }
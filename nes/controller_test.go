@@ -0,0 +1,206 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/faiface/pixel/pixelgl"
+)
+
+func TestControllerStrobe(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+
+	bus.Controller[0].SetButton(ButtonA, true)
+	bus.Controller[0].SetButton(ButtonStart, true)
+	bus.Controller[0].SetButton(ButtonLeft, true)
+	bus.Controller[1].SetButton(ButtonB, true)
+
+	// Buttons are read in the order A, B, Select, Start, Up, Down, Left, Right,
+	// followed by 1s.
+	bus.CpuWrite(0x4016, 0x01)
+	bus.CpuWrite(0x4016, 0x00)
+
+	read := func(addr uint16, n int) []byte {
+		bits := make([]byte, n)
+		for i := range bits {
+			bits[i] = bus.CpuRead(addr) & 0x01
+		}
+		return bits
+	}
+
+	tests := []struct {
+		addr uint16
+		want []byte
+	}{
+		{0x4016, []byte{1, 0, 0, 1, 0, 0, 1, 0, 1, 1}},
+		{0x4017, []byte{0, 1, 0, 0, 0, 0, 0, 0, 1, 1}},
+	}
+	for _, test := range tests {
+		got := read(test.addr, len(test.want))
+		for i := range test.want {
+			if got[i] != test.want[i] {
+				t.Errorf("$%04X reads %v, want %v", test.addr, got, test.want)
+				break
+			}
+		}
+	}
+
+	// Buttons pressed after the strobe aren't seen until the next strobe.
+	bus.Controller[0].SetButton(ButtonB, true)
+	bus.CpuWrite(0x4016, 0x00)
+	if got := read(0x4016, 1)[0]; got != 1 {
+		t.Errorf("read %d after the buttons ran out, want 1", got)
+	}
+
+	// While the strobe is high, every read returns A.
+	bus.CpuWrite(0x4016, 0x01)
+	for i, got := range read(0x4016, 4) {
+		if got != 1 {
+			t.Errorf("read %d = %d with strobe high, want A (1)", i, got)
+		}
+	}
+	bus.Controller[0].SetButton(ButtonA, false)
+	if got := read(0x4016, 1)[0]; got != 0 {
+		t.Errorf("read %d with strobe high after releasing A, want 0", got)
+	}
+
+	// Writes to $4017 don't latch the controllers.
+	bus.CpuWrite(0x4016, 0x00)
+	read(0x4016, 8)
+	bus.CpuWrite(0x4017, 0x01)
+	if got := read(0x4016, 1)[0]; got != 1 {
+		t.Errorf("read %d after writing $4017, want 1", got)
+	}
+}
+
+func TestSetButtonOutOfRange(t *testing.T) {
+	c := NewController()
+	c.SetButton(ButtonA, true)
+
+	// Not buttons: ignored, without changing the state.
+	for _, b := range []Button{-1, Button(buttonCount), 100} {
+		c.SetButton(b, true)
+	}
+	if got, want := c.GetState(), byte(1<<ButtonA); got != want {
+		t.Errorf("state = %08b, want %08b", got, want)
+	}
+}
+
+func TestKeyBindings(t *testing.T) {
+	bus := NewBus(false, false)
+
+	// Controller 1 has the default keys, controller 2 has none.
+	if got := bus.Controller[0].keyBindings[ButtonA]; got != pixelgl.KeyX {
+		t.Errorf("controller 1 A bound to %v, want X", got)
+	}
+	if got := len(bus.Controller[0].keyBindings); got != 8 {
+		t.Errorf("controller 1 has %d keys bound, want 8", got)
+	}
+	if got := len(bus.Controller[1].keyBindings); got != 0 {
+		t.Errorf("controller 2 has %d keys bound, want 0", got)
+	}
+
+	// Rebinding replaces the button's key.
+	bus.Controller[0].SetKeyBinding(ButtonA, pixelgl.KeySpace)
+	if got := bus.Controller[0].keyBindings[ButtonA]; got != pixelgl.KeySpace {
+		t.Errorf("A bound to %v after rebinding, want Space", got)
+	}
+	if got := defaultKeyBindings[ButtonA]; got != pixelgl.KeyX {
+		t.Errorf("rebinding changed the default A key to %v", got)
+	}
+}
+
+func TestGamepadBindings(t *testing.T) {
+	bus := NewBus(false, false)
+
+	// Controller 1 reads the first joystick.
+	if c := bus.Controller[0]; !c.gamepadEnabled || c.gamepad != pixelgl.Joystick1 {
+		t.Errorf("controller 1 gamepad = %v, %v, want Joystick1", c.gamepad, c.gamepadEnabled)
+	}
+	if bus.Controller[1].gamepadEnabled {
+		t.Error("controller 2 reads a gamepad by default")
+	}
+
+	bus.Controller[1].SetGamepad(pixelgl.Joystick2)
+	if c := bus.Controller[1]; !c.gamepadEnabled || c.gamepad != pixelgl.Joystick2 {
+		t.Errorf("controller 2 gamepad = %v, %v, want Joystick2", c.gamepad, c.gamepadEnabled)
+	}
+
+	// Rebinding one controller leaves the other and the defaults alone.
+	bus.Controller[0].SetGamepadBinding(ButtonA, pixelgl.ButtonX)
+	if got := bus.Controller[0].gamepadBindings[ButtonA]; got != pixelgl.ButtonX {
+		t.Errorf("controller 1 A bound to %v, want X", got)
+	}
+	if got := bus.Controller[1].gamepadBindings[ButtonA]; got != pixelgl.ButtonB {
+		t.Errorf("controller 2 A bound to %v, want B", got)
+	}
+	if got := defaultGamepadBindings[ButtonA]; got != pixelgl.ButtonB {
+		t.Errorf("rebinding changed the default A button to %v", got)
+	}
+}
+
+func TestDMCControllerConflict(t *testing.T) {
+	rom := newTestRom(1, 1, 0x00, 0x00)
+	prg := rom[16 : 16+16*1024]
+	for i := 0; i < 8; i++ {
+		copy(prg[i*3:], []byte{0xAD, 0x16, 0x40}) // LDA $4016
+	}
+	// Reset vector: $C000
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0xC0
+
+	// Reads the controller 4 times, with DMC DMA landing on the read cycle of
+	// the first.
+	readButtons := func(conflict, correction bool) []byte {
+		bus := NewBus(false, false)
+		bus.InsertCartridge(newTestCartridge(t, rom))
+		bus.SetDMCConflict(conflict)
+		bus.SetDMCReadCorrection(correction)
+
+		bus.Controller[0].SetButton(ButtonA, true)
+		bus.Controller[0].SetButton(ButtonSelect, true)
+		bus.latchControllers()
+
+		// Finish the reset sequence.
+		for bus.Cpu.Cycles > 0 {
+			bus.Clock()
+		}
+
+		bits := make([]byte, 4)
+		for i := range bits {
+			// Start the instruction, and run to its last cycle.
+			for bus.Cpu.Cycles == 0 {
+				bus.Clock()
+			}
+			for bus.Cpu.Cycles > 1 {
+				bus.Clock()
+			}
+
+			if i == 0 {
+				// Request a sample byte.
+				bus.Apu.dmc.bytesRemaining = 1
+				bus.Apu.dmc.bufferFull = false
+			}
+
+			for bus.Cpu.Cycles > 0 {
+				bus.Clock()
+			}
+			bits[i] = bus.Cpu.A & 0x01
+		}
+		return bits
+	}
+
+	// A, B, Select, Start
+	if got, want := readButtons(false, false), []byte{1, 0, 1, 0}; string(got) != string(want) {
+		t.Errorf("without conflict: buttons = %v, want %v", got, want)
+	}
+
+	// B is skipped.
+	if got, want := readButtons(true, false), []byte{1, 1, 0, 0}; string(got) != string(want) {
+		t.Errorf("with conflict: buttons = %v, want %v", got, want)
+	}
+
+	// Corrected, B is read again.
+	if got, want := readButtons(true, true), []byte{1, 0, 1, 0}; string(got) != string(want) {
+		t.Errorf("with correction: buttons = %v, want %v", got, want)
+	}
+}
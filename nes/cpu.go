@@ -3,9 +3,8 @@ package nes
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log"
-	"os"
-	"time"
 )
 
 type Cpu6502 struct {
@@ -26,12 +25,15 @@ type Cpu6502 struct {
 	Fetched       byte   // Byte of memory used by CPU instructions
 	CycleCount    uint32 // Total # of cycles executed by the CPU
 	isImpliedAddr bool   // Whether the current instruction's address mode is implied
+	addrPartial   uint16 // Indexed address before carrying into the high byte
 
-	// Used for printing disassembly in debug mode
+	// Result of the last call to Disassemble
 	Disassembly map[uint16]string
 
-	PrevInstructions [15]string
-	PrevInstIdx      int
+	// Recently executed instructions, used for crash reports
+	trace      [crashTraceLen]traceEntry
+	traceIdx   int
+	traceCount int
 
 	InstLookup [16 * 16]Instruction // Instruction operation lookup
 
@@ -40,13 +42,25 @@ type Cpu6502 struct {
 	Logger *log.Logger // CPU logging
 	state  string      // CPU register state
 	prevPc uint16      // Previous program counter
+
+	traceWriter io.Writer // Nintendulator format trace of every instruction, nil if disabled
+
+	// Last bus access, where DMC DMA halts the CPU
+	lastAccessAddr uint16
+	lastAccessRead bool
+
+	// Debugging
+	breakpoints    map[uint16]bool
+	watchpoints    map[uint16]Watchpoint
+	breakReason    string // Why emulation should stop, if a breakpoint or watchpoint was hit
+	skipBreakpoint bool   // Run the instruction at Pc, which was already stopped at
 }
 
 const (
 	stackBase uint16 = 0x0100
 )
 
-func NewCpu6502(isLogging bool) *Cpu6502 {
+func NewCpu6502() *Cpu6502 {
 	cpu := &Cpu6502{
 		Pc:     0x0000,
 		Sp:     0xFD,
@@ -64,53 +78,41 @@ func NewCpu6502(isLogging bool) *Cpu6502 {
 		CycleCount:    0,
 	}
 
-	// Create log file.
-	if isLogging {
-		now := time.Now()
-		logFile := fmt.Sprintf("./logs/cpu%s.log", now.Format("20060102-150405"))
-		f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE, 0664)
-		if err != nil {
-			log.Fatal("Unable to create CPU log file...\n", err)
-		}
-
-		cpu.Logger = log.New(f, "", 0)
-	}
-
 	// Create the lookup table containing all the CPU instructions.
 	// Reference: http://archive.6502.org/datasheets/rockwell_r650x_r651x.pdf
 	//            http://www.oxyron.de/html/opcodes02.html
 	cpu.InstLookup = [16 * 16]Instruction{
-		{"BRK", cpu.opBRK, IMP, 7}, {"ORA", cpu.opORA, IZX, 6}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"NOP", cpu.opNOP, ZP0, 3}, {"ORA", cpu.opORA, ZP0, 3}, {"ASL", cpu.opASL, ZP0, 5}, {"XXX", cpu.opXXX, IMP, 5}, {"PHP", cpu.opPHP, IMP, 3}, {"ORA", cpu.opORA, IMM, 2}, {"ASL", cpu.opASL, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"NOP", cpu.opNOP, ABS, 4}, {"ORA", cpu.opORA, ABS, 4}, {"ASL", cpu.opASL, ABS, 6}, {"XXX", cpu.opXXX, IMP, 6},
+		{"BRK", cpu.opBRK, IMP, 7}, {"ORA", cpu.opORA, IZX, 6}, {"XXX", cpu.opXXX, IMP, 2}, {"SLO", cpu.opSLO, IZX, 8}, {"NOP", cpu.opNOP, ZP0, 3}, {"ORA", cpu.opORA, ZP0, 3}, {"ASL", cpu.opASL, ZP0, 5}, {"SLO", cpu.opSLO, ZP0, 5}, {"PHP", cpu.opPHP, IMP, 3}, {"ORA", cpu.opORA, IMM, 2}, {"ASL", cpu.opASL, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"NOP", cpu.opNOP, ABS, 4}, {"ORA", cpu.opORA, ABS, 4}, {"ASL", cpu.opASL, ABS, 6}, {"SLO", cpu.opSLO, ABS, 6},
 
-		{"BPL", cpu.opBPL, REL, 2}, {"ORA", cpu.opORA, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"ORA", cpu.opORA, ZPX, 4}, {"ASL", cpu.opASL, ZPX, 6}, {"XXX", cpu.opXXX, IMP, 6}, {"CLC", cpu.opCLC, IMP, 2}, {"ORA", cpu.opORA, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"XXX", cpu.opXXX, IMP, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"ORA", cpu.opORA, ABX, 4}, {"ASL", cpu.opASL, ABX, 7}, {"XXX", cpu.opXXX, IMP, 7},
+		{"BPL", cpu.opBPL, REL, 2}, {"ORA", cpu.opORA, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"SLO", cpu.opSLO, IZY, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"ORA", cpu.opORA, ZPX, 4}, {"ASL", cpu.opASL, ZPX, 6}, {"SLO", cpu.opSLO, ZPX, 6}, {"CLC", cpu.opCLC, IMP, 2}, {"ORA", cpu.opORA, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"SLO", cpu.opSLO, ABY, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"ORA", cpu.opORA, ABX, 4}, {"ASL", cpu.opASL, ABX, 7}, {"SLO", cpu.opSLO, ABX, 7},
 
-		{"JSR", cpu.opJSR, ABS, 6}, {"AND", cpu.opAND, IZX, 6}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"BIT", cpu.opBIT, ZP0, 3}, {"AND", cpu.opAND, ZP0, 3}, {"ROL", cpu.opROL, ZP0, 5}, {"XXX", cpu.opXXX, IMP, 5}, {"PLP", cpu.opPLP, IMP, 4}, {"AND", cpu.opAND, IMM, 2}, {"ROL", cpu.opROL, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"BIT", cpu.opBIT, ABS, 4}, {"AND", cpu.opAND, ABS, 4}, {"ROL", cpu.opROL, ABS, 6}, {"XXX", cpu.opXXX, IMP, 6},
+		{"JSR", cpu.opJSR, ABS, 6}, {"AND", cpu.opAND, IZX, 6}, {"XXX", cpu.opXXX, IMP, 2}, {"RLA", cpu.opRLA, IZX, 8}, {"BIT", cpu.opBIT, ZP0, 3}, {"AND", cpu.opAND, ZP0, 3}, {"ROL", cpu.opROL, ZP0, 5}, {"RLA", cpu.opRLA, ZP0, 5}, {"PLP", cpu.opPLP, IMP, 4}, {"AND", cpu.opAND, IMM, 2}, {"ROL", cpu.opROL, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"BIT", cpu.opBIT, ABS, 4}, {"AND", cpu.opAND, ABS, 4}, {"ROL", cpu.opROL, ABS, 6}, {"RLA", cpu.opRLA, ABS, 6},
 
-		{"BMI", cpu.opBMI, REL, 2}, {"AND", cpu.opAND, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"AND", cpu.opAND, ZPX, 4}, {"ROL", cpu.opROL, ZPX, 6}, {"XXX", cpu.opXXX, IMP, 6}, {"SEC", cpu.opSEC, IMP, 2}, {"AND", cpu.opAND, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"XXX", cpu.opXXX, IMP, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"AND", cpu.opAND, ABX, 4}, {"ROL", cpu.opROL, ABX, 7}, {"XXX", cpu.opXXX, IMP, 7},
+		{"BMI", cpu.opBMI, REL, 2}, {"AND", cpu.opAND, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"RLA", cpu.opRLA, IZY, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"AND", cpu.opAND, ZPX, 4}, {"ROL", cpu.opROL, ZPX, 6}, {"RLA", cpu.opRLA, ZPX, 6}, {"SEC", cpu.opSEC, IMP, 2}, {"AND", cpu.opAND, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"RLA", cpu.opRLA, ABY, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"AND", cpu.opAND, ABX, 4}, {"ROL", cpu.opROL, ABX, 7}, {"RLA", cpu.opRLA, ABX, 7},
 
-		{"RTI", cpu.opRTI, IMP, 6}, {"EOR", cpu.opEOR, IZX, 6}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"NOP", cpu.opNOP, ZP0, 3}, {"EOR", cpu.opEOR, ZP0, 3}, {"LSR", cpu.opLSR, ZP0, 5}, {"XXX", cpu.opXXX, IMP, 5}, {"PHA", cpu.opPHA, IMP, 3}, {"EOR", cpu.opEOR, IMM, 2}, {"LSR", cpu.opLSR, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"JMP", cpu.opJMP, ABS, 3}, {"EOR", cpu.opEOR, ABS, 4}, {"LSR", cpu.opLSR, ABS, 6}, {"XXX", cpu.opXXX, IMP, 6},
+		{"RTI", cpu.opRTI, IMP, 6}, {"EOR", cpu.opEOR, IZX, 6}, {"XXX", cpu.opXXX, IMP, 2}, {"SRE", cpu.opSRE, IZX, 8}, {"NOP", cpu.opNOP, ZP0, 3}, {"EOR", cpu.opEOR, ZP0, 3}, {"LSR", cpu.opLSR, ZP0, 5}, {"SRE", cpu.opSRE, ZP0, 5}, {"PHA", cpu.opPHA, IMP, 3}, {"EOR", cpu.opEOR, IMM, 2}, {"LSR", cpu.opLSR, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"JMP", cpu.opJMP, ABS, 3}, {"EOR", cpu.opEOR, ABS, 4}, {"LSR", cpu.opLSR, ABS, 6}, {"SRE", cpu.opSRE, ABS, 6},
 
-		{"BVC", cpu.opBVC, REL, 2}, {"EOR", cpu.opEOR, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"EOR", cpu.opEOR, ZPX, 4}, {"LSR", cpu.opLSR, ZPX, 6}, {"XXX", cpu.opXXX, IMP, 6}, {"CLI", cpu.opCLI, IMP, 2}, {"EOR", cpu.opEOR, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"XXX", cpu.opXXX, IMP, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"EOR", cpu.opEOR, ABX, 4}, {"LSR", cpu.opLSR, ABX, 7}, {"XXX", cpu.opXXX, IMP, 7},
+		{"BVC", cpu.opBVC, REL, 2}, {"EOR", cpu.opEOR, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"SRE", cpu.opSRE, IZY, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"EOR", cpu.opEOR, ZPX, 4}, {"LSR", cpu.opLSR, ZPX, 6}, {"SRE", cpu.opSRE, ZPX, 6}, {"CLI", cpu.opCLI, IMP, 2}, {"EOR", cpu.opEOR, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"SRE", cpu.opSRE, ABY, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"EOR", cpu.opEOR, ABX, 4}, {"LSR", cpu.opLSR, ABX, 7}, {"SRE", cpu.opSRE, ABX, 7},
 
-		{"RTS", cpu.opRTS, IMP, 6}, {"ADC", cpu.opADC, IZX, 6}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"NOP", cpu.opNOP, ZP0, 3}, {"ADC", cpu.opADC, ZP0, 3}, {"ROR", cpu.opROR, ZP0, 5}, {"XXX", cpu.opXXX, IMP, 5}, {"PLA", cpu.opPLA, IMP, 4}, {"ADC", cpu.opADC, IMM, 2}, {"ROR", cpu.opROR, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"JMP", cpu.opJMP, IND, 5}, {"ADC", cpu.opADC, ABS, 4}, {"ROR", cpu.opROR, ABS, 6}, {"XXX", cpu.opXXX, IMP, 6},
+		{"RTS", cpu.opRTS, IMP, 6}, {"ADC", cpu.opADC, IZX, 6}, {"XXX", cpu.opXXX, IMP, 2}, {"RRA", cpu.opRRA, IZX, 8}, {"NOP", cpu.opNOP, ZP0, 3}, {"ADC", cpu.opADC, ZP0, 3}, {"ROR", cpu.opROR, ZP0, 5}, {"RRA", cpu.opRRA, ZP0, 5}, {"PLA", cpu.opPLA, IMP, 4}, {"ADC", cpu.opADC, IMM, 2}, {"ROR", cpu.opROR, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"JMP", cpu.opJMP, IND, 5}, {"ADC", cpu.opADC, ABS, 4}, {"ROR", cpu.opROR, ABS, 6}, {"RRA", cpu.opRRA, ABS, 6},
 
-		{"BVS", cpu.opBVS, REL, 2}, {"ADC", cpu.opADC, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"ADC", cpu.opADC, ZPX, 4}, {"ROR", cpu.opROR, ZPX, 6}, {"XXX", cpu.opXXX, IMP, 6}, {"SEI", cpu.opSEI, IMP, 2}, {"ADC", cpu.opADC, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"XXX", cpu.opXXX, IMP, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"ADC", cpu.opADC, ABX, 4}, {"ROR", cpu.opROR, ABX, 7}, {"XXX", cpu.opXXX, IMP, 7},
+		{"BVS", cpu.opBVS, REL, 2}, {"ADC", cpu.opADC, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"RRA", cpu.opRRA, IZY, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"ADC", cpu.opADC, ZPX, 4}, {"ROR", cpu.opROR, ZPX, 6}, {"RRA", cpu.opRRA, ZPX, 6}, {"SEI", cpu.opSEI, IMP, 2}, {"ADC", cpu.opADC, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"RRA", cpu.opRRA, ABY, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"ADC", cpu.opADC, ABX, 4}, {"ROR", cpu.opROR, ABX, 7}, {"RRA", cpu.opRRA, ABX, 7},
 
-		{"NOP", cpu.opNOP, IMM, 2}, {"STA", cpu.opSTA, IZX, 6}, {"NOP", cpu.opNOP, IMM, 2}, {"XXX", cpu.opXXX, IMP, 6}, {"STY", cpu.opSTY, ZP0, 3}, {"STA", cpu.opSTA, ZP0, 3}, {"STX", cpu.opSTX, ZP0, 3}, {"XXX", cpu.opXXX, IMP, 3}, {"DEY", cpu.opDEY, IMP, 2}, {"NOP", cpu.opNOP, IMM, 2}, {"TXA", cpu.opTXA, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"STY", cpu.opSTY, ABS, 4}, {"STA", cpu.opSTA, ABS, 4}, {"STX", cpu.opSTX, ABS, 4}, {"XXX", cpu.opXXX, IMP, 6},
+		{"NOP", cpu.opNOP, IMM, 2}, {"STA", cpu.opSTA, IZX, 6}, {"NOP", cpu.opNOP, IMM, 2}, {"SAX", cpu.opSAX, IZX, 6}, {"STY", cpu.opSTY, ZP0, 3}, {"STA", cpu.opSTA, ZP0, 3}, {"STX", cpu.opSTX, ZP0, 3}, {"SAX", cpu.opSAX, ZP0, 3}, {"DEY", cpu.opDEY, IMP, 2}, {"NOP", cpu.opNOP, IMM, 2}, {"TXA", cpu.opTXA, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"STY", cpu.opSTY, ABS, 4}, {"STA", cpu.opSTA, ABS, 4}, {"STX", cpu.opSTX, ABS, 4}, {"SAX", cpu.opSAX, ABS, 4},
 
-		{"BCC", cpu.opBCC, REL, 2}, {"STA", cpu.opSTA, IZY, 6}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 6}, {"STY", cpu.opSTY, ZPX, 4}, {"STA", cpu.opSTA, ZPX, 4}, {"STX", cpu.opSTX, ZPY, 4}, {"XXX", cpu.opXXX, IMP, 4}, {"TYA", cpu.opTYA, IMP, 2}, {"STA", cpu.opSTA, ABY, 5}, {"TXS", cpu.opTXS, IMP, 2}, {"XXX", cpu.opXXX, IMP, 5}, {"XXX", cpu.opXXX, IMP, 5}, {"STA", cpu.opSTA, ABX, 5}, {"XXX", cpu.opXXX, IMP, 5}, {"XXX", cpu.opXXX, IMP, 7},
+		{"BCC", cpu.opBCC, REL, 2}, {"STA", cpu.opSTA, IZY, 6}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 6}, {"STY", cpu.opSTY, ZPX, 4}, {"STA", cpu.opSTA, ZPX, 4}, {"STX", cpu.opSTX, ZPY, 4}, {"SAX", cpu.opSAX, ZPY, 4}, {"TYA", cpu.opTYA, IMP, 2}, {"STA", cpu.opSTA, ABY, 5}, {"TXS", cpu.opTXS, IMP, 2}, {"XXX", cpu.opXXX, IMP, 5}, {"XXX", cpu.opXXX, IMP, 5}, {"STA", cpu.opSTA, ABX, 5}, {"XXX", cpu.opXXX, IMP, 5}, {"XXX", cpu.opXXX, IMP, 7},
 
-		{"LDY", cpu.opLDY, IMM, 2}, {"LDA", cpu.opLDA, IZX, 6}, {"LDX", cpu.opLDX, IMM, 2}, {"XXX", cpu.opXXX, IMP, 6}, {"LDY", cpu.opLDY, ZP0, 3}, {"LDA", cpu.opLDA, ZP0, 3}, {"LDX", cpu.opLDX, ZP0, 3}, {"XXX", cpu.opXXX, IMP, 3}, {"TAY", cpu.opTAY, IMP, 2}, {"LDA", cpu.opLDA, IMM, 2}, {"TAX", cpu.opTAX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"LDY", cpu.opLDY, ABS, 4}, {"LDA", cpu.opLDA, ABS, 4}, {"LDX", cpu.opLDX, ABS, 4}, {"XXX", cpu.opXXX, IMP, 6},
+		{"LDY", cpu.opLDY, IMM, 2}, {"LDA", cpu.opLDA, IZX, 6}, {"LDX", cpu.opLDX, IMM, 2}, {"LAX", cpu.opLAX, IZX, 6}, {"LDY", cpu.opLDY, ZP0, 3}, {"LDA", cpu.opLDA, ZP0, 3}, {"LDX", cpu.opLDX, ZP0, 3}, {"LAX", cpu.opLAX, ZP0, 3}, {"TAY", cpu.opTAY, IMP, 2}, {"LDA", cpu.opLDA, IMM, 2}, {"TAX", cpu.opTAX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"LDY", cpu.opLDY, ABS, 4}, {"LDA", cpu.opLDA, ABS, 4}, {"LDX", cpu.opLDX, ABS, 4}, {"LAX", cpu.opLAX, ABS, 4},
 
-		{"BCS", cpu.opBCS, REL, 2}, {"LDA", cpu.opLDA, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 5}, {"LDY", cpu.opLDY, ZPX, 4}, {"LDA", cpu.opLDA, ZPX, 4}, {"LDX", cpu.opLDX, ZPY, 4}, {"XXX", cpu.opXXX, IMP, 4}, {"CLV", cpu.opCLV, IMP, 2}, {"LDA", cpu.opLDA, ABY, 4}, {"TSX", cpu.opTSX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 4}, {"LDY", cpu.opLDY, ABX, 4}, {"LDA", cpu.opLDA, ABX, 4}, {"LDX", cpu.opLDX, ABY, 4}, {"XXX", cpu.opXXX, IMP, 7},
+		{"BCS", cpu.opBCS, REL, 2}, {"LDA", cpu.opLDA, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"LAX", cpu.opLAX, IZY, 5}, {"LDY", cpu.opLDY, ZPX, 4}, {"LDA", cpu.opLDA, ZPX, 4}, {"LDX", cpu.opLDX, ZPY, 4}, {"LAX", cpu.opLAX, ZPY, 4}, {"CLV", cpu.opCLV, IMP, 2}, {"LDA", cpu.opLDA, ABY, 4}, {"TSX", cpu.opTSX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 4}, {"LDY", cpu.opLDY, ABX, 4}, {"LDA", cpu.opLDA, ABX, 4}, {"LDX", cpu.opLDX, ABY, 4}, {"LAX", cpu.opLAX, ABY, 4},
 
-		{"CPY", cpu.opCPY, IMM, 2}, {"CMP", cpu.opCMP, IZX, 6}, {"NOP", cpu.opNOP, IMM, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"CPY", cpu.opCPY, ZP0, 3}, {"CMP", cpu.opCMP, ZP0, 3}, {"DEC", cpu.opDEC, ZP0, 5}, {"XXX", cpu.opXXX, IMP, 5}, {"INY", cpu.opINY, IMP, 2}, {"CMP", cpu.opCMP, IMM, 2}, {"DEX", cpu.opDEX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"CPY", cpu.opCPY, ABS, 4}, {"CMP", cpu.opCMP, ABS, 4}, {"DEC", cpu.opDEC, ABS, 6}, {"XXX", cpu.opXXX, IMP, 6},
+		{"CPY", cpu.opCPY, IMM, 2}, {"CMP", cpu.opCMP, IZX, 6}, {"NOP", cpu.opNOP, IMM, 2}, {"DCP", cpu.opDCP, IZX, 8}, {"CPY", cpu.opCPY, ZP0, 3}, {"CMP", cpu.opCMP, ZP0, 3}, {"DEC", cpu.opDEC, ZP0, 5}, {"DCP", cpu.opDCP, ZP0, 5}, {"INY", cpu.opINY, IMP, 2}, {"CMP", cpu.opCMP, IMM, 2}, {"DEX", cpu.opDEX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"CPY", cpu.opCPY, ABS, 4}, {"CMP", cpu.opCMP, ABS, 4}, {"DEC", cpu.opDEC, ABS, 6}, {"DCP", cpu.opDCP, ABS, 6},
 
-		{"BNE", cpu.opBNE, REL, 2}, {"CMP", cpu.opCMP, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"CMP", cpu.opCMP, ZPX, 4}, {"DEC", cpu.opDEC, ZPX, 6}, {"XXX", cpu.opXXX, IMP, 6}, {"CLD", cpu.opCLD, IMP, 2}, {"CMP", cpu.opCMP, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"XXX", cpu.opXXX, IMP, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"CMP", cpu.opCMP, ABX, 4}, {"DEC", cpu.opDEC, ABX, 7}, {"XXX", cpu.opXXX, IMP, 7},
+		{"BNE", cpu.opBNE, REL, 2}, {"CMP", cpu.opCMP, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"DCP", cpu.opDCP, IZY, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"CMP", cpu.opCMP, ZPX, 4}, {"DEC", cpu.opDEC, ZPX, 6}, {"DCP", cpu.opDCP, ZPX, 6}, {"CLD", cpu.opCLD, IMP, 2}, {"CMP", cpu.opCMP, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"DCP", cpu.opDCP, ABY, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"CMP", cpu.opCMP, ABX, 4}, {"DEC", cpu.opDEC, ABX, 7}, {"DCP", cpu.opDCP, ABX, 7},
 
-		{"CPX", cpu.opCPX, IMM, 2}, {"SBC", cpu.opSBC, IZX, 6}, {"NOP", cpu.opNOP, IMM, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"CPX", cpu.opCPX, ZP0, 3}, {"SBC", cpu.opSBC, ZP0, 3}, {"INC", cpu.opINC, ZP0, 5}, {"XXX", cpu.opXXX, IMP, 5}, {"INX", cpu.opINX, IMP, 2}, {"SBC", cpu.opSBC, IMM, 2}, {"NOP", cpu.opNOP, IMP, 2}, {"XXX", cpu.opXXX, IMP, 2}, {"CPX", cpu.opCPX, ABS, 4}, {"SBC", cpu.opSBC, ABS, 4}, {"INC", cpu.opINC, ABS, 6}, {"XXX", cpu.opXXX, IMP, 6},
+		{"CPX", cpu.opCPX, IMM, 2}, {"SBC", cpu.opSBC, IZX, 6}, {"NOP", cpu.opNOP, IMM, 2}, {"ISB", cpu.opISB, IZX, 8}, {"CPX", cpu.opCPX, ZP0, 3}, {"SBC", cpu.opSBC, ZP0, 3}, {"INC", cpu.opINC, ZP0, 5}, {"ISB", cpu.opISB, ZP0, 5}, {"INX", cpu.opINX, IMP, 2}, {"SBC", cpu.opSBC, IMM, 2}, {"NOP", cpu.opNOP, IMP, 2}, {"SBC", cpu.opSBC, IMM, 2}, {"CPX", cpu.opCPX, ABS, 4}, {"SBC", cpu.opSBC, ABS, 4}, {"INC", cpu.opINC, ABS, 6}, {"ISB", cpu.opISB, ABS, 6},
 
-		{"BEQ", cpu.opBEQ, REL, 2}, {"SBC", cpu.opSBC, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"XXX", cpu.opXXX, IMP, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"SBC", cpu.opSBC, ZPX, 4}, {"INC", cpu.opINC, ZPX, 6}, {"XXX", cpu.opXXX, IMP, 6}, {"SED", cpu.opSED, IMP, 2}, {"SBC", cpu.opSBC, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"XXX", cpu.opXXX, IMP, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"SBC", cpu.opSBC, ABX, 4}, {"INC", cpu.opINC, ABX, 7}, {"XXX", cpu.opXXX, IMP, 7},
+		{"BEQ", cpu.opBEQ, REL, 2}, {"SBC", cpu.opSBC, IZY, 5}, {"XXX", cpu.opXXX, IMP, 2}, {"ISB", cpu.opISB, IZY, 8}, {"NOP", cpu.opNOP, ZPX, 4}, {"SBC", cpu.opSBC, ZPX, 4}, {"INC", cpu.opINC, ZPX, 6}, {"ISB", cpu.opISB, ZPX, 6}, {"SED", cpu.opSED, IMP, 2}, {"SBC", cpu.opSBC, ABY, 4}, {"NOP", cpu.opNOP, IMP, 2}, {"ISB", cpu.opISB, ABY, 7}, {"NOP", cpu.opNOP, ABX, 4}, {"SBC", cpu.opSBC, ABX, 4}, {"INC", cpu.opINC, ABX, 7}, {"ISB", cpu.opISB, ABX, 7},
 	}
 
 	// Create an address mode map, used to determine addressing mode function
@@ -138,12 +140,50 @@ func (cpu *Cpu6502) ConnectBus(b *Bus) { cpu.bus = b }
 
 // Read from the attached bus.
 func (cpu *Cpu6502) read(addr uint16) byte {
-	return cpu.bus.CpuRead(addr)
+	data := cpu.bus.CpuRead(addr)
+	cpu.lastAccessAddr, cpu.lastAccessRead = addr, true
+	if len(cpu.watchpoints) > 0 {
+		cpu.checkWatchpoint(addr, data, false)
+	}
+	return data
 }
 
 // Write to the attached bus.
 func (cpu *Cpu6502) write(addr uint16, data byte) {
 	cpu.bus.CpuWrite(addr, data)
+	cpu.lastAccessAddr, cpu.lastAccessRead = addr, false
+	if len(cpu.watchpoints) > 0 {
+		cpu.checkWatchpoint(addr, data, true)
+	}
+}
+
+// Write the result of a read-modify-write instruction. The 6502 writes the
+// unmodified value back first, then the result.
+func (cpu *Cpu6502) writeRMW(old, result byte) {
+	cpu.write(cpu.AddrAbs, old)
+	cpu.write(cpu.AddrAbs, result)
+}
+
+// Add value and the carry flag to the accumulator, used by ADC and SBC.
+func (cpu *Cpu6502) addWithCarry(value byte) {
+	// 16-bit to keep any carry.
+	result := uint16(cpu.A) + uint16(value) + uint16(cpu.getFlag(StatusFlagC))
+
+	cpu.setFlag(StatusFlagC, result > 0xFF)
+	cpu.setFlag(StatusFlagZ, byte(result) == 0)
+
+	// Set negative flag if bit 7 of result is set.
+	cpu.setFlag(StatusFlagN, (result&(1<<7) > 0))
+
+	// Determine if overflow using MSB from accumulator, value, and result:
+	// v = (a == m && a != r)
+	a := (cpu.A & (1 << 7))
+	m := (value & (1 << 7))
+	r := (byte(result) & (1 << 7))
+
+	cpu.setFlag(StatusFlagV, (a == m) && (a != r))
+
+	cpu.A = byte(result)
 }
 
 // Read a word from memory (little endian order).
@@ -162,6 +202,28 @@ func (cpu *Cpu6502) fetch() {
 	}
 }
 
+// Perform the extra read that indexed addressing modes make before the carry
+// into the high byte of the address is known. Loads only make the read when a
+// page is crossed, while stores and read-modify-write instructions always do.
+// The read is visible to hardware registers with read side effects.
+//
+// reference: https://wiki.nesdev.com/w/index.php/CPU_addressing_modes
+func (cpu *Cpu6502) dummyRead(inst Instruction) {
+	if inst.AddrMode != ABX && inst.AddrMode != ABY && inst.AddrMode != IZY {
+		return
+	}
+
+	switch inst.Name {
+	case "STA", "ASL", "LSR", "ROL", "ROR", "INC", "DEC",
+		"SLO", "RLA", "SRE", "RRA", "DCP", "ISB":
+		cpu.read(cpu.addrPartial)
+	default:
+		if cpu.addrPartial != cpu.AddrAbs {
+			cpu.read(cpu.addrPartial)
+		}
+	}
+}
+
 // Functions to push and pop from the stack.
 func (cpu *Cpu6502) stackPush(data byte) {
 	cpu.write((stackBase | uint16(cpu.Sp)), data)
@@ -232,21 +294,24 @@ func (cpu *Cpu6502) Reset() {
 	cpu.Cycles = 7
 }
 
-// Interrupt Request
+// Interrupt Request. Ignored while the interrupt disable flag is set.
 func (cpu *Cpu6502) IRQ() {
+	if cpu.getFlag(StatusFlagI) > 0 {
+		return
+	}
+
 	// Push program counter to the stack
 	pcHi := byte((cpu.Pc >> 8) & 0x00FF)
 	pcLo := byte(cpu.Pc & 0x00FF)
 	cpu.stackPush(pcHi)
 	cpu.stackPush(pcLo)
 
-	// Set flags: interrupt, break, and unused
-	cpu.setFlag(StatusFlagI, true)
-	cpu.setFlag(StatusFlagB, true)
-	cpu.setFlag(StatusFlagX, true)
+	// Push status flag to stack, with the break flag clear to tell the IRQ
+	// apart from BRK. Interrupts are re-enabled when RTI pulls it back.
+	cpu.stackPush(cpu.Status&^byte(StatusFlagB) | byte(StatusFlagX))
 
-	// Push status flag to stack
-	cpu.stackPush(cpu.Status)
+	// Disable interrupts while the handler runs
+	cpu.setFlag(StatusFlagI, true)
 
 	// Set program counter to value stored at IRQ vector address
 	cpu.Pc = cpu.readWord(irqVectAddr)
@@ -263,13 +328,12 @@ func (cpu *Cpu6502) NMI() {
 	cpu.stackPush(pcHi)
 	cpu.stackPush(pcLo)
 
-	// Set flags: interrupt, break, and unused
-	cpu.setFlag(StatusFlagI, true)
-	cpu.setFlag(StatusFlagB, true)
-	cpu.setFlag(StatusFlagX, true)
+	// Push status flag to stack, with the break flag clear. The interrupt
+	// disable flag is pushed as it was, so RTI restores it.
+	cpu.stackPush(cpu.Status&^byte(StatusFlagB) | byte(StatusFlagX))
 
-	// Push status flag to stack
-	cpu.stackPush(cpu.Status)
+	// Disable interrupts while the handler runs
+	cpu.setFlag(StatusFlagI, true)
 
 	// Set program counter to value stored at NMI vector address
 	cpu.Pc = cpu.readWord(nmiVectAddr)
@@ -284,6 +348,11 @@ func (cpu *Cpu6502) Clock() {
 		// Get the next opcode by reading from the bus at the location of the
 		// current program counter.
 		cpu.Opcode = cpu.read(cpu.Pc)
+		cpu.recordTrace()
+		cpu.skipBreakpoint = false
+		if cpu.traceWriter != nil {
+			cpu.writeTrace()
+		}
 
 		// Store CPU state for logging.
 		if cpu.bus.isLogging {
@@ -292,12 +361,6 @@ func (cpu *Cpu6502) Clock() {
 			cpu.prevPc = cpu.Pc
 		}
 
-		if cpu.bus.isDebug {
-			disassembly := cpu.Disassembly[cpu.Pc]
-			cpu.PrevInstructions[cpu.PrevInstIdx] = disassembly
-			cpu.PrevInstIdx = (cpu.PrevInstIdx + 1) % len(cpu.PrevInstructions)
-		}
-
 		// Lookup by opcode the instruction to be executed.
 		inst := cpu.InstLookup[cpu.Opcode]
 
@@ -310,6 +373,7 @@ func (cpu *Cpu6502) Clock() {
 		// Add any additional cycles needed by either the addressing mode or
 		// instruction.
 		extraCycles1 := cpu.AddrModeFns[inst.AddrMode]()
+		cpu.dummyRead(inst)
 
 		// Execute the instruction.
 		extraCycles2 := inst.Execute()
@@ -362,7 +426,7 @@ func (cpu *Cpu6502) amREL() byte {
 	cpu.AddrRel = uint16(addr)
 
 	// Pad left 8 bits if value is negative.
-	if cpu.AddrRel > (1 << 7) {
+	if cpu.AddrRel&(1<<7) > 0 {
 		cpu.AddrRel |= 0xFF00
 	}
 
@@ -414,6 +478,7 @@ func (cpu *Cpu6502) amABX() byte {
 	cpu.Pc += 2
 
 	cpu.AddrAbs = addr + uint16(cpu.X)
+	cpu.addrPartial = addr&0xFF00 | cpu.AddrAbs&0x00FF
 
 	// Add a cycle if page cross occurred.
 	if cpu.AddrAbs&0xFF00 != addr&0xFF00 {
@@ -431,6 +496,7 @@ func (cpu *Cpu6502) amABY() byte {
 	cpu.Pc += 2
 
 	cpu.AddrAbs = addr + uint16(cpu.Y)
+	cpu.addrPartial = addr&0xFF00 | cpu.AddrAbs&0x00FF
 
 	// Add a cycle if page cross occurred.
 	if cpu.AddrAbs&0xFF00 != addr&0xFF00 {
@@ -495,6 +561,7 @@ func (cpu *Cpu6502) amIZY() byte {
 	hi := cpu.read((addr + 1) & 0x00FF) // Zero page wraparound
 
 	cpu.AddrAbs = (uint16(hi)<<8 | uint16(lo)) + uint16(cpu.Y)
+	cpu.addrPartial = uint16(hi)<<8 | cpu.AddrAbs&0x00FF
 
 	// Add a cycle if page cross occurred.
 	if cpu.AddrAbs&0xFF00 != (uint16(hi) << 8) {
@@ -520,24 +587,7 @@ type Instruction struct {
 func (cpu *Cpu6502) opADC() byte {
 	cpu.fetch()
 
-	// 16-bit to keep any carry.
-	result := uint16(cpu.A) + uint16(cpu.Fetched) + uint16(cpu.getFlag(StatusFlagC))
-
-	cpu.setFlag(StatusFlagC, result > 0xFF)
-	cpu.setFlag(StatusFlagZ, byte(result) == 0)
-
-	// Set negative flag if bit 7 of result is set.
-	cpu.setFlag(StatusFlagN, (result&(1<<7) > 0))
-
-	// Determine if overflow using MSB from accumulator, memory, and result:
-	// v = (a == m && a != r)
-	a := (cpu.A & (1 << 7))
-	m := (cpu.Fetched & (1 << 7))
-	r := (byte(result) & (1 << 7))
-
-	cpu.setFlag(StatusFlagV, (a == m) && (a != r))
-
-	cpu.A = byte(result)
+	cpu.addWithCarry(cpu.Fetched)
 
 	return 0x01 // Potential for extra cycle
 }
@@ -560,23 +610,25 @@ func (cpu *Cpu6502) opAND() byte {
 func (cpu *Cpu6502) opASL() byte {
 	cpu.fetch()
 
+	old := cpu.Fetched
+
 	// Set carry flag to old bit 7.
 	cpu.setFlag(StatusFlagC, cpu.Fetched&(1<<7) > 0)
 
-	result := cpu.Fetched << 1
+	cpu.Fetched = cpu.Fetched << 1
 
 	// Write result to accumulator register if in implied addressing mode, else
 	// write to addrAbs location in memory.
 	if cpu.isImpliedAddr {
-		cpu.A = result
+		cpu.A = cpu.Fetched
 	} else {
-		cpu.write(cpu.AddrAbs, result)
+		cpu.writeRMW(old, cpu.Fetched)
 	}
 
-	cpu.setFlag(StatusFlagZ, cpu.A == 0)
+	cpu.setFlag(StatusFlagZ, cpu.Fetched == 0)
 
 	// Set if bit 7 of result is set.
-	cpu.setFlag(StatusFlagN, result&(1<<7) > 0)
+	cpu.setFlag(StatusFlagN, cpu.Fetched&(1<<7) > 0)
 
 	return 0x00
 }
@@ -835,10 +887,11 @@ func (cpu *Cpu6502) opCPY() byte {
 // DEC - Decrement Memory
 func (cpu *Cpu6502) opDEC() byte {
 	cpu.fetch()
+	old := cpu.Fetched
 
 	cpu.Fetched--
 
-	cpu.write(cpu.AddrAbs, cpu.Fetched)
+	cpu.writeRMW(old, cpu.Fetched)
 
 	cpu.setFlag(StatusFlagZ, cpu.Fetched == 0)         // if A == 0
 	cpu.setFlag(StatusFlagN, (cpu.Fetched&(1<<7) > 0)) // if bit 7 set
@@ -887,10 +940,11 @@ func (cpu *Cpu6502) opEOR() byte {
 // INC - Increment Memory
 func (cpu *Cpu6502) opINC() byte {
 	cpu.fetch()
+	old := cpu.Fetched
 
 	cpu.Fetched++
 
-	cpu.write(cpu.AddrAbs, cpu.Fetched)
+	cpu.writeRMW(old, cpu.Fetched)
 
 	cpu.setFlag(StatusFlagZ, cpu.Fetched == 0)         // if A == 0
 	cpu.setFlag(StatusFlagN, (cpu.Fetched&(1<<7) > 0)) // if bit 7 set
@@ -982,6 +1036,7 @@ func (cpu *Cpu6502) opLDY() byte {
 // LSR - Logical Shift Right
 func (cpu *Cpu6502) opLSR() byte {
 	cpu.fetch()
+	old := cpu.Fetched
 
 	// Set carry flag to old bit 0.
 	cpu.setFlag(StatusFlagC, cpu.Fetched&0x1 > 0)
@@ -994,7 +1049,7 @@ func (cpu *Cpu6502) opLSR() byte {
 	if cpu.isImpliedAddr {
 		cpu.A = cpu.Fetched
 	} else {
-		cpu.write(cpu.AddrAbs, cpu.Fetched)
+		cpu.writeRMW(old, cpu.Fetched)
 	}
 
 	return 0x00
@@ -1056,6 +1111,7 @@ func (cpu *Cpu6502) opPLP() byte {
 // ROL - Rotate Left
 func (cpu *Cpu6502) opROL() byte {
 	cpu.fetch()
+	old := cpu.Fetched
 
 	carry := cpu.getFlag(StatusFlagC)
 
@@ -1073,7 +1129,7 @@ func (cpu *Cpu6502) opROL() byte {
 	if cpu.isImpliedAddr {
 		cpu.A = cpu.Fetched
 	} else {
-		cpu.write(cpu.AddrAbs, cpu.Fetched)
+		cpu.writeRMW(old, cpu.Fetched)
 	}
 
 	return 0x00
@@ -1082,6 +1138,7 @@ func (cpu *Cpu6502) opROL() byte {
 // ROR - Rotate Right
 func (cpu *Cpu6502) opROR() byte {
 	cpu.fetch()
+	old := cpu.Fetched
 
 	carry := cpu.getFlag(StatusFlagC)
 
@@ -1099,7 +1156,7 @@ func (cpu *Cpu6502) opROR() byte {
 	if cpu.isImpliedAddr {
 		cpu.A = cpu.Fetched
 	} else {
-		cpu.write(cpu.AddrAbs, cpu.Fetched)
+		cpu.writeRMW(old, cpu.Fetched)
 	}
 
 	return 0x00
@@ -1142,27 +1199,8 @@ func (cpu *Cpu6502) opRTS() byte {
 func (cpu *Cpu6502) opSBC() byte {
 	cpu.fetch()
 
-	// Invert to subtract
-	sub := uint16(cpu.Fetched) ^ 0x00FF
-
-	// 16-bit to keep any carry.
-	result := uint16(cpu.A) + sub + uint16(cpu.getFlag(StatusFlagC))
-
-	cpu.setFlag(StatusFlagC, result > 0xFF)
-	cpu.setFlag(StatusFlagZ, byte(result) == 0)
-
-	// Set negative flag if bit 7 of result is set.
-	cpu.setFlag(StatusFlagN, (result&(1<<7) > 0))
-
-	// Determine if overflow using MSB from accumulator, memory, and result:
-	// v = (a != m && m == r)
-	a := (cpu.A & (1 << 7))
-	m := (cpu.Fetched & (1 << 7))
-	r := (byte(result) & (1 << 7))
-
-	cpu.setFlag(StatusFlagV, (a != m) && (m == r))
-
-	cpu.A = byte(result)
+	// Subtracting is adding the inverted value.
+	cpu.addWithCarry(^cpu.Fetched)
 
 	return 0x01
 }
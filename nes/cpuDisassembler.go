@@ -1,106 +1,140 @@
 package nes
 
 import (
-	"bytes"
 	"fmt"
+	"sort"
 )
 
+// Instructions shown before and after the current one in the debug panel's
+// disassembly.
+const disassemblyWindowLines = 6
+
 // Disassemble the loaded 6502 program into human-readable CPU instructions
-// mapped to their respective memory address.
+// mapped to their respective memory address. Memory is read without side
+// effects, so I/O registers read as 0.
 //
 // Much help from https://github.com/OneLoneCoder/olcNES
 func (cpu *Cpu6502) Disassemble(startAddr, endAddr uint16) map[uint16]string {
-	// Current CPU instruction, disassembled
-	var lineDiss bytes.Buffer
-	var value, lo, hi byte
-
 	// this needs to be bigger than uint16, to determine when larger than endAddr
 	var addr uint32 = uint32(startAddr)
 
 	disassembly := make(map[uint16]string)
 
 	for addr <= uint32(endAddr) {
-		// Instruction memory address
-		lineAddr := uint16(addr)
-		lineDiss.WriteString(fmt.Sprintf("$%04X: ", lineAddr))
-
-		// Readable instruction name
-		opcode := cpu.read(uint16(addr))
-		addr++
-		instName := cpu.InstLookup[opcode].Name
-		lineDiss.WriteString(fmt.Sprintf("%s ", instName))
-
-		// Get addressing mode.
-		addrMode := cpu.InstLookup[opcode].AddrMode
-
-		switch addrMode {
-		case IMP:
-			lineDiss.WriteString("{IMP}")
-		case IMM:
-			value = cpu.read(uint16(addr))
-			addr++
-			lineDiss.WriteString(fmt.Sprintf("#$%02X {IMM}", value))
-		case REL:
-			value = cpu.read(uint16(addr))
-			addr++
-			lineDiss.WriteString(fmt.Sprintf("$%02X [%04X] {REL}", value, uint16(value)+uint16(addr)))
-		case ZP0:
-			lo = cpu.read(uint16(addr))
-			addr++
-			hi = 0x00
-			lineDiss.WriteString(fmt.Sprintf("$%02X {ZP0}", lo))
-		case ZPX:
-			lo = cpu.read(uint16(addr))
-			addr++
-			hi = 0x00
-			lineDiss.WriteString(fmt.Sprintf("$%02X, X {ZPX}", lo))
-		case ZPY:
-			lo = cpu.read(uint16(addr))
-			addr++
-			hi = 0x00
-			lineDiss.WriteString(fmt.Sprintf("$%02X, Y {ZPY}", lo))
-		case ABS:
-			lo = cpu.read(uint16(addr))
-			addr++
-			hi = cpu.read(uint16(addr))
-			addr++
-			lineDiss.WriteString(fmt.Sprintf("$%04X {ABS}", uint16(hi)<<8|uint16(lo)))
-		case ABX:
-			lo = cpu.read(uint16(addr))
-			addr++
-			hi = cpu.read(uint16(addr))
-			addr++
-			lineDiss.WriteString(fmt.Sprintf("$%04X, X {ABX}", uint16(hi)<<8|uint16(lo)))
-		case ABY:
-			lo = cpu.read(uint16(addr))
-			addr++
-			hi = cpu.read(uint16(addr))
-			addr++
-			lineDiss.WriteString(fmt.Sprintf("$%04X, Y {ABY}", uint16(hi)<<8|uint16(lo)))
-		case IND:
-			lo = cpu.read(uint16(addr))
-			addr++
-			hi = cpu.read(uint16(addr))
-			addr++
-			lineDiss.WriteString(fmt.Sprintf("($%04X) {IND}", uint16(hi)<<8|uint16(lo)))
-		case IZX:
-			lo = cpu.read(uint16(addr))
-			addr++
-			hi = 0x00
-			lineDiss.WriteString(fmt.Sprintf("($%02X, X) {IZX}", lo))
-		case IZY:
-			lo = cpu.read(uint16(addr))
-			addr++
-			hi = 0x00
-			lineDiss.WriteString(fmt.Sprintf("($%02X, Y) {IZY}", lo))
-		}
-
-		// Add to map
-		disassembly[lineAddr] = lineDiss.String()
-		lineDiss.Reset()
+		line, size := cpu.disassembleInst(uint16(addr), cpu.bus.peek)
+		disassembly[uint16(addr)] = line
+		addr += uint32(size)
 	}
 
 	cpu.Disassembly = disassembly
 
 	return disassembly
 }
+
+// disassembleAround returns lines of disassembly around addr: up to before
+// instructions leading up to it, the instruction at addr, and after
+// instructions following it. The index of addr's line is returned too. Memory
+// is read without side effects, so it can be called at any time.
+func (cpu *Cpu6502) disassembleAround(addr uint16, before, after int) ([]string, int) {
+	var lines []string
+
+	// Instructions are 1 to 3 bytes long, and can't be decoded backwards.
+	// Decode forwards from an address that lands on addr instead, trying
+	// recently run instructions first, as they are known to be instructions
+	// and not data. Then try the furthest addresses first, for the most lines.
+	furthest := int(addr) - before*3
+	if furthest < 0 {
+		furthest = 0
+	}
+	starts := cpu.recentInstAddrs(furthest, int(addr))
+	for start := furthest; start < int(addr); start++ {
+		starts = append(starts, start)
+	}
+
+	for _, start := range starts {
+		var chain []string
+		for start < int(addr) {
+			line, size := cpu.disassembleInst(uint16(start), cpu.bus.peek)
+			chain = append(chain, line)
+			start += size
+		}
+		if start == int(addr) {
+			lines = chain
+			break
+		}
+	}
+	if len(lines) > before {
+		lines = lines[len(lines)-before:]
+	}
+
+	current := len(lines)
+
+	next := int(addr)
+	for i := 0; i <= after && next <= 0xFFFF; i++ {
+		line, size := cpu.disassembleInst(uint16(next), cpu.bus.peek)
+		lines = append(lines, line)
+		next += size
+	}
+
+	return lines, current
+}
+
+// recentInstAddrs returns the addresses of recently run instructions from
+// start up to end, in order.
+func (cpu *Cpu6502) recentInstAddrs(start, end int) []int {
+	var addrs []int
+	for i := 0; i < cpu.traceCount; i++ {
+		pc := int(cpu.trace[i].pc)
+		if pc >= start && pc < end {
+			addrs = append(addrs, pc)
+		}
+	}
+	sort.Ints(addrs)
+
+	return addrs
+}
+
+// disassembleInst returns the instruction at addr as a human-readable line,
+// and its size in bytes. Memory is read through read.
+func (cpu *Cpu6502) disassembleInst(addr uint16, read func(uint16) byte) (string, int) {
+	// Readable instruction name
+	opcode := read(addr)
+	inst := cpu.InstLookup[opcode]
+	line := fmt.Sprintf("$%04X: %s ", addr, inst.Name)
+
+	// Operand bytes
+	lo := read(addr + 1)
+	hi := read(addr + 2)
+	word := uint16(hi)<<8 | uint16(lo)
+
+	switch inst.AddrMode {
+	case IMP:
+		return line + "{IMP}", 1
+	case IMM:
+		return line + fmt.Sprintf("#$%02X {IMM}", lo), 2
+	case REL:
+		// The offset is signed, from the following instruction.
+		target := addr + 2 + uint16(int8(lo))
+		return line + fmt.Sprintf("$%02X [%04X] {REL}", lo, target), 2
+	case ZP0:
+		return line + fmt.Sprintf("$%02X {ZP0}", lo), 2
+	case ZPX:
+		return line + fmt.Sprintf("$%02X, X {ZPX}", lo), 2
+	case ZPY:
+		return line + fmt.Sprintf("$%02X, Y {ZPY}", lo), 2
+	case ABS:
+		return line + fmt.Sprintf("$%04X {ABS}", word), 3
+	case ABX:
+		return line + fmt.Sprintf("$%04X, X {ABX}", word), 3
+	case ABY:
+		return line + fmt.Sprintf("$%04X, Y {ABY}", word), 3
+	case IND:
+		return line + fmt.Sprintf("($%04X) {IND}", word), 3
+	case IZX:
+		return line + fmt.Sprintf("($%02X, X) {IZX}", lo), 2
+	case IZY:
+		return line + fmt.Sprintf("($%02X, Y) {IZY}", lo), 2
+	}
+
+	return line, 1
+}
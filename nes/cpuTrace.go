@@ -0,0 +1,128 @@
+package nes
+
+import (
+	"fmt"
+	"io"
+)
+
+// Traces log every instruction the CPU runs in the format of Nintendulator's
+// logs, such as nestest.log, so they can be diffed against them:
+//
+//	C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7
+//
+// Each line is the CPU's state before the instruction runs: its address and
+// bytes, the disassembled instruction with the memory it uses, the registers,
+// the PPU scanline and dot, and the CPU cycle count. Unofficial opcodes are
+// marked with a '*'.
+
+// EnableTrace writes a line to w for every instruction the CPU runs. Pass nil
+// to stop tracing.
+func (cpu *Cpu6502) EnableTrace(w io.Writer) {
+	cpu.traceWriter = w
+}
+
+// writeTrace writes the trace line for the instruction at the program
+// counter, which is about to run.
+func (cpu *Cpu6502) writeTrace() {
+	fmt.Fprintln(cpu.traceWriter, cpu.traceLine())
+}
+
+// traceLine returns the trace line for the instruction at the program
+// counter, with the CPU's current state.
+func (cpu *Cpu6502) traceLine() string {
+	pc := cpu.Pc
+	opcode := cpu.bus.peek(pc)
+	inst := cpu.InstLookup[opcode]
+	size := addrModeSizes[inst.AddrMode]
+
+	var instBytes string
+	for i := uint16(0); i < uint16(size); i++ {
+		if i > 0 {
+			instBytes += " "
+		}
+		instBytes += fmt.Sprintf("%02X", cpu.bus.peek(pc+i))
+	}
+
+	mark := ' '
+	if cpu.isUnofficialOpcode(opcode) {
+		mark = '*'
+	}
+
+	scanline, dot := cpu.bus.Ppu.lastDot()
+
+	return fmt.Sprintf("%04X  %-8s %c%-32sA:%02X X:%02X Y:%02X P:%02X SP:%02X PPU:%3d,%3d CYC:%d",
+		pc, instBytes, mark, cpu.traceInst(pc, inst),
+		cpu.A, cpu.X, cpu.Y, cpu.Status, cpu.Sp, scanline, dot, cpu.CycleCount)
+}
+
+// Instruction size in bytes, for each addressing mode.
+var addrModeSizes = [...]int{
+	IMP: 1, IMM: 2, REL: 2,
+	ZP0: 2, ZPX: 2, ZPY: 2,
+	ABS: 3, ABX: 3, ABY: 3,
+	IND: 3, IZX: 2, IZY: 2,
+}
+
+// traceInst disassembles the instruction at pc for a trace line, showing the
+// address it uses and the value there, as they are before it runs. Memory is
+// read without side effects, so I/O registers read as 0.
+func (cpu *Cpu6502) traceInst(pc uint16, inst Instruction) string {
+	peek := cpu.bus.peek
+	peekWord := func(lo, hi uint16) uint16 {
+		return uint16(peek(hi))<<8 | uint16(peek(lo))
+	}
+	// Zero page pointers wrap around within the zero page.
+	peekZpWord := func(addr byte) uint16 {
+		return peekWord(uint16(addr), uint16(addr+1))
+	}
+
+	op := peek(pc + 1)
+	word := peekWord(pc+1, pc+2)
+
+	switch inst.AddrMode {
+	case IMP:
+		switch inst.Name {
+		case "ASL", "LSR", "ROL", "ROR":
+			return inst.Name + " A"
+		}
+		return inst.Name
+	case IMM:
+		return fmt.Sprintf("%s #$%02X", inst.Name, op)
+	case REL:
+		// The offset is signed, from the following instruction.
+		return fmt.Sprintf("%s $%04X", inst.Name, pc+2+uint16(int8(op)))
+	case ZP0:
+		return fmt.Sprintf("%s $%02X = %02X", inst.Name, op, peek(uint16(op)))
+	case ZPX:
+		addr := op + cpu.X
+		return fmt.Sprintf("%s $%02X,X @ %02X = %02X", inst.Name, op, addr, peek(uint16(addr)))
+	case ZPY:
+		addr := op + cpu.Y
+		return fmt.Sprintf("%s $%02X,Y @ %02X = %02X", inst.Name, op, addr, peek(uint16(addr)))
+	case ABS:
+		if inst.Name == "JMP" || inst.Name == "JSR" {
+			return fmt.Sprintf("%s $%04X", inst.Name, word)
+		}
+		return fmt.Sprintf("%s $%04X = %02X", inst.Name, word, peek(word))
+	case ABX:
+		addr := word + uint16(cpu.X)
+		return fmt.Sprintf("%s $%04X,X @ %04X = %02X", inst.Name, word, addr, peek(addr))
+	case ABY:
+		addr := word + uint16(cpu.Y)
+		return fmt.Sprintf("%s $%04X,Y @ %04X = %02X", inst.Name, word, addr, peek(addr))
+	case IND:
+		// The high byte of the target doesn't carry into the next page.
+		target := peekWord(word, word&0xFF00|(word+1)&0x00FF)
+		return fmt.Sprintf("%s ($%04X) = %04X", inst.Name, word, target)
+	case IZX:
+		ptr := op + cpu.X
+		addr := peekZpWord(ptr)
+		return fmt.Sprintf("%s ($%02X,X) @ %02X = %04X = %02X", inst.Name, op, ptr, addr, peek(addr))
+	case IZY:
+		base := peekZpWord(op)
+		addr := base + uint16(cpu.Y)
+		return fmt.Sprintf("%s ($%02X),Y = %04X @ %04X = %02X", inst.Name, op, base, addr, peek(addr))
+	}
+
+	return inst.Name
+}
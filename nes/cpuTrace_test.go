@@ -0,0 +1,59 @@
+package nes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	rom := newTestRom(1, 1, 0x00, 0x00)
+	prg := rom[16 : 16+16*1024]
+	copy(prg, []byte{
+		0x4C, 0x05, 0xC0, // JMP $C005
+		0x00, 0x00,
+		0xA2, 0x05, // LDX #$05
+		0xB5, 0x10, // LDA $10,X
+		0x0A,       // ASL A
+		0x04, 0xA9, // NOP $A9 (unofficial)
+	})
+	// Reset vector: $C000
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0xC0
+
+	bus := NewBus(false, false)
+	if err := bus.LoadBytes(rom); err != nil {
+		t.Fatal(err)
+	}
+	bus.Ram[0x15] = 0x42
+
+	var buf bytes.Buffer
+	bus.Cpu.EnableTrace(&buf)
+	for i := 0; i < 5; i++ {
+		bus.StepInstruction()
+	}
+
+	want := []string{
+		"C000  4C 05 C0  JMP $C005                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7",
+		"C005  A2 05     LDX #$05                        A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 30 CYC:10",
+		"C007  B5 10     LDA $10,X @ 15 = 42             A:00 X:05 Y:00 P:24 SP:FD PPU:  0, 36 CYC:12",
+		"C009  0A        ASL A                           A:42 X:05 Y:00 P:24 SP:FD PPU:  0, 48 CYC:16",
+		"C00A  04 A9    *NOP $A9 = 00                    A:84 X:05 Y:00 P:A4 SP:FD PPU:  0, 54 CYC:18",
+	}
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d:\ngot  %q\nwant %q", i+1, got[i], want[i])
+		}
+	}
+
+	// Nothing more is written once tracing stops.
+	bus.Cpu.EnableTrace(nil)
+	buf.Reset()
+	bus.StepInstruction()
+	if buf.Len() > 0 {
+		t.Errorf("trace written after disabling it: %q", buf.String())
+	}
+}
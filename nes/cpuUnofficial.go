@@ -0,0 +1,106 @@
+package nes
+
+// Unofficial instructions. The 6502 decodes every opcode, and the ones left
+// out of the datasheet combine parts of the official instructions. The stable
+// ones below are used by some games, and tested by nestest.
+//
+// reference: https://wiki.nesdev.com/w/index.php/Programming_with_unofficial_opcodes
+
+// isUnofficialOpcode returns whether opcode is one of the undocumented 6502
+// instructions.
+func (cpu *Cpu6502) isUnofficialOpcode(opcode byte) bool {
+	switch cpu.InstLookup[opcode].Name {
+	case "XXX", "LAX", "SAX", "DCP", "ISB", "SLO", "RLA", "SRE", "RRA":
+		return true
+	case "NOP":
+		return opcode != 0xEA
+	case "SBC":
+		return opcode == 0xEB
+	}
+	return false
+}
+
+// DCP - Decrement Memory, then Compare with Accumulator
+func (cpu *Cpu6502) opDCP() byte {
+	cpu.opDEC()
+
+	cpu.setFlag(StatusFlagC, cpu.A >= cpu.Fetched)
+	cpu.setFlag(StatusFlagZ, cpu.A == cpu.Fetched)
+	cpu.setFlag(StatusFlagN, ((cpu.A-cpu.Fetched)&(1<<7) > 0)) // if bit 7 set
+
+	return 0x00
+}
+
+// ISB - Increment Memory, then Subtract from Accumulator with Borrow
+func (cpu *Cpu6502) opISB() byte {
+	cpu.opINC()
+
+	cpu.addWithCarry(^cpu.Fetched)
+
+	return 0x00
+}
+
+// LAX - Load Accumulator and X Register
+func (cpu *Cpu6502) opLAX() byte {
+	cpu.fetch()
+
+	cpu.A = cpu.Fetched
+	cpu.X = cpu.Fetched
+
+	cpu.setFlag(StatusFlagZ, cpu.A == 0)
+	cpu.setFlag(StatusFlagN, cpu.A&(1<<7) > 0)
+
+	return 0x01
+}
+
+// RLA - Rotate Left, then AND with Accumulator
+func (cpu *Cpu6502) opRLA() byte {
+	cpu.opROL()
+
+	cpu.A &= cpu.Fetched
+
+	cpu.setFlag(StatusFlagZ, cpu.A == 0)
+	cpu.setFlag(StatusFlagN, cpu.A&(1<<7) > 0)
+
+	return 0x00
+}
+
+// RRA - Rotate Right, then Add to Accumulator with Carry
+func (cpu *Cpu6502) opRRA() byte {
+	cpu.opROR()
+
+	cpu.addWithCarry(cpu.Fetched)
+
+	return 0x00
+}
+
+// SAX - Store Accumulator AND X Register
+func (cpu *Cpu6502) opSAX() byte {
+	cpu.write(cpu.AddrAbs, cpu.A&cpu.X)
+
+	return 0x00
+}
+
+// SLO - Shift Left, then OR with Accumulator
+func (cpu *Cpu6502) opSLO() byte {
+	cpu.opASL()
+
+	cpu.A |= cpu.Fetched
+
+	cpu.setFlag(StatusFlagZ, cpu.A == 0)
+	cpu.setFlag(StatusFlagN, cpu.A&(1<<7) > 0)
+
+	return 0x00
+}
+
+// SRE - Shift Right, then Exclusive OR with Accumulator
+func (cpu *Cpu6502) opSRE() byte {
+	cpu.opLSR()
+
+	cpu.A ^= cpu.Fetched
+
+	cpu.setFlag(StatusFlagZ, cpu.A == 0)
+	cpu.setFlag(StatusFlagN, cpu.A&(1<<7) > 0)
+
+	return 0x00
+}
@@ -0,0 +1,80 @@
+package nes
+
+import "testing"
+
+func TestUnofficialOpcodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte          // runs from $0200
+		a, x, y byte            // registers before
+		p       byte            // status before
+		mem     map[uint16]byte // memory before
+		wantA   byte
+		wantX   byte
+		wantP   byte
+		wantMem map[uint16]byte
+		cycles  int
+	}{
+		{"LAX zp", []byte{0xA7, 0x10}, 0x00, 0x00, 0x00, 0x24,
+			map[uint16]byte{0x10: 0x80}, 0x80, 0x80, 0xA4, nil, 3},
+		{"LAX (zp),Y page cross", []byte{0xB3, 0x10}, 0x11, 0x22, 0x01, 0x24,
+			map[uint16]byte{0x10: 0xFF, 0x11: 0x02, 0x0300: 0x00}, 0x00, 0x00, 0x26, nil, 6},
+		{"LAX abs,Y", []byte{0xBF, 0x00, 0x03}, 0x00, 0x00, 0x00, 0x24,
+			map[uint16]byte{0x0300: 0x7F}, 0x7F, 0x7F, 0x24, nil, 4},
+		{"SAX zp", []byte{0x87, 0x20}, 0xF0, 0x3C, 0x00, 0x24,
+			nil, 0xF0, 0x3C, 0x24, map[uint16]byte{0x20: 0x30}, 3},
+		{"SBC #imm", []byte{0xEB, 0x10}, 0x50, 0x00, 0x00, 0x25,
+			nil, 0x40, 0x00, 0x25, nil, 2},
+		{"DCP zp", []byte{0xC7, 0x20}, 0x40, 0x00, 0x00, 0x24,
+			map[uint16]byte{0x20: 0x41}, 0x40, 0x00, 0x27, map[uint16]byte{0x20: 0x40}, 5},
+		{"DCP abs,X page cross", []byte{0xDF, 0xFF, 0x02}, 0xFF, 0x01, 0x00, 0x24,
+			map[uint16]byte{0x0300: 0x00}, 0xFF, 0x01, 0x27, map[uint16]byte{0x0300: 0xFF}, 7},
+		{"ISB zp", []byte{0xE7, 0x20}, 0x20, 0x00, 0x00, 0x25,
+			map[uint16]byte{0x20: 0x0F}, 0x10, 0x00, 0x25, map[uint16]byte{0x20: 0x10}, 5},
+		{"SLO zp", []byte{0x07, 0x20}, 0x02, 0x00, 0x00, 0x24,
+			map[uint16]byte{0x20: 0x81}, 0x02, 0x00, 0x25, map[uint16]byte{0x20: 0x02}, 5},
+		{"RLA zp", []byte{0x27, 0x20}, 0xFF, 0x00, 0x00, 0x25,
+			map[uint16]byte{0x20: 0x80}, 0x01, 0x00, 0x25, map[uint16]byte{0x20: 0x01}, 5},
+		{"SRE zp", []byte{0x47, 0x20}, 0x01, 0x00, 0x00, 0x24,
+			map[uint16]byte{0x20: 0x03}, 0x00, 0x00, 0x27, map[uint16]byte{0x20: 0x01}, 5},
+		{"RRA zp", []byte{0x67, 0x20}, 0x10, 0x00, 0x00, 0x25,
+			map[uint16]byte{0x20: 0x02}, 0x91, 0x00, 0xA4, map[uint16]byte{0x20: 0x81}, 5},
+		{"SLO (zp,X)", []byte{0x03, 0x0F}, 0x00, 0x01, 0x00, 0x24,
+			map[uint16]byte{0x10: 0x00, 0x11: 0x03, 0x0300: 0x40}, 0x80, 0x01, 0xA4, map[uint16]byte{0x0300: 0x80}, 8},
+		{"NOP zp", []byte{0x04, 0x20}, 0x12, 0x34, 0x00, 0x24,
+			nil, 0x12, 0x34, 0x24, nil, 3},
+	}
+
+	for _, test := range tests {
+		bus := NewBus(false, false)
+		cpu := bus.Cpu
+
+		copy(bus.Ram[0x0200:], test.program)
+		for addr, data := range test.mem {
+			bus.Ram[addr] = data
+		}
+		cpu.Pc = 0x0200
+		cpu.A, cpu.X, cpu.Y, cpu.Status = test.a, test.x, test.y, test.p
+		cpu.Cycles = 0
+		cpu.Clock()
+
+		if !cpu.isUnofficialOpcode(test.program[0]) {
+			t.Errorf("%s: opcode %#02x not reported as unofficial", test.name, test.program[0])
+		}
+		if cpu.A != test.wantA || cpu.X != test.wantX || cpu.Status != test.wantP {
+			t.Errorf("%s: A=%02X X=%02X P=%02X, want A=%02X X=%02X P=%02X",
+				test.name, cpu.A, cpu.X, cpu.Status, test.wantA, test.wantX, test.wantP)
+		}
+		for addr, want := range test.wantMem {
+			if got := bus.Ram[addr]; got != want {
+				t.Errorf("%s: $%04X = %02X, want %02X", test.name, addr, got, want)
+			}
+		}
+		if got := int(cpu.Cycles) + 1; got != test.cycles {
+			t.Errorf("%s: %d cycles, want %d", test.name, got, test.cycles)
+		}
+		if got := cpu.Pc; got != 0x0200+uint16(len(test.program)) {
+			t.Errorf("%s: PC = $%04X after instruction, want $%04X", test.name, got, 0x0200+len(test.program))
+		}
+	}
+}
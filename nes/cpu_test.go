@@ -1,6 +1,7 @@
 package nes
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -23,7 +24,7 @@ func TestAmIZY(t *testing.T) {}
 ////////////////////////////////////////////////////////////////
 // Instructions
 func TestOpAND(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -59,7 +60,7 @@ func TestOpAND(t *testing.T) {
 }
 
 func TestOpASL(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -100,7 +101,7 @@ func TestOpASL(t *testing.T) {
 }
 
 func TestOpBPL(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -131,9 +132,12 @@ func TestOpBPL(t *testing.T) {
 }
 
 func TestOpBRK(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
+	// BRK reads the IRQ vector from the cartridge.
+	nes.InsertCartridge(&Cartridge{prgMem: make([]byte, 16*1024), mapper: NewMapper000(1, 1)})
+
 	// Snapshot
 	flags := cpu.Status
 
@@ -166,7 +170,7 @@ func TestOpBRK(t *testing.T) {
 }
 
 func TestOpCLC(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -197,7 +201,7 @@ func TestOpCLC(t *testing.T) {
 }
 
 func TestOpJSR(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -228,7 +232,7 @@ func TestOpJSR(t *testing.T) {
 }
 
 func TestOpORA(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -262,7 +266,7 @@ func TestOpORA(t *testing.T) {
 }
 
 func TestOpPHP(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -283,7 +287,7 @@ func TestOpPHP(t *testing.T) {
 		{cpu.getFlag(StatusFlagV), flags & byte(StatusFlagV)}, // unchanged
 		{cpu.getFlag(StatusFlagN), flags & byte(StatusFlagN)}, // unchanged
 
-		{cpu.stackPop(), cpu.Status}, // check flags were pushed to stack
+		{cpu.stackPop(), cpu.Status | byte(StatusFlagB)}, // check flags were pushed to stack, with B set
 	}
 
 	// Test
@@ -293,3 +297,176 @@ func TestOpPHP(t *testing.T) {
 		}
 	}
 }
+
+// countingMapper is an NROM-like mapper that counts the CPU accesses to each
+// address, like a mapper whose registers react to every access.
+type countingMapper struct {
+	reads  map[uint16]int
+	writes map[uint16]int
+}
+
+func (m *countingMapper) CpuMapRead(addr uint16) (uint32, bool) {
+	m.reads[addr]++
+	return uint32(addr & 0x3FFF), true
+}
+
+func (m *countingMapper) CpuMapWrite(addr uint16, data byte) (uint32, bool) {
+	m.writes[addr]++
+	return uint32(addr & 0x3FFF), true
+}
+
+func (m *countingMapper) PpuMapRead(addr uint16) (uint32, bool)  { return uint32(addr), true }
+func (m *countingMapper) PpuMapWrite(addr uint16) (uint32, bool) { return uint32(addr), true }
+
+func TestDummyAccesses(t *testing.T) {
+	tests := []struct {
+		name       string
+		program    []byte // runs from $0000, with X = 2
+		wantReads  map[uint16]int
+		wantWrites map[uint16]int
+	}{
+		{"LDA abs,X", []byte{0xBD, 0x00, 0x80},
+			map[uint16]int{0x8002: 1}, map[uint16]int{}},
+		{"LDA abs,X page cross", []byte{0xBD, 0xFF, 0x80},
+			map[uint16]int{0x8001: 1, 0x8101: 1}, map[uint16]int{}},
+		{"STA abs,X", []byte{0x9D, 0x00, 0x80},
+			map[uint16]int{0x8002: 1}, map[uint16]int{0x8002: 1}},
+		{"STA abs,X page cross", []byte{0x9D, 0xFF, 0x80},
+			map[uint16]int{0x8001: 1}, map[uint16]int{0x8101: 1}},
+		{"INC abs", []byte{0xEE, 0x00, 0x80},
+			map[uint16]int{0x8000: 1}, map[uint16]int{0x8000: 2}},
+		{"INC abs,X page cross", []byte{0xFE, 0xFF, 0x80},
+			map[uint16]int{0x8001: 1, 0x8101: 1}, map[uint16]int{0x8101: 2}},
+	}
+
+	for _, test := range tests {
+		mapper := &countingMapper{map[uint16]int{}, map[uint16]int{}}
+
+		bus := NewBus(false, false)
+		bus.Cart = &Cartridge{
+			prgMem: make([]byte, 16*1024),
+			chrMem: make([]byte, 8*1024),
+			prgRam: make([]byte, prgRamSize),
+			mapper: mapper,
+		}
+		cpu := bus.Cpu
+
+		copy(bus.Ram[:], test.program)
+		cpu.Pc = 0x0000
+		cpu.X = 2
+		cpu.Cycles = 0
+		cpu.Clock()
+
+		if !reflect.DeepEqual(mapper.reads, test.wantReads) {
+			t.Errorf("%v: reads = %v, want %v", test.name, mapper.reads, test.wantReads)
+		}
+		if !reflect.DeepEqual(mapper.writes, test.wantWrites) {
+			t.Errorf("%v: writes = %v, want %v", test.name, mapper.writes, test.wantWrites)
+		}
+	}
+}
+
+func TestDisassembleAround(t *testing.T) {
+	bus := NewBus(false, false)
+	cpu := bus.Cpu
+
+	copy(bus.Ram[0x0200:], []byte{
+		0xA9, 0x01, // LDA #$01
+		0x8D, 0x00, 0x03, // STA $0300
+		0xE8,       // INX
+		0xD0, 0xF8, // BNE $0200
+		0x4C, 0x00, 0x02, // JMP $0200
+	})
+
+	// Run up to the INX. The zeros before the program decode as BRKs, which
+	// would swallow the LDA's operand if the program hadn't been run.
+	cpu.Pc = 0x0200
+	for cpu.Pc != 0x0205 {
+		cpu.Cycles = 0
+		cpu.Clock()
+	}
+
+	lines, current := cpu.disassembleAround(cpu.Pc, 2, 2)
+
+	want := []string{
+		"$0200: LDA #$01 {IMM}",
+		"$0202: STA $0300 {ABS}",
+		"$0205: INX {IMP}",
+		"$0206: BNE $F8 [0200] {REL}",
+		"$0208: JMP $0200 {ABS}",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+	if current != 2 {
+		t.Errorf("current line = %d, want 2", current)
+	}
+}
+
+func TestPageCrossCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    uint16 // where the program runs from
+		program []byte // runs with X = 1, Y = 1, and Z clear
+		cycles  int
+		wantPc  uint16
+	}{
+		{"LDA abs,X", 0x0200, []byte{0xBD, 0x00, 0x03}, 4, 0x0203},
+		{"LDA abs,X page cross", 0x0200, []byte{0xBD, 0xFF, 0x03}, 5, 0x0203},
+		{"LDA abs,Y page cross", 0x0200, []byte{0xB9, 0xFF, 0x03}, 5, 0x0203},
+		{"LDA (zp),Y", 0x0200, []byte{0xB1, 0x10}, 5, 0x0202},
+		{"LDA (zp),Y page cross", 0x0200, []byte{0xB1, 0x12}, 6, 0x0202},
+		{"STA abs,X", 0x0200, []byte{0x9D, 0x00, 0x03}, 5, 0x0203},
+		{"STA abs,X page cross", 0x0200, []byte{0x9D, 0xFF, 0x03}, 5, 0x0203},
+		{"BEQ not taken", 0x0200, []byte{0xF0, 0x10}, 2, 0x0202},
+		{"BNE taken", 0x0200, []byte{0xD0, 0x10}, 3, 0x0212},
+		{"BNE taken page cross", 0x02F0, []byte{0xD0, 0x10}, 4, 0x0302},
+		{"BNE taken backwards", 0x0210, []byte{0xD0, 0xFC}, 3, 0x020E},
+		{"BNE taken -128", 0x0200, []byte{0xD0, 0x80}, 4, 0x0182},
+	}
+
+	for _, test := range tests {
+		bus := NewBus(false, false)
+		cpu := bus.Cpu
+
+		// Pointers for (zp),Y: $0300, and $03FF.
+		bus.Ram[0x10], bus.Ram[0x11] = 0x00, 0x03
+		bus.Ram[0x12], bus.Ram[0x13] = 0xFF, 0x03
+
+		copy(bus.Ram[test.addr:], test.program)
+		cpu.Pc = test.addr
+		cpu.X, cpu.Y = 1, 1
+		cpu.Status = 0x24
+		cpu.Cycles = 0
+		cpu.Clock()
+
+		if got := int(cpu.Cycles) + 1; got != test.cycles {
+			t.Errorf("%s: %d cycles, want %d", test.name, got, test.cycles)
+		}
+		if cpu.Pc != test.wantPc {
+			t.Errorf("%s: PC = $%04X, want $%04X", test.name, cpu.Pc, test.wantPc)
+		}
+	}
+}
+
+func TestJMPIndirectPageBug(t *testing.T) {
+	bus := NewBus(false, false)
+	cpu := bus.Cpu
+
+	// JMP ($02FF) reads the high byte of the target from $0200, not $0300.
+	copy(bus.Ram[0x0400:], []byte{0x6C, 0xFF, 0x02})
+	bus.Ram[0x02FF] = 0x34
+	bus.Ram[0x0200] = 0x12
+	bus.Ram[0x0300] = 0x56
+
+	cpu.Pc = 0x0400
+	cpu.Cycles = 0
+	cpu.Clock()
+
+	if cpu.Pc != 0x1234 {
+		t.Errorf("JMP ($02FF) jumped to $%04X, want $1234", cpu.Pc)
+	}
+	if got := int(cpu.Cycles) + 1; got != 5 {
+		t.Errorf("JMP ($02FF) took %d cycles, want 5", got)
+	}
+}
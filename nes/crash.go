@@ -0,0 +1,111 @@
+package nes
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+// When the emulator panics, a crash report is written to crashDir with what
+// the NES was doing at the time, then the panic continues.
+
+// Directory crash reports are written to.
+var crashDir = "./crashes"
+
+// Number of recently executed instructions kept for crash reports.
+const crashTraceLen = 64
+
+// An executed instruction, kept for crash reports.
+type traceEntry struct {
+	pc     uint16
+	opcode byte
+}
+
+// recordTrace adds the instruction about to be executed to the CPU's trace
+// ring buffer.
+func (cpu *Cpu6502) recordTrace() {
+	cpu.trace[cpu.traceIdx] = traceEntry{cpu.Pc, cpu.Opcode}
+	cpu.traceIdx = (cpu.traceIdx + 1) % crashTraceLen
+	if cpu.traceCount < crashTraceLen {
+		cpu.traceCount++
+	}
+}
+
+// recoverCrash writes a crash report if the emulator is panicking, and then
+// continues panicking. It must be deferred.
+func (b *Bus) recoverCrash() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	path, err := b.writeCrashReport(r, debug.Stack())
+	if err != nil {
+		log.Println("Unable to write crash report:", err)
+	} else {
+		log.Println("Crash report written to", path)
+	}
+
+	panic(r)
+}
+
+// writeCrashReport writes a crash report for the panic value r to a new file
+// in crashDir, and returns its path.
+func (b *Bus) writeCrashReport(r interface{}, stack []byte) (string, error) {
+	if err := os.MkdirAll(crashDir, 0775); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(crashDir, "crash"+time.Now().Format("20060102-150405")+".txt")
+	if err := ioutil.WriteFile(path, b.crashReport(r, stack), 0664); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// crashReport describes the panic and the state of the NES.
+func (b *Bus) crashReport(r interface{}, stack []byte) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "panic: %v\n\n", r)
+
+	// Cartridge
+	if b.Cart == nil {
+		buf.WriteString("Cartridge: none\n\n")
+	} else {
+		info := b.Cart.Info()
+		fmt.Fprintf(&buf, "Cartridge: hash %08X, mapper %d (%s), %v mirroring\n",
+			b.Cart.Hash(), info.MapperID, info.MapperName, b.Cart.Mirroring())
+		fmt.Fprintf(&buf, "Mapper state: %+v\n\n", b.Cart.mapper)
+	}
+
+	// CPU
+	cpu := b.Cpu
+	fmt.Fprintf(&buf, "CPU: PC:%04X A:%02X X:%02X Y:%02X P:%02X SP:%02X CYC:%d\n",
+		cpu.Pc, cpu.A, cpu.X, cpu.Y, cpu.Status, cpu.Sp, cpu.CycleCount)
+
+	// PPU
+	ppu := b.Ppu
+	fmt.Fprintf(&buf, "PPU: scanline:%d cycle:%d frame:%d CTRL:%02X MASK:%02X STATUS:%02X v:%04X t:%04X x:%d\n",
+		ppu.scanline, ppu.cycle, ppu.frames, byte(*ppu.ppuCtrl), byte(*ppu.ppuMask), byte(*ppu.ppuStatus),
+		ppu.vRam.value(), ppu.tRam.value(), ppu.scrollFineX)
+	fmt.Fprintf(&buf, "Clock count: %d\n\n", b.ClockCount)
+
+	// Recently executed instructions, oldest first.
+	fmt.Fprintf(&buf, "Last %d instructions:\n", cpu.traceCount)
+	start := cpu.traceIdx - cpu.traceCount + crashTraceLen
+	for i := 0; i < cpu.traceCount; i++ {
+		entry := cpu.trace[(start+i)%crashTraceLen]
+		fmt.Fprintf(&buf, "$%04X: %02X %s\n", entry.pc, entry.opcode, cpu.InstLookup[entry.opcode].Name)
+	}
+
+	fmt.Fprintf(&buf, "\n%s", stack)
+
+	return buf.Bytes()
+}
@@ -0,0 +1,68 @@
+package nes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCrashReport(t *testing.T) {
+	dir := t.TempDir()
+	defer func(d string) { crashDir = d }(crashDir)
+	crashDir = dir
+
+	// A program of NOPs.
+	rom := newTestRom(1, 1, 0x00, 0x00)
+	prg := rom[16 : 16+0x4000]
+	for i := range prg {
+		prg[i] = 0xEA
+	}
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0x80
+
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, rom))
+	for i := 0; i < 1000; i++ {
+		bus.Clock()
+	}
+
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		defer bus.recoverCrash()
+		panic("boom")
+	}()
+
+	if recovered != "boom" {
+		t.Errorf("recovered %v, want the panic to continue", recovered)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "crash*.txt"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("found crash reports %v, want 1 (%v)", files, err)
+	}
+	report, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"panic: boom",
+		"Cartridge: hash",
+		"mapper 0 (NROM)",
+		"CPU: PC:",
+		"PPU: scanline:",
+		"Last 64 instructions:",
+		": EA NOP\n",
+		"recoverCrash", // Go stack trace
+	} {
+		if !bytes.Contains(report, []byte(want)) {
+			t.Errorf("crash report missing %q:\n%s", want, report)
+		}
+	}
+
+	if n := strings.Count(string(report), ": EA NOP\n"); n != crashTraceLen {
+		t.Errorf("crash report has %d instructions, want %d", n, crashTraceLen)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"image"
 	"image/color"
 	"log"
+	"time"
 
 	"github.com/faiface/pixel"
 	"github.com/faiface/pixel/pixelgl"
@@ -25,10 +26,26 @@ type Display struct {
 	debugRegText        *text.Text  // CPU register printout
 	debugInstText       *text.Text  // CPU instruction disassembly
 	debugControllerText *text.Text  // Controller input status
+	debugMemText        *text.Text  // Memory dump
+
+	// Game picture settings
+	overscan    Overscan // Pixels cropped from each edge of the NES picture
+	aspectRatio float64  // Pixel aspect ratio (width / height)
+
+	presentTime time.Duration // Time taken by the last UpdateScreen
+
+	frozenRgba *image.RGBA // Game picture shown while video is paused, nil if not paused
 
 	isDebug bool // Debug mode enabled on the NES
 }
 
+// Overscan is the number of NES pixels hidden at each edge of the picture.
+// Televisions cut off part of the picture, and some games leave garbage in
+// the areas they expect to be hidden.
+type Overscan struct {
+	Top, Bottom, Left, Right int
+}
+
 const (
 	// Main NES display settings
 	nesResW    float64 = 256
@@ -44,6 +61,12 @@ const (
 	debugResH float64 = gameH
 )
 
+// Global defaults for the game picture, used unless a game overrides them.
+var (
+	DefaultOverscan    = Overscan{} // Show the whole picture.
+	DefaultAspectRatio = 1.0        // Square pixels. Use 8.0 / 7 for NTSC televisions.
+)
+
 func NewDisplay(isDebug bool) *Display {
 	rect := image.Rect(0, 0, int(nesResW), int(nesResH))
 	gameRgba := image.NewRGBA(rect)
@@ -67,14 +90,9 @@ func NewDisplay(isDebug bool) *Display {
 		log.Fatal("Unable to create new PixelGl window...\n", err)
 	}
 
-	// Calculate matrix recquired to render game to display based on the set scale.
-	pic := pixel.PictureDataFromImage(gameRgba)
-	gameMatrix := pixel.IM.Moved(pic.Bounds().Center().Scaled(scale))
-	gameMatrix = gameMatrix.Scaled(pic.Bounds().Center().Scaled(scale), scale)
-
 	// Calculate debug window matrix used to treat (0, 0) as top-left corner of
 	// the debug panel.
-	pic = pixel.PictureDataFromImage(debugRgba)
+	pic := pixel.PictureDataFromImage(debugRgba)
 	debugMatrix := pixel.IM.Moved(pic.Bounds().Center().Add(pixel.V(gameW, 0)))
 
 	// Debug text
@@ -82,25 +100,86 @@ func NewDisplay(isDebug bool) *Display {
 	debugRegText := text.New(pixel.V(gameW+8, gameH-40), debugAtlas)
 	debugInstText := text.New(pixel.V(gameW+8, gameH-180), debugAtlas)
 	debugControllerText := text.New(pixel.V(gameW+300, gameH-40), debugAtlas)
+	debugMemText := text.New(pixel.V(gameW+8, gameH-364), debugAtlas)
 
-	return &Display{
-		gameRgba,
-		debugRgba,
-		window,
-		gameMatrix,
-		debugMatrix,
-		debugAtlas,
-		debugRegText,
-		debugInstText,
-		debugControllerText,
-		isDebug,
+	d := &Display{
+		gameRgba:            gameRgba,
+		debugRgba:           debugRgba,
+		window:              window,
+		debugMatrix:         debugMatrix,
+		debugAtlas:          debugAtlas,
+		debugRegText:        debugRegText,
+		debugInstText:       debugInstText,
+		debugControllerText: debugControllerText,
+		debugMemText:        debugMemText,
+		overscan:            DefaultOverscan,
+		aspectRatio:         DefaultAspectRatio,
+		isDebug:             isDebug,
 	}
+	d.updateGameMatrix()
+
+	return d
+}
+
+// SetOverscan sets the number of pixels cropped from each edge of the game
+// picture.
+func (d *Display) SetOverscan(o Overscan) {
+	d.overscan = o
+}
+
+// SetAspectRatio sets the pixel aspect ratio (width / height) of the game
+// picture. The picture is shrunk along one axis to fit the window.
+func (d *Display) SetAspectRatio(ratio float64) {
+	if ratio <= 0 {
+		ratio = DefaultAspectRatio
+	}
+	d.aspectRatio = ratio
+	d.updateGameMatrix()
+}
+
+// Calculate matrix recquired to render game to display based on the set scale
+// and aspect ratio. The game picture is centered in the game area.
+func (d *Display) updateGameMatrix() {
+	scaleX, scaleY := scale, scale
+	if d.aspectRatio > 1 {
+		scaleY /= d.aspectRatio
+	} else {
+		scaleX *= d.aspectRatio
+	}
+
+	center := pixel.V(gameW/2, gameH/2)
+	d.gameMatrix = pixel.IM.Moved(center).ScaledXY(center, pixel.V(scaleX, scaleY))
+}
+
+// gameFrame returns the part of the game picture left visible after cropping
+// the overscan. Pixel pictures have their origin at the bottom-left.
+func (d *Display) gameFrame() pixel.Rect {
+	o := d.overscan
+	return pixel.R(
+		float64(o.Left),
+		float64(o.Bottom),
+		nesResW-float64(o.Right),
+		nesResH-float64(o.Top),
+	)
 }
 
 func (d *Display) DrawPixel(x, y int, c color.RGBA) {
 	d.gameRgba.SetRGBA(x, y, c)
 }
 
+// FillRow fills row y of the game display with a color, from x to the end of
+// the row.
+func (d *Display) FillRow(x, y int, c color.RGBA) {
+	for ; x < int(nesResW); x++ {
+		d.gameRgba.SetRGBA(x, y, c)
+	}
+}
+
+// Frame returns the game picture being drawn.
+func (d *Display) Frame() *image.RGBA {
+	return d.gameRgba
+}
+
 func (d *Display) DrawDebugPixel(x, y int, c color.RGBA) {
 	d.debugRgba.SetRGBA(x, y, c)
 }
@@ -121,10 +200,19 @@ func (d *Display) WriteRegDebugString(t string) {
 	d.debugRegText.WriteString(t)
 }
 
-// Write a string of text to the isntruction disassembly section of the debug panel.
-func (d *Display) WriteInstDebugString(t string) {
+// Write lines of disassembly to the instruction section of the debug panel,
+// highlighting the current instruction.
+func (d *Display) WriteInstDebugLines(lines []string, current int) {
 	d.debugInstText.Clear()
-	d.debugInstText.WriteString(t)
+	for i, line := range lines {
+		d.debugInstText.Color = colornames.White
+		prefix := "  "
+		if i == current {
+			d.debugInstText.Color = colornames.Yellow
+			prefix = "> "
+		}
+		d.debugInstText.WriteString(prefix + line + "\n")
+	}
 }
 
 // Write a string of text to the controller status section of the debug panel.
@@ -133,9 +221,23 @@ func (d *Display) WriteControllerDebugString(t string) {
 	d.debugControllerText.WriteString(t)
 }
 
+// Write a string of text to the memory dump section of the debug panel.
+func (d *Display) WriteMemDebugString(t string) {
+	d.debugMemText.Clear()
+	d.debugMemText.WriteString(t)
+}
+
 // UpdateScreen updates both the game display and the debug display using the
 // display's current image.RGBA representation of each.
 func (d *Display) UpdateScreen() {
+	// Nothing to show without a window.
+	if d.window == nil {
+		return
+	}
+
+	start := time.Now()
+	defer func() { d.presentTime = time.Since(start) }()
+
 	d.window.Clear(colornames.Black)
 
 	d.updateGameDisplay()
@@ -146,14 +248,43 @@ func (d *Display) UpdateScreen() {
 		d.debugRegText.Draw(d.window, pixel.IM)
 		d.debugInstText.Draw(d.window, pixel.IM)
 		d.debugControllerText.Draw(d.window, pixel.IM)
+		d.debugMemText.Draw(d.window, pixel.IM)
 	}
 
 	d.window.Update()
 }
 
+// SetFrozen freezes the game picture on the current frame, or unfreezes it.
+// Frames drawn while frozen are not shown.
+func (d *Display) SetFrozen(frozen bool) {
+	if !frozen {
+		d.frozenRgba = nil
+		return
+	}
+
+	if d.frozenRgba == nil {
+		d.frozenRgba = image.NewRGBA(d.gameRgba.Rect)
+		copy(d.frozenRgba.Pix, d.gameRgba.Pix)
+	}
+}
+
+// shownFrame returns the game picture to show on screen.
+func (d *Display) shownFrame() *image.RGBA {
+	if d.frozenRgba != nil {
+		return d.frozenRgba
+	}
+	return d.gameRgba
+}
+
 func (d *Display) updateGameDisplay() {
-	sprite := getSpriteFromImage(d.gameRgba)
-	sprite.Draw(d.window, d.gameMatrix)
+	pic := pixel.PictureDataFromImage(d.shownFrame())
+	frame := d.gameFrame()
+	sprite := pixel.NewSprite(pic, frame)
+
+	// Sprites are drawn centered on their frame, so shift the cropped frame
+	// back to where it sits in the full picture.
+	offset := frame.Center().Sub(pic.Bounds().Center())
+	sprite.Draw(d.window, pixel.IM.Moved(offset).Chained(d.gameMatrix))
 }
 
 func (d *Display) updateDebugDisplay() {
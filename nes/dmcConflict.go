@@ -0,0 +1,50 @@
+package nes
+
+// DMC DMA halts the CPU on a read cycle. While halted, the CPU keeps repeating
+// that read, and the controllers count each one as a read of the next button.
+// When the CPU was reading $4016 or $4017, a button is skipped: the famous DMC
+// conflict, which games that play DMC samples work around by reading the
+// controllers until two reads agree.
+//
+// The CPU runs a whole instruction on its first cycle, so the repeated read
+// happens after the CPU has read its button rather than before. The button
+// skipped is the next one instead of the one read, which corrupts the same
+// read sequence.
+//
+// reference: https://wiki.nesdev.com/w/index.php/APU_DMC#Conflict_with_controller_and_PPU_read
+
+// SetDMCConflict enables or disables emulation of DMC DMA corrupting
+// controller reads. Defaults to enabled, as on the NTSC 2A03.
+func (b *Bus) SetDMCConflict(enabled bool) {
+	b.dmcConflict = enabled
+}
+
+// SetDMCReadCorrection enables or disables correcting controller reads
+// corrupted by the DMC conflict. The repeated read still happens, but the
+// button skipped is put back, as if the game had read the controllers again
+// the way later revisions of some games do. This lets affected games be played
+// without the glitch. Defaults to disabled.
+func (b *Bus) SetDMCReadCorrection(enabled bool) {
+	b.dmcReadCorrection = enabled
+}
+
+// dmcControllerConflict repeats the read of a controller port that the CPU has
+// just made, when DMC DMA halts the CPU on it.
+func (b *Bus) dmcControllerConflict() {
+	// The CPU has run its whole instruction, so its last access was made on
+	// the cycle just run only if that was the instruction's last cycle.
+	if !b.dmcConflict || b.Cpu.Cycles > 0 || !b.Cpu.lastAccessRead {
+		return
+	}
+
+	addr := b.Cpu.lastAccessAddr
+	if addr < ctrlMinAddr || addr > ctrlMaxAddr {
+		return
+	}
+
+	state := b.ControllerState
+	b.CpuRead(addr)
+	if b.dmcReadCorrection {
+		b.ControllerState = state
+	}
+}
@@ -0,0 +1,23 @@
+package nes
+
+import "github.com/faiface/pixel/pixelgl"
+
+// Holding the fast forward key runs the NES as fast as possible, such as to
+// skip through slow text. Sound is muted meanwhile, as it would otherwise
+// play far more samples than the audio backend can keep up with.
+
+const fastForwardKey = pixelgl.KeyTab
+
+// SetFastForward runs the NES as fast as possible with sound muted, or returns
+// to the target FPS.
+func (b *Bus) SetFastForward(on bool) {
+	b.fastForward = on
+	b.Apu.SetMuted(on)
+}
+
+// Fast forward while the fast forward key is held, checked once per frame.
+func (b *Bus) updateFastForwardInput(win *pixelgl.Window) {
+	if held := win.Pressed(fastForwardKey); held != b.fastForward {
+		b.SetFastForward(held)
+	}
+}
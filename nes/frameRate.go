@@ -0,0 +1,66 @@
+package nes
+
+import "time"
+
+// Run paces frames to a target rate, the NTSC rate by default. The rate only
+// changes how often frames run, never how much is emulated: each frame is
+// always a whole PPU frame.
+
+// NtscFrameRate is the frame rate of an NTSC NES, about 60.0988 frames per
+// second. A frame is 341x262 PPU dots, one fewer on odd rendered frames, and
+// the PPU runs at 3 times the CPU clock.
+const NtscFrameRate = 3 * apuClockRate / (341*262 - 0.5)
+
+// SetTargetFPS sets the frames per second Run aims for. 0 or less runs as fast
+// as possible, for benchmarking.
+func (b *Bus) SetTargetFPS(fps float64) {
+	if fps < 0 {
+		fps = 0
+	}
+	b.targetFPS = fps
+}
+
+// TargetFPS returns the frames per second Run aims for, or 0 if uncapped.
+func (b *Bus) TargetFPS() float64 {
+	return b.targetFPS
+}
+
+// frameRate returns the frames per second Run is running at, 0 if uncapped.
+// While paused, the window is still updated at the NTSC rate.
+func (b *Bus) frameRate() float64 {
+	if b.paused {
+		return NtscFrameRate
+	}
+	if b.fastForward {
+		return 0
+	}
+	return b.targetFPS
+}
+
+// frameLimiter keeps frames at a steady rate by sleeping until each one is
+// due. Frames are scheduled from when the last was due, not when it finished,
+// so time spent emulating and drawing doesn't slow the rate down.
+type frameLimiter struct {
+	next time.Time // When the next frame is due
+}
+
+// wait sleeps until the next frame is due at fps frames per second, or returns
+// straight away if fps is 0.
+func (l *frameLimiter) wait(fps float64) {
+	now := time.Now()
+	if fps <= 0 {
+		l.next = now
+		return
+	}
+
+	interval := time.Duration(float64(time.Second) / fps)
+	l.next = l.next.Add(interval)
+
+	// Start again from now if more than a frame behind, such as after a slow
+	// frame or a change of rate, rather than rushing to catch up.
+	if l.next.Before(now.Add(-interval)) {
+		l.next = now
+	}
+
+	time.Sleep(l.next.Sub(now))
+}
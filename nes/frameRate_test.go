@@ -0,0 +1,54 @@
+package nes
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNtscFrameRate(t *testing.T) {
+	if math.Abs(NtscFrameRate-60.0988) > 0.0001 {
+		t.Errorf("NTSC frame rate = %v, want 60.0988", NtscFrameRate)
+	}
+
+	bus := NewBus(false, false)
+	if got := bus.TargetFPS(); got != NtscFrameRate {
+		t.Errorf("default target FPS = %v, want %v", got, NtscFrameRate)
+	}
+	bus.SetTargetFPS(-1)
+	if got := bus.TargetFPS(); got != 0 {
+		t.Errorf("target FPS after setting -1 = %v, want 0 (uncapped)", got)
+	}
+}
+
+func TestFrameLimiter(t *testing.T) {
+	var l frameLimiter
+
+	// 20 frames at 500 FPS take at least 19 frame intervals; the first frame
+	// isn't waited for.
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		l.wait(500)
+	}
+	if elapsed := time.Since(start); elapsed < 19*2*time.Millisecond {
+		t.Errorf("20 frames at 500 FPS took %v, want at least 38ms", elapsed)
+	}
+
+	// A slow frame isn't made up for by running the next frames back to back.
+	time.Sleep(20 * time.Millisecond)
+	l.wait(500)
+	start = time.Now()
+	l.wait(500)
+	if elapsed := time.Since(start); elapsed < time.Millisecond {
+		t.Errorf("frame after a slow frame waited %v, want about 2ms", elapsed)
+	}
+
+	// Uncapped never waits.
+	start = time.Now()
+	for i := 0; i < 1000; i++ {
+		l.wait(0)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("1000 uncapped frames took %v, want no waiting", elapsed)
+	}
+}
@@ -0,0 +1,102 @@
+package nes
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Number of recent frames kept for frame timing statistics.
+const frameTimeSamples = 300
+
+// FrameStats summarizes how long recent frames took to run in real time.
+type FrameStats struct {
+	Frames  int         // Number of frames sampled
+	Emulate TimingStats // Time spent emulating the frame
+	Present TimingStats // Time spent drawing the frame to the window
+}
+
+// TimingStats summarizes a set of durations.
+type TimingStats struct {
+	Min  time.Duration
+	Max  time.Duration
+	Mean time.Duration
+	P99  time.Duration // 99th percentile
+}
+
+func (s FrameStats) String() string {
+	return fmt.Sprintf("Frame times (%d frames):\nemulate %v\npresent %v", s.Frames, s.Emulate, s.Present)
+}
+
+func (s TimingStats) String() string {
+	return fmt.Sprintf("min %v max %v mean %v p99 %v",
+		s.Min.Round(time.Microsecond), s.Max.Round(time.Microsecond),
+		s.Mean.Round(time.Microsecond), s.P99.Round(time.Microsecond))
+}
+
+// frameTimer records the timing of the most recent frames in a ring buffer.
+type frameTimer struct {
+	mu sync.Mutex
+
+	emulate [frameTimeSamples]time.Duration
+	present [frameTimeSamples]time.Duration
+	next    int // Index of the next sample to write
+	count   int // Number of samples recorded, up to frameTimeSamples
+}
+
+// record adds the timing of one frame, replacing the oldest if full.
+func (t *frameTimer) record(emulate, present time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.emulate[t.next] = emulate
+	t.present[t.next] = present
+	t.next = (t.next + 1) % frameTimeSamples
+	if t.count < frameTimeSamples {
+		t.count++
+	}
+}
+
+func (t *frameTimer) stats() FrameStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return FrameStats{
+		Frames:  t.count,
+		Emulate: timingStats(t.emulate[:t.count]),
+		Present: timingStats(t.present[:t.count]),
+	}
+}
+
+// timingStats calculates the statistics of a set of durations.
+func timingStats(samples []time.Duration) TimingStats {
+	if len(samples) == 0 {
+		return TimingStats{}
+	}
+
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	// Nearest-rank percentile
+	p99 := (len(sorted)*99+99)/100 - 1
+
+	return TimingStats{
+		Min:  sorted[0],
+		Max:  sorted[len(sorted)-1],
+		Mean: total / time.Duration(len(sorted)),
+		P99:  sorted[p99],
+	}
+}
+
+// FrameTimeStats returns timing statistics for the last few seconds of frames
+// run by Run. Use it to track down occasional slow frames.
+func (b *Bus) FrameTimeStats() FrameStats {
+	return b.frameTimes.stats()
+}
@@ -0,0 +1,41 @@
+package nes
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFrameTimeStats(t *testing.T) {
+	var timer frameTimer
+
+	if got := timer.stats(); got != (FrameStats{}) {
+		t.Errorf("stats with no frames = %+v, want zero", got)
+	}
+
+	// Fill the buffer twice over, so only the last frameTimeSamples frames
+	// (1ms-300ms) are kept.
+	for i := 1; i <= 2*frameTimeSamples; i++ {
+		d := time.Duration(i-frameTimeSamples) * time.Millisecond
+		timer.record(d, 2*d)
+	}
+
+	got := timer.stats()
+	want := FrameStats{
+		Frames: frameTimeSamples,
+		Emulate: TimingStats{
+			Min:  1 * time.Millisecond,
+			Max:  300 * time.Millisecond,
+			Mean: 150500 * time.Microsecond,
+			P99:  297 * time.Millisecond,
+		},
+		Present: TimingStats{
+			Min:  2 * time.Millisecond,
+			Max:  600 * time.Millisecond,
+			Mean: 301 * time.Millisecond,
+			P99:  594 * time.Millisecond,
+		},
+	}
+	if got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,41 @@
+package nes
+
+// GameOverride holds settings applied automatically when a specific game is
+// inserted. Zero values fall back to the global defaults.
+type GameOverride struct {
+	Overscan    *Overscan // Overscan cropping, or nil for DefaultOverscan
+	AspectRatio float64   // Pixel aspect ratio, or 0 for DefaultAspectRatio
+}
+
+// Override database, keyed by ROM hash (see Cartridge.Hash).
+var gameOverrides = map[uint32]GameOverride{}
+
+// AddGameOverride registers settings for the game with the given ROM hash.
+func AddGameOverride(hash uint32, override GameOverride) {
+	gameOverrides[hash] = override
+}
+
+// applyDisplayDefaults applies the inserted game's overscan and aspect ratio to
+// the display, using the global defaults for anything not overridden.
+func (b *Bus) applyDisplayDefaults() {
+	if b.Disp == nil {
+		return
+	}
+
+	overscan := DefaultOverscan
+	aspectRatio := DefaultAspectRatio
+
+	if b.Cart != nil {
+		if override, ok := gameOverrides[b.Cart.Hash()]; ok {
+			if override.Overscan != nil {
+				overscan = *override.Overscan
+			}
+			if override.AspectRatio > 0 {
+				aspectRatio = override.AspectRatio
+			}
+		}
+	}
+
+	b.Disp.SetOverscan(overscan)
+	b.Disp.SetAspectRatio(aspectRatio)
+}
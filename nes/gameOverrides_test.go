@@ -0,0 +1,29 @@
+package nes
+
+import "testing"
+
+func TestGameOverrideDisplayDefaults(t *testing.T) {
+	cart := newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00))
+	other := newTestCartridge(t, newTestRom(2, 1, 0x00, 0x00))
+
+	overscan := Overscan{Top: 8, Bottom: 8, Left: 8}
+	AddGameOverride(cart.Hash(), GameOverride{Overscan: &overscan})
+	defer delete(gameOverrides, cart.Hash())
+
+	bus := NewBus(false, false)
+	bus.Disp = &Display{}
+
+	bus.InsertCartridge(cart)
+	if bus.Disp.overscan != overscan {
+		t.Errorf("overscan = %+v, want %+v", bus.Disp.overscan, overscan)
+	}
+	if bus.Disp.aspectRatio != DefaultAspectRatio {
+		t.Errorf("aspect ratio = %v, want default %v", bus.Disp.aspectRatio, DefaultAspectRatio)
+	}
+
+	// Games without an override use the global defaults.
+	bus.InsertCartridge(other)
+	if bus.Disp.overscan != DefaultOverscan {
+		t.Errorf("overscan = %+v, want default %+v", bus.Disp.overscan, DefaultOverscan)
+	}
+}
@@ -0,0 +1,85 @@
+package nes
+
+import (
+	"log"
+
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// How far (0 to 1) the left analog stick is pushed before it presses a
+// direction on the D-pad.
+const gamepadDeadzone = 0.5
+
+// Gamepad buttons bound to each controller by default, for an Xbox style
+// layout. The bottom and right face buttons sit where B and A are on an NES
+// controller.
+var defaultGamepadBindings = map[Button]pixelgl.GamepadButton{
+	ButtonRight:  pixelgl.ButtonDpadRight,
+	ButtonLeft:   pixelgl.ButtonDpadLeft,
+	ButtonDown:   pixelgl.ButtonDpadDown,
+	ButtonUp:     pixelgl.ButtonDpadUp,
+	ButtonStart:  pixelgl.ButtonStart,
+	ButtonSelect: pixelgl.ButtonBack,
+	ButtonB:      pixelgl.ButtonA,
+	ButtonA:      pixelgl.ButtonB,
+}
+
+// SetGamepad reads the controller's buttons from a connected joystick, as
+// well as the keyboard. Controller 1 reads Joystick1 by default. The joystick
+// can be plugged in and out while the NES runs.
+func (c *Controller) SetGamepad(js pixelgl.Joystick) {
+	c.gamepad = js
+	c.gamepadEnabled = true
+	c.gamepadConnected = false
+}
+
+// SetGamepadBinding binds a gamepad button to a controller button, replacing
+// the button's current gamepad button.
+func (c *Controller) SetGamepadBinding(b Button, button pixelgl.GamepadButton) {
+	c.gamepadBindings[b] = button
+}
+
+// pollGamepad returns whether the controller's gamepad is connected, logging
+// when it is plugged in or out.
+func (c *Controller) pollGamepad(win *pixelgl.Window) bool {
+	if !c.gamepadEnabled {
+		return false
+	}
+
+	connected := win.JoystickPresent(c.gamepad)
+	if connected != c.gamepadConnected {
+		if connected {
+			log.Printf("Gamepad connected: %s\n", win.JoystickName(c.gamepad))
+		} else {
+			log.Println("Gamepad disconnected")
+
+			// Let go of the buttons held when it was unplugged.
+			c.releaseAll()
+		}
+		c.gamepadConnected = connected
+	}
+
+	return connected
+}
+
+// gamepadPressed returns whether a button is held on the gamepad, through its
+// bound gamepad button or, for the D-pad, the left analog stick.
+func (c *Controller) gamepadPressed(win *pixelgl.Window, b Button) bool {
+	if button, ok := c.gamepadBindings[b]; ok && win.JoystickPressed(c.gamepad, button) {
+		return true
+	}
+
+	// Pushing the stick up is negative.
+	switch b {
+	case ButtonRight:
+		return win.JoystickAxis(c.gamepad, pixelgl.AxisLeftX) > gamepadDeadzone
+	case ButtonLeft:
+		return win.JoystickAxis(c.gamepad, pixelgl.AxisLeftX) < -gamepadDeadzone
+	case ButtonDown:
+		return win.JoystickAxis(c.gamepad, pixelgl.AxisLeftY) > gamepadDeadzone
+	case ButtonUp:
+		return win.JoystickAxis(c.gamepad, pixelgl.AxisLeftY) < -gamepadDeadzone
+	}
+
+	return false
+}
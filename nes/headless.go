@@ -0,0 +1,28 @@
+package nes
+
+import "image"
+
+// RunHeadless runs the inserted cartridge for the given number of frames
+// without opening a window, and returns the last frame drawn. The frame is a
+// copy, so it stays the same as the NES keeps running.
+//
+// An ImageRenderer is connected if the PPU has no renderer. Later calls carry
+// on from where the last one stopped.
+func (b *Bus) RunHeadless(frames int) *image.RGBA {
+	// Write a crash report if emulation panics.
+	defer b.recoverCrash()
+
+	if b.Ppu.display == nil {
+		b.Ppu.ConnectDisplay(NewImageRenderer())
+	}
+
+	for i := 0; i < frames; i++ {
+		b.StepFrame()
+	}
+
+	drawn := b.Ppu.display.Frame()
+	frame := image.NewRGBA(drawn.Rect)
+	copy(frame.Pix, drawn.Pix)
+
+	return frame
+}
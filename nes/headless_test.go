@@ -0,0 +1,33 @@
+package nes
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"testing"
+)
+
+func TestRunHeadless(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newIntegrationRom()))
+
+	// Same picture as running with a display.
+	frame := bus.RunHeadless(10)
+	if got := fmt.Sprintf("%08X", crc32.ChecksumIEEE(frame.Pix)); got != integrationGoldenHash {
+		t.Errorf("frame hash = %v, want %v", got, integrationGoldenHash)
+	}
+	if w, h := frame.Rect.Dx(), frame.Rect.Dy(); w != 256 || h != 240 {
+		t.Errorf("frame size = %dx%d, want 256x240", w, h)
+	}
+
+	// The returned frame is not drawn over by later frames.
+	pix := append([]byte(nil), frame.Pix...)
+	drawn := bus.Ppu.display.Frame()
+	for i := range drawn.Pix {
+		drawn.Pix[i] = 0
+	}
+	bus.RunHeadless(1)
+	if !bytes.Equal(frame.Pix, pix) {
+		t.Error("frame changed after running more frames")
+	}
+}
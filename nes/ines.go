@@ -0,0 +1,180 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// iNES file header
+// reference: https://wiki.nesdev.com/w/index.php/INES
+//
+// Bytes:
+//
+//	0-3   - Constant "NES" followed by MS-DOS end of file
+//	4     - PRG ROM size in 16KB chunks
+//	5     - CHR ROM size in 8KB chunks, 0 for CHR RAM
+//	6     - Flags 6: mapper low nibble, trainer, battery, mirroring
+//	7     - Flags 7: mapper high nibble, PlayChoice-10, console type
+//	8     - Flags 8: PRG RAM size (rarely used)
+//	9     - Flags 9: TV system (rarely used)
+//	10-15 - Unused padding
+//
+// NES 2.0 headers are marked by bits 2-3 of flags 7 set to 0b10, and use
+// bytes 8-15 for larger ROM and mapper numbers and the memory sizes.
+// reference: https://wiki.nesdev.com/w/index.php/NES_2.0
+//
+//	8     - Mapper bits 8-11 (low nibble), submapper (high nibble)
+//	9     - PRG ROM size MSB (low nibble), CHR ROM size MSB (high nibble)
+//	10    - PRG-RAM shift (low nibble), PRG-NVRAM shift (high nibble)
+//	11    - CHR-RAM shift (low nibble), CHR-NVRAM shift (high nibble)
+//	12    - CPU/PPU timing
+//	13-15 - Console type details, misc. ROMs, default expansion device
+type INesHeader struct {
+	IsNES2 bool // NES 2.0 header
+
+	PrgRomSize int // Bytes
+	ChrRomSize int // Bytes, 0 if the cartridge uses CHR RAM
+
+	// RAM sizes in bytes. NVRAM is battery-backed. iNES 1.0 headers give the
+	// whole PRG-RAM size in PrgRamSize (8KB unless flags 8 says more), and
+	// 8KB of CHR RAM when there is no CHR ROM.
+	PrgRamSize   int
+	PrgNvramSize int
+	ChrRamSize   int
+	ChrNvramSize int
+
+	Mapper    int
+	Submapper byte // NES 2.0 only
+	Mirroring MirrorMode
+
+	HasBattery    bool // Battery-backed PRG-RAM
+	HasTrainer    bool // 512-byte trainer before PRG ROM
+	HasPlayChoice bool // 8KB PlayChoice-10 INST-ROM after CHR ROM
+	IsVSSystem    bool
+	Region        Region
+}
+
+const inesHeaderSize = 16
+
+var inesMagic = [4]byte{'N', 'E', 'S', 0x1A}
+
+// ParseINesHeader parses the header at the start of an iNES file, checking
+// the file is long enough for the ROM sizes it gives.
+func ParseINesHeader(data []byte) (INesHeader, error) {
+	var header INesHeader
+
+	if len(data) < inesHeaderSize {
+		return header, fmt.Errorf("iNES header too short: %d bytes", len(data))
+	}
+	if [4]byte{data[0], data[1], data[2], data[3]} != inesMagic {
+		return header, errors.New("not an iNES file: missing \"NES\\x1A\"")
+	}
+
+	flags6, flags7, flags9 := data[6], data[7], data[9]
+	header.IsNES2 = flags7&0x0C == 0x08
+
+	header.PrgRomSize = int(data[4]) * 16 * 1024
+	header.ChrRomSize = int(data[5]) * 8 * 1024
+	if header.IsNES2 {
+		var prgOk, chrOk bool
+		header.PrgRomSize, prgOk = nes2RomSize(data[4], data[9]&0x0F, 16*1024)
+		header.ChrRomSize, chrOk = nes2RomSize(data[5], data[9]>>4, 8*1024)
+		if !prgOk || !chrOk {
+			return header, errors.New("NES 2.0 header ROM size too large")
+		}
+	}
+	if header.PrgRomSize == 0 {
+		return header, errors.New("iNES header has no PRG ROM")
+	}
+
+	// Mapper number from the high nibbles of flags 6 and 7.
+	header.Mapper = int(flags7&0xF0 | flags6>>4)
+	if header.IsNES2 {
+		header.Mapper |= int(data[8]&0x0F) << 8
+		header.Submapper = data[8] >> 4
+	}
+
+	// RAM sizes
+	if header.IsNES2 {
+		header.PrgRamSize = nes2RamSize(data[10] & 0x0F)
+		header.PrgNvramSize = nes2RamSize(data[10] >> 4)
+		header.ChrRamSize = nes2RamSize(data[11] & 0x0F)
+		header.ChrNvramSize = nes2RamSize(data[11] >> 4)
+	} else {
+		// Flags 8 is the PRG-RAM size in 8KB units, where 0 means 8KB.
+		header.PrgRamSize = 8 * 1024
+		if data[8] > 1 {
+			header.PrgRamSize = int(data[8]) * 8 * 1024
+		}
+		if header.ChrRomSize == 0 {
+			header.ChrRamSize = 8 * 1024
+		}
+	}
+
+	// Nametable mirroring (bit 0 of flags 6). Bit 3 means the cartridge has
+	// its own VRAM for four-screen mirroring, whatever bit 0 says.
+	header.Mirroring = MirrorHorizontal
+	if flags6&0x08 > 0 {
+		header.Mirroring = MirrorFourScreen
+	} else if flags6&0x01 > 0 {
+		header.Mirroring = MirrorVertical
+	}
+
+	header.HasBattery = flags6&0x02 > 0
+	header.HasTrainer = flags6&0x04 > 0
+	header.HasPlayChoice = flags7&0x04 > 0
+
+	// The header is followed by the trainer, PRG ROM, CHR ROM, and
+	// PlayChoice INST-ROM (ignored).
+	size := inesHeaderSize + header.PrgRomSize + header.ChrRomSize
+	if header.HasTrainer {
+		size += trainerSize
+	}
+	if len(data) < size {
+		return header, fmt.Errorf("ROM file too short: %d bytes, header needs %d", len(data), size)
+	}
+
+	// Console type (low 2 bits of flags 7). 1 is a VS System board, in both
+	// iNES and NES 2.0 headers.
+	header.IsVSSystem = flags7&0x03 == 0x01
+
+	// TV system (bit 0 of flags 9). NES 2.0 uses the low 2 bits of byte 12
+	// instead: 0 NTSC, 1 PAL, 2 multi-region, 3 Dendy. Multi-region games
+	// run as NTSC, and Dendy consoles run at 50Hz like PAL.
+	header.Region = RegionNTSC
+	if header.IsNES2 {
+		if timing := data[12] & 0x03; timing == 1 || timing == 3 {
+			header.Region = RegionPAL
+		}
+	} else if flags9&0x01 > 0 {
+		header.Region = RegionPAL
+	}
+
+	return header, nil
+}
+
+// nes2RomSize returns a NES 2.0 ROM size in bytes, from its LSB byte and MSB
+// nibble. Sizes are normally a count of units. With the MSB nibble set to 0xF
+// the LSB byte is instead EEEEEEMM, giving 2^E * (MM*2 + 1) bytes, and ok is
+// false if that is over 2GB.
+func nes2RomSize(lsb, msb byte, unit int) (size int, ok bool) {
+	if msb == 0x0F {
+		exponent, multiplier := lsb>>2, int64(lsb&0x03)*2+1
+		if exponent > 31 {
+			return 0, false
+		}
+		size := int64(1) << exponent * multiplier
+		return int(size), size <= math.MaxInt32
+	}
+	return (int(msb)<<8 | int(lsb)) * unit, true
+}
+
+// nes2RamSize returns a NES 2.0 RAM size in bytes from its shift count: 0 for
+// none, otherwise 64 << shift.
+func nes2RamSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << shift
+}
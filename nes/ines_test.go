@@ -0,0 +1,178 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestParseINesHeader(t *testing.T) {
+	// 2 x 16KB PRG, 1 x 8KB CHR, mapper 0x42, vertical, battery, trainer,
+	// VS System, PAL.
+	rom := newTestRom(2, 1, 0x27, 0x41)
+	rom[9] = 0x01
+	rom = append(rom, make([]byte, trainerSize)...)
+
+	header, err := ParseINesHeader(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := INesHeader{
+		PrgRomSize: 32 * 1024,
+		ChrRomSize: 8 * 1024,
+		PrgRamSize: 8 * 1024,
+		Mapper:     0x42,
+		Mirroring:  MirrorVertical,
+		HasBattery: true,
+		HasTrainer: true,
+		IsVSSystem: true,
+		Region:     RegionPAL,
+	}
+	if header != want {
+		t.Errorf("header = %+v, want %+v", header, want)
+	}
+}
+
+func TestParseNES2Header(t *testing.T) {
+	// NES 2.0: mapper 0x142 submapper 3, 0x102 x 16KB PRG, CHR RAM,
+	// 8KB PRG-RAM, 32KB PRG-NVRAM, 32KB CHR RAM, Dendy timing.
+	rom := newTestRom(2, 0, 0x22, 0x48)
+	rom[8], rom[9], rom[10], rom[11], rom[12] = 0x31, 0x01, 0x97, 0x09, 0x03
+	rom = append(rom, make([]byte, 0x100*16*1024)...)
+
+	header, err := ParseINesHeader(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := INesHeader{
+		IsNES2:       true,
+		PrgRomSize:   0x102 * 16 * 1024,
+		PrgRamSize:   8 * 1024,
+		PrgNvramSize: 32 * 1024,
+		ChrRamSize:   32 * 1024,
+		Mapper:       0x142,
+		Submapper:    3,
+		Mirroring:    MirrorHorizontal,
+		HasBattery:   true,
+		Region:       RegionPAL,
+	}
+	if header != want {
+		t.Errorf("header = %+v, want %+v", header, want)
+	}
+
+	// Exponent-multiplier PRG ROM size: 2^3 * 3 bytes.
+	rom[4], rom[9] = 0x0D, 0x0F
+	if header, _ := ParseINesHeader(rom); header.PrgRomSize != 24 {
+		t.Errorf("exponent PRG ROM size = %d, want 24", header.PrgRomSize)
+	}
+
+	// Without the NES 2.0 identifier, the same bytes are read as iNES 1.0.
+	rom[4], rom[7], rom[9] = 2, 0x40, 0x00
+	header, err = ParseINesHeader(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.IsNES2 || header.Mapper != 0x42 || header.Submapper != 0 ||
+		header.PrgRomSize != 32*1024 || header.ChrRamSize != 8*1024 {
+		t.Errorf("iNES 1.0 header = %+v", header)
+	}
+}
+
+func TestFourScreenMirroring(t *testing.T) {
+	// Bit 3 of flags 6 overrides bit 0.
+	for _, flags6 := range []byte{0x08, 0x09} {
+		header, err := ParseINesHeader(newTestRom(1, 1, flags6, 0x00))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Mirroring != MirrorFourScreen {
+			t.Errorf("flags 6 $%02X: mirroring = %v, want %v", flags6, header.Mirroring, MirrorFourScreen)
+		}
+	}
+
+	// MMC3 can't switch a four-screen cartridge's mirroring.
+	cart := newTestCartridge(t, newTestRom(2, 1, 0x48, 0x00))
+	cart.cpuWrite(0xA000, 0x01)
+	if got := cart.Mirroring(); got != MirrorFourScreen {
+		t.Errorf("mirroring after MMC3 write = %v, want %v", got, MirrorFourScreen)
+	}
+}
+
+func TestNES2RamSizes(t *testing.T) {
+	// NROM, CHR RAM, 16KB PRG-RAM, 16KB CHR RAM.
+	rom := newTestRom(1, 0, 0x00, 0x08)
+	rom[10], rom[11] = 0x08, 0x08
+
+	cart := newTestCartridge(t, rom)
+	if len(cart.prgRam) != 16*1024 {
+		t.Errorf("PRG-RAM size = %d, want %d", len(cart.prgRam), 16*1024)
+	}
+	if len(cart.chrMem) != 16*1024 {
+		t.Errorf("CHR RAM size = %d, want %d", len(cart.chrMem), 16*1024)
+	}
+}
+
+func TestParseINesHeaderErrors(t *testing.T) {
+	badMagic := newTestRom(1, 1, 0x00, 0x00)
+	badMagic[3] = 0x00
+
+	// NES 2.0 with an exponent-multiplier PRG ROM size.
+	nes2Exponent := func(prgSize byte) []byte {
+		rom := newTestRom(1, 0, 0x00, 0x08)
+		rom[4], rom[9] = prgSize, 0x0F
+		return rom
+	}
+
+	// NES 2.0 with 0x101 x 16KB PRG ROM, but only one in the file.
+	nes2Large := newTestRom(1, 0, 0x00, 0x08)
+	nes2Large[9] = 0x01
+
+	tests := map[string][]byte{
+		"empty":     nil,
+		"too short": newTestRom(1, 1, 0x00, 0x00)[:15],
+		"bad magic": badMagic,
+		"no PRG":    newTestRom(0, 1, 0x00, 0x00),
+
+		"truncated PRG":      newTestRom(2, 1, 0x00, 0x00)[:16+16*1024],
+		"truncated CHR":      newTestRom(1, 1, 0x00, 0x00)[:16+16*1024+4*1024],
+		"truncated trainer":  newTestRom(1, 1, 0x04, 0x00),
+		"NES 2.0 truncated":  nes2Large,
+		"exponent overflow":  nes2Exponent(0xFC), // 2^63 bytes
+		"exponent negative":  nes2Exponent(0xFF), // 2^63 * 7 bytes
+		"exponent too large": nes2Exponent(0x80), // 2^32 bytes
+		"exponent past EOF":  nes2Exponent(0x50), // 1MB
+	}
+
+	for name, data := range tests {
+		if _, err := ParseINesHeader(data); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestLoadBytes(t *testing.T) {
+	bus := NewBus(false, false)
+
+	// Header promises more PRG ROM than the file holds.
+	rom := newTestRom(2, 1, 0x00, 0x00)
+	if err := bus.LoadBytes(rom[:16+16*1024]); err == nil {
+		t.Errorf("truncated ROM: no error")
+	}
+
+	// Unsupported mapper.
+	if err := bus.LoadBytes(newTestRom(1, 1, 0xF0, 0xF0)); err == nil {
+		t.Errorf("unsupported mapper: no error")
+	}
+
+	if bus.Cart != nil {
+		t.Fatalf("cartridge inserted after failed loads")
+	}
+
+	rom[16+0x7FFC], rom[16+0x7FFD] = 0x34, 0x92
+	if err := bus.LoadBytes(rom); err != nil {
+		t.Fatal(err)
+	}
+	if bus.Cpu.Pc != 0x9234 {
+		t.Errorf("PC = %#04x, want 0x9234", bus.Cpu.Pc)
+	}
+}
@@ -0,0 +1,110 @@
+package nes
+
+import (
+	"fmt"
+	"hash/crc32"
+	"image"
+	"testing"
+)
+
+// Test program for a 16KB NROM cartridge, loaded at $8000. It sets up the
+// palette, a row of background tiles, and one sprite copied to OAM with DMA,
+// then enables rendering and loops. The NMI handler repeats the DMA each frame.
+var integrationProgram = []byte{
+	// 8000: SEI / CLD / LDX #$FF / TXS
+	0x78, 0xD8, 0xA2, 0xFF, 0x9A,
+	// 8005: BIT $2002 / BPL $8005 ; wait for vblank
+	// 800A: BIT $2002 / BPL $800A ; and once more for the PPU to warm up
+	0x2C, 0x02, 0x20, 0x10, 0xFB,
+	0x2C, 0x02, 0x20, 0x10, 0xFB,
+
+	// 800F: LDA #$3F / STA $2006 / LDA #$00 / STA $2006 ; palette
+	0xA9, 0x3F, 0x8D, 0x06, 0x20, 0xA9, 0x00, 0x8D, 0x06, 0x20,
+	// 8019: LDX #$00
+	// 801B: LDA $9000,X / STA $2007 / INX / CPX #$20 / BNE $801B
+	0xA2, 0x00,
+	0xBD, 0x00, 0x90, 0x8D, 0x07, 0x20, 0xE8, 0xE0, 0x20, 0xD0, 0xF5,
+
+	// 8026: LDA #$21 / STA $2006 / LDA #$04 / STA $2006 ; 24 tiles from $2104
+	0xA9, 0x21, 0x8D, 0x06, 0x20, 0xA9, 0x04, 0x8D, 0x06, 0x20,
+	// 8030: LDA #$01 / LDX #24
+	// 8034: STA $2007 / DEX / BNE $8034
+	0xA9, 0x01, 0xA2, 0x18,
+	0x8D, 0x07, 0x20, 0xCA, 0xD0, 0xFA,
+
+	// 803A: LDA #$FF / LDX #$00 ; hide all sprites
+	// 803E: STA $0200,X / INX / BNE $803E
+	0xA9, 0xFF, 0xA2, 0x00,
+	0x9D, 0x00, 0x02, 0xE8, 0xD0, 0xFA,
+	// 8044: sprite 0 at y=100, tile 2, attributes 0, x=120
+	0xA9, 0x64, 0x8D, 0x00, 0x02,
+	0xA9, 0x02, 0x8D, 0x01, 0x02,
+	0xA9, 0x00, 0x8D, 0x02, 0x02,
+	0xA9, 0x78, 0x8D, 0x03, 0x02,
+	// 8058: LDA #$02 / STA $4014 ; OAM DMA from $0200
+	0xA9, 0x02, 0x8D, 0x14, 0x40,
+
+	// 805D: LDA #$00 / STA $2005 / STA $2005 ; no scrolling
+	0xA9, 0x00, 0x8D, 0x05, 0x20, 0x8D, 0x05, 0x20,
+	// 8065: LDA #$80 / STA $2000 ; NMI on
+	0xA9, 0x80, 0x8D, 0x00, 0x20,
+	// 806A: LDA #$1E / STA $2001 ; show background and sprites
+	0xA9, 0x1E, 0x8D, 0x01, 0x20,
+	// 806F: JMP $806F
+	0x4C, 0x6F, 0x80,
+
+	// 8072: LDA #$02 / STA $4014 / RTI ; NMI: OAM DMA
+	0xA9, 0x02, 0x8D, 0x14, 0x40, 0x40,
+}
+
+var integrationPalette = []byte{
+	0x0F, 0x16, 0x27, 0x30, 0x0F, 0x16, 0x27, 0x30, 0x0F, 0x16, 0x27, 0x30, 0x0F, 0x16, 0x27, 0x30,
+	0x0F, 0x12, 0x2A, 0x30, 0x0F, 0x12, 0x2A, 0x30, 0x0F, 0x12, 0x2A, 0x30, 0x0F, 0x12, 0x2A, 0x30,
+}
+
+// Background tile 1 (checkerboard) and sprite tile 2 (diamond).
+var integrationTiles = map[int][16]byte{
+	1: {0xAA, 0x55, 0xAA, 0x55, 0xAA, 0x55, 0xAA, 0x55, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00},
+	2: {0x18, 0x3C, 0x7E, 0xFF, 0xFF, 0x7E, 0x3C, 0x18, 0x00, 0x18, 0x3C, 0x7E, 0x7E, 0x3C, 0x18, 0x00},
+}
+
+// Hash of the 10th frame rendered by the integration program.
+const integrationGoldenHash = "FF5949AA"
+
+// newIntegrationRom assembles the integration program into an NROM iNES file.
+func newIntegrationRom() []byte {
+	rom := newTestRom(1, 1, 0x00, 0x00)
+	prg := rom[16 : 16+16*1024]
+	chr := rom[16+16*1024:]
+
+	copy(prg, integrationProgram)
+	copy(prg[0x1000:], integrationPalette)
+	for tile, data := range integrationTiles {
+		copy(chr[tile*16:], data[:])
+	}
+
+	// NMI, reset, and IRQ vectors.
+	copy(prg[0x3FFA:], []byte{0x72, 0x80, 0x00, 0x80, 0x77, 0x80})
+
+	return rom
+}
+
+func TestIntegrationFrame(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newIntegrationRom()))
+
+	disp := &Display{
+		gameRgba: image.NewRGBA(image.Rect(0, 0, int(nesResW), int(nesResH))),
+	}
+	bus.Disp = disp
+	bus.Ppu.ConnectDisplay(disp)
+
+	for i := 0; i < 10; i++ {
+		bus.StepFrame()
+	}
+
+	got := fmt.Sprintf("%08X", crc32.ChecksumIEEE(disp.gameRgba.Pix))
+	if got != integrationGoldenHash {
+		t.Errorf("frame hash = %v, want %v", got, integrationGoldenHash)
+	}
+}
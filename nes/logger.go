@@ -0,0 +1,136 @@
+package nes
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LogConfig configures the CPU and PPU log files.
+type LogConfig struct {
+	Dir      string // Directory to write logs to, created if missing. Defaults to ./logs
+	MaxSize  int64  // Start a new log file after this many bytes. 0 disables rotation.
+	MaxFiles int    // Number of rotated files to keep per log, oldest removed first. 0 keeps all.
+}
+
+const defaultLogDir = "./logs"
+
+// EnableLogging starts logging CPU instructions and PPU activity to files in
+// the configured directory.
+func (b *Bus) EnableLogging(cfg LogConfig) error {
+	// Open both log files before using either, so a failure leaves logging
+	// as it was.
+	cpuLog, err := newLogWriter(cfg, "cpu")
+	if err != nil {
+		return err
+	}
+	ppuLog, err := newLogWriter(cfg, "ppu")
+	if err != nil {
+		cpuLog.Close()
+		return err
+	}
+
+	b.Cpu.Logger = log.New(cpuLog, "", 0)
+	b.Ppu.logger = log.New(ppuLog, "", 0)
+	b.isLogging = true
+
+	return nil
+}
+
+// newLogWriter returns a writer to <dir>/<name><timestamp>.log.
+func newLogWriter(cfg LogConfig, name string) (*rotatingWriter, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		dir = defaultLogDir
+	}
+
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return nil, fmt.Errorf("unable to create log directory: %w", err)
+	}
+
+	w := &rotatingWriter{
+		dir:      dir,
+		name:     name + time.Now().Format("20060102-150405"),
+		maxSize:  cfg.MaxSize,
+		maxFiles: cfg.MaxFiles,
+	}
+	if err := w.rotate(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// rotatingWriter writes to a log file, moving on to a new numbered file each
+// time maxSize bytes have been written.
+//
+// Files are named <name>.log, <name>.1.log, <name>.2.log, ...
+type rotatingWriter struct {
+	dir      string
+	name     string
+	maxSize  int64
+	maxFiles int
+
+	file  *os.File
+	size  int64 // Bytes written to the current file
+	count int   // Number of files opened
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the current log file.
+func (w *rotatingWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+
+	return err
+}
+
+// rotate closes the current log file and opens the next one, removing the
+// oldest file if there are more than maxFiles.
+func (w *rotatingWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(w.path(w.count), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return fmt.Errorf("unable to create log file: %w", err)
+	}
+
+	w.file = f
+	w.size = 0
+	w.count++
+
+	if w.maxFiles > 0 && w.count > w.maxFiles {
+		os.Remove(w.path(w.count - w.maxFiles - 1))
+	}
+
+	return nil
+}
+
+// path returns the path of the i-th log file.
+func (w *rotatingWriter) path(i int) string {
+	if i == 0 {
+		return filepath.Join(w.dir, w.name+".log")
+	}
+	return filepath.Join(w.dir, fmt.Sprintf("%s.%d.log", w.name, i))
+}
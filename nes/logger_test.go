@@ -0,0 +1,60 @@
+package nes
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogRotation(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "nested", "logs")
+
+	w, err := newLogWriter(LogConfig{Dir: dir, MaxSize: 100, MaxFiles: 2}, "cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	logger := log.New(w, "", 0)
+
+	// 10 lines of 40 bytes, 2 lines per file.
+	line := strings.Repeat("x", 39)
+	for i := 0; i < 10; i++ {
+		logger.Print(line)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("%d log files kept, want 2", len(files))
+	}
+
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 100 {
+			t.Errorf("%v is %d bytes, want at most 100", f.Name(), info.Size())
+		}
+		if !strings.HasPrefix(f.Name(), "cpu") || !strings.HasSuffix(f.Name(), ".log") {
+			t.Errorf("unexpected log file name %v", f.Name())
+		}
+	}
+}
+
+func TestLogDirError(t *testing.T) {
+	// A regular file where the log directory should be.
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := NewBus(false, false)
+	if err := bus.EnableLogging(LogConfig{Dir: path}); err == nil {
+		t.Error("expected an error creating the log directory")
+	}
+}
@@ -1,9 +1,83 @@
 package nes
 
-// Mapper functions return whether or not the given address was successfully mapped.
+// Mapper maps CPU and PPU addresses on the cartridge to offsets in its PRG and
+// CHR memory. Each function returns false if the cartridge memory does not
+// respond to the address.
 type Mapper interface {
-	cpuMapRead(uint16) uint16
-	cpuMapWrite(uint16) uint16
-	ppuMapRead(uint16) uint16
-	ppuMapWrite(uint16) uint16
+	CpuMapRead(addr uint16) (mapped uint32, ok bool)
+
+	// Mappers with registers in the PRG ROM address space latch the data
+	// written instead of mapping it to memory.
+	CpuMapWrite(addr uint16, data byte) (mapped uint32, ok bool)
+
+	PpuMapRead(addr uint16) (mapped uint32, ok bool)
+	PpuMapWrite(addr uint16) (mapped uint32, ok bool)
+}
+
+// Mappers that control nametable mirroring, overriding the mirroring set by
+// the iNES header.
+type mirroringMapper interface {
+	Mirroring() MirrorMode
+}
+
+// Mappers with bus conflicts: PRG ROM drives the data bus while a register in
+// the PRG ROM address space is written, so only bits set in both the value
+// written and the ROM byte at the address reach the mapper.
+type busConflictMapper interface {
+	busConflicts() bool
+}
+
+// Mappers that count scanlines, like MMC3. The real mappers watch PPU address
+// line A12 rise as the PPU switches from fetching background tiles in
+// 0x0000-0x0FFF to sprite tiles in 0x1000-0x1FFF, once per rendered scanline.
+type scanlineMapper interface {
+	countScanline()
+}
+
+// Mappers with registers, which are kept in save states.
+type stateMapper interface {
+	serializeState(s *stateSerializer)
+}
+
+// Mappers that can request an IRQ, like MMC3.
+type irqMapper interface {
+	IrqState() bool
+	IrqClear()
+}
+
+// Common names of the supported mappers, by iNES mapper number.
+var mapperNames = map[byte]string{
+	0: "NROM",
+	1: "MMC1",
+	2: "UxROM",
+	3: "CNROM",
+	4: "MMC3",
+}
+
+// NewMapper returns the mapper with the given iNES number for a cartridge with
+// the given number of 16KB PRG ROM banks and 8KB CHR ROM banks, or nil if the
+// mapper is not supported. 0 CHR banks means the cartridge uses CHR RAM.
+func NewMapper(id byte, prgBanks, chrBanks byte) Mapper {
+	switch id {
+	case 0:
+		return NewMapper000(prgBanks, chrBanks)
+	case 1:
+		return NewMapper001(prgBanks, chrBanks)
+	case 2:
+		return NewMapper002(prgBanks, chrBanks)
+	case 3:
+		return NewMapper003(prgBanks, chrBanks)
+	case 4:
+		return NewMapper004(prgBanks, chrBanks)
+	}
+
+	return nil
+}
+
+// mapperName returns the common name of an iNES mapper.
+func mapperName(id byte) string {
+	if name, ok := mapperNames[id]; ok {
+		return name
+	}
+	return "unknown"
 }
@@ -21,41 +21,36 @@ func NewMapper000(prgRomChunks, chrRomChunks byte) Mapper000 {
 // if 32KB ROM size:
 //   0x8000-0xFFFF -> 0x0000-0x7FFF
 
-func (m Mapper000) cpuMapRead(addr uint16) uint16 {
+func (m Mapper000) CpuMapRead(addr uint16) (uint32, bool) {
 	if addr >= 0x8000 && addr <= 0xFFFF {
 		if m.PrgBanks > 1 {
-			addr &= 0x7FFF // 32KB ROM
-		} else {
-			addr &= 0x3FFF // 16KB ROM, need to mirror
+			return uint32(addr & 0x7FFF), true // 32KB ROM
 		}
+		return uint32(addr & 0x3FFF), true // 16KB ROM, need to mirror
 	}
 
-	return addr
+	return 0, false
 }
 
-func (m Mapper000) cpuMapWrite(addr uint16) uint16 {
-	if addr >= 0x8000 && addr <= 0xFFFF {
-		if m.PrgBanks > 1 {
-			addr &= 0x3FFF // 16KB ROM, need to mirror
-		} else {
-			addr &= 0x7FFF // 32KB ROM
-		}
-	}
-
-	return addr
+// PRG ROM can't be written.
+func (m Mapper000) CpuMapWrite(addr uint16, data byte) (uint32, bool) {
+	return 0, false
 }
 
 // No PPU mapping
-func (m Mapper000) ppuMapRead(addr uint16) uint16 {
+func (m Mapper000) PpuMapRead(addr uint16) (uint32, bool) {
 	if addr >= 0x0000 && addr <= 0x1FFF {
+		return uint32(addr), true
 	}
 
-	return addr
+	return 0, false
 }
 
-func (m Mapper000) ppuMapWrite(addr uint16) uint16 {
-	if addr >= 0x0000 && addr <= 0x1FFF {
+// Only CHR RAM can be written.
+func (m Mapper000) PpuMapWrite(addr uint16) (uint32, bool) {
+	if addr >= 0x0000 && addr <= 0x1FFF && m.ChrBanks == 0 {
+		return uint32(addr), true
 	}
 
-	return addr
+	return 0, false
 }
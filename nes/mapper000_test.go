@@ -0,0 +1,110 @@
+package nes
+
+import "testing"
+
+func TestMapper000ResetVector(t *testing.T) {
+	tests := []struct {
+		name      string
+		prgChunks byte
+		want      uint16
+	}{
+		// NROM-128: $C000-$FFFF mirrors the only bank, so the vector is read
+		// from the end of it.
+		{"NROM-128", 1, 0x8123},
+		// NROM-256: $C000-$FFFF is the second bank.
+		{"NROM-256", 2, 0xC456},
+	}
+
+	for _, tt := range tests {
+		rom := newTestRom(tt.prgChunks, 1, 0x00, 0x00)
+		prg := rom[16:]
+		prg[0x3FFC], prg[0x3FFD] = 0x23, 0x81
+		if tt.prgChunks > 1 {
+			prg[0x7FFC], prg[0x7FFD] = 0x56, 0xC4
+		}
+
+		bus := NewBus(false, false)
+		bus.InsertCartridge(newTestCartridge(t, rom))
+
+		got := uint16(bus.CpuRead(0xFFFD))<<8 | uint16(bus.CpuRead(0xFFFC))
+		if got != tt.want {
+			t.Errorf("%s: reset vector = $%04X, want $%04X", tt.name, got, tt.want)
+		}
+		if bus.Cpu.Pc != tt.want {
+			t.Errorf("%s: PC after reset = $%04X, want $%04X", tt.name, bus.Cpu.Pc, tt.want)
+		}
+	}
+}
+
+func TestMapper000Mirroring(t *testing.T) {
+	tests := []struct {
+		prgBanks byte
+		addr     uint16
+		want     uint32
+	}{
+		{1, 0x8000, 0x0000},
+		{1, 0xBFFF, 0x3FFF},
+		{1, 0xC000, 0x0000}, // mirror
+		{1, 0xFFFC, 0x3FFC}, // mirror
+		{2, 0x8000, 0x0000},
+		{2, 0xC000, 0x4000},
+		{2, 0xFFFC, 0x7FFC},
+	}
+
+	for _, tt := range tests {
+		m := NewMapper(0, tt.prgBanks, 1)
+		if got, ok := m.CpuMapRead(tt.addr); !ok || got != tt.want {
+			t.Errorf("%d banks: CpuMapRead($%04X) = $%04X, %v, want $%04X", tt.prgBanks, tt.addr, got, ok, tt.want)
+		}
+		if got, ok := m.CpuMapWrite(tt.addr, 0x00); ok {
+			t.Errorf("%d banks: CpuMapWrite($%04X) mapped to $%04X", tt.prgBanks, tt.addr, got)
+		}
+	}
+
+	// Below the PRG ROM
+	if _, ok := NewMapper(0, 1, 1).CpuMapRead(0x4020); ok {
+		t.Errorf("CpuMapRead($4020) mapped")
+	}
+}
+
+func TestMapper000PrgWrites(t *testing.T) {
+	for _, prgChunks := range []byte{1, 2} {
+		rom := newTestRom(prgChunks, 1, 0x00, 0x00)
+		bus := NewBus(false, false)
+		bus.InsertCartridge(newTestCartridge(t, rom))
+
+		// PRG ROM is read only.
+		for _, addr := range []uint16{0x8000, 0xFFFC} {
+			want := bus.CpuRead(addr)
+			bus.CpuWrite(addr, ^want)
+			if got := bus.CpuRead(addr); got != want {
+				t.Errorf("%d PRG banks: read $%02X from $%04X after write, want $%02X", prgChunks, got, addr, want)
+			}
+		}
+	}
+}
+
+func TestMapper000ChrWrites(t *testing.T) {
+	tests := []struct {
+		chrBanks byte
+		want     byte
+	}{
+		{0, 0xAB}, // CHR RAM
+		{1, 0x00}, // CHR ROM
+	}
+
+	for _, tt := range tests {
+		cart, err := NewCartridge(make([]byte, 16*1024), make([]byte, int(tt.chrBanks)*8*1024), 0, MirrorHorizontal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cart.ppuWrite(0x1234, 0xAB)
+		if got := cart.ppuRead(0x1234); got != tt.want {
+			t.Errorf("%d CHR banks: read $%02X after write, want $%02X", tt.chrBanks, got, tt.want)
+		}
+	}
+
+	if NewMapper(0xFF, 1, 1) != nil {
+		t.Errorf("unsupported mapper created")
+	}
+}
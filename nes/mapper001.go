@@ -0,0 +1,154 @@
+package nes
+
+// MMC1 (SxROM)
+// reference: https://wiki.nesdev.com/w/index.php/MMC1
+//
+// Registers are written one bit at a time through a 5-bit shift register.
+// Each write to 0x8000-0xFFFF shifts in bit 0 of the data, and the fifth write
+// copies the shift register to the register selected by the address:
+//
+//	0x8000-0x9FFF - Control: mirroring (bits 0-1), PRG mode (bits 2-3), CHR mode (bit 4)
+//	0xA000-0xBFFF - CHR bank 0
+//	0xC000-0xDFFF - CHR bank 1
+//	0xE000-0xFFFF - PRG bank (bits 0-3)
+//
+// Writing a value with bit 7 set clears the shift register instead, and sets
+// the PRG mode to 3.
+type Mapper001 struct {
+	PrgBanks byte
+	ChrBanks byte
+
+	shift      byte // Shift register, filled from bit 4 down
+	shiftCount byte // Bits written to the shift register
+
+	control  byte
+	chrBank0 byte
+	chrBank1 byte
+	prgBank  byte
+}
+
+func NewMapper001(prgRomChunks, chrRomChunks byte) *Mapper001 {
+	return &Mapper001{
+		PrgBanks: prgRomChunks,
+		ChrBanks: chrRomChunks,
+
+		// PRG mode 3 at power-up, so the reset vector is in the fixed last bank.
+		control: 0x0C,
+	}
+}
+
+// PRG banking
+//
+// PRG mode 0, 1: switch 32KB at 0x8000, ignoring the low bit of the bank
+// PRG mode 2:    fix the first bank at 0x8000, switch 16KB at 0xC000
+// PRG mode 3:    switch 16KB at 0x8000, fix the last bank at 0xC000
+
+func (m *Mapper001) CpuMapRead(addr uint16) (uint32, bool) {
+	if addr < 0x8000 {
+		return 0, false
+	}
+
+	var bank byte
+	switch (m.control >> 2) & 0x03 {
+	case 0, 1:
+		bank = m.prgBank&0x0E | byte(addr>>14)&0x01
+	case 2:
+		if addr >= 0xC000 {
+			bank = m.prgBank & 0x0F
+		}
+	case 3:
+		bank = m.PrgBanks - 1
+		if addr < 0xC000 {
+			bank = m.prgBank & 0x0F
+		}
+	}
+	bank %= m.PrgBanks
+
+	return uint32(bank)*0x4000 + uint32(addr&0x3FFF), true
+}
+
+func (m *Mapper001) CpuMapWrite(addr uint16, data byte) (uint32, bool) {
+	if addr < 0x8000 {
+		return 0, false
+	}
+
+	// Reset the shift register.
+	if data&0x80 > 0 {
+		m.shift = 0
+		m.shiftCount = 0
+		m.control |= 0x0C
+		return 0, false
+	}
+
+	m.shift = m.shift>>1 | (data&0x01)<<4
+	m.shiftCount++
+	if m.shiftCount < 5 {
+		return 0, false
+	}
+
+	switch {
+	case addr <= 0x9FFF:
+		m.control = m.shift
+	case addr <= 0xBFFF:
+		m.chrBank0 = m.shift
+	case addr <= 0xDFFF:
+		m.chrBank1 = m.shift
+	default:
+		m.prgBank = m.shift
+	}
+	m.shift = 0
+	m.shiftCount = 0
+
+	// Registers are not memory.
+	return 0, false
+}
+
+// CHR banking
+//
+// CHR mode 0: switch 8KB at 0x0000, ignoring the low bit of CHR bank 0
+// CHR mode 1: switch 4KB at 0x0000 (CHR bank 0) and 0x1000 (CHR bank 1)
+
+func (m *Mapper001) PpuMapRead(addr uint16) (uint32, bool) {
+	if addr > 0x1FFF {
+		return 0, false
+	}
+
+	var bank byte
+	if m.control&0x10 == 0 {
+		bank = m.chrBank0&0x1E | byte(addr>>12)&0x01
+	} else if addr < 0x1000 {
+		bank = m.chrBank0
+	} else {
+		bank = m.chrBank1
+	}
+
+	// 8KB of CHR RAM if there is no CHR ROM.
+	chrBanks4K := 2 * int(m.ChrBanks)
+	if chrBanks4K == 0 {
+		chrBanks4K = 2
+	}
+	bank = byte(int(bank) % chrBanks4K)
+
+	return uint32(bank)*0x1000 + uint32(addr&0x0FFF), true
+}
+
+// Only CHR RAM can be written.
+func (m *Mapper001) PpuMapWrite(addr uint16) (uint32, bool) {
+	if m.ChrBanks != 0 {
+		return 0, false
+	}
+	return m.PpuMapRead(addr)
+}
+
+// Mirroring returns the nametable mirroring set by the control register.
+func (m *Mapper001) Mirroring() MirrorMode {
+	switch m.control & 0x03 {
+	case 0:
+		return MirrorOnescreenLo
+	case 1:
+		return MirrorOnescreenHi
+	case 2:
+		return MirrorVertical
+	}
+	return MirrorHorizontal
+}
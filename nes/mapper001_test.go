@@ -0,0 +1,135 @@
+package nes
+
+import "testing"
+
+// newBankedCartridge returns a cartridge with 16KB PRG banks and 4KB CHR banks
+// filled with their bank number.
+func newBankedCartridge(t *testing.T, mapperID int, prgBanks, chrBanks int) *Cartridge {
+	t.Helper()
+
+	prg := make([]byte, prgBanks*16*1024)
+	for i := range prg {
+		prg[i] = byte(i / (16 * 1024))
+	}
+	chr := make([]byte, chrBanks*8*1024)
+	for i := range chr {
+		chr[i] = byte(i / (4 * 1024))
+	}
+
+	cart, err := NewCartridge(prg, chr, mapperID, MirrorHorizontal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cart
+}
+
+// writeMMC1 writes a 5-bit value to an MMC1 register through the shift
+// register, low bit first.
+func writeMMC1(cart *Cartridge, addr uint16, value byte) {
+	for i := 0; i < 5; i++ {
+		cart.cpuWrite(addr, value>>i&0x01)
+	}
+}
+
+func TestMapper001PrgBanking(t *testing.T) {
+	tests := []struct {
+		name             string
+		control, prgBank byte
+		want8000, wantC0 byte // Banks at 0x8000 and 0xC000
+	}{
+		{"32KB", 0x00, 0x05, 4, 5},
+		{"fixed first", 0x08, 0x05, 0, 5},
+		{"fixed last", 0x0C, 0x05, 5, 7},
+	}
+
+	for _, tt := range tests {
+		cart := newBankedCartridge(t, 1, 8, 2)
+		if got := cart.cpuRead(0xC000); got != 7 {
+			t.Errorf("%s: power-up bank at $C000 = %d, want 7", tt.name, got)
+		}
+
+		writeMMC1(cart, 0x8000, tt.control)
+		writeMMC1(cart, 0xE000, tt.prgBank)
+
+		if got := cart.cpuRead(0x8000); got != tt.want8000 {
+			t.Errorf("%s: bank at $8000 = %d, want %d", tt.name, got, tt.want8000)
+		}
+		if got := cart.cpuRead(0xFFFF); got != tt.wantC0 {
+			t.Errorf("%s: bank at $C000 = %d, want %d", tt.name, got, tt.wantC0)
+		}
+	}
+}
+
+func TestMapper001ChrBanking(t *testing.T) {
+	tests := []struct {
+		name           string
+		control        byte
+		wantLo, wantHi byte // 4KB banks at 0x0000 and 0x1000
+	}{
+		{"8KB", 0x00, 2, 3},
+		{"4KB", 0x10, 3, 6},
+	}
+
+	for _, tt := range tests {
+		cart := newBankedCartridge(t, 1, 2, 4)
+		writeMMC1(cart, 0x8000, tt.control)
+		writeMMC1(cart, 0xA000, 0x03)
+		writeMMC1(cart, 0xC000, 0x06)
+
+		if got := cart.ppuRead(0x0000); got != tt.wantLo {
+			t.Errorf("%s: bank at $0000 = %d, want %d", tt.name, got, tt.wantLo)
+		}
+		if got := cart.ppuRead(0x1FFF); got != tt.wantHi {
+			t.Errorf("%s: bank at $1000 = %d, want %d", tt.name, got, tt.wantHi)
+		}
+	}
+
+	// CHR RAM is writable, CHR ROM is not.
+	ram := newBankedCartridge(t, 1, 2, 0)
+	ram.ppuWrite(0x1234, 0xAB)
+	if got := ram.ppuRead(0x1234); got != 0xAB {
+		t.Errorf("CHR RAM: read $%02X after write, want $AB", got)
+	}
+	rom := newBankedCartridge(t, 1, 2, 4)
+	rom.ppuWrite(0x0000, 0xAB)
+	if got := rom.ppuRead(0x0000); got != 0 {
+		t.Errorf("CHR ROM: read $%02X after write, want $00", got)
+	}
+}
+
+func TestMapper001Mirroring(t *testing.T) {
+	cart := newBankedCartridge(t, 1, 2, 2)
+
+	for control, want := range []MirrorMode{MirrorOnescreenLo, MirrorOnescreenHi, MirrorVertical, MirrorHorizontal} {
+		writeMMC1(cart, 0x8000, byte(control))
+		if got := cart.Mirroring(); got != want {
+			t.Errorf("control %d: mirroring %v, want %v", control, got, want)
+		}
+	}
+
+	// Forcing mirroring still overrides the mapper.
+	cart.SetMirroring(MirrorFourScreen)
+	if got := cart.Mirroring(); got != MirrorFourScreen {
+		t.Errorf("forced mirroring %v, want %v", got, MirrorFourScreen)
+	}
+}
+
+func TestMapper001ShiftReset(t *testing.T) {
+	cart := newBankedCartridge(t, 1, 8, 2)
+	writeMMC1(cart, 0x8000, 0x08) // Fixed first bank
+
+	// A reset partway through a write discards the bits written so far, and
+	// sets PRG mode 3.
+	cart.cpuWrite(0xE000, 0x01)
+	cart.cpuWrite(0xE000, 0x01)
+	cart.cpuWrite(0xE000, 0x80)
+	writeMMC1(cart, 0xE000, 0x02)
+
+	if got := cart.cpuRead(0x8000); got != 2 {
+		t.Errorf("bank at $8000 = %d, want 2", got)
+	}
+	if got := cart.cpuRead(0xC000); got != 7 {
+		t.Errorf("bank at $C000 = %d, want 7", got)
+	}
+}
@@ -0,0 +1,61 @@
+package nes
+
+// UxROM
+// reference: https://wiki.nesdev.com/w/index.php/UxROM
+//
+// Any write to 0x8000-0xFFFF selects the 16KB PRG bank at 0x8000-0xBFFF. The
+// last bank is fixed at 0xC000-0xFFFF. CHR is 8KB, usually RAM.
+type Mapper002 struct {
+	PrgBanks byte
+	ChrBanks byte
+
+	prgBank byte
+}
+
+func NewMapper002(prgRomChunks, chrRomChunks byte) *Mapper002 {
+	return &Mapper002{
+		PrgBanks: prgRomChunks,
+		ChrBanks: chrRomChunks,
+	}
+}
+
+func (m *Mapper002) CpuMapRead(addr uint16) (uint32, bool) {
+	if addr < 0x8000 {
+		return 0, false
+	}
+
+	bank := m.PrgBanks - 1
+	if addr < 0xC000 {
+		bank = m.prgBank % m.PrgBanks
+	}
+
+	return uint32(bank)*0x4000 + uint32(addr&0x3FFF), true
+}
+
+func (m *Mapper002) CpuMapWrite(addr uint16, data byte) (uint32, bool) {
+	if addr >= 0x8000 {
+		// UNROM uses 3 bits and UOROM 4. Bigger boards use the rest.
+		m.prgBank = data
+	}
+
+	// The bank register is not memory.
+	return 0, false
+}
+
+// No PPU mapping
+func (m *Mapper002) PpuMapRead(addr uint16) (uint32, bool) {
+	if addr <= 0x1FFF {
+		return uint32(addr), true
+	}
+
+	return 0, false
+}
+
+// Only CHR RAM can be written.
+func (m *Mapper002) PpuMapWrite(addr uint16) (uint32, bool) {
+	if addr <= 0x1FFF && m.ChrBanks == 0 {
+		return uint32(addr), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,30 @@
+package nes
+
+import "testing"
+
+func TestMapper002PrgBanking(t *testing.T) {
+	cart := newBankedCartridge(t, 2, 8, 0)
+
+	for _, bank := range []byte{0, 3, 6, 9} {
+		cart.cpuWrite(0xC123, bank)
+
+		if got, want := cart.cpuRead(0x8000), bank%8; got != want {
+			t.Errorf("bank %d: read %d at $8000, want %d", bank, got, want)
+		}
+		if got := cart.cpuRead(0xFFFC); got != 7 {
+			t.Errorf("bank %d: read %d at $C000, want fixed bank 7", bank, got)
+		}
+	}
+
+	// Writes select a bank instead of changing PRG ROM.
+	cart.cpuWrite(0xC000, 0x05)
+	if got := cart.cpuRead(0xC000); got != 7 {
+		t.Errorf("PRG ROM written: read %d at $C000, want 7", got)
+	}
+
+	// CHR RAM
+	cart.ppuWrite(0x1234, 0xAB)
+	if got := cart.ppuRead(0x1234); got != 0xAB {
+		t.Errorf("CHR RAM: read $%02X after write, want $AB", got)
+	}
+}
@@ -0,0 +1,65 @@
+package nes
+
+// CNROM
+// reference: https://wiki.nesdev.com/w/index.php/CNROM
+//
+// Any write to 0x8000-0xFFFF selects the 8KB CHR ROM bank. PRG ROM is fixed
+// like NROM. The PRG ROM drives the data bus while the bank is written, so
+// the value written is ANDed with the ROM byte at the address (bus conflict).
+type Mapper003 struct {
+	PrgBanks byte
+	ChrBanks byte
+
+	chrBank byte
+}
+
+func NewMapper003(prgRomChunks, chrRomChunks byte) *Mapper003 {
+	return &Mapper003{
+		PrgBanks: prgRomChunks,
+		ChrBanks: chrRomChunks,
+	}
+}
+
+// Same as NROM
+func (m *Mapper003) CpuMapRead(addr uint16) (uint32, bool) {
+	if addr < 0x8000 {
+		return 0, false
+	}
+
+	if m.PrgBanks > 1 {
+		return uint32(addr & 0x7FFF), true // 32KB ROM
+	}
+	return uint32(addr & 0x3FFF), true // 16KB ROM, need to mirror
+}
+
+func (m *Mapper003) CpuMapWrite(addr uint16, data byte) (uint32, bool) {
+	if addr >= 0x8000 {
+		// Up to 4 banks on CNROM boards.
+		m.chrBank = data & 0x03
+	}
+
+	// The bank register is not memory.
+	return 0, false
+}
+
+func (m *Mapper003) PpuMapRead(addr uint16) (uint32, bool) {
+	if addr > 0x1FFF {
+		return 0, false
+	}
+
+	bank := m.chrBank
+	if m.ChrBanks > 0 {
+		bank %= m.ChrBanks
+	}
+
+	return uint32(bank)*0x2000 + uint32(addr), true
+}
+
+// CHR ROM can't be written.
+func (m *Mapper003) PpuMapWrite(addr uint16) (uint32, bool) {
+	return 0, false
+}
+
+func (m *Mapper003) busConflicts() bool {
+	return true
+}
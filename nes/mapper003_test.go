@@ -0,0 +1,46 @@
+package nes
+
+import "testing"
+
+func TestMapper003ChrBanking(t *testing.T) {
+	prg := make([]byte, 32*1024)
+	for i := range prg {
+		prg[i] = 0xFF
+	}
+	prg[0x0010] = 0x02 // Bus conflict: only bit 1 can be written at $8010
+	chr := make([]byte, 4*8*1024)
+	for i := range chr {
+		chr[i] = byte(i / (8 * 1024))
+	}
+	cart, err := NewCartridge(prg, chr, 3, MirrorVertical)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr uint16
+		data byte
+		want byte
+	}{
+		{0x8000, 0x01, 1},
+		{0xFFFF, 0x03, 3},
+		{0x8010, 0x03, 2}, // 0x03 & 0x02
+		{0x8010, 0x01, 0}, // 0x01 & 0x02
+	}
+
+	for _, tt := range tests {
+		cart.cpuWrite(tt.addr, tt.data)
+
+		if got := cart.ppuRead(0x0000); got != tt.want {
+			t.Errorf("write $%02X to $%04X: bank %d at $0000, want %d", tt.data, tt.addr, got, tt.want)
+		}
+		if got := cart.ppuRead(0x1FFF); got != tt.want {
+			t.Errorf("write $%02X to $%04X: bank %d at $1FFF, want %d", tt.data, tt.addr, got, tt.want)
+		}
+	}
+
+	// PRG ROM is fixed.
+	if got := cart.cpuRead(0x8010); got != 0x02 {
+		t.Errorf("PRG ROM at $8010 = $%02X, want $02", got)
+	}
+}
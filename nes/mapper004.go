@@ -0,0 +1,188 @@
+package nes
+
+// MMC3 (TxROM)
+// reference: https://wiki.nesdev.com/w/index.php/MMC3
+//
+// Registers are selected by address range and whether the address is even
+// or odd:
+//
+//	0x8000 even - Bank select: register R0-R7 (bits 0-2), PRG mode (bit 6), CHR mode (bit 7)
+//	0x8000 odd  - Bank data for the selected register
+//	0xA000 even - Mirroring: 0 vertical, 1 horizontal
+//	0xA000 odd  - PRG-RAM protect (ignored)
+//	0xC000 even - IRQ latch, the value the scanline counter is reloaded with
+//	0xC000 odd  - IRQ reload, the counter is reloaded on the next scanline
+//	0xE000 even - IRQ disable, also acknowledges a pending IRQ
+//	0xE000 odd  - IRQ enable
+type Mapper004 struct {
+	PrgBanks byte
+	ChrBanks byte
+
+	bankSelect byte
+	registers  [8]byte // R0-R5 select CHR banks, R6-R7 PRG banks
+	mirroring  MirrorMode
+
+	// Scanline counter
+	irqLatch   byte
+	irqCounter byte
+	irqReload  bool
+	irqEnabled bool
+	irqPending bool
+}
+
+func NewMapper004(prgRomChunks, chrRomChunks byte) *Mapper004 {
+	return &Mapper004{
+		PrgBanks: prgRomChunks,
+		ChrBanks: chrRomChunks,
+
+		registers: [8]byte{0, 2, 4, 5, 6, 7, 0, 1},
+	}
+}
+
+// PRG banking, in 8KB banks
+//
+//	           PRG mode 0    PRG mode 1
+//	0x8000     R6            second last
+//	0xA000     R7            R7
+//	0xC000     second last   R6
+//	0xE000     last          last
+
+func (m *Mapper004) CpuMapRead(addr uint16) (uint32, bool) {
+	if addr < 0x8000 {
+		return 0, false
+	}
+
+	banks := int(m.PrgBanks) * 2
+	var bank int
+	switch (addr - 0x8000) / 0x2000 {
+	case 0:
+		bank = int(m.registers[6])
+		if m.bankSelect&0x40 > 0 {
+			bank = banks - 2
+		}
+	case 1:
+		bank = int(m.registers[7])
+	case 2:
+		bank = banks - 2
+		if m.bankSelect&0x40 > 0 {
+			bank = int(m.registers[6])
+		}
+	case 3:
+		bank = banks - 1
+	}
+	bank %= banks
+
+	return uint32(bank)*0x2000 + uint32(addr&0x1FFF), true
+}
+
+func (m *Mapper004) CpuMapWrite(addr uint16, data byte) (uint32, bool) {
+	if addr < 0x8000 {
+		return 0, false
+	}
+
+	even := addr&0x01 == 0
+	switch {
+	case addr <= 0x9FFF && even:
+		m.bankSelect = data
+	case addr <= 0x9FFF:
+		m.registers[m.bankSelect&0x07] = data
+	case addr <= 0xBFFF && even:
+		m.mirroring = MirrorVertical
+		if data&0x01 > 0 {
+			m.mirroring = MirrorHorizontal
+		}
+	case addr <= 0xBFFF:
+		// PRG-RAM protect
+	case addr <= 0xDFFF && even:
+		m.irqLatch = data
+	case addr <= 0xDFFF:
+		m.irqCounter = 0
+		m.irqReload = true
+	case even:
+		m.irqEnabled = false
+		m.irqPending = false
+	default:
+		m.irqEnabled = true
+	}
+
+	// Registers are not memory.
+	return 0, false
+}
+
+// CHR banking, in 1KB banks. R0 and R1 select 2KB banks, ignoring the low bit.
+//
+//	           CHR mode 0    CHR mode 1
+//	0x0000     R0            R2
+//	0x0400     R0 + 1        R3
+//	0x0800     R1            R4
+//	0x0C00     R1 + 1        R5
+//	0x1000     R2            R0
+//	0x1400     R3            R0 + 1
+//	0x1800     R4            R1
+//	0x1C00     R5            R1 + 1
+
+func (m *Mapper004) PpuMapRead(addr uint16) (uint32, bool) {
+	if addr > 0x1FFF {
+		return 0, false
+	}
+
+	// CHR mode 1 swaps the 2KB and 1KB banks between the pattern tables.
+	slot := addr / 0x0400
+	if m.bankSelect&0x80 > 0 {
+		slot ^= 0x04
+	}
+
+	var bank int
+	if slot < 4 {
+		bank = int(m.registers[slot/2]&0xFE) + int(slot%2)
+	} else {
+		bank = int(m.registers[slot-2])
+	}
+
+	// 8KB of CHR RAM if there is no CHR ROM.
+	banks := int(m.ChrBanks) * 8
+	if banks == 0 {
+		banks = 8
+	}
+	bank %= banks
+
+	return uint32(bank)*0x0400 + uint32(addr&0x03FF), true
+}
+
+// Only CHR RAM can be written.
+func (m *Mapper004) PpuMapWrite(addr uint16) (uint32, bool) {
+	if m.ChrBanks != 0 {
+		return 0, false
+	}
+	return m.PpuMapRead(addr)
+}
+
+// Mirroring returns the nametable mirroring set by writes to 0xA000.
+func (m *Mapper004) Mirroring() MirrorMode {
+	return m.mirroring
+}
+
+// countScanline clocks the scanline counter. When the counter reaches 0 with
+// IRQs enabled, an IRQ is requested.
+func (m *Mapper004) countScanline() {
+	if m.irqCounter == 0 || m.irqReload {
+		m.irqCounter = m.irqLatch
+		m.irqReload = false
+	} else {
+		m.irqCounter--
+	}
+
+	if m.irqCounter == 0 && m.irqEnabled {
+		m.irqPending = true
+	}
+}
+
+// IrqState returns whether the mapper is requesting an IRQ.
+func (m *Mapper004) IrqState() bool {
+	return m.irqPending
+}
+
+// IrqClear acknowledges the mapper's IRQ request.
+func (m *Mapper004) IrqClear() {
+	m.irqPending = false
+}
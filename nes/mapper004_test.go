@@ -0,0 +1,211 @@
+package nes
+
+import "testing"
+
+// newMMC3Cartridge returns an MMC3 cartridge with 8KB PRG banks and 1KB CHR
+// banks filled with their bank number.
+func newMMC3Cartridge(t *testing.T, prgBanks, chrBanks int) *Cartridge {
+	t.Helper()
+
+	prg := make([]byte, prgBanks*16*1024)
+	for i := range prg {
+		prg[i] = byte(i / (8 * 1024))
+	}
+	chr := make([]byte, chrBanks*8*1024)
+	for i := range chr {
+		chr[i] = byte(i / 1024)
+	}
+
+	cart, err := NewCartridge(prg, chr, 4, MirrorHorizontal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cart
+}
+
+func TestMapper004PrgBanking(t *testing.T) {
+	tests := []struct {
+		name string
+		mode byte
+		want [4]byte // Banks at 0x8000, 0xA000, 0xC000, 0xE000
+	}{
+		{"mode 0", 0x00, [4]byte{3, 5, 14, 15}},
+		{"mode 1", 0x40, [4]byte{14, 5, 3, 15}},
+	}
+
+	for _, tt := range tests {
+		cart := newMMC3Cartridge(t, 8, 1)
+		cart.cpuWrite(0x8000, tt.mode|6)
+		cart.cpuWrite(0x8001, 3)
+		cart.cpuWrite(0x8000, tt.mode|7)
+		cart.cpuWrite(0x8001, 5)
+
+		for i, want := range tt.want {
+			addr := 0x8000 + uint16(i)*0x2000
+			if got := cart.cpuRead(addr); got != want {
+				t.Errorf("%s: bank at $%04X = %d, want %d", tt.name, addr, got, want)
+			}
+		}
+	}
+}
+
+func TestMapper004ChrBanking(t *testing.T) {
+	tests := []struct {
+		name string
+		mode byte
+		want [8]byte // 1KB banks at 0x0000-0x1C00
+	}{
+		{"mode 0", 0x00, [8]byte{2, 3, 6, 7, 8, 9, 10, 11}},
+		{"mode 1", 0x80, [8]byte{8, 9, 10, 11, 2, 3, 6, 7}},
+	}
+
+	for _, tt := range tests {
+		cart := newMMC3Cartridge(t, 2, 2)
+
+		// R0 and R1 ignore the low bit.
+		for r, bank := range []byte{3, 6, 8, 9, 10, 11} {
+			cart.cpuWrite(0x8000, tt.mode|byte(r))
+			cart.cpuWrite(0x8001, bank)
+		}
+
+		for i, want := range tt.want {
+			addr := uint16(i) * 0x0400
+			if got := cart.ppuRead(addr); got != want {
+				t.Errorf("%s: bank at $%04X = %d, want %d", tt.name, addr, got, want)
+			}
+		}
+	}
+}
+
+func TestMapper004Mirroring(t *testing.T) {
+	cart := newMMC3Cartridge(t, 2, 1)
+
+	cart.cpuWrite(0xA000, 0x01)
+	if got := cart.Mirroring(); got != MirrorHorizontal {
+		t.Errorf("mirroring %v, want %v", got, MirrorHorizontal)
+	}
+	cart.cpuWrite(0xA000, 0x00)
+	if got := cart.Mirroring(); got != MirrorVertical {
+		t.Errorf("mirroring %v, want %v", got, MirrorVertical)
+	}
+}
+
+func TestMapper004ScanlineIrq(t *testing.T) {
+	// MMC3, CHR ROM
+	ppu, _ := newTestPpu(t, newTestRom(2, 1, 0x40, 0x00))
+	cart := ppu.Cart
+	mapper := cart.mapper.(*Mapper004)
+
+	// Start at the pre-render scanline.
+	ppu.frameComplete = false
+	for !ppu.frameComplete {
+		ppu.Clock()
+	}
+
+	ppu.ppuMask.setFlag(maskBgShow)
+	ppu.ppuMask.setFlag(maskSpriteShow)
+
+	for frame := 0; frame < 2; frame++ {
+		// Every frame, request an IRQ after 10 scanlines: the counter is
+		// reloaded on the pre-render scanline, and counts down on scanlines
+		// 0-9. Then it is reloaded again and counts down 10 more.
+		cart.cpuWrite(0xC000, 10)
+		cart.cpuWrite(0xC001, 0)
+		cart.cpuWrite(0xE000, 0)
+		cart.cpuWrite(0xE001, 0)
+
+		ppu.frameComplete = false
+		for !ppu.frameComplete && ppu.scanline < 30 {
+			ppu.Clock()
+
+			if ppu.cycle != 261 || ppu.scanline < 0 {
+				continue
+			}
+
+			want := ppu.scanline%11 == 9
+			if got := mapper.IrqState(); got != want {
+				t.Fatalf("frame %d scanline %d: IRQ %v, want %v", frame, ppu.scanline, got, want)
+			}
+
+			// Acknowledge, like an IRQ handler would.
+			if mapper.IrqState() {
+				cart.cpuWrite(0xE000, 0)
+				cart.cpuWrite(0xE001, 0)
+			}
+		}
+
+		for !ppu.frameComplete {
+			ppu.Clock()
+		}
+	}
+}
+
+func TestMapper004RasterIrq(t *testing.T) {
+	// MMC3, CHR ROM. The last 8KB PRG bank is fixed at $E000.
+	rom := newTestRom(2, 1, 0x40, 0x00)
+	prg := rom[16+0x6000:]
+
+	// $E000: disable the APU frame IRQ, enable NMI and rendering, CLI, then
+	// loop forever.
+	copy(prg[0x0000:], []byte{
+		0xA9, 0x40, 0x8D, 0x17, 0x40, // LDA #$40, STA $4017
+		0xA9, 0x80, 0x8D, 0x00, 0x20, // LDA #$80, STA $2000
+		0xA9, 0x18, 0x8D, 0x01, 0x20, // LDA #$18, STA $2001
+		0x58,             // CLI
+		0x4C, 0x10, 0xE0, // JMP $E010
+	})
+	// $E100 (NMI): set the counter to 10, reload it and enable the IRQ.
+	copy(prg[0x0100:], []byte{
+		0xA9, 0x0A, 0x8D, 0x00, 0xC0, // LDA #10, STA $C000
+		0x8D, 0x01, 0xC0, // STA $C001
+		0x8D, 0x01, 0xE0, // STA $E001
+		0x40, // RTI
+	})
+	// $E200 (IRQ): acknowledge, count, RTI.
+	copy(prg[0x0200:], []byte{
+		0x8D, 0x00, 0xE0, // STA $E000
+		0xE6, 0x10, // INC $10
+		0x40, // RTI
+	})
+	// NMI vector $E100, reset vector $E000, IRQ vector $E200.
+	copy(prg[0x1FFA:], []byte{0x00, 0xE1, 0x00, 0xE0, 0x00, 0xE2})
+
+	bus := NewBus(false, false)
+	cart := newTestCartridge(t, rom)
+	mapper := cart.mapper.(*Mapper004)
+	bus.InsertCartridge(cart)
+
+	// The IRQ is first enabled by the NMI at the end of the first frame.
+	for frame := 0; frame < 4; frame++ {
+		count := bus.Ram[0x10]
+		var irqScanline int
+
+		bus.Ppu.frameComplete = false
+		for !bus.Ppu.frameComplete {
+			bus.Clock()
+			if bus.Ram[0x10] != count && irqScanline == 0 {
+				irqScanline = bus.Ppu.scanline
+			}
+		}
+
+		if frame == 0 {
+			if got := bus.Ram[0x10]; got != 0 {
+				t.Fatalf("frame 0: %d IRQs before the counter was set", got)
+			}
+			continue
+		}
+
+		// The counter is reloaded on the pre-render scanline, and reaches
+		// zero on scanline 9. The IRQ is taken once and acknowledged.
+		if got := bus.Ram[0x10] - count; got != 1 {
+			t.Fatalf("frame %d: %d IRQs, want 1", frame, got)
+		}
+		if irqScanline != 9 {
+			t.Errorf("frame %d: IRQ handled on scanline %d, want 9", frame, irqScanline)
+		}
+		if mapper.IrqState() {
+			t.Errorf("frame %d: IRQ not acknowledged", frame)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package nes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// The debug panel shows a hex dump of a page of CPU memory. The memory page
+// key cycles through the zero page, the stack, and the page at the address
+// set with SetMemoryDumpAddr.
+
+const memoryPageKey = pixelgl.KeyM
+
+// Bytes in each row of a memory dump.
+const memoryDumpRowSize = 16
+
+// Pages of CPU memory shown in the debug panel.
+type memoryPage int
+
+const (
+	memoryPageZero memoryPage = iota
+	memoryPageStack
+	memoryPageUser
+	memoryPageCount
+)
+
+// DumpMemory formats rows of CPU memory from start as a hex and ASCII dump,
+// 16 bytes to a row:
+//
+//	0300: 48 65 6C 6C 6F 00 00 00 00 00 00 00 00 00 00 00  Hello...........
+//
+// Memory is read through CpuRead, so banked cartridge memory shows whatever
+// the mapper has switched in. The I/O registers at $2000-$5FFF are shown as
+// "--" rather than read, as reading them has side effects.
+func (b *Bus) DumpMemory(start uint16, rows int) string {
+	// Reads made for debugging aren't on the data bus.
+	openBus := b.openBus
+	defer func() { b.openBus = openBus }()
+
+	var sb strings.Builder
+	for row := 0; row < rows; row++ {
+		rowAddr := start + uint16(row*memoryDumpRowSize)
+		hex := make([]string, memoryDumpRowSize)
+		ascii := make([]byte, memoryDumpRowSize)
+		for i := range hex {
+			addr := rowAddr + uint16(i)
+			if addr >= ppuMinAddr && addr < prgRamMinAddr {
+				hex[i], ascii[i] = "--", '.'
+				continue
+			}
+
+			data := b.CpuRead(addr)
+			hex[i] = fmt.Sprintf("%02X", data)
+			ascii[i] = '.'
+			if data >= 0x20 && data < 0x7F {
+				ascii[i] = data
+			}
+		}
+
+		fmt.Fprintf(&sb, "%04X: %s  %s\n", rowAddr, strings.Join(hex, " "), ascii)
+	}
+
+	return sb.String()
+}
+
+// SetMemoryDumpAddr sets the start of the memory shown on the debug panel's
+// user page, and shows that page.
+func (b *Bus) SetMemoryDumpAddr(addr uint16) {
+	b.memoryDumpAddr = addr
+	b.memoryPage = memoryPageUser
+}
+
+// Name and start address of the memory page shown in the debug panel.
+func (b *Bus) memoryPageAddr() (string, uint16) {
+	switch b.memoryPage {
+	case memoryPageZero:
+		return "Zero page", 0x0000
+	case memoryPageStack:
+		return "Stack", stackBase
+	}
+	return fmt.Sprintf("$%04X", b.memoryDumpAddr), b.memoryDumpAddr
+}
+
+// Show the next memory page when the memory page key is pressed, checked once
+// per frame.
+func (b *Bus) updateMemoryDumpInput(win *pixelgl.Window) {
+	if win.JustPressed(memoryPageKey) {
+		b.memoryPage = (b.memoryPage + 1) % memoryPageCount
+	}
+}
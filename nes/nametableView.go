@@ -0,0 +1,82 @@
+package nes
+
+import (
+	"image"
+
+	"github.com/faiface/pixel/pixelgl"
+	"golang.org/x/image/draw"
+)
+
+// The nametable view key switches the bottom of the debug panel between the
+// pattern tables and the 2 nametables in the console's VRAM, to see where the
+// game is scrolled to and what is drawn off screen.
+
+const nametableViewKey = pixelgl.KeyN
+
+// GetNametable renders nametable i (0-3, at $2000, $2400, $2800, and $2C00)
+// as a 256x240 image, the way the background would draw it: with the
+// background pattern table selected by PPUCTRL, and the palettes chosen by
+// its attribute table. Nametables are read through the cartridge's mirroring,
+// so mirrored nametables render the same.
+func (p *Ppu) GetNametable(i int) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, int(nesResW), int(nesResH)))
+
+	base := nameTblAddr + uint16(i&0x3)*0x400
+	bgTable := uint16(p.ppuCtrl.getFlag(ctrlBgPatternTbl)) << 12
+
+	for tileY := uint16(0); tileY < 30; tileY++ {
+		for tileX := uint16(0); tileX < 32; tileX++ {
+			id := uint16(p.ppuRead(base + tileY*32 + tileX))
+
+			// Each attribute byte holds the palettes of 4 2x2 tile areas.
+			attr := p.ppuRead(base + 0x3C0 + (tileY/4)*8 + tileX/4)
+			shift := (tileY&0x2)<<1 | tileX&0x2
+			palette := (attr >> shift) & 0x3
+
+			for row := uint16(0); row < 8; row++ {
+				tileLo := p.ppuRead(bgTable + id*16 + row)
+				tileHi := p.ppuRead(bgTable + id*16 + row + 8)
+
+				for col := 0; col < 8; col++ {
+					pixel := (tileLo>>(7-col))&0x01 | ((tileHi>>(7-col))&0x01)<<1
+
+					// Transparent pixels show the backdrop color.
+					c := p.getColorFromPalette(0, 0)
+					if pixel > 0 {
+						c = p.getColorFromPalette(palette, pixel)
+					}
+
+					rgba.SetRGBA(int(tileX)*8+col, int(tileY*8+row), c)
+				}
+			}
+		}
+	}
+
+	return rgba
+}
+
+// physicalNametables returns the nametables (0-3) backed by the console's 2
+// nametables of VRAM under the current mirroring.
+func (p *Ppu) physicalNametables() [2]int {
+	if p.mirroring() == MirrorHorizontal {
+		return [2]int{0, 2}
+	}
+	return [2]int{0, 1}
+}
+
+// Shrink a nametable to half size, to fit in place of a pattern table.
+func nametableThumbnail(nametable *image.RGBA) *image.RGBA {
+	thumb := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	dst := image.Rect(0, 4, 128, 124)
+	draw.ApproxBiLinear.Scale(thumb, dst, nametable, nametable.Bounds(), draw.Src, nil)
+
+	return thumb
+}
+
+// Toggle the nametable view when the nametable view key is pressed, checked
+// once per frame.
+func (b *Bus) updateNametableViewInput(win *pixelgl.Window) {
+	if win.JustPressed(nametableViewKey) {
+		b.showNametables = !b.showNametables
+	}
+}
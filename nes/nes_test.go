@@ -0,0 +1,49 @@
+package nes
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests are run from the package directory, but resources such as test ROMs
+// are loaded relative to the repository root.
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		log.Fatal("Unable to change to repository root...\n", err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// newTestRom returns the bytes of an iNES file with the given header flags,
+// and PRG/CHR memory filled with zeros.
+func newTestRom(prgChunks, chrChunks, flags6, flags7 byte) []byte {
+	header := []byte{'N', 'E', 'S', 0x1A, prgChunks, chrChunks, flags6, flags7,
+		0, 0, 0, 0, 0, 0, 0, 0}
+
+	rom := make([]byte, 16*1024*int(prgChunks)+8*1024*int(chrChunks))
+
+	return append(header, rom...)
+}
+
+// newTestCartridge writes rom to a temporary iNES file and loads it. Saves
+// are kept in the same temporary directory.
+func newTestCartridge(t *testing.T, rom []byte) *Cartridge {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.nes")
+	if err := os.WriteFile(path, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cart, err := NewCartridgeFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cart.SetSavePath(filepath.Join(filepath.Dir(path), "test.sav"))
+	cart.SetStatePath(filepath.Join(filepath.Dir(path), "test.state"))
+
+	return cart
+}
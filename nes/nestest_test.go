@@ -0,0 +1,59 @@
+package nes
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// nestest and its golden log, from https://www.qmtpro.com/~nes/misc/. The log
+// must be the version with a PPU column, as written by EnableTrace.
+//
+// Neither file is in the repository, so TestNestestLog is opt-in: it is
+// skipped unless both are copied to external_tests/nestest/ at the repository
+// root.
+const (
+	nestestRom = "./external_tests/nestest/nestest.nes"
+	nestestLog = "./external_tests/nestest/nestest.log"
+)
+
+// Runs nestest's automated mode, which starts at $C000 and tests every
+// instruction without a display, comparing the trace of each instruction to
+// the golden log.
+func TestNestestLog(t *testing.T) {
+	golden, err := os.ReadFile(nestestLog)
+	if err != nil {
+		t.Skipf("nestest log not found: %v", nestestLog)
+	}
+
+	bus := NewBus(false, false)
+	if err := bus.Load(nestestRom); err != nil {
+		t.Skipf("nestest ROM not loaded: %v", err)
+	}
+	bus.Cpu.Pc = 0xC000
+
+	var trace bytes.Buffer
+	bus.Cpu.EnableTrace(&trace)
+
+	wantLines := strings.Split(strings.TrimRight(string(golden), "\r\n"), "\n")
+	prev := ""
+	for i, want := range wantLines {
+		want = strings.TrimSuffix(want, "\r")
+
+		trace.Reset()
+		bus.StepInstruction()
+		got := strings.TrimSuffix(trace.String(), "\n")
+
+		if got != want {
+			t.Fatalf("line %d differs from nestest.log, after:\n     %s\ngot  %s\nwant %s",
+				i+1, prev, got, want)
+		}
+		prev = got
+	}
+
+	// nestest also leaves an error code for the failed test, if any.
+	if bus.Ram[0x02] != 0x00 || bus.Ram[0x03] != 0x00 {
+		t.Errorf("nestest error codes $02 = %#02x, $03 = %#02x", bus.Ram[0x02], bus.Ram[0x03])
+	}
+}
@@ -0,0 +1,51 @@
+package nes
+
+import (
+	"image"
+	"image/draw"
+
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// The debug panel shows the 8 palettes in palette memory as swatches, next to
+// the pattern tables. The pattern table palette key cycles which of them the
+// pattern tables are drawn with.
+
+const patternTablePaletteKey = pixelgl.KeyL
+
+// Width and height of each color in the palette image.
+const paletteSwatchSize = 12
+
+// GetPaletteImage returns the 32 colors in palette memory as swatches. The 4
+// background palettes of 4 colors are in the top row, and the 4 sprite
+// palettes in the bottom row. Mirrored entries, such as color 0 of the sprite
+// palettes, show the color they mirror.
+func (p *Ppu) GetPaletteImage() *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, 16*paletteSwatchSize, 2*paletteSwatchSize))
+
+	for i := 0; i < 32; i++ {
+		x := (i % 16) * paletteSwatchSize
+		y := (i / 16) * paletteSwatchSize
+		swatch := image.Rect(x, y, x+paletteSwatchSize, y+paletteSwatchSize)
+
+		c := p.paletteRGBA[p.ppuRead(paletteAddr+uint16(i))&0x3F]
+		draw.Draw(rgba, swatch, image.NewUniform(c), image.Point{}, draw.Src)
+	}
+
+	return rgba
+}
+
+// SetPatternTablePalette sets which palette (0-7) GetPatternTable draws
+// tiles with. Palettes 0-3 are the background palettes, and 4-7 the sprite
+// palettes. Defaults to 0.
+func (p *Ppu) SetPatternTablePalette(palette int) {
+	p.patternTablePalette = byte(palette) & 0x7
+}
+
+// Draw the pattern tables with the next palette when the pattern table palette
+// key is pressed, checked once per frame.
+func (b *Bus) updatePaletteViewInput(win *pixelgl.Window) {
+	if win.JustPressed(patternTablePaletteKey) {
+		b.Ppu.SetPatternTablePalette(int(b.Ppu.patternTablePalette) + 1)
+	}
+}
@@ -0,0 +1,47 @@
+package nes
+
+import "github.com/faiface/pixel/pixelgl"
+
+// While running, the pause key pauses emulation. While paused, the step frame
+// key runs 1 frame and the step instruction key runs 1 CPU instruction, for
+// debugging frame by frame.
+
+const (
+	pauseKey           = pixelgl.KeyP
+	stepFrameKey       = pixelgl.KeyPeriod
+	stepInstructionKey = pixelgl.KeyComma
+)
+
+// SetPaused pauses or resumes Run. StepFrame and StepInstruction still run the
+// NES while paused.
+func (b *Bus) SetPaused(paused bool) {
+	b.paused = paused
+}
+
+// Paused returns whether Run is paused.
+func (b *Bus) Paused() bool {
+	return b.paused
+}
+
+// Handle the pause and step keys, once per frame.
+func (b *Bus) updatePauseInput(win *pixelgl.Window) {
+	if win.JustPressed(pauseKey) {
+		b.SetPaused(!b.paused)
+		if b.paused {
+			b.showMessage("Paused")
+		} else {
+			b.showMessage("Resumed")
+		}
+	}
+
+	if !b.paused {
+		return
+	}
+
+	if win.JustPressed(stepFrameKey) {
+		b.StepFrame()
+	}
+	if win.JustPressed(stepInstructionKey) {
+		b.StepInstruction()
+	}
+}
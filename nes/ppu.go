@@ -1,13 +1,13 @@
 package nes
 
 import (
+	_ "embed"
 	"fmt"
 	"image"
 	"image/color"
+	"io"
 	"io/ioutil"
 	"log"
-	"os"
-	"time"
 )
 
 const (
@@ -37,7 +37,7 @@ const (
 type Ppu struct {
 	Cart *Cartridge
 
-	nameTable    [2][1024]byte // NES allows storage for 2 nametables
+	nameTable    [4][1024]byte // 2 nametables, plus 2 more for four-screen cartridges
 	paletteTable [32]byte
 	patternTable [2][4096]byte
 
@@ -56,6 +56,12 @@ type Ppu struct {
 	frames int // Total number of rendered frames
 
 	dataBuffer byte // PPU reads are delayed 1 cycle, so we buffer the byte being read.
+	openBus    byte // Last value on the CPU/PPU data bus, returned by write-only registers.
+
+	// Open bus decay
+	openBusDecay     bool      // Whether bits of openBus decay to 0 over time
+	openBusRefreshed [8]uint64 // Value of dots when each bit of openBus was last driven high
+	dots             uint64    // Total number of PPU cycles run
 
 	// Background Rendering ~~~~~~
 	// "Loopy" internal registers
@@ -88,6 +94,7 @@ type Ppu struct {
 	// Shifters to hold sprite pattern data
 	spritePatternShifterLo [8]byte // low byte
 	spritePatternShifterHi [8]byte // high byte
+	spriteStartX           [8]byte // X position of each sprite, before counting down
 
 	// Foreground/background pixel and palette - used for rendering
 	bgPixel   byte
@@ -101,17 +108,49 @@ type Ppu struct {
 	// Sprite zero detection
 	isSpriteZeroPossible bool
 	isSpriteZeroRendered bool
+	spriteZeroHitEnabled bool // Debugging aid, disable to never set the sprite zero hit flag
+	spriteZeroHitDelay   int  // Dots from the hit until the flag is set
+	spriteZeroHitPending int  // Dots left until the flag is set, 0 if no hit is pending
+
+	accurateOamReads  bool // Emulate what OAMDATA reads return during rendering
+	spriteOverflowBug bool // Emulate the hardware bug in the sprite overflow search
+
+	renderMode RenderMode // Draw the picture dot by dot, or a scanline at a time
+
+	pixelTrace pixelTrace // Pixel being explained by ExplainPixel
+
+	vramWriteLog io.Writer // Log of writes to PPU memory, nil if disabled
+
+	patternTablePalette byte // Palette (0-7) GetPatternTable draws with
 
-	display *Display
+	// Tile usage tracking
+	trackTileUsage bool
+	tileUsage      [tileCount]int // Fetches of each tile in the current frame
+	lastTileUsage  [tileCount]int // Fetches of each tile in the last complete frame
 
-	paletteRGBA [paletteSize]color.RGBA
+	display Renderer
+
+	region Region // TV system, which sets the number of scanlines
+
+	// Blank (rendering disabled) fast path
+	blankFilled bool       // Whether the rest of the current scanline has been filled
+	blankColor  color.RGBA // Color the current scanline was filled with
+
+	paletteRGBA    [paletteSize]color.RGBA // Active palette used for rendering
+	defaultPalette [paletteSize]color.RGBA // Palette used outside of VS System mode
 
 	logger *log.Logger
 }
 
 func NewPpu() *Ppu {
+	palette, err := parsePalette(ntscPaletteFile)
+	if err != nil {
+		// The embedded palette is checked by the tests.
+		panic(err)
+	}
+
 	return &Ppu{
-		nameTable:    [2][1024]byte{},
+		nameTable:    [4][1024]byte{},
 		paletteTable: [32]byte{},
 		patternTable: [2][4096]byte{},
 
@@ -128,10 +167,13 @@ func NewPpu() *Ppu {
 		vRam: new(PpuLoopyReg),
 		tRam: new(PpuLoopyReg),
 
-		paletteRGBA: loadPalette("./palettes/ntscpalette.pal"),
+		paletteRGBA:    palette,
+		defaultPalette: palette,
 
 		oam:            newOAM(64),
 		spriteScanline: newOAM(8),
+
+		spriteZeroHitEnabled: true,
 	}
 }
 
@@ -139,44 +181,277 @@ func (p *Ppu) ConnectCartridge(c *Cartridge) {
 	p.Cart = c
 }
 
-func (p *Ppu) ConnectDisplay(d *Display) {
-	p.display = d
+// ConnectDisplay sets the renderer the PPU draws the game picture to, or none
+// if nil.
+func (p *Ppu) ConnectDisplay(r Renderer) {
+	p.display = r
+}
+
+// Reset returns the PPU to its power-up state. The connected cartridge,
+// display, and palette are kept.
+func (p *Ppu) Reset() {
+	*p.ppuCtrl = 0
+	*p.ppuMask = 0
+	*p.ppuStatus = 0
+	p.nmi = false
+
+	p.nameTable = [4][1024]byte{}
+	p.paletteTable = [32]byte{}
+
+	p.scanline = 0
+	p.cycle = 0
+	p.frameComplete = true
+	p.frames = 0
+	p.spriteZeroHitPending = 0
+	p.dataBuffer = 0
+	p.openBus = 0
+	p.openBusRefreshed = [8]uint64{}
+
+	// Background rendering
+	*p.vRam = 0
+	*p.tRam = 0
+	p.scrollFineX = 0
+	p.addrLatch = 0
+	p.nextBgTileId = 0
+	p.nextBgAttr = 0
+	p.nextBgTileLo = 0
+	p.nextBgTileHi = 0
+	p.bgPatternShifterLo = 0
+	p.bgPatternShifterHi = 0
+	p.bgAttribShifterLo = 0
+	p.bgAttribShifterHi = 0
+
+	// Foreground rendering
+	for _, sprite := range p.oam {
+		*sprite = oamSprite{}
+	}
+	p.oamAddr = 0
+	p.spriteScanline.clear()
+	p.spriteCount = 0
+	p.clearSpriteShifters()
+
+	p.bgPixel = 0
+	p.fgPixel = 0
+	p.bgPalette = 0
+	p.fgPalette = 0
+	p.fgPriority = false
+	p.isSpriteZeroPossible = false
+	p.isSpriteZeroRendered = false
 }
 
-// For future use if PPU logging is needed.
-func newPpuLogger() *log.Logger {
-	now := time.Now()
-	logFile := fmt.Sprintf("./logs/ppu%s.log", now.Format("20060102-150405"))
-	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE, 0664)
+// LoadPaletteFile loads a 64 color .pal file, and uses it instead of the
+// built-in NTSC palette. The palette is kept if the file can't be loaded.
+func (p *Ppu) LoadPaletteFile(path string) error {
+	palette, err := loadPalette(path)
 	if err != nil {
-		log.Fatal("Unable to create PPU log file...\n", err)
+		return err
+	}
+
+	p.paletteRGBA = palette
+	p.defaultPalette = palette
+
+	return nil
+}
+
+// SetPalette replaces the palette used to convert palette indices to RGBA colors.
+func (p *Ppu) SetPalette(palette [paletteSize]color.RGBA) {
+	p.paletteRGBA = palette
+}
+
+// SetSpriteZeroHitEnabled enables or disables sprite zero hit detection. With
+// detection disabled the sprite zero hit flag is never set, which helps find
+// out whether a visual bug comes from a game's sprite zero timing.
+func (p *Ppu) SetSpriteZeroHitEnabled(enabled bool) {
+	p.spriteZeroHitEnabled = enabled
+}
+
+// SetSpriteZeroHitDelay sets how many dots after the overlapping pixel is
+// drawn the sprite zero hit flag is set. With no delay, the flag is set on the
+// dot the pixel is drawn, dot x+1 for the pixel at x. Games timing raster
+// splits off the flag can be tuned against test ROMs such as
+// sprite_hit_tests with this. Defaults to 0.
+func (p *Ppu) SetSpriteZeroHitDelay(dots int) {
+	if dots < 0 {
+		dots = 0
+	}
+	p.spriteZeroHitDelay = dots
+}
+
+// SetAccurateOAMReads enables emulation of OAMDATA ($2004) reads during
+// rendering, which return the sprite evaluation bus instead of the OAM byte at
+// OAMADDR.
+func (p *Ppu) SetAccurateOAMReads(enabled bool) {
+	p.accurateOamReads = enabled
+}
+
+// SetSpriteOverflowBug enables emulation of the hardware bug in the sprite
+// overflow search, which makes the sprite overflow flag unreliable in the same
+// way as on a real NES. When disabled, the flag is set whenever more than 8
+// sprites are on a scanline.
+func (p *Ppu) SetSpriteOverflowBug(enabled bool) {
+	p.spriteOverflowBug = enabled
+}
+
+// GetVRAMAddress returns the 15 bit internal VRAM address (loopy v), which
+// also holds the current scroll position while rendering.
+func (p *Ppu) GetVRAMAddress() uint16 {
+	return p.vRam.value()
+}
+
+// SetVRAMAddress sets the 15 bit internal VRAM address (loopy v) directly,
+// without going through the PPUADDR ($2006) write latch. The temporary
+// address (loopy t) and the latch are left alone. Setting it while the PPU is
+// rendering changes the scroll position mid-frame, and desyncs scrolling
+// until the game next writes it.
+func (p *Ppu) SetVRAMAddress(addr uint16) {
+	*p.vRam = PpuLoopyReg(addr & 0x7FFF)
+}
+
+// lastDot returns the scanline and cycle the PPU ran last.
+func (p *Ppu) lastDot() (scanline, cycle int) {
+	switch {
+	case p.cycle > 0:
+		return p.scanline, p.cycle - 1
+	case p.scanline > -1:
+		return p.scanline - 1, 340
+	}
+	return p.region.scanlines() - 2, 340
+}
+
+// readOamData returns the value read from OAMDATA ($2004).
+//
+// While rendering a visible scanline the PPU is using OAM itself:
+//
+//	cycles 1-64:    secondary OAM is cleared, reads return 0xFF
+//	cycles 65-256:  sprite evaluation reads primary OAM
+//	cycles 257-320: sprite fetches read secondary OAM (Y, tile, attribute, then X
+//	                for the remaining cycles of each 8-cycle fetch)
+//
+// reference: https://wiki.nesdev.com/w/index.php/PPU_sprite_evaluation
+func (p *Ppu) readOamData() byte {
+	rendering := p.shouldRender() && p.scanline >= 0 && p.scanline < 240
+	if !p.accurateOamReads || !rendering {
+		return p.oam.read(p.oamAddr)
+	}
+
+	switch {
+	case p.cycle >= 1 && p.cycle <= 64:
+		return 0xFF
+	case p.cycle >= 257 && p.cycle <= 320:
+		sprite := (p.cycle - 257) / 8
+		field := (p.cycle - 257) % 8
+		if field > 3 {
+			field = 3
+		}
+		return p.spriteScanline.read(byte(sprite*4 + field))
 	}
 
-	return log.New(f, "", 0)
+	return p.oam.read(p.oamAddr)
 }
 
 // PPU clock cycle.
-// 1 frame = 262 scanlines (-1 - 260)
+// 1 frame = 262 scanlines (-1 - 260), or 312 on PAL (-1 - 310)
 // 1 scanline = 341 PPU clock cycles (0 - 340)
 func (p *Ppu) Clock() {
-	p.calculateBackgroundPixel()
-	p.calculateForegroundPixel()
-	p.drawPixel(p.cycle-1, p.scanline)
+	p.dots++
+
+	// A delayed sprite zero hit. Hits are only found on visible scanlines, so
+	// none is pending between frames, when states are saved.
+	if p.spriteZeroHitPending > 0 {
+		p.spriteZeroHitPending--
+		if p.spriteZeroHitPending == 0 {
+			p.ppuStatus.setFlag(statusSprite0Hit)
+		}
+	}
+
+	if p.shouldRender() {
+		if p.renderMode == ScanlineFast {
+			p.clockScanline()
+		} else {
+			p.calculateBackgroundPixel()
+			p.calculateForegroundPixel()
+			p.drawPixel(p.cycle-1, p.scanline)
+		}
+		p.blankFilled = false
+
+		// Sprite tiles are fetched from cycle 257, which mappers counting
+		// scanlines see around cycle 260.
+		if p.cycle == 260 && p.scanline >= -1 && p.scanline < 240 && p.Cart != nil {
+			p.Cart.countScanline()
+		}
+	} else {
+		p.clockBlank()
+	}
 
 	p.cycle++
 	if p.cycle >= 341 {
 		p.cycle = 0
 		p.scanline++
 
-		// Scanline 261 is referred to scanline -1
-		if p.scanline >= 261 {
+		// The last scanline is referred to as scanline -1
+		if p.scanline >= p.region.scanlines()-1 {
 			p.scanline = -1
 			p.frameComplete = true
 			p.frames++
+			p.endTileUsageFrame()
+
+			// There is no renderer when running without a display.
+			if p.display != nil {
+				p.display.UpdateScreen()
+			}
+		}
+	}
+}
+
+// clockBlank is a fast path for PPU clock cycles while rendering is disabled.
+// Nothing is fetched or shifted, and the screen only shows the backdrop color,
+// so each scanline is filled in one go instead of pixel by pixel. Status flag
+// and frame timing match the full rendering pipeline.
+func (p *Ppu) clockBlank() {
+	switch {
+	case p.scanline == -1 && p.cycle == 1:
+		p.ppuStatus.clearFlag(statusVBlank)
+		p.ppuStatus.clearFlag(statusSpriteOverflow)
+		p.ppuStatus.clearFlag(statusSprite0Hit)
+		p.clearSpriteShifters()
+	case p.scanline == 0 && p.cycle == 0:
+		// Odd frame cycle skip, see calculateBackgroundPixel.
+		if p.skipsOddFrameCycle() {
+			p.cycle++
+		}
+	case p.scanline == 241 && p.cycle == 1:
+		p.ppuStatus.setFlag(statusVBlank)
+
+		if p.ppuCtrl.getFlag(ctrlNmi) == 1 {
+			p.nmi = true
+		}
+	}
+
+	// No sprites are evaluated for the next scanline.
+	if p.cycle == 257 {
+		p.spriteCount = 0
+	}
 
-			p.display.UpdateScreen()
+	// Fill the rest of the scanline when first reached, or when the backdrop
+	// color changes partway through.
+	if p.display != nil && p.scanline >= 0 && p.scanline < 240 && p.cycle >= 1 && p.cycle <= 256 {
+		clr := p.backdropColor()
+		if !p.blankFilled || clr != p.blankColor {
+			p.display.FillRow(p.cycle-1, p.scanline, clr)
+			p.blankFilled = true
+			p.blankColor = clr
 		}
 	}
+
+	if p.cycle == 0 {
+		p.blankFilled = false
+	}
+}
+
+// skipsOddFrameCycle returns whether this frame skips cycle 0 of scanline 0.
+// Only NTSC consoles skip it, on odd frames.
+func (p *Ppu) skipsOddFrameCycle() bool {
+	return p.region == RegionNTSC && p.frames%2 == 1
 }
 
 // calculateBackgroundPixel calculates the correct pixel on the background to
@@ -195,7 +470,7 @@ func (p *Ppu) calculateBackgroundPixel() {
 		// frame. We skip this 0 cycle every other frame to emulate this
 		// behavior.
 		if p.scanline == 0 && p.cycle == 0 {
-			if p.frames%2 == 1 {
+			if p.skipsOddFrameCycle() {
 				p.cycle++
 			}
 		}
@@ -234,6 +509,7 @@ func (p *Ppu) calculateBackgroundPixel() {
 				fetchAddr = uint16(p.ppuCtrl.getFlag(ctrlBgPatternTbl))<<12 |
 					uint16(p.nextBgTileId)<<4 | uint16(p.vRam.getFineY()) + 0x0
 				p.nextBgTileLo = p.ppuRead(fetchAddr)
+				p.countTileFetch(fetchAddr)
 			case 6:
 				// Pattern table tile high
 				fetchAddr = uint16(p.ppuCtrl.getFlag(ctrlBgPatternTbl))<<12 |
@@ -242,14 +518,7 @@ func (p *Ppu) calculateBackgroundPixel() {
 			case 7:
 				// Increment horizontal scroll
 				if p.shouldRender() {
-					if p.vRam.getCoarseX() == 31 {
-						// Wrap around (nametable is 32 tiles wide)
-						p.vRam.setCoarseX(0)
-						p.vRam.toggleNametableH()
-					} else {
-						// Course X is last bits of vRam address
-						*p.vRam += 1
-					}
+					p.vRam.incrementCoarseX()
 				}
 			}
 		}
@@ -264,7 +533,8 @@ func (p *Ppu) calculateBackgroundPixel() {
 		if p.cycle == 257 {
 			p.loadBackgroundShifters()
 			if p.shouldRender() {
-				p.vRam.setNametable(p.tRam.getNametable() & 0b01)
+				// Horizontal nametable bit only, keep the vertical one.
+				p.vRam.setNametable(p.tRam.getNametable()&0b01 | p.vRam.getNametable()&0b10)
 				p.vRam.setCoarseX(p.tRam.getCoarseX())
 			}
 		}
@@ -278,7 +548,8 @@ func (p *Ppu) calculateBackgroundPixel() {
 		// End of visible frame, transfer y position from tRam to vRam
 		if p.scanline == -1 && p.cycle >= 280 && p.cycle <= 304 {
 			if p.shouldRender() {
-				p.vRam.setNametable(p.tRam.getNametable() & 0b10)
+				// Vertical nametable bit only, keep the horizontal one.
+				p.vRam.setNametable(p.tRam.getNametable()&0b10 | p.vRam.getNametable()&0b01)
 				p.vRam.setCoarseY(p.tRam.getCoarseY())
 				p.vRam.setFineY(p.tRam.getFineY())
 			}
@@ -304,7 +575,9 @@ func (p *Ppu) calculateBackgroundPixel() {
 	// this scanline/pixel.
 	var bgPixel, bgPalette byte
 
-	if p.ppuMask.getFlag(maskBgShow) > 0 {
+	// The pixel drawn on this cycle is x = cycle - 1, so the left 8 pixels
+	// are drawn on cycles 1-8.
+	if p.ppuMask.getFlag(maskBgShow) > 0 && (p.ppuMask.getFlag(maskBgLeft) > 0 || p.cycle >= 9) {
 		bitMux := uint16(0x8000 >> p.scrollFineX)
 
 		var pixelLo, pixelHi byte
@@ -341,8 +614,10 @@ func (p *Ppu) calculateForegroundPixel() {
 		p.clearSpriteShifters()
 	}
 
-	// End of visible scanline
-	if p.cycle == 257 && p.scanline >= 0 {
+	// End of visible scanline. Sprites are evaluated for the next scanline, so
+	// the pre-render scanline (-1) finds no sprites for scanline 0, and nothing
+	// is evaluated after the last visible scanline.
+	if p.cycle == 257 && p.scanline >= -1 && p.scanline < 240 {
 		p.spriteScanline.clear()
 		p.spriteCount = 0
 
@@ -354,11 +629,23 @@ func (p *Ppu) calculateForegroundPixel() {
 		p.loadSprites()
 	}
 
-	// Get the palette, pixel, and priority.
-	if p.ppuMask.getFlag(maskSpriteShow) > 0 {
-		if p.ppuMask.getFlag(maskSpriteLeft) > 0 || p.cycle >= 9 {
-			p.isSpriteZeroRendered = false
+	// The pixel drawn on this cycle is x = cycle - 1.
+	p.calculateSpritePixel(p.cycle - 1)
+}
 
+// calculateSpritePixel finds the sprite pixel, if any, drawn at x on the
+// current scanline from the sprite shifters.
+func (p *Ppu) calculateSpritePixel(x int) {
+	// Get the palette, pixel, and priority. Nothing is drawn unless a sprite
+	// pixel is found below.
+	p.fgPixel = 0
+	p.fgPalette = 0
+	p.fgPriority = false
+	p.isSpriteZeroRendered = false
+
+	if p.ppuMask.getFlag(maskSpriteShow) > 0 {
+		// Left 8 pixels, like the background.
+		if p.ppuMask.getFlag(maskSpriteLeft) > 0 || x >= 8 {
 			// Find the first visible pixel (x = 0) of highest priority.
 			for spriteIdx, sprite := range p.spriteScanline {
 				if spriteIdx >= p.spriteCount {
@@ -433,48 +720,71 @@ func (p *Ppu) drawPixel(x, y int) {
 		}
 
 		// Detect sprite zero hit
-		if p.isSpriteZeroPossible && p.isSpriteZeroRendered {
-			showBg := p.ppuStatus.getFlag(maskBgShow)
-			showFg := p.ppuStatus.getFlag(maskSpriteShow)
+		if p.spriteZeroHitEnabled && p.isSpriteZeroPossible && p.isSpriteZeroRendered {
+			showBg := p.ppuMask.getFlag(maskBgShow)
+			showFg := p.ppuMask.getFlag(maskSpriteShow)
 			if showBg > 0 && showFg > 0 {
-				bgLeft := p.ppuStatus.getFlag(maskBgLeft)
-				fgLeft := p.ppuStatus.getFlag(maskSpriteLeft)
+				bgLeft := p.ppuMask.getFlag(maskBgLeft)
+				fgLeft := p.ppuMask.getFlag(maskSpriteLeft)
 
-				minCycle, maxCycle := 1, 257
-				if !(bgLeft > 0 || fgLeft > 0) {
-					// Left 8 pixels are disabled
-					minCycle = 9
+				minX, maxX := 0, 256
+				if bgLeft == 0 || fgLeft == 0 {
+					// Left 8 pixels of either layer are disabled
+					minX = 8
 				}
-				if p.cycle >= minCycle && p.cycle <= maxCycle {
-					p.ppuStatus.setFlag(statusSprite0Hit)
+				if x >= minX && x <= maxX {
+					p.setSpriteZeroHit()
 				}
 			}
 		}
 	}
 
+	p.tracePixel(x, y, pixel, palette)
+
 	// Draw the pixel
-	clr := p.getColorFromPalette(palette, pixel)
-	p.display.DrawPixel(x, y, clr)
+	if p.display != nil {
+		var clr color.RGBA
+		if pixel == 0 {
+			clr = p.backdropColor()
+		} else {
+			clr = p.outputColor(p.ppuRead(paletteAddr + uint16((palette<<2)+pixel)))
+		}
+		p.display.DrawPixel(x, y, clr)
+	}
+}
+
+// Set the sprite zero hit flag, after the delay set by SetSpriteZeroHitDelay.
+// Only the first hit of a frame counts.
+func (p *Ppu) setSpriteZeroHit() {
+	if p.spriteZeroHitDelay == 0 {
+		p.ppuStatus.setFlag(statusSprite0Hit)
+	} else if p.spriteZeroHitPending == 0 && p.ppuStatus.getFlag(statusSprite0Hit) == 0 {
+		p.spriteZeroHitPending = p.spriteZeroHitDelay
+	}
 }
 
 // Communicate with main (CPU) bus - used for PPU register access.
 func (p *Ppu) cpuRead(addr uint16) byte {
 	var data byte
 
+	// Write-only registers return the last value on the data bus.
+	p.decayOpenBus()
+	data = p.openBus
+	driven := byte(0xFF) // Bits of data driven by the register
+
 	switch addr {
-	case 0x0000: // Controller
-	case 0x0001: // Mask
+	case 0x0000, 0x0001, 0x0003, 0x0005, 0x0006: // Controller, Mask, OAM Address, Scroll, Address (write-only)
+		driven = 0x00
 	case 0x0002: // Status
-		data = byte(*p.ppuStatus) & 0xE0
+		// Only the top 3 bits are driven, the rest is open bus.
+		data = byte(*p.ppuStatus)&0xE0 | p.openBus&0x1F
+		driven = 0xE0
 
 		// Reading the status register clears the VBlank flag and the PPU address latch.
 		p.ppuStatus.clearFlag(statusVBlank)
 		p.addrLatch = 0
-	case 0x0003: // OAM Address
 	case 0x0004: // OAM Data
-		data = p.oam.read(p.oamAddr)
-	case 0x0005: // Scroll
-	case 0x0006: // Address
+		data = p.readOamData()
 	case 0x0007: // Data
 		// CPU reads from VRAM are delayed by one cycle. The data to be read is
 		// stored in a buffer on the PPU. Reading from VRAM returns the current
@@ -500,10 +810,15 @@ func (p *Ppu) cpuRead(addr uint16) byte {
 		}
 	}
 
+	p.setOpenBus(data, driven)
+
 	return data
 }
 
 func (p *Ppu) cpuWrite(addr uint16, data byte) {
+	// Every write fills the data bus, including writes to read-only registers.
+	p.setOpenBus(data, 0xFF)
+
 	switch addr {
 	case 0x0000: // Controller
 		*p.ppuCtrl = PpuReg(data)
@@ -516,7 +831,7 @@ func (p *Ppu) cpuWrite(addr uint16, data byte) {
 	case 0x0003: // OAM Address
 		p.oamAddr = data
 	case 0x0004: // OAM Data
-		p.oam.write(p.oamAddr, data)
+		p.writeOam(p.oamAddr, data)
 	case 0x0005: // Scroll
 		if p.addrLatch == 0 {
 			// First write (coarse/fine X scroll values)
@@ -578,10 +893,12 @@ func (p *Ppu) ppuRead(addr uint16) byte {
 	var data byte
 
 	if addr >= patternTblAddr && addr <= patternTblAddrEnd {
-		//tbl := (addr >> 12) & 0x1
-		//idx := addr & 0x0FFF
-		//data = p.patternTable[tbl][idx]
-		data = p.Cart.ppuRead(addr)
+		if p.Cart != nil {
+			data = p.Cart.ppuRead(addr)
+		} else {
+			// Built-in splash screen tiles
+			data = p.patternTable[(addr>>12)&0x1][addr&0x0FFF]
+		}
 	} else if addr >= nameTblAddr && addr <= nameTblAddrEnd {
 		// Nametable read with the correct mirroring set by the game cartridge
 		data = p.nametableRead(addr)
@@ -604,9 +921,13 @@ func (p *Ppu) ppuWrite(addr uint16, data byte) {
 		//tbl := (addr >> 12) & 0x1
 		//idx := addr & 0x0FFF
 		//p.patternTable[tbl][idx] = data
-		p.Cart.ppuWrite(addr, data)
+		p.logVRAMWrite("pattern", addr, data)
+		if p.Cart != nil {
+			p.Cart.ppuWrite(addr, data)
+		}
 	} else if addr >= nameTblAddr && addr <= nameTblAddrEnd {
 		// Nametable write with the correct mirroring set by the game cartridge
+		p.logVRAMWrite("nametable", addr, data)
 		p.nametableWrite(addr, data)
 	} else if addr >= paletteAddr && addr <= paletteAddrEnd {
 		// Mirrored addresses
@@ -614,38 +935,17 @@ func (p *Ppu) ppuWrite(addr uint16, data byte) {
 		if addr == 0x0010 || addr == 0x0014 || addr == 0x0018 || addr == 0x001C {
 			addr -= 0x10
 		}
+		p.logVRAMWrite("palette", paletteAddr|addr, data)
 		p.paletteTable[addr] = data
 	}
 }
 
 // Gets a byte of data from the nametable memory using a given memory address.
 func (p *Ppu) nametableRead(addr uint16) byte {
-	var data byte
-
 	// Get an address relative to the nametable space (0x0000-0x0FFF)
 	addr &= 0x0FFF
-	nameTblId := getNametableId(addr)
 
-	switch nameTblId {
-	case 0:
-		data = p.nameTable[0][addr&0x3FF]
-	case 1:
-		if p.Cart.mirroring == mirrorHorizontal {
-			data = p.nameTable[0][addr&0x3FF] // mirror
-		} else if p.Cart.mirroring == mirrorVertical {
-			data = p.nameTable[1][addr&0x3FF]
-		}
-	case 2:
-		if p.Cart.mirroring == mirrorHorizontal {
-			data = p.nameTable[1][addr&0x3FF]
-		} else if p.Cart.mirroring == mirrorVertical {
-			data = p.nameTable[0][addr&0x3FF] // mirror
-		}
-	case 3:
-		data = p.nameTable[1][addr&0x3FF] // always mirror
-	}
-
-	return data
+	return p.nameTable[p.nametableBank(addr)][addr&0x3FF]
 }
 
 // Write data to the appropriate nametable, determined by the address and what
@@ -653,26 +953,37 @@ func (p *Ppu) nametableRead(addr uint16) byte {
 func (p *Ppu) nametableWrite(addr uint16, data byte) {
 	// Relative nametable address
 	addr &= 0x0FFF
+
+	p.nameTable[p.nametableBank(addr)][addr&0x3FF] = data
+}
+
+// Returns which nametable memory bank backs the given relative nametable
+// address under the current mirroring mode.
+func (p *Ppu) nametableBank(addr uint16) byte {
 	nameTblId := getNametableId(addr)
 
-	switch nameTblId {
-	case 0:
-		p.nameTable[0][addr&0x3FF] = data
-	case 1:
-		if p.Cart.mirroring == mirrorHorizontal {
-			p.nameTable[0][addr&0x3FF] = data // mirror
-		} else if p.Cart.mirroring == mirrorVertical {
-			p.nameTable[1][addr&0x3FF] = data
-		}
-	case 2:
-		if p.Cart.mirroring == mirrorHorizontal {
-			p.nameTable[1][addr&0x3FF] = data
-		} else if p.Cart.mirroring == mirrorVertical {
-			p.nameTable[0][addr&0x3FF] = data // mirror
-		}
-	case 3:
-		p.nameTable[1][addr&0x3FF] = data // always mirror
+	switch p.mirroring() {
+	case MirrorVertical:
+		return nameTblId & 1
+	case MirrorOnescreenLo:
+		return 0
+	case MirrorOnescreenHi:
+		return 1
+	case MirrorFourScreen:
+		return nameTblId
+	}
+
+	// Horizontal
+	return nameTblId >> 1
+}
+
+// Get the cartridge's nametable mirroring mode. Horizontal mirroring is used
+// when no cartridge is inserted.
+func (p *Ppu) mirroring() MirrorMode {
+	if p.Cart == nil {
+		return MirrorHorizontal
 	}
+	return p.Cart.Mirroring()
 }
 
 // Returns the nametable ID (0, 1, 2, 3) for the given relative memory address.
@@ -692,16 +1003,39 @@ func getNametableId(addr uint16) byte {
 	return id
 }
 
-// LoadPalette loads an NES palette from the specified file path, and returns
-// and array of RGBA colors.
-func loadPalette(filepath string) [paletteSize]color.RGBA {
+// Default NTSC palette, used unless another is loaded with LoadPaletteFile.
+//
+//go:embed palettes/ntscpalette.pal
+var ntscPaletteFile []byte
+
+// Size of a .pal file: an RGB triplet for each of the 64 colors.
+const paletteFileSize = int(paletteSize) * 3
+
+// loadPalette loads an NES palette from the specified file path, and returns
+// an array of RGBA colors.
+func loadPalette(filepath string) ([paletteSize]color.RGBA, error) {
 	data, err := ioutil.ReadFile(filepath)
 	if err != nil {
-		log.Fatal("Unable to open palette file.\n", err)
+		return [paletteSize]color.RGBA{}, fmt.Errorf("unable to open palette file: %w", err)
 	}
 
+	palette, err := parsePalette(data)
+	if err != nil {
+		return palette, fmt.Errorf("%v: %w", filepath, err)
+	}
+
+	return palette, nil
+}
+
+// parsePalette converts the contents of a .pal file to an array of RGBA
+// colors.
+func parsePalette(data []byte) ([paletteSize]color.RGBA, error) {
 	palette := [paletteSize]color.RGBA{}
 
+	if len(data) != paletteFileSize {
+		return palette, fmt.Errorf("palette is %d bytes, want %d", len(data), paletteFileSize)
+	}
+
 	for i := 0; i < len(data); i += 3 {
 		r := data[i]
 		g := data[i+1]
@@ -709,7 +1043,7 @@ func loadPalette(filepath string) [paletteSize]color.RGBA {
 		palette[i/3] = color.RGBA{r, g, b, 255}
 	}
 
-	return palette
+	return palette, nil
 }
 
 // Get a color from the given palette ID, offset by the given pixel value.
@@ -719,6 +1053,62 @@ func (p *Ppu) getColorFromPalette(palette, pixel byte) color.RGBA {
 	return p.paletteRGBA[idx&0x3F]
 }
 
+// Brightness of the color channels not emphasized, while any are.
+const emphasisAttenuation = 0.816
+
+// outputColor returns the color output for a palette entry, with greyscale and
+// color emphasis from the mask applied.
+//
+// reference: https://wiki.nesdev.com/w/index.php/PPU_palettes#Color_tint_bits
+func (p *Ppu) outputColor(idx byte) color.RGBA {
+	// Greyscale only keeps the grey column of the palette.
+	if p.ppuMask.getFlag(maskGreyscale) > 0 {
+		idx &= 0x30
+	}
+	c := p.paletteRGBA[idx&0x3F]
+
+	red := p.ppuMask.getFlag(maskEmphasizeRed) > 0
+	green := p.ppuMask.getFlag(maskEmphasizeGreen) > 0
+	blue := p.ppuMask.getFlag(maskEmphasizeBlue) > 0
+	if !red && !green && !blue {
+		return c
+	}
+
+	// PAL consoles swap the red and green bits.
+	if p.region == RegionPAL {
+		red, green = green, red
+	}
+
+	// Emphasis darkens the other channels.
+	attenuate := func(v uint8) uint8 { return uint8(float64(v) * emphasisAttenuation) }
+	if !red {
+		c.R = attenuate(c.R)
+	}
+	if !green {
+		c.G = attenuate(c.G)
+	}
+	if !blue {
+		c.B = attenuate(c.B)
+	}
+
+	return c
+}
+
+// Get the backdrop color, shown wherever no background or sprite pixel is
+// drawn.
+//
+// While rendering is disabled and the VRAM address points into palette memory,
+// the PPU shows the palette entry at that address instead (the "background
+// palette hack"). Some games use this to display colors other than $3F00.
+func (p *Ppu) backdropColor() color.RGBA {
+	addr := p.vRam.value() & ppuMaxAddr
+	if !p.shouldRender() && addr >= paletteAddr {
+		return p.outputColor(p.ppuRead(addr))
+	}
+
+	return p.outputColor(p.ppuRead(paletteAddr))
+}
+
 // Check whether the PPU is in render mode. This is set by the maskBgShow and
 // maskSpriteShow flags.
 func (p *Ppu) shouldRender() bool {
@@ -741,14 +1131,19 @@ func (p *Ppu) updateShifters() {
 
 	// Sprites
 	if p.ppuMask.getFlag(maskSpriteShow) > 0 && p.cycle >= 1 && p.cycle < 258 {
-		for spriteIdx := 0; spriteIdx < p.spriteCount; spriteIdx++ {
-			sprite := p.spriteScanline[spriteIdx]
-			if sprite.x > 0 {
-				sprite.x--
-			} else {
-				p.spritePatternShifterLo[spriteIdx] <<= 1
-				p.spritePatternShifterHi[spriteIdx] <<= 1
-			}
+		p.updateSpriteShifters()
+	}
+}
+
+// Count each sprite down to its X position, then shift out its pixels.
+func (p *Ppu) updateSpriteShifters() {
+	for spriteIdx := 0; spriteIdx < p.spriteCount; spriteIdx++ {
+		sprite := p.spriteScanline[spriteIdx]
+		if sprite.x > 0 {
+			sprite.x--
+		} else {
+			p.spritePatternShifterLo[spriteIdx] <<= 1
+			p.spritePatternShifterHi[spriteIdx] <<= 1
 		}
 	}
 }
@@ -810,30 +1205,41 @@ func (p *Ppu) getSpriteSize() int {
 
 // Sprite evaluation - find first 8 sprites to be rendered on next scanline,
 // copy them to secondary OAM (spriteScanline).
+//
+// Evaluation starts at the sprite OAMADDR points to and wraps around OAM, so
+// games can rotate sprite priority by changing OAMADDR each frame, dropping
+// different sprites when more than 8 share a scanline. Like on hardware, the
+// first sprite evaluated is the one treated as sprite zero for sprite zero
+// hits, whatever its index.
 func (p *Ppu) spriteEvaluation() {
 	spriteOverflow := false
 
 	p.isSpriteZeroPossible = false
 
-	for oamIdx, entry := range p.oam {
-		diff := p.scanline - int(entry.y)
-		spriteSize := p.getSpriteSize()
-		if diff >= 0 && diff < spriteSize {
-			// Sprite hit!
-			if p.spriteCount < 8 {
-				// Check if sprite zero
-				if oamIdx == 0 {
-					p.isSpriteZeroPossible = true
-				}
+	spriteSize := p.getSpriteSize()
+	start := int(p.oamAddr >> 2)
+	for i := 0; i < len(p.oam); i++ {
+		oamIdx := (start + i) % len(p.oam)
+		if !p.isSpriteOnScanline(p.oam[oamIdx].y, spriteSize) {
+			continue
+		}
 
-				copyOamEntry(p.spriteScanline[p.spriteCount], p.oam[oamIdx])
-				p.spriteCount++
-			} else {
-				spriteOverflow = true
+		// Sprite hit!
+		if p.spriteCount < 8 {
+			// Check if sprite zero
+			if i == 0 {
+				p.isSpriteZeroPossible = true
 			}
-		}
 
-		if p.spriteCount >= 8 && spriteOverflow {
+			copyOamEntry(p.spriteScanline[p.spriteCount], p.oam[oamIdx])
+			p.spriteCount++
+
+			if p.spriteCount == 8 && p.spriteOverflowBug {
+				spriteOverflow = p.searchSpriteOverflow(oamIdx+1, len(p.oam)-i-1, spriteSize)
+				break
+			}
+		} else {
+			spriteOverflow = true
 			break
 		}
 	}
@@ -843,6 +1249,37 @@ func (p *Ppu) spriteEvaluation() {
 	}
 }
 
+// isSpriteOnScanline returns whether a sprite at Y position y is on the
+// scanline being evaluated.
+func (p *Ppu) isSpriteOnScanline(y byte, spriteSize int) bool {
+	diff := p.scanline - int(y)
+	return diff >= 0 && diff < spriteSize
+}
+
+// searchSpriteOverflow searches the count sprites left to evaluate, from
+// sprite n and wrapping around OAM, for a 9th sprite on the scanline the way
+// the hardware does. Once 8 sprites are found,
+// the byte within each sprite being checked as its Y position is incremented
+// along with the sprite, so it reads the tile, attribute, and X bytes of later
+// sprites as Y. This misses sprites that are on the scanline, and finds ones
+// that are not.
+//
+// reference: https://wiki.nesdev.com/w/index.php/PPU_sprite_evaluation#Sprite_overflow_bug
+func (p *Ppu) searchSpriteOverflow(n, count int, spriteSize int) bool {
+	m := 0
+	for ; count > 0; n, count = n+1, count-1 {
+		y := p.oam.read(byte((n%len(p.oam))*4 + m))
+		if p.isSpriteOnScanline(y, spriteSize) {
+			return true
+		}
+
+		// The bug: m is incremented too, without carrying into n.
+		m = (m + 1) & 0x03
+	}
+
+	return false
+}
+
 // Clear the PPU's 8 sprite shifters, setting each shifter to 0.
 func (p *Ppu) clearSpriteShifters() {
 	for i := 0; i < 8; i++ {
@@ -852,53 +1289,33 @@ func (p *Ppu) clearSpriteShifters() {
 }
 
 // getSpritePatternAddr returns the calculated low and high memory addresses
-// for the given sprite.
+// for the given sprite's row on the current scanline.
 func (p *Ppu) getSpritePatternAddr(sprite *oamSprite) (uint16, uint16) {
-	// Find correct addresses - influenced by sprite mode, current
-	// pattern table, tile ID of the sprite
-	var addrLo uint16
-
-	if p.getSpriteSize() == 8 {
-		// 8x8
-		if sprite.isFlippedVertical() {
-			// 0KB or 4KB pattern table, 16 byte sprite
-			addrLo = (uint16(p.ppuCtrl.getFlag(ctrlSpritePatternTbl)) << 12) |
-				(uint16(sprite.id) << 4) |
-				(uint16(7 - (byte(p.scanline) - sprite.y))) // row (flipped)
-		} else {
-			addrLo = (uint16(p.ppuCtrl.getFlag(ctrlSpritePatternTbl)) << 12) |
-				(uint16(sprite.id) << 4) |
-				(uint16(byte(p.scanline) - sprite.y)) // row
-		}
+	// Row of the sprite on the current scanline, 0 to 7 or 0 to 15. Sprite
+	// evaluation only finds sprites covering the scanline, so it is in range.
+	size := byte(p.getSpriteSize())
+	row := byte(p.scanline) - sprite.y
+	if sprite.isFlippedVertical() {
+		// Flipping an 8x16 sprite swaps its top and bottom tiles too.
+		row = size - 1 - row
+	}
+
+	var table uint16
+	var tile byte
+	if size == 8 {
+		// 0KB or 4KB pattern table, set by PPUCTRL
+		table = uint16(p.ppuCtrl.getFlag(ctrlSpritePatternTbl)) << 12
+		tile = sprite.id
 	} else {
-		// 8x16
-		if sprite.isFlippedVertical() {
-			if p.scanline-int(sprite.y) < 8 {
-				// top half of the sprite
-				addrLo = (uint16(sprite.id&0x01) << 12) |
-					(uint16(sprite.id&0xFE) << 4) |
-					(uint16(7 - (byte(p.scanline)-sprite.y)&0x07))
-			} else {
-				// bottom half of the sprite
-				addrLo = (uint16(sprite.id&0x01) << 12) |
-					(uint16((sprite.id&0xFE)+1) << 4) |
-					(uint16(7 - (byte(p.scanline)-sprite.y)&0x07))
-			}
-		} else {
-			if p.scanline-int(sprite.y) < 8 {
-				// top half of the sprite
-				addrLo = (uint16(sprite.id&0x01) << 12) |
-					(uint16(sprite.id&0xFE) << 4) |
-					(uint16((byte(p.scanline) - sprite.y) & 0x07))
-			} else {
-				// bottom half of the sprite
-				addrLo = (uint16(sprite.id&0x01) << 12) |
-					(uint16((sprite.id&0xFE)+1) << 4) |
-					(uint16((byte(p.scanline) - sprite.y) & 0x07))
-			}
-		}
+		// 8x16: bit 0 of the tile index selects the pattern table, and the
+		// top half uses the even tile, the bottom half the odd tile after it.
+		table = uint16(sprite.id&0x01) << 12
+		tile = sprite.id&0xFE + row>>3
 	}
 
+	// 16 byte tiles
+	addrLo := table | uint16(tile)<<4 | uint16(row&0x07)
+
 	return addrLo, addrLo + 8
 }
 
@@ -913,6 +1330,7 @@ func (p *Ppu) loadSprites() {
 		// Read data
 		spritePatternDataLo := p.ppuRead(spritePatternAddrLo)
 		spritePatternDataHi := p.ppuRead(spritePatternAddrHi)
+		p.countTileFetch(spritePatternAddrLo)
 		if sprite.isFlippedHorizontal() {
 			spritePatternDataLo = flipByte(spritePatternDataLo)
 			spritePatternDataHi = flipByte(spritePatternDataHi)
@@ -921,13 +1339,15 @@ func (p *Ppu) loadSprites() {
 		// Load data to sprite shifters
 		p.spritePatternShifterLo[spriteIdx] = spritePatternDataLo
 		p.spritePatternShifterHi[spriteIdx] = spritePatternDataHi
+		p.spriteStartX[spriteIdx] = sprite.x
 	}
 }
 
 // Convenience functions for development.
 
 // Pattern tables are 16x16 grids of tiles or sprites. Each tile is 8x8 pixels
-// and 16 bytes of memory.
+// and 16 bytes of memory. Tiles are drawn with the palette chosen by
+// SetPatternTablePalette.
 func (p *Ppu) GetPatternTable(i int) *image.RGBA {
 	rgba := image.NewRGBA(image.Rect(0, 0, 128, 128))
 
@@ -954,7 +1374,7 @@ func (p *Ppu) GetPatternTable(i int) *image.RGBA {
 					y := tileY*8 + row
 
 					// Pixel color
-					c := p.getColorFromPalette(0, pixel)
+					c := p.getColorFromPalette(p.patternTablePalette, pixel)
 
 					// Draw the pixel
 					rgba.Set(x, y, c)
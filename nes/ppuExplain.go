@@ -0,0 +1,110 @@
+package nes
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Pixel tracing records how the PPU chose the color of one pixel: the
+// background pixel, every sprite pixel competing for it, and which one won.
+
+// pixelTrace holds the pixel being traced and its latest explanation.
+type pixelTrace struct {
+	enabled     bool
+	x, y        int
+	explanation string // Empty until the pixel has been drawn
+}
+
+// ExplainPixel explains how the color of pixel (x, y) was chosen when it was
+// last drawn. The first call for a pixel starts tracing it, and the
+// explanation is ready once the PPU draws it, within a frame. Tracing follows
+// one pixel at a time.
+func (p *Ppu) ExplainPixel(x, y int) string {
+	t := &p.pixelTrace
+	if !t.enabled || t.x != x || t.y != y {
+		*t = pixelTrace{enabled: true, x: x, y: y}
+	}
+
+	if t.explanation == "" {
+		return fmt.Sprintf("Pixel (%d, %d) has not been drawn since tracing started. Run a frame first.", x, y)
+	}
+	return t.explanation
+}
+
+// tracePixel records the explanation for pixel (x, y) if it is being traced.
+// The pixel and palette are the ones chosen by drawPixel.
+func (p *Ppu) tracePixel(x, y int, pixel, palette byte) {
+	t := &p.pixelTrace
+	if !t.enabled || t.x != x || t.y != y {
+		return
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Pixel (%d, %d), frame %d\n", x, y, p.frames)
+
+	// Background
+	switch {
+	case p.ppuMask.getFlag(maskBgShow) == 0:
+		buf.WriteString("Background: hidden\n")
+	case x < 8 && p.ppuMask.getFlag(maskBgLeft) == 0:
+		buf.WriteString("Background: clipped in the left 8 pixels\n")
+	default:
+		fmt.Fprintf(&buf, "Background: pixel %d, palette %d\n", p.bgPixel, p.bgPalette)
+	}
+
+	// Sprites, in priority order. The first opaque one is used.
+	switch {
+	case p.ppuMask.getFlag(maskSpriteShow) == 0:
+		buf.WriteString("Sprites: hidden\n")
+	case x < 8 && p.ppuMask.getFlag(maskSpriteLeft) == 0:
+		buf.WriteString("Sprites: clipped in the left 8 pixels\n")
+	default:
+		candidates := 0
+		for i := 0; i < p.spriteCount; i++ {
+			// Sprites covering this pixel have counted down to x = 0, and
+			// have not shifted out all 8 pixels.
+			sprite := p.spriteScanline[i]
+			startX := int(p.spriteStartX[i])
+			if sprite.x != 0 || x < startX || x >= startX+8 {
+				continue
+			}
+
+			lo := (p.spritePatternShifterLo[i] & 0x80) >> 7
+			hi := (p.spritePatternShifterHi[i] & 0x80) >> 7
+			priority := "in front of"
+			if sprite.attribute&(1<<5) > 0 {
+				priority = "behind"
+			}
+
+			fmt.Fprintf(&buf, "Sprite %d (tile $%02X): pixel %d, palette %d, %s background\n",
+				i, sprite.id, hi<<1|lo, sprite.attribute&0x03+0x04, priority)
+			candidates++
+		}
+		if candidates == 0 {
+			buf.WriteString("Sprites: none at this pixel\n")
+		}
+	}
+
+	// Decision, as made by drawPixel
+	switch {
+	case p.bgPixel == 0 && p.fgPixel == 0:
+		buf.WriteString("Result: background and sprites transparent, backdrop shown\n")
+	case p.bgPixel == 0:
+		buf.WriteString("Result: background transparent, sprite shown\n")
+	case p.fgPixel == 0:
+		buf.WriteString("Result: no opaque sprite, background shown\n")
+	case p.fgPriority:
+		buf.WriteString("Result: opaque sprite in front of opaque background, sprite shown\n")
+	default:
+		buf.WriteString("Result: opaque sprite behind opaque background, background shown\n")
+	}
+
+	if pixel == 0 {
+		fmt.Fprintf(&buf, "Color: backdrop ($3F00) = $%02X", p.ppuRead(paletteAddr)&0x3F)
+	} else {
+		addr := paletteAddr + uint16(palette<<2+pixel)
+		fmt.Fprintf(&buf, "Color: palette %d pixel %d ($%04X) = $%02X", palette, pixel, addr, p.ppuRead(addr)&0x3F)
+	}
+
+	t.explanation = buf.String()
+}
@@ -101,3 +101,14 @@ func (r *PpuLoopyReg) toggleNametableH() {
 func (r *PpuLoopyReg) toggleNametableV() {
 	*r ^= 0x0800
 }
+
+// Increment coarse X, wrapping around to the other horizontal nametable (a
+// nametable is 32 tiles wide).
+func (r *PpuLoopyReg) incrementCoarseX() {
+	if r.getCoarseX() == 31 {
+		r.setCoarseX(0)
+		r.toggleNametableH()
+	} else {
+		*r += 1
+	}
+}
@@ -0,0 +1,42 @@
+package nes
+
+// The PPU's I/O data latch holds the last value on the data bus between the CPU
+// and PPU. It is a capacitor that slowly loses its charge, so each bit reads as
+// 0 about 600ms after it was last driven high.
+// reference: https://wiki.nesdev.com/w/index.php/Open_bus_behavior#PPU_open_bus
+
+// PPU cycles in 600ms, at 5.369318 MHz.
+const openBusDecayDots = 3221591
+
+// SetOpenBusDecay enables or disables decay of the PPU data latch read back by
+// the write-only registers and the low bits of PPUSTATUS. When disabled, the
+// latch holds its value forever.
+func (p *Ppu) SetOpenBusDecay(enabled bool) {
+	p.openBusDecay = enabled
+}
+
+// setOpenBus puts data on the data latch. Only the driven bits are changed,
+// the rest keep their value.
+func (p *Ppu) setOpenBus(data, driven byte) {
+	p.openBus = p.openBus&^driven | data&driven
+
+	for bit := 0; bit < 8; bit++ {
+		if data&driven&(1<<bit) > 0 {
+			p.openBusRefreshed[bit] = p.dots
+		}
+	}
+}
+
+// decayOpenBus clears the bits of the data latch that have not been driven
+// high for longer than the decay time.
+func (p *Ppu) decayOpenBus() {
+	if !p.openBusDecay {
+		return
+	}
+
+	for bit := 0; bit < 8; bit++ {
+		if p.openBus&(1<<bit) > 0 && p.dots-p.openBusRefreshed[bit] >= openBusDecayDots {
+			p.openBus &^= 1 << bit
+		}
+	}
+}
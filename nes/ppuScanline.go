@@ -0,0 +1,152 @@
+package nes
+
+// RenderMode selects how the PPU draws the picture.
+type RenderMode int
+
+const (
+	// Every dot is fetched, shifted, and drawn on its own PPU cycle, like
+	// hardware.
+	DotAccurate RenderMode = iota
+
+	// Each visible scanline is drawn in one pass on its first cycle, from the
+	// scroll position, nametables, and sprites at that time. Much faster, and
+	// the picture matches DotAccurate unless a game changes the scroll,
+	// pattern tables, or palette partway through a scanline. Sprite zero hit
+	// is set at the start of the scanline instead of on the dot it happens.
+	ScanlineFast
+)
+
+// SetRenderMode sets how the PPU draws the picture. Defaults to DotAccurate.
+// Change it between frames: changing it while a frame is drawn may leave one
+// scanline scrolled wrong.
+func (p *Ppu) SetRenderMode(mode RenderMode) {
+	p.renderMode = mode
+}
+
+// clockScanline runs a PPU clock cycle while rendering in ScanlineFast mode.
+// Status flags, scrolling, and sprite evaluation are updated on the same
+// cycles as in DotAccurate mode, but there are no per-dot fetches or shifts.
+//
+// Loopy v is not moved along the scanline. It holds the scroll position of
+// the start of the scanline until cycle 256, where DotAccurate mode has
+// already prefetched the next scanline's first 2 tiles.
+func (p *Ppu) clockScanline() {
+	switch {
+	case p.scanline == -1 && p.cycle == 1:
+		p.ppuStatus.clearFlag(statusVBlank)
+		p.ppuStatus.clearFlag(statusSpriteOverflow)
+		p.ppuStatus.clearFlag(statusSprite0Hit)
+		p.clearSpriteShifters()
+	case p.scanline == 0 && p.cycle == 0:
+		// Odd frame cycle skip, see calculateBackgroundPixel.
+		if p.skipsOddFrameCycle() {
+			p.cycle++
+		}
+	case p.scanline == 241 && p.cycle == 1:
+		p.ppuStatus.setFlag(statusVBlank)
+
+		if p.ppuCtrl.getFlag(ctrlNmi) == 1 {
+			p.nmi = true
+		}
+	}
+
+	// Nothing else happens outside the visible and pre-render scanlines.
+	if p.scanline < -1 || p.scanline >= 240 {
+		return
+	}
+
+	switch p.cycle {
+	case 1:
+		if p.scanline >= 0 {
+			p.renderScanline()
+		}
+	case 256:
+		p.incrementVerticalScroll()
+	case 257:
+		// Horizontal nametable bit only, keep the vertical one.
+		p.vRam.setNametable(p.tRam.getNametable()&0b01 | p.vRam.getNametable()&0b10)
+		p.vRam.setCoarseX(p.tRam.getCoarseX())
+
+		// Sprites for the next scanline.
+		p.spriteScanline.clear()
+		p.spriteCount = 0
+		p.spriteEvaluation()
+	case 280:
+		if p.scanline == -1 {
+			// Vertical nametable bit only, keep the horizontal one.
+			p.vRam.setNametable(p.tRam.getNametable()&0b10 | p.vRam.getNametable()&0b01)
+			p.vRam.setCoarseY(p.tRam.getCoarseY())
+			p.vRam.setFineY(p.tRam.getFineY())
+		}
+	case 340:
+		p.loadSprites()
+	}
+}
+
+// renderScanline draws all 256 pixels of the current scanline, scrolled by
+// loopy v and fine X, with the sprites loaded at the end of the previous
+// scanline.
+func (p *Ppu) renderScanline() {
+	showBg := p.ppuMask.getFlag(maskBgShow) > 0
+	showBgLeft := p.ppuMask.getFlag(maskBgLeft) > 0
+	showSprites := p.ppuMask.getFlag(maskSpriteShow) > 0
+
+	v := *p.vRam
+	var tileLo, tileHi, attr byte
+
+	for x := 0; x < int(nesResW); x++ {
+		// Sprites move along one pixel every cycle after the first, as in
+		// updateShifters.
+		if showSprites && x > 0 {
+			p.updateSpriteShifters()
+		}
+
+		p.bgPixel = 0
+		p.bgPalette = 0
+		if showBg {
+			// Fetch the next tile when fine X scrolling reaches it.
+			fineX := int(p.scrollFineX) + x
+			if x == 0 || fineX%8 == 0 {
+				tileLo, tileHi, attr = p.fetchBackgroundTile(v)
+				v.incrementCoarseX()
+			}
+
+			if showBgLeft || x >= 8 {
+				bit := 7 - fineX%8
+				p.bgPixel = (tileHi>>bit&0x1)<<1 | tileLo>>bit&0x1
+				p.bgPalette = attr
+			}
+		}
+
+		p.calculateSpritePixel(x)
+		p.drawPixel(x, p.scanline)
+	}
+}
+
+// fetchBackgroundTile returns the pattern table row and palette of the
+// background tile at the VRAM address v.
+func (p *Ppu) fetchBackgroundTile(v PpuLoopyReg) (lo, hi, palette byte) {
+	// Nametable byte
+	tileId := p.ppuRead(nameTblAddr | (v.value() & 0x0FFF))
+
+	// Attribute table byte, holding the palettes of a 4x4 tile area. Each 2x2
+	// tile quadrant uses 2 bits.
+	attr := p.ppuRead(0x23C0 | (v.value() & 0x0C00) |
+		((v.value() >> 4) & 0x38) | ((v.value() >> 2) & 0x07))
+	if (v.getCoarseY() & 0x2) > 0 {
+		attr >>= 4
+	}
+	if (v.getCoarseX() & 0x2) > 0 {
+		attr >>= 2
+	}
+	palette = attr & 0x3
+
+	// Pattern table tile low and high
+	addr := uint16(p.ppuCtrl.getFlag(ctrlBgPatternTbl))<<12 |
+		uint16(tileId)<<4 | uint16(v.getFineY())
+	lo = p.ppuRead(addr)
+	hi = p.ppuRead(addr + 0x8)
+	p.countTileFetch(addr)
+
+	return lo, hi, palette
+}
@@ -0,0 +1,36 @@
+package nes
+
+import (
+	"fmt"
+	"io"
+)
+
+// The VRAM write log records every write to PPU memory with when it happened,
+// one line per write:
+//
+//	frame 12 scanline 241 cycle 30: nametable $2043 = $1F
+//
+// Logs from two runs, or two versions of the emulator, can be diffed to find
+// the first write where PPU memory diverges.
+
+// SetVRAMWriteLog logs every write to the pattern tables (CHR), nametables,
+// palettes, and OAM to w. Pass nil to stop logging.
+func (p *Ppu) SetVRAMWriteLog(w io.Writer) {
+	p.vramWriteLog = w
+}
+
+// logVRAMWrite logs a write of data to addr in the given area of PPU memory.
+func (p *Ppu) logVRAMWrite(area string, addr uint16, data byte) {
+	if p.vramWriteLog == nil {
+		return
+	}
+
+	fmt.Fprintf(p.vramWriteLog, "frame %d scanline %d cycle %d: %s $%04X = $%02X\n",
+		p.frames, p.scanline, p.cycle, area, addr, data)
+}
+
+// writeOam writes to OAM, from OAMDATA ($2004) or OAM DMA.
+func (p *Ppu) writeOam(addr byte, data byte) {
+	p.logVRAMWrite("oam", uint16(addr), data)
+	p.oam.write(addr, data)
+}
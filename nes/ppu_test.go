@@ -0,0 +1,1427 @@
+package nes
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestPpu returns a PPU connected to a cartridge built from rom, drawing to
+// a display without a window.
+func newTestPpu(t *testing.T, rom []byte) (*Ppu, *Display) {
+	t.Helper()
+
+	ppu := NewPpu()
+	ppu.ConnectCartridge(newTestCartridge(t, rom))
+
+	disp := &Display{
+		gameRgba: image.NewRGBA(image.Rect(0, 0, int(nesResW), int(nesResH))),
+	}
+	ppu.ConnectDisplay(disp)
+
+	return ppu, disp
+}
+
+// writeSolidTiles writes tiles to CHR RAM in pattern table 0: tile 1 is solid
+// pixel value 1, and tile 2 is solid pixel value 2.
+func writeSolidTiles(ppu *Ppu) {
+	for row := uint16(0); row < 8; row++ {
+		ppu.ppuWrite(0x0010+row, 0xFF)
+		ppu.ppuWrite(0x0028+row, 0xFF)
+	}
+}
+
+func TestSpritePatternTableSelect(t *testing.T) {
+	ppu := NewPpu()
+	ppu.scanline = 20
+
+	tests := []struct {
+		spriteSize  int  // 8 or 16
+		ctrlTable   bool // PPUCTRL sprite pattern table flag
+		id          byte // sprite tile index
+		wantTableLo uint16
+	}{
+		// 8x8: PPUCTRL selects the table
+		{8, false, 0x03, 0x0000},
+		{8, true, 0x03, 0x1000},
+		{8, false, 0x02, 0x0000},
+		{8, true, 0x02, 0x1000},
+
+		// 8x16: bit 0 of the tile index selects the table, PPUCTRL is ignored
+		{16, false, 0x03, 0x1000},
+		{16, true, 0x03, 0x1000},
+		{16, false, 0x02, 0x0000},
+		{16, true, 0x02, 0x0000},
+	}
+
+	for _, test := range tests {
+		*ppu.ppuCtrl = 0
+		if test.spriteSize == 16 {
+			ppu.ppuCtrl.setFlag(ctrlSpriteSize)
+		}
+		if test.ctrlTable {
+			ppu.ppuCtrl.setFlag(ctrlSpritePatternTbl)
+		}
+
+		sprite := &oamSprite{y: byte(ppu.scanline), id: test.id}
+		addrLo, _ := ppu.getSpritePatternAddr(sprite)
+
+		if got := addrLo & 0x1000; got != test.wantTableLo {
+			t.Errorf("%dpx sprite %#02x, PPUCTRL table %v: got table %#04x, want %#04x",
+				test.spriteSize, test.id, test.ctrlTable, got, test.wantTableLo)
+		}
+	}
+}
+
+func TestSpriteYOffset(t *testing.T) {
+	const spriteX = 16
+
+	// Tile 0 is solid (pixel value 3).
+	rom := newTestRom(1, 1, 0x00, 0x00)
+	chr := rom[16+16*1024:]
+	for i := 0; i < 16; i++ {
+		chr[i] = 0xFF
+	}
+
+	tests := []struct {
+		y         byte
+		wantLines []int // scanlines the sprite is drawn on
+	}{
+		{0, []int{1, 2, 3, 4, 5, 6, 7, 8}},
+		{100, []int{101, 102, 103, 104, 105, 106, 107, 108}},
+		{232, []int{233, 234, 235, 236, 237, 238, 239}},
+		{239, nil}, // off-screen
+		{255, nil}, // off-screen, must not wrap to the top of the screen
+	}
+
+	for _, test := range tests {
+		ppu, disp := newTestPpu(t, rom)
+		ppu.paletteTable[0x00] = 0x0F // backdrop: black
+		ppu.paletteTable[0x13] = 0x30 // sprite palette 0, pixel 3: white
+		ppu.ppuMask.setFlag(maskSpriteShow)
+		ppu.ppuMask.setFlag(maskSpriteLeft)
+
+		// Hide all sprites except sprite 0.
+		ppu.oam.clear()
+		sprite := ppu.oam[0]
+		sprite.y, sprite.id, sprite.attribute, sprite.x = test.y, 0, 0, spriteX
+
+		// Render one full frame so sprites carried over from the previous
+		// frame would show up, then render the visible part of the next one.
+		for ppu.frames == 0 {
+			ppu.Clock()
+		}
+		for ppu.scanline < 240 {
+			ppu.Clock()
+		}
+
+		want := map[int]bool{}
+		for _, line := range test.wantLines {
+			want[line] = true
+		}
+
+		white := ppu.paletteRGBA[0x30]
+		for y := 0; y < int(nesResH); y++ {
+			got := false
+			for x := 0; x < int(nesResW); x++ {
+				if disp.gameRgba.RGBAAt(x, y) == white {
+					got = true
+				}
+			}
+			if got != want[y] {
+				t.Errorf("sprite y=%d: drawn on scanline %d = %v, want %v", test.y, y, got, want[y])
+			}
+		}
+	}
+}
+
+func TestTallSprites(t *testing.T) {
+	const spriteX = 16
+
+	tests := []struct {
+		y       byte
+		flipped bool
+	}{
+		{0, false},
+		{0, true},
+		{100, false},
+		{100, true},
+		{230, false}, // partly off-screen
+		{230, true},
+	}
+
+	for _, test := range tests {
+		// CHR RAM
+		ppu, disp := newTestPpu(t, newTestRom(1, 0, 0x00, 0x00))
+
+		// Tiles 2 and 3, the top and bottom of the sprite, mark each row r
+		// with a single pixel in column r: pixel value 1 in the top tile, and
+		// pixel value 2 in the bottom tile.
+		for row := uint16(0); row < 8; row++ {
+			ppu.ppuWrite(0x0020+row, 0x80>>row)
+			ppu.ppuWrite(0x0038+row, 0x80>>row)
+		}
+
+		ppu.paletteTable[0x00] = 0x0F // backdrop: black
+		ppu.paletteTable[0x11] = 0x30 // sprite palette 0, pixel 1: white
+		ppu.paletteTable[0x12] = 0x16 // sprite palette 0, pixel 2: red
+		ppu.ppuCtrl.setFlag(ctrlSpriteSize)
+		ppu.ppuMask.setFlag(maskSpriteShow)
+		ppu.ppuMask.setFlag(maskSpriteLeft)
+
+		ppu.oam.clear()
+		sprite := ppu.oam[0]
+		sprite.y, sprite.id, sprite.attribute, sprite.x = test.y, 0x02, 0, spriteX
+		if test.flipped {
+			sprite.attribute = 0x80
+		}
+
+		for ppu.frames == 0 {
+			ppu.Clock()
+		}
+		for ppu.scanline < 240 {
+			ppu.Clock()
+		}
+
+		for line := 0; line < 16; line++ {
+			y := int(test.y) + 1 + line
+			if y >= int(nesResH) {
+				break
+			}
+
+			// Row of the sprite drawn on this scanline
+			row := line
+			if test.flipped {
+				row = 15 - line
+			}
+			want := ppu.paletteRGBA[0x30]
+			if row >= 8 {
+				want = ppu.paletteRGBA[0x16]
+			}
+
+			for x := spriteX; x < spriteX+8; x++ {
+				got := disp.gameRgba.RGBAAt(x, y)
+				if x == spriteX+row%8 && got != want {
+					t.Errorf("sprite y=%d flipped=%v: row %d pixel (%d, %d) = %v, want %v",
+						test.y, test.flipped, row, x, y, got, want)
+				}
+				if x != spriteX+row%8 && got != ppu.paletteRGBA[0x0F] {
+					t.Errorf("sprite y=%d flipped=%v: row %d pixel (%d, %d) = %v, want backdrop",
+						test.y, test.flipped, row, x, y, got)
+				}
+			}
+		}
+	}
+}
+
+func TestSpriteOverflowBug(t *testing.T) {
+	const line = 20
+
+	tests := []struct {
+		name        string
+		sprites     [][4]byte // OAM entries after the 8 sprites on the scanline
+		wantCorrect bool      // overflow flag without the bug
+		wantBuggy   bool      // overflow flag with the bug
+	}{
+		{"9th sprite found", [][4]byte{{line, 0, 0, 0}}, true, true},
+		{"no 9th sprite", [][4]byte{{0xFF, 0xFF, 0xFF, 0xFF}}, false, false},
+		{
+			// The 10th sprite's Y is missed, as its tile is read as Y instead.
+			"false negative",
+			[][4]byte{{0xFF, 0xFF, 0xFF, 0xFF}, {line, 0xFF, 0xFF, 0xFF}},
+			true, false,
+		},
+		{
+			// The 10th sprite's tile is read as Y.
+			"false positive",
+			[][4]byte{{0xFF, 0xFF, 0xFF, 0xFF}, {0xFF, line, 0xFF, 0xFF}},
+			false, true,
+		},
+		{
+			// The 11th sprite's attribute is read as Y.
+			"false positive attribute",
+			[][4]byte{{0xFF, 0xFF, 0xFF, 0xFF}, {0xFF, 0xFF, 0xFF, 0xFF}, {0xFF, 0xFF, line, 0xFF}},
+			false, true,
+		},
+	}
+
+	for _, test := range tests {
+		for _, bug := range []bool{false, true} {
+			ppu := NewPpu()
+			ppu.SetSpriteOverflowBug(bug)
+			ppu.scanline = line
+
+			ppu.oam.clear()
+			for i := 0; i < 8; i++ {
+				ppu.oam[i].y = line
+			}
+			for i, sprite := range test.sprites {
+				for j, data := range sprite {
+					ppu.oam.write(byte((8+i)*4+j), data)
+				}
+			}
+
+			ppu.spriteScanline.clear()
+			ppu.spriteCount = 0
+			ppu.spriteEvaluation()
+
+			want := test.wantCorrect
+			if bug {
+				want = test.wantBuggy
+			}
+			if got := ppu.ppuStatus.getFlag(statusSpriteOverflow) > 0; got != want {
+				t.Errorf("%s, bug %v: overflow flag = %v, want %v", test.name, bug, got, want)
+			}
+			if ppu.spriteCount != 8 {
+				t.Errorf("%s, bug %v: %d sprites found, want 8", test.name, bug, ppu.spriteCount)
+			}
+		}
+	}
+}
+
+func TestSpriteEvaluationStart(t *testing.T) {
+	const line = 50
+
+	tests := []struct {
+		oamAddr    byte
+		want       []byte // X positions of the sprites found, in order
+		spriteZero bool   // The first sprite evaluated is on the scanline
+	}{
+		{0x00, []byte{0, 1, 2, 3, 4, 5, 6, 7}, true},
+		{0x08, []byte{2, 3, 4, 5, 6, 7, 8, 9}, true},
+		// Evaluation wraps around to the start of OAM.
+		{0x14, []byte{5, 6, 7, 8, 9, 10, 11, 0}, true},
+		{0xF0, []byte{0, 1, 2, 3, 4, 5, 6, 7}, false},
+	}
+
+	for _, tt := range tests {
+		ppu := NewPpu()
+		ppu.scanline = line
+
+		// 12 sprites on the scanline, each at an X position of its index.
+		ppu.oam.clear()
+		for i := 0; i < 12; i++ {
+			ppu.oam[i].y, ppu.oam[i].x = line, byte(i)
+		}
+		ppu.oamAddr = tt.oamAddr
+
+		ppu.spriteScanline.clear()
+		ppu.spriteCount = 0
+		ppu.spriteEvaluation()
+
+		if ppu.spriteCount != len(tt.want) {
+			t.Fatalf("OAMADDR $%02X: %d sprites found, want %d", tt.oamAddr, ppu.spriteCount, len(tt.want))
+		}
+		for i, x := range tt.want {
+			if got := ppu.spriteScanline[i].x; got != x {
+				t.Errorf("OAMADDR $%02X: sprite %d found is at X %d, want %d", tt.oamAddr, i, got, x)
+			}
+		}
+
+		// The sprite at OAMADDR takes part in sprite zero hits, not sprite 0.
+		if ppu.isSpriteZeroPossible != tt.spriteZero {
+			t.Errorf("OAMADDR $%02X: sprite zero possible = %v, want %v", tt.oamAddr, ppu.isSpriteZeroPossible, tt.spriteZero)
+		}
+		if ppu.ppuStatus.getFlag(statusSpriteOverflow) == 0 {
+			t.Errorf("OAMADDR $%02X: overflow flag not set", tt.oamAddr)
+		}
+	}
+
+	// Rendered with OAMADDR at sprite 2, a hit comes from sprite 2 over the
+	// background, and not from sprite 0.
+	for _, tt := range []struct {
+		sprite int
+		hit    bool
+	}{
+		{2, true},
+		{0, false},
+	} {
+		// CHR RAM
+		ppu, _ := newTestPpu(t, newTestRom(1, 0, 0x00, 0x00))
+
+		writeSolidTiles(ppu)
+		for i := 0; i < 960; i++ {
+			ppu.nameTable[0][i] = 1
+		}
+
+		// The sprite over the background at x = 100-107, scanlines 41-48.
+		ppu.oam.clear()
+		ppu.oam[tt.sprite].y, ppu.oam[tt.sprite].id, ppu.oam[tt.sprite].x = 40, 2, 100
+		ppu.oamAddr = 0x08
+		ppu.ppuMask.setFlag(maskBgShow)
+		ppu.ppuMask.setFlag(maskSpriteShow)
+
+		for !(ppu.scanline == 50 && ppu.cycle == 0) {
+			ppu.Clock()
+		}
+		if hit := ppu.ppuStatus.getFlag(statusSprite0Hit) > 0; hit != tt.hit {
+			t.Errorf("OAMADDR $08, sprite %d: sprite zero hit = %v, want %v", tt.sprite, hit, tt.hit)
+		}
+	}
+}
+
+func TestBlankScreenBackdrop(t *testing.T) {
+	ppu, disp := newTestPpu(t, newTestRom(1, 1, 0x00, 0x00))
+	ppu.ppuCtrl.setFlag(ctrlNmi)
+	ppu.paletteTable[0x00] = 0x21
+
+	// Leftovers from a previous frame.
+	for y := 0; y < int(nesResH); y++ {
+		disp.FillRow(0, y, color.RGBA{1, 2, 3, 255})
+	}
+
+	// Change the backdrop color partway through scanline 100.
+	for !(ppu.scanline == 100 && ppu.cycle == 129) {
+		ppu.Clock()
+	}
+	ppu.paletteTable[0x00] = 0x16
+
+	nmi := false
+	ppu.frameComplete = false
+	for !ppu.frameComplete {
+		ppu.Clock()
+		nmi = nmi || ppu.nmi
+	}
+
+	if !nmi {
+		t.Error("no NMI while rendering is disabled")
+	}
+
+	before, after := ppu.paletteRGBA[0x21], ppu.paletteRGBA[0x16]
+	for y := 0; y < int(nesResH); y++ {
+		for x := 0; x < int(nesResW); x++ {
+			want := before
+			if y > 100 || (y == 100 && x >= 128) {
+				want = after
+			}
+			if got := disp.gameRgba.RGBAAt(x, y); got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestWriteOnlyRegisterOpenBus(t *testing.T) {
+	ppu, _ := newTestPpu(t, newTestRom(1, 1, 0x00, 0x00))
+
+	// Writing to the read-only status register still fills the data bus.
+	ppu.cpuWrite(0x0002, 0x5A)
+
+	for _, addr := range []uint16{0x0000, 0x0001, 0x0003, 0x0005, 0x0006} {
+		if got := ppu.cpuRead(addr); got != 0x5A {
+			t.Errorf("read $%04X = %#02x, want open bus 0x5a", 0x2000+addr, got)
+		}
+	}
+
+	// Status fills the low 5 bits from the data bus.
+	ppu.ppuStatus.setFlag(statusVBlank)
+	if got := ppu.cpuRead(0x0002); got != 0x80|0x1A {
+		t.Errorf("read $2002 = %#02x, want 0x9a", got)
+	}
+
+	// Reads update the data bus too.
+	if got := ppu.cpuRead(0x0000); got != 0x9A {
+		t.Errorf("read $2000 after $2002 = %#02x, want 0x9a", got)
+	}
+}
+
+func TestStatusAfterDataRead(t *testing.T) {
+	ppu, _ := newTestPpu(t, newTestRom(1, 1, 0x00, 0x00))
+
+	ppu.ppuWrite(0x2400, 0x1B)
+	ppu.ppuWrite(0x2401, 0x05)
+	ppu.cpuWrite(0x0006, 0x24)
+	ppu.cpuWrite(0x0006, 0x00)
+
+	// The first read returns the stale buffer, the second $2400.
+	ppu.cpuRead(0x0007)
+	if got := ppu.cpuRead(0x0007); got != 0x1B {
+		t.Fatalf("read $2007 = %#02x, want 0x1b", got)
+	}
+
+	// The low bits of status come from the data bus, which holds the value
+	// just read, not the buffer, which now holds $2401.
+	ppu.ppuStatus.setFlag(statusVBlank)
+	if got := ppu.cpuRead(0x0002); got != 0x80|0x1B {
+		t.Errorf("read $2002 = %#02x, want 0x9b", got)
+	}
+}
+
+func TestOamDataReadDuringRendering(t *testing.T) {
+	ppu, _ := newTestPpu(t, newTestRom(1, 1, 0x00, 0x00))
+	ppu.ppuMask.setFlag(maskBgShow)
+	ppu.ppuMask.setFlag(maskSpriteShow)
+	ppu.SetAccurateOAMReads(true)
+
+	ppu.oam.clear()
+	ppu.oam[0].y, ppu.oam[0].id, ppu.oam[0].attribute, ppu.oam[0].x = 10, 0x42, 0x01, 0x80
+	ppu.oamAddr = 0x01
+
+	// Run to the given scanline and cycle, then read $2004.
+	readAt := func(scanline, cycle int) byte {
+		for !(ppu.scanline == scanline && ppu.cycle == cycle) {
+			ppu.Clock()
+		}
+		return ppu.cpuRead(0x0004)
+	}
+
+	tests := []struct {
+		scanline, cycle int
+		want            byte
+	}{
+		{11, 1, 0xFF},    // clearing secondary OAM
+		{11, 64, 0xFF},   // clearing secondary OAM
+		{11, 100, 0x42},  // evaluation, primary OAM at OAMADDR
+		{11, 257, 10},    // sprite 0 Y, in secondary OAM
+		{11, 258, 0x42},  // sprite 0 tile
+		{11, 259, 0x01},  // sprite 0 attribute
+		{11, 264, 0x80},  // sprite 0 X
+		{11, 265, 0xFF},  // sprite 1 Y, empty slot
+		{245, 100, 0x42}, // vblank, primary OAM at OAMADDR
+	}
+
+	for _, test := range tests {
+		if got := readAt(test.scanline, test.cycle); got != test.want {
+			t.Errorf("scanline %d cycle %d: read %#02x, want %#02x", test.scanline, test.cycle, got, test.want)
+		}
+	}
+
+	// Without the accuracy flag, reads always return OAM at OAMADDR.
+	ppu.SetAccurateOAMReads(false)
+	if got := readAt(20, 10); got != 0x42 {
+		t.Errorf("accuracy off: read %#02x, want 0x42", got)
+	}
+}
+
+func TestBackdropPaletteHack(t *testing.T) {
+	ppu, disp := newTestPpu(t, newTestRom(1, 1, 0x00, 0x00))
+	ppu.paletteTable[0x00] = 0x0F
+	ppu.paletteTable[0x05] = 0x2A
+
+	// Rendering is disabled. Point VRAM at $3F05.
+	ppu.cpuWrite(0x0006, 0x3F)
+	ppu.cpuWrite(0x0006, 0x05)
+
+	ppu.frameComplete = false
+	for !ppu.frameComplete {
+		ppu.Clock()
+	}
+
+	want := ppu.paletteRGBA[0x2A]
+	if got := disp.gameRgba.RGBAAt(100, 100); got != want {
+		t.Errorf("VRAM at $3F05: backdrop = %v, want %v", got, want)
+	}
+
+	// Outside of palette memory the backdrop is $3F00.
+	ppu.cpuWrite(0x0006, 0x20)
+	ppu.cpuWrite(0x0006, 0x00)
+
+	ppu.frameComplete = false
+	for !ppu.frameComplete {
+		ppu.Clock()
+	}
+
+	want = ppu.paletteRGBA[0x0F]
+	if got := disp.gameRgba.RGBAAt(100, 100); got != want {
+		t.Errorf("VRAM at $2000: backdrop = %v, want %v", got, want)
+	}
+}
+
+func TestMirroringOverride(t *testing.T) {
+	// Vertically mirrored cartridge.
+	ppu, _ := newTestPpu(t, newTestRom(1, 1, 0x01, 0x00))
+	cart := ppu.Cart
+
+	tests := []struct {
+		mode MirrorMode
+		want [4]byte // Bank backing each of $2000, $2400, $2800, $2C00
+	}{
+		{MirrorHorizontal, [4]byte{0, 0, 1, 1}},
+		{MirrorVertical, [4]byte{0, 1, 0, 1}},
+		{MirrorOnescreenLo, [4]byte{0, 0, 0, 0}},
+		{MirrorOnescreenHi, [4]byte{1, 1, 1, 1}},
+		{MirrorFourScreen, [4]byte{0, 1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		cart.SetMirroring(tt.mode)
+		ppu.nameTable = [4][1024]byte{}
+
+		for i, bank := range tt.want {
+			addr := nameTblAddr + uint16(i)*0x400 + 0x10
+			ppu.ppuWrite(addr, byte(i+1))
+			if got := ppu.nameTable[bank][0x10]; got != byte(i+1) {
+				t.Errorf("%v: write to $%04X: bank %d holds %d, want %d", tt.mode, addr, bank, got, i+1)
+			}
+			if got := ppu.ppuRead(addr); got != byte(i+1) {
+				t.Errorf("%v: read from $%04X = %d, want %d", tt.mode, addr, got, i+1)
+			}
+		}
+	}
+
+	cart.RestoreMirroring()
+	if got := cart.Mirroring(); got != MirrorVertical {
+		t.Errorf("restored mirroring = %v, want %v", got, MirrorVertical)
+	}
+}
+
+func TestMapperMirroringSwitch(t *testing.T) {
+	// MMC1, CHR RAM
+	ppu, disp := newTestPpu(t, newTestRom(2, 0, 0x10, 0x00))
+
+	writeSolidTiles(ppu)
+	ppu.paletteTable[0x00] = 0x0F
+	ppu.paletteTable[0x01] = 0x16
+	ppu.paletteTable[0x02] = 0x2A
+
+	// Bank 0 uses tile 1, bank 1 uses tile 2.
+	for i := 0; i < 960; i++ {
+		ppu.nameTable[0][i] = 1
+		ppu.nameTable[1][i] = 2
+	}
+
+	// Show the top-right nametable, $2400.
+	ppu.cpuWrite(0x0000, 0x01)
+	ppu.ppuMask.setFlag(maskBgShow)
+	ppu.ppuMask.setFlag(maskBgLeft)
+
+	tests := []struct {
+		control byte // MMC1 mirroring bits
+		want    byte // Palette index of the color drawn
+	}{
+		{0x02, 0x2A}, // vertical: $2400 is bank 1
+		{0x03, 0x16}, // horizontal: $2400 is bank 0
+		{0x00, 0x16}, // one-screen, bank 0
+		{0x01, 0x2A}, // one-screen, bank 1
+	}
+
+	for _, tt := range tests {
+		// Fixed last PRG bank, plus the mirroring bits.
+		writeMMC1(ppu.Cart, 0x8000, 0x0C|tt.control)
+
+		ppu.frameComplete = false
+		for !ppu.frameComplete {
+			ppu.Clock()
+		}
+
+		want := ppu.paletteRGBA[tt.want]
+		if got := disp.gameRgba.RGBAAt(100, 100); got != want {
+			t.Errorf("MMC1 mirroring %d (%v): pixel = %v, want %v", tt.control, ppu.mirroring(), got, want)
+		}
+	}
+}
+
+func TestVRAMAddressAccess(t *testing.T) {
+	ppu, _ := newTestPpu(t, newTestRom(1, 1, 0x00, 0x00))
+
+	ppu.SetVRAMAddress(0x2105)
+	ppu.cpuWrite(0x0007, 0x42)
+
+	if got := ppu.nametableRead(0x2105); got != 0x42 {
+		t.Errorf("nametable $2105 = %#02x, want 0x42", got)
+	}
+	if got := ppu.GetVRAMAddress(); got != 0x2106 {
+		t.Errorf("VRAM address after PPUDATA write = $%04X, want $2106", got)
+	}
+
+	// Only 15 bits are kept.
+	ppu.SetVRAMAddress(0xFFFF)
+	if got := ppu.GetVRAMAddress(); got != 0x7FFF {
+		t.Errorf("VRAM address = $%04X, want $7FFF", got)
+	}
+}
+
+func TestMidFrameScrollWrites(t *testing.T) {
+	const (
+		mirrorH = 0x00 // iNES flags 6
+		mirrorV = 0x01
+	)
+
+	tests := []struct {
+		name   string
+		flags6 byte
+		writes [][2]uint16 // Register, data written during hblank of scanline 9
+		// Whether each nametable column uses tile 1 (otherwise tile 2), and
+		// which is expected on scanlines 0-10 and after.
+		columns       func(col int) bool
+		before, after func(col int) bool
+		afterLine     int
+	}{
+		{
+			// Jump to the bottom-left nametable. Its vertical nametable bit
+			// must survive the horizontal copy on every following scanline.
+			name:      "$2006 vertical nametable",
+			flags6:    mirrorH,
+			writes:    [][2]uint16{{0x0006, 0x28}, {0x0006, 0x00}},
+			before:    func(col int) bool { return true },
+			after:     func(col int) bool { return false },
+			afterLine: 10,
+		},
+		{
+			// Jump to the top-right nametable.
+			name:      "$2006 horizontal nametable",
+			flags6:    mirrorV,
+			writes:    [][2]uint16{{0x0006, 0x24}, {0x0006, 0x00}},
+			before:    func(col int) bool { return true },
+			after:     func(col int) bool { return false },
+			afterLine: 10,
+		},
+		{
+			// X scroll only reaches loopy t. Scanline 10 was prefetched and
+			// keeps scrolling from v, and the new scroll is copied to v at
+			// the end of scanline 10.
+			name:      "$2005 X scroll",
+			flags6:    mirrorV,
+			writes:    [][2]uint16{{0x0005, 0x08}},
+			columns:   func(col int) bool { return col%2 == 0 },
+			before:    func(col int) bool { return col%2 == 0 },
+			after:     func(col int) bool { return col%2 == 1 },
+			afterLine: 11,
+		},
+	}
+
+	for _, tt := range tests {
+		// CHR RAM
+		ppu, disp := newTestPpu(t, newTestRom(1, 0, tt.flags6, 0x00))
+
+		writeSolidTiles(ppu)
+		ppu.paletteTable[0x00] = 0x0F
+		ppu.paletteTable[0x01] = 0x16
+		ppu.paletteTable[0x02] = 0x2A
+
+		// Fill each bank, leaving the attribute tables at palette 0. With
+		// columns unset, bank 0 uses tile 1 and bank 1 uses tile 2.
+		for bank := range ppu.nameTable[:2] {
+			for i := 0; i < 960; i++ {
+				tile1 := bank == 0
+				if tt.columns != nil {
+					tile1 = tt.columns(i % 32)
+				}
+				ppu.nameTable[bank][i] = 2
+				if tile1 {
+					ppu.nameTable[bank][i] = 1
+				}
+			}
+		}
+
+		ppu.ppuMask.setFlag(maskBgShow)
+		ppu.ppuMask.setFlag(maskBgLeft)
+
+		// Render one frame to settle scrolling, then the next one with the
+		// writes during hblank of scanline 9.
+		ppu.frameComplete = false
+		for !ppu.frameComplete {
+			ppu.Clock()
+		}
+		for !(ppu.scanline == 9 && ppu.cycle == 260) {
+			ppu.Clock()
+		}
+		for _, w := range tt.writes {
+			ppu.cpuWrite(w[0], byte(w[1]))
+		}
+		ppu.frameComplete = false
+		for !ppu.frameComplete {
+			ppu.Clock()
+		}
+
+		c1, c2 := ppu.paletteRGBA[0x16], ppu.paletteRGBA[0x2A]
+	rows:
+		for y := 0; y < 20; y++ {
+			tile1 := tt.before
+			if y >= tt.afterLine {
+				tile1 = tt.after
+			}
+
+			for x := 0; x < int(nesResW); x++ {
+				want := c2
+				if tile1(x / 8) {
+					want = c1
+				}
+				if got := disp.gameRgba.RGBAAt(x, y); got != want {
+					t.Errorf("%s: pixel (%d, %d) = %v, want %v", tt.name, x, y, got, want)
+					continue rows
+				}
+			}
+		}
+	}
+}
+
+func TestOpenBusDecay(t *testing.T) {
+	for _, decay := range []bool{false, true} {
+		ppu, _ := newTestPpu(t, newTestRom(1, 1, 0x00, 0x00))
+		ppu.SetOpenBusDecay(decay)
+
+		ppu.cpuWrite(0x0002, 0x1F)
+
+		// Just inside the decay time.
+		for i := 0; i < openBusDecayDots-1; i++ {
+			ppu.Clock()
+		}
+		if got := ppu.cpuRead(0x0000); got != 0x1F {
+			t.Errorf("decay %v: read $2000 before decaying = %#02x, want 0x1f", decay, got)
+		}
+
+		ppu.Clock()
+
+		want := byte(0x1F)
+		if decay {
+			want = 0x00
+		}
+		if got := ppu.cpuRead(0x0000); got != want {
+			t.Errorf("decay %v: read $2000 after decay time = %#02x, want %#02x", decay, got, want)
+		}
+		if got := ppu.cpuRead(0x0002) & 0x1F; got != want {
+			t.Errorf("decay %v: low bits of $2002 after decay time = %#02x, want %#02x", decay, got, want)
+		}
+	}
+}
+
+func TestLeftColumnClipping(t *testing.T) {
+	tests := []struct {
+		name    string
+		mask    []PpuRegFlag
+		bgFrom  int // First column showing background, -1 for none
+		fgRange [2]int
+	}{
+		{"background clipped", []PpuRegFlag{maskBgShow}, 8, [2]int{}},
+		{"background shown", []PpuRegFlag{maskBgShow, maskBgLeft}, 0, [2]int{}},
+		{"sprite clipped", []PpuRegFlag{maskSpriteShow}, -1, [2]int{8, 12}},
+		{"sprite shown", []PpuRegFlag{maskSpriteShow, maskSpriteLeft}, -1, [2]int{4, 12}},
+	}
+
+	for _, tt := range tests {
+		// CHR RAM
+		ppu, disp := newTestPpu(t, newTestRom(1, 0, 0x00, 0x00))
+
+		writeSolidTiles(ppu)
+		for i := 0; i < 960; i++ {
+			ppu.nameTable[0][i] = 1
+		}
+		ppu.paletteTable[0x00] = 0x0F
+		ppu.paletteTable[0x01] = 0x16
+		ppu.paletteTable[0x12] = 0x2A
+
+		// A sprite covering x = 4-11 on scanlines 41-48.
+		ppu.oam.clear()
+		ppu.oam[0].y, ppu.oam[0].id, ppu.oam[0].attribute, ppu.oam[0].x = 40, 2, 0x00, 4
+
+		for _, flag := range tt.mask {
+			ppu.ppuMask.setFlag(flag)
+		}
+
+		for frame := 0; frame < 2; frame++ {
+			ppu.frameComplete = false
+			for !ppu.frameComplete {
+				ppu.Clock()
+			}
+		}
+
+		backdrop, bg, fg := ppu.paletteRGBA[0x0F], ppu.paletteRGBA[0x16], ppu.paletteRGBA[0x2A]
+		for x := 0; x < 32; x++ {
+			want := backdrop
+			if tt.bgFrom >= 0 && x >= tt.bgFrom {
+				want = bg
+			}
+			if x >= tt.fgRange[0] && x < tt.fgRange[1] {
+				want = fg
+			}
+			if got := disp.gameRgba.RGBAAt(x, 44); got != want {
+				t.Errorf("%s: pixel (%d, 44) = %v, want %v", tt.name, x, got, want)
+			}
+		}
+	}
+}
+
+func TestExplainPixel(t *testing.T) {
+	// CHR RAM
+	ppu, _ := newTestPpu(t, newTestRom(1, 0, 0x00, 0x00))
+	writeSolidTiles(ppu)
+	for i := 0; i < 960; i++ {
+		ppu.nameTable[0][i] = 1
+	}
+	ppu.paletteTable[0x01] = 0x16
+	ppu.paletteTable[0x12] = 0x2A
+	ppu.ppuMask.setFlag(maskBgShow)
+	ppu.ppuMask.setFlag(maskBgLeft)
+	ppu.ppuMask.setFlag(maskSpriteShow)
+	ppu.ppuMask.setFlag(maskSpriteLeft)
+
+	// A sprite covering x = 4-11 on scanlines 41-48.
+	ppu.oam.clear()
+	ppu.oam[0].y, ppu.oam[0].id, ppu.oam[0].attribute, ppu.oam[0].x = 40, 2, 0x00, 4
+
+	runFrame := func() {
+		ppu.frameComplete = false
+		for !ppu.frameComplete {
+			ppu.Clock()
+		}
+	}
+
+	tests := []struct {
+		name      string
+		x, y      int
+		attribute byte
+		want      []string
+	}{
+		{"sprite in front", 6, 44, 0x00, []string{
+			"Background: pixel 1, palette 0\n",
+			"Sprite 0 (tile $02): pixel 2, palette 4, in front of background\n",
+			"Result: opaque sprite in front of opaque background, sprite shown\n",
+			"Color: palette 4 pixel 2 ($3F12) = $2A",
+		}},
+		{"sprite behind", 6, 44, 0x20, []string{
+			"Sprite 0 (tile $02): pixel 2, palette 4, behind background\n",
+			"Result: opaque sprite behind opaque background, background shown\n",
+			"Color: palette 0 pixel 1 ($3F01) = $16",
+		}},
+		{"no sprite", 20, 44, 0x00, []string{
+			"Sprites: none at this pixel\n",
+			"Result: no opaque sprite, background shown\n",
+		}},
+	}
+
+	if got := ppu.ExplainPixel(6, 44); !strings.Contains(got, "not been drawn") {
+		t.Errorf("explained before drawing:\n%s", got)
+	}
+
+	for _, tt := range tests {
+		ppu.oam[0].attribute = tt.attribute
+
+		// Start tracing the pixel, then draw it.
+		ppu.ExplainPixel(tt.x, tt.y)
+		runFrame()
+
+		got := ppu.ExplainPixel(tt.x, tt.y)
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: explanation missing %q:\n%s", tt.name, want, got)
+			}
+		}
+	}
+}
+
+func TestPreRenderPrefetch(t *testing.T) {
+	for scroll := 0; scroll < 16; scroll++ {
+		// CHR RAM
+		ppu, disp := newTestPpu(t, newTestRom(1, 0, 0x00, 0x00))
+		writeSolidTiles(ppu)
+
+		// Tile 3 is pixel value 1 on the left half, and 2 on the right.
+		for row := uint16(0); row < 8; row++ {
+			ppu.ppuWrite(0x0030+row, 0xF0)
+			ppu.ppuWrite(0x0038+row, 0x0F)
+		}
+
+		// Columns 0-2 of the top row are tiles 3, 1, 2. The rest is blank.
+		ppu.nameTable[0][0], ppu.nameTable[0][1], ppu.nameTable[0][2] = 3, 1, 2
+		ppu.paletteTable[0x00] = 0x0F
+		ppu.paletteTable[0x01] = 0x16
+		ppu.paletteTable[0x02] = 0x2A
+
+		ppu.ppuMask.setFlag(maskBgShow)
+		ppu.ppuMask.setFlag(maskBgLeft)
+
+		// Scroll during vblank, then render a whole frame.
+		for ppu.scanline != 241 {
+			ppu.Clock()
+		}
+		ppu.cpuWrite(0x0005, byte(scroll))
+		ppu.cpuWrite(0x0005, 0)
+		for frame := 0; frame < 2; frame++ {
+			ppu.frameComplete = false
+			for !ppu.frameComplete {
+				ppu.Clock()
+			}
+		}
+
+		// Pixel value at x in the nametable.
+		nametablePixel := func(x int) byte {
+			switch x / 8 {
+			case 0:
+				if x%8 < 4 {
+					return 1
+				}
+				return 2
+			case 1:
+				return 1
+			case 2:
+				return 2
+			}
+			return 0
+		}
+
+		colors := [3]byte{0x0F, 0x16, 0x2A}
+		for x := 0; x < 24; x++ {
+			want := ppu.paletteRGBA[colors[nametablePixel(x+scroll)]]
+			if got := disp.gameRgba.RGBAAt(x, 0); got != want {
+				t.Errorf("scroll %d: pixel (%d, 0) = %v, want %v", scroll, x, got, want)
+			}
+		}
+	}
+}
+
+func TestScanlineFastRenderMode(t *testing.T) {
+	render := func(mode RenderMode) *image.RGBA {
+		// CHR RAM
+		ppu, disp := newTestPpu(t, newTestRom(1, 0, 0x01, 0x00))
+		ppu.SetRenderMode(mode)
+
+		// Tiles with a different pattern in every row and plane.
+		for i := uint16(0x0010); i < 0x0100; i++ {
+			ppu.ppuWrite(i, byte(i*37+i>>3))
+		}
+		for bank := range ppu.nameTable[:2] {
+			for i := 0; i < 960; i++ {
+				ppu.nameTable[bank][i] = byte((i*7+bank*3)%15 + 1)
+			}
+			for i := 960; i < 1024; i++ {
+				ppu.nameTable[bank][i] = byte(i*13 + bank)
+			}
+		}
+		for i := range ppu.paletteTable {
+			ppu.paletteTable[i] = byte(i*5) & 0x3F
+		}
+
+		// Overlapping, flipped, and background priority sprites, some in the
+		// left 8 pixels.
+		ppu.oam.clear()
+		for i := 0; i < 20; i++ {
+			ppu.oam[i].y = byte(20 + i*9%50)
+			ppu.oam[i].id = byte(i%15 + 1)
+			ppu.oam[i].attribute = byte(i*0x23) & 0xE3
+			ppu.oam[i].x = byte(i * 13)
+		}
+
+		ppu.ppuMask.setFlag(maskBgShow)
+		ppu.ppuMask.setFlag(maskSpriteShow)
+		ppu.ppuMask.setFlag(maskSpriteLeft)
+
+		// Scroll into the right nametable during vblank.
+		for ppu.scanline != 241 {
+			ppu.Clock()
+		}
+		ppu.cpuWrite(0x0005, 0x6B)
+		ppu.cpuWrite(0x0005, 0x13)
+		for frame := 0; frame < 2; frame++ {
+			ppu.frameComplete = false
+			for !ppu.frameComplete {
+				ppu.Clock()
+			}
+		}
+
+		return disp.gameRgba
+	}
+
+	dot, fast := render(DotAccurate), render(ScanlineFast)
+	for y := 0; y < int(nesResH); y++ {
+		for x := 0; x < int(nesResW); x++ {
+			if got, want := fast.RGBAAt(x, y), dot.RGBAAt(x, y); got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestVRAMWriteLog(t *testing.T) {
+	// CHR RAM
+	ppu, _ := newTestPpu(t, newTestRom(1, 0, 0x00, 0x00))
+
+	var log strings.Builder
+	ppu.SetVRAMWriteLog(&log)
+
+	write := func(addr uint16, data byte) {
+		ppu.cpuWrite(0x0006, byte(addr>>8))
+		ppu.cpuWrite(0x0006, byte(addr))
+		ppu.cpuWrite(0x0007, data)
+	}
+
+	write(0x0123, 0xAA)
+	write(0x2043, 0x1F)
+	for i := 0; i < 5; i++ {
+		ppu.Clock()
+	}
+	write(0x3F10, 0x0F) // Mirror of $3F00
+	ppu.cpuWrite(0x0003, 0x08)
+	ppu.cpuWrite(0x0004, 0x40)
+	ppu.cpuWrite(0x0000, 0x00) // Not PPU memory
+
+	want := "frame 0 scanline 0 cycle 0: pattern $0123 = $AA\n" +
+		"frame 0 scanline 0 cycle 0: nametable $2043 = $1F\n" +
+		"frame 0 scanline 0 cycle 5: palette $3F00 = $0F\n" +
+		"frame 0 scanline 0 cycle 5: oam $0008 = $40\n"
+	if got := log.String(); got != want {
+		t.Errorf("log:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Stop logging.
+	ppu.SetVRAMWriteLog(nil)
+	write(0x2043, 0x00)
+	if got := log.String(); got != want {
+		t.Errorf("logged after disabling:\n%s", got)
+	}
+}
+
+func TestGreyscale(t *testing.T) {
+	ppu, disp := newTestPpu(t, newTestRom(1, 0, 0x00, 0x00))
+	writeSolidTiles(ppu)
+	for i := uint16(0); i < 960; i++ {
+		ppu.ppuWrite(0x2000+i, 0x01)
+	}
+	ppu.ppuWrite(0x3F00, 0x21)
+	ppu.ppuWrite(0x3F01, 0x16)
+
+	ppu.ppuMask.setFlag(maskBgShow)
+	ppu.ppuMask.setFlag(maskBgLeft)
+	ppu.ppuMask.setFlag(maskGreyscale)
+
+	for i := 0; i < 2; i++ {
+		ppu.frameComplete = false
+		for !ppu.frameComplete {
+			ppu.Clock()
+		}
+	}
+
+	// Red ($16) shows as the grey at the start of its row ($10).
+	want := ppu.paletteRGBA[0x10]
+	for y := 0; y < int(nesResH); y++ {
+		for x := 0; x < int(nesResW); x++ {
+			if got := disp.gameRgba.RGBAAt(x, y); got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want grey %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestColorEmphasis(t *testing.T) {
+	ppu := NewPpu()
+	ppu.paletteRGBA[0x30] = color.RGBA{200, 200, 200, 255}
+	level := 200.0
+	dim := uint8(level * emphasisAttenuation)
+
+	tests := []struct {
+		region Region
+		flags  []PpuRegFlag
+		want   color.RGBA
+	}{
+		{RegionNTSC, nil, color.RGBA{200, 200, 200, 255}},
+		{RegionNTSC, []PpuRegFlag{maskEmphasizeRed}, color.RGBA{200, dim, dim, 255}},
+		{RegionNTSC, []PpuRegFlag{maskEmphasizeGreen, maskEmphasizeBlue}, color.RGBA{dim, 200, 200, 255}},
+		{RegionPAL, []PpuRegFlag{maskEmphasizeRed}, color.RGBA{dim, 200, dim, 255}},
+	}
+
+	for _, tt := range tests {
+		ppu.region = tt.region
+		*ppu.ppuMask = 0
+		for _, flag := range tt.flags {
+			ppu.ppuMask.setFlag(flag)
+		}
+
+		if got := ppu.outputColor(0x30); got != tt.want {
+			t.Errorf("%v mask %08b: color = %v, want %v", tt.region, *ppu.ppuMask, got, tt.want)
+		}
+	}
+}
+
+func TestGreyscaleEmphasis(t *testing.T) {
+	ppu := NewPpu()
+	ppu.paletteRGBA[0x16] = color.RGBA{200, 40, 20, 255}
+	ppu.paletteRGBA[0x10] = color.RGBA{150, 150, 150, 255}
+	grey := 150.0
+	dim := uint8(grey * emphasisAttenuation)
+
+	// Greyscale picks the grey column first, then emphasis darkens the grey:
+	// an emphasized grey, not a greyscaled emphasized red.
+	tests := []struct {
+		flags []PpuRegFlag
+		want  color.RGBA
+	}{
+		{[]PpuRegFlag{maskGreyscale}, color.RGBA{150, 150, 150, 255}},
+		{[]PpuRegFlag{maskGreyscale, maskEmphasizeRed}, color.RGBA{150, dim, dim, 255}},
+		{[]PpuRegFlag{maskGreyscale, maskEmphasizeGreen, maskEmphasizeBlue}, color.RGBA{dim, 150, 150, 255}},
+	}
+
+	for _, tt := range tests {
+		*ppu.ppuMask = 0
+		for _, flag := range tt.flags {
+			ppu.ppuMask.setFlag(flag)
+		}
+
+		if got := ppu.outputColor(0x16); got != tt.want {
+			t.Errorf("mask %08b: color = %v, want %v", *ppu.ppuMask, got, tt.want)
+		}
+	}
+}
+
+func TestSpriteZeroHit(t *testing.T) {
+	tests := []struct {
+		name string
+		mask []PpuRegFlag
+		hit  bool
+	}{
+		{"background and sprites shown", []PpuRegFlag{maskBgShow, maskSpriteShow}, true},
+		{"background only", []PpuRegFlag{maskBgShow}, false},
+		{"sprites only", []PpuRegFlag{maskSpriteShow}, false},
+		{"nothing shown", nil, false},
+	}
+
+	for _, tt := range tests {
+		// CHR RAM
+		ppu, _ := newTestPpu(t, newTestRom(1, 0, 0x00, 0x00))
+
+		writeSolidTiles(ppu)
+		for i := 0; i < 960; i++ {
+			ppu.nameTable[0][i] = 1
+		}
+
+		// Sprite 0 over the background at x = 100-107, scanlines 41-48.
+		ppu.oam.clear()
+		ppu.oam[0].y, ppu.oam[0].id, ppu.oam[0].x = 40, 2, 100
+
+		for _, flag := range tt.mask {
+			ppu.ppuMask.setFlag(flag)
+		}
+
+		// Run to the end of the sprite, then check the flag before it is
+		// cleared at the end of vblank.
+		ppu.frameComplete = false
+		for !(ppu.scanline == 50 && ppu.cycle == 0) {
+			ppu.Clock()
+		}
+		if hit := ppu.ppuStatus.getFlag(statusSprite0Hit) > 0; hit != tt.hit {
+			t.Errorf("%s: sprite zero hit = %v, want %v", tt.name, hit, tt.hit)
+		}
+	}
+}
+
+func TestSpriteZeroHitEnabled(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		// CHR RAM
+		ppu, _ := newTestPpu(t, newTestRom(1, 0, 0x00, 0x00))
+		ppu.SetSpriteZeroHitEnabled(enabled)
+
+		writeSolidTiles(ppu)
+		for i := 0; i < 960; i++ {
+			ppu.nameTable[0][i] = 1
+		}
+		ppu.oam.clear()
+		ppu.oam[0].y, ppu.oam[0].id, ppu.oam[0].x = 40, 2, 100
+		ppu.ppuMask.setFlag(maskBgShow)
+		ppu.ppuMask.setFlag(maskSpriteShow)
+
+		for !(ppu.scanline == 50 && ppu.cycle == 0) {
+			ppu.Clock()
+		}
+
+		// Read through $2002, as the game would.
+		if hit := ppu.cpuRead(0x0002)&0x40 > 0; hit != enabled {
+			t.Errorf("enabled %v: sprite zero hit = %v, want %v", enabled, hit, enabled)
+		}
+	}
+}
+
+func TestSpriteZeroHitDelay(t *testing.T) {
+	// Sprite 0 covers x = 100-107 on scanline 41, so the first overlapping
+	// pixel is x = 100, drawn on dot 101.
+	for _, delay := range []int{0, 1, 2} {
+		// CHR RAM
+		ppu, _ := newTestPpu(t, newTestRom(1, 0, 0x00, 0x00))
+		ppu.SetSpriteZeroHitDelay(delay)
+
+		writeSolidTiles(ppu)
+		for i := 0; i < 960; i++ {
+			ppu.nameTable[0][i] = 1
+		}
+		ppu.oam.clear()
+		ppu.oam[0].y, ppu.oam[0].id, ppu.oam[0].x = 40, 2, 100
+		ppu.ppuMask.setFlag(maskBgShow)
+		ppu.ppuMask.setFlag(maskSpriteShow)
+
+		ppu.frameComplete = false
+		for ppu.ppuStatus.getFlag(statusSprite0Hit) == 0 {
+			if ppu.scanline == 50 {
+				t.Fatalf("delay %d: no sprite zero hit", delay)
+			}
+			ppu.Clock()
+		}
+		if scanline, dot := ppu.lastDot(); scanline != 41 || dot != 101+delay {
+			t.Errorf("delay %d: hit on scanline %d dot %d, want scanline 41 dot %d",
+				delay, scanline, dot, 101+delay)
+		}
+	}
+}
+
+func TestGetNametable(t *testing.T) {
+	// Vertical mirroring, CHR RAM
+	ppu, _ := newTestPpu(t, newTestRom(1, 0, 0x01, 0x00))
+
+	writeSolidTiles(ppu)
+	ppu.paletteTable[0x00] = 0x0F
+	ppu.paletteTable[0x01] = 0x16
+	ppu.paletteTable[0x05] = 0x2A // Palette 1, pixel 1
+
+	// Tile 1 at tiles (0, 0) and (2, 0), in $2000. The attribute byte gives
+	// the top-right 2x2 tiles of the first 4x4 palette 1.
+	ppu.ppuWrite(0x2000, 1)
+	ppu.ppuWrite(0x2002, 1)
+	ppu.ppuWrite(0x23C0, 0x04)
+
+	tests := []struct {
+		nametable int
+		x, y      int
+		want      byte // Palette index of the color drawn
+	}{
+		{0, 0, 0, 0x16},
+		{0, 7, 7, 0x16},
+		{0, 8, 0, 0x0F},  // Tile 0 is blank
+		{0, 16, 0, 0x2A}, // Palette 1
+		{1, 0, 0, 0x0F},  // The other bank is empty
+		{2, 0, 0, 0x16},  // Mirror of $2000
+		{2, 16, 0, 0x2A},
+	}
+
+	for _, tt := range tests {
+		want := ppu.paletteRGBA[tt.want]
+		if got := ppu.GetNametable(tt.nametable).RGBAAt(tt.x, tt.y); got != want {
+			t.Errorf("nametable %d (%d, %d) = %v, want %v", tt.nametable, tt.x, tt.y, got, want)
+		}
+	}
+
+	if got := ppu.physicalNametables(); got != [2]int{0, 1} {
+		t.Errorf("physical nametables = %v, want [0 1]", got)
+	}
+
+	// The tiles come from the background pattern table, which is blank.
+	ppu.cpuWrite(0x0000, 0x10)
+	if got, want := ppu.GetNametable(0).RGBAAt(0, 0), ppu.paletteRGBA[0x0F]; got != want {
+		t.Errorf("pattern table 1: (0, 0) = %v, want %v", got, want)
+	}
+}
+
+func TestGetPaletteImage(t *testing.T) {
+	ppu := NewPpu()
+	for i := byte(0); i < 32; i++ {
+		ppu.ppuWrite(paletteAddr+uint16(i), i+1)
+	}
+
+	img := ppu.GetPaletteImage()
+	if got, want := img.Rect.Size(), image.Pt(16*paletteSwatchSize, 2*paletteSwatchSize); got != want {
+		t.Fatalf("size = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		entry int
+		want  byte // Palette index of the swatch's color
+	}{
+		{0x00, 0x11}, // Last written through its mirror, $3F10
+		{0x01, 0x02},
+		{0x07, 0x08},
+		{0x0F, 0x10},
+		{0x10, 0x11}, // Mirror of $3F00
+		{0x11, 0x12},
+		{0x1F, 0x20},
+	}
+	for _, tt := range tests {
+		x := (tt.entry%16)*paletteSwatchSize + paletteSwatchSize/2
+		y := (tt.entry/16)*paletteSwatchSize + paletteSwatchSize/2
+		if got, want := img.RGBAAt(x, y), ppu.paletteRGBA[tt.want]; got != want {
+			t.Errorf("entry $%02X = %v, want %v", tt.entry, got, want)
+		}
+	}
+}
+
+func TestPatternTablePalette(t *testing.T) {
+	// CHR RAM
+	ppu, _ := newTestPpu(t, newTestRom(1, 0, 0x00, 0x00))
+
+	writeSolidTiles(ppu)
+	ppu.paletteTable[0x01] = 0x16
+	ppu.paletteTable[0x19] = 0x2A // Palette 6, pixel 1
+
+	// Tile 1 is at (8, 0).
+	if got, want := ppu.GetPatternTable(0).RGBAAt(8, 0), ppu.paletteRGBA[0x16]; got != want {
+		t.Errorf("palette 0: %v, want %v", got, want)
+	}
+
+	ppu.SetPatternTablePalette(6)
+	if got, want := ppu.GetPatternTable(0).RGBAAt(8, 0), ppu.paletteRGBA[0x2A]; got != want {
+		t.Errorf("palette 6: %v, want %v", got, want)
+	}
+
+	// Palettes wrap around.
+	ppu.SetPatternTablePalette(8)
+	if got, want := ppu.GetPatternTable(0).RGBAAt(8, 0), ppu.paletteRGBA[0x16]; got != want {
+		t.Errorf("palette 8: %v, want %v", got, want)
+	}
+}
+
+func TestLoadPalette(t *testing.T) {
+	dir := t.TempDir()
+
+	data := make([]byte, paletteFileSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	path := filepath.Join(dir, "test.pal")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	palette, err := loadPalette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := palette[0x3F], (color.RGBA{189, 190, 191, 255}); got != want {
+		t.Errorf("color $3F = %v, want %v", got, want)
+	}
+
+	// Palettes with more or fewer than 64 colors are rejected.
+	for _, size := range []int{0, paletteFileSize - 3, paletteFileSize + 3*64} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.pal", size))
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadPalette(path); err == nil {
+			t.Errorf("%d byte palette: no error", size)
+		}
+	}
+
+	if _, err := loadPalette(filepath.Join(dir, "missing.pal")); err == nil {
+		t.Error("missing palette: no error")
+	}
+}
+
+func TestLoadPaletteFile(t *testing.T) {
+	ppu := NewPpu()
+	ntsc := ppu.paletteRGBA
+	if want := (color.RGBA{254, 255, 255, 255}); ntsc[0x30] != want {
+		t.Errorf("embedded palette color $30 = %v, want %v", ntsc[0x30], want)
+	}
+
+	// A bad file keeps the current palette.
+	path := filepath.Join(t.TempDir(), "test.pal")
+	if err := ppu.LoadPaletteFile(path); err == nil {
+		t.Error("missing palette: no error")
+	}
+	if ppu.paletteRGBA != ntsc {
+		t.Error("palette changed by a failed load")
+	}
+
+	data := make([]byte, paletteFileSize)
+	data[0], data[1], data[2] = 0x10, 0x20, 0x30
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ppu.LoadPaletteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ppu.paletteRGBA[0x00], (color.RGBA{0x10, 0x20, 0x30, 255}); got != want {
+		t.Errorf("color $00 = %v, want %v", got, want)
+	}
+	if ppu.defaultPalette != ppu.paletteRGBA {
+		t.Error("loaded palette isn't the default outside of VS System mode")
+	}
+}
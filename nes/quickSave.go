@@ -0,0 +1,196 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// Quick saves write save states to numbered slot files named after the ROM,
+// ./saves/<rom name>.state0 to .state9. While running, the quick save key
+// saves to the selected slot, the quick load key loads it, and the number keys
+// select a slot.
+
+const (
+	quickSaveSlots = 10
+
+	// How long quick save messages stay in the debug panel
+	messageDuration = 3 * time.Second
+)
+
+// QuickSaveKeys are the keys used to quick save and quick load.
+type QuickSaveKeys struct {
+	Save pixelgl.Button
+	Load pixelgl.Button
+}
+
+// F5 to quick save, F9 to quick load.
+var DefaultQuickSaveKeys = QuickSaveKeys{
+	Save: pixelgl.KeyF5,
+	Load: pixelgl.KeyF9,
+}
+
+// Keys used to select each slot.
+var stateSlotKeys = [quickSaveSlots]pixelgl.Button{
+	pixelgl.Key0, pixelgl.Key1, pixelgl.Key2, pixelgl.Key3, pixelgl.Key4,
+	pixelgl.Key5, pixelgl.Key6, pixelgl.Key7, pixelgl.Key8, pixelgl.Key9,
+}
+
+// defaultStatePath returns the path quick save slot files are named after, for
+// the ROM at romPath: ./saves/<rom name>.state
+func defaultStatePath(romPath string) string {
+	name := strings.TrimSuffix(filepath.Base(romPath), filepath.Ext(romPath))
+	return filepath.Join(defaultSaveDir, name+".state")
+}
+
+// SetStatePath sets the path quick save slot files are named after. The slot
+// number is added to it. Defaults to ./saves/<rom name>.state
+func (c *Cartridge) SetStatePath(path string) {
+	c.statePath = path
+}
+
+// SetQuickSaveKeys sets the keys used to quick save and quick load.
+func (b *Bus) SetQuickSaveKeys(keys QuickSaveKeys) {
+	b.quickSaveKeys = keys
+}
+
+// SelectStateSlot selects the slot (0-9) used to quick save and quick load.
+func (b *Bus) SelectStateSlot(slot int) error {
+	if slot < 0 || slot >= quickSaveSlots {
+		return fmt.Errorf("invalid save state slot %d", slot)
+	}
+
+	b.stateSlot = slot
+
+	return nil
+}
+
+// QuickSave saves the machine's state to the selected slot's file.
+func (b *Bus) QuickSave() error {
+	path, err := b.stateSlotPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := b.SaveState()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return fmt.Errorf("unable to create save directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("unable to write save state: %w", err)
+	}
+
+	return nil
+}
+
+// QuickLoad loads the machine's state from the selected slot's file.
+func (b *Bus) QuickLoad() error {
+	path, err := b.stateSlotPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("slot %d is empty", b.stateSlot)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read save state: %w", err)
+	}
+
+	return b.LoadState(data)
+}
+
+// stateSlotPath returns the selected slot's file for the inserted game.
+func (b *Bus) stateSlotPath() (string, error) {
+	if b.Cart == nil {
+		return "", errors.New("no cartridge inserted")
+	}
+	if b.Cart.statePath == "" {
+		return "", errors.New("no save state path for the game")
+	}
+
+	return b.Cart.statePath + strconv.Itoa(b.stateSlot), nil
+}
+
+// Write a file by writing a temporary file next to it, then renaming it over
+// the file. A crash partway through leaves the old file untouched.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// Handle the quick save keys, once per frame.
+func (b *Bus) updateQuickSaveInput(win *pixelgl.Window) {
+	for slot, key := range stateSlotKeys {
+		if win.JustPressed(key) {
+			b.SelectStateSlot(slot)
+			b.showMessage(fmt.Sprintf("Slot %d selected", slot))
+		}
+	}
+
+	if win.JustPressed(b.quickSaveKeys.Save) {
+		if err := b.QuickSave(); err != nil {
+			b.showMessage(fmt.Sprintf("Save failed: %v", err))
+		} else {
+			b.showMessage(fmt.Sprintf("Saved to slot %d", b.stateSlot))
+		}
+	}
+
+	if win.JustPressed(b.quickSaveKeys.Load) {
+		if err := b.QuickLoad(); err != nil {
+			b.showMessage(fmt.Sprintf("Load failed: %v", err))
+		} else {
+			b.showMessage(fmt.Sprintf("Loaded slot %d", b.stateSlot))
+		}
+	}
+}
+
+// Show a message in the debug panel for a few seconds. It is logged too, as
+// the debug panel may be hidden.
+func (b *Bus) showMessage(msg string) {
+	log.Println(msg)
+
+	b.message = msg
+	b.messageExpires = time.Now().Add(messageDuration)
+}
+
+// currentMessage returns the message to show in the debug panel, if any.
+func (b *Bus) currentMessage() string {
+	if time.Now().After(b.messageExpires) {
+		return ""
+	}
+	return b.message
+}
@@ -0,0 +1,92 @@
+package nes
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuickSaveSlots(t *testing.T) {
+	bus := newStateTestBus(t)
+	dir := filepath.Dir(bus.Cart.statePath)
+
+	// Save a different state to slots 0 and 3.
+	bus.StepFrame()
+	if err := bus.QuickSave(); err != nil {
+		t.Fatal(err)
+	}
+	slot0, _ := bus.SaveState()
+
+	bus.StepFrame()
+	if err := bus.SelectStateSlot(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.QuickSave(); err != nil {
+		t.Fatal(err)
+	}
+	slot3, _ := bus.SaveState()
+
+	// Only the slot files are left, with no temporary files.
+	files, err := filepath.Glob(filepath.Join(dir, "test.state*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "test.state0"), filepath.Join(dir, "test.state3")}
+	if len(files) != len(want) || files[0] != want[0] || files[1] != want[1] {
+		t.Errorf("state files = %v, want %v", files, want)
+	}
+
+	bus.StepFrame()
+	for _, tt := range []struct {
+		slot int
+		want []byte
+	}{
+		{0, slot0},
+		{3, slot3},
+	} {
+		bus.SelectStateSlot(tt.slot)
+		if err := bus.QuickLoad(); err != nil {
+			t.Fatalf("slot %d: %v", tt.slot, err)
+		}
+		if got, _ := bus.SaveState(); !bytes.Equal(got, tt.want) {
+			t.Errorf("slot %d: loaded state differs from the saved state", tt.slot)
+		}
+	}
+
+	// Saving again replaces the slot's file.
+	bus.StepFrame()
+	if err := bus.QuickSave(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(want[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := bus.SaveState(); !bytes.Equal(got, data) {
+		t.Error("slot 3 was not replaced by the new save")
+	}
+}
+
+func TestQuickSaveErrors(t *testing.T) {
+	bus := newStateTestBus(t)
+
+	if err := bus.SelectStateSlot(10); err == nil {
+		t.Error("selected slot 10, want error")
+	}
+	if err := bus.SelectStateSlot(-1); err == nil {
+		t.Error("selected slot -1, want error")
+	}
+
+	if err := bus.SelectStateSlot(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.QuickLoad(); err == nil {
+		t.Error("loaded empty slot, want error")
+	}
+
+	bus.EjectCartridge()
+	if err := bus.QuickSave(); err == nil {
+		t.Error("saved with no cartridge, want error")
+	}
+}
@@ -0,0 +1,107 @@
+package nes
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// NTSC and PAL consoles run at different speeds. PAL divides the master clock
+// down to a slower CPU, clocks the PPU 3.2 times per CPU cycle instead of 3,
+// and draws 312 scanlines per frame instead of 262, with the extra 50 spent
+// in vertical blank. The APU's frame counter and DMC rates are adjusted to
+// match.
+//
+// reference: https://wiki.nesdev.com/w/index.php/Cycle_reference_chart
+
+const (
+	// CPU cycles per second.
+	ntscCpuClockRate = apuClockRate
+	palCpuClockRate  = 1662607
+
+	// PPU cycles per CPU cycle on PAL, 3.2, as a fraction.
+	palPpuCyclesNum = 16
+	palPpuCyclesDen = 5
+)
+
+// PalFrameRate is the frame rate of a PAL NES, about 50.007 frames per second.
+// A frame is 341x312 PPU dots, and the PPU runs at 3.2 times the CPU clock.
+const PalFrameRate = palCpuClockRate * palPpuCyclesNum / (palPpuCyclesDen * 341.0 * 312)
+
+// scanlines returns the number of scanlines per frame, including the
+// pre-render scanline.
+func (r Region) scanlines() int {
+	if r == RegionPAL {
+		return 312
+	}
+	return 262
+}
+
+func (r Region) cpuClockRate() int {
+	if r == RegionPAL {
+		return palCpuClockRate
+	}
+	return ntscCpuClockRate
+}
+
+// FrameRate returns the frames per second of the region's consoles.
+func (r Region) FrameRate() float64 {
+	if r == RegionPAL {
+		return PalFrameRate
+	}
+	return NtscFrameRate
+}
+
+// Tags in ROM file names, in the GoodNES and No-Intro naming conventions, of
+// games released only in PAL countries.
+var palFilenameTags = []string{"(e)", "(europe)", "(pal)", "(a)", "(australia)"}
+
+// regionFromFilename guesses a game's region from tags in its ROM file name,
+// for iNES headers that don't set it. It returns false if there is no tag.
+func regionFromFilename(path string) (Region, bool) {
+	name := strings.ToLower(filepath.Base(path))
+	for _, tag := range palFilenameTags {
+		if strings.Contains(name, tag) {
+			return RegionPAL, true
+		}
+	}
+	return RegionNTSC, false
+}
+
+// SetRegion forces the TV system the NES runs as, ignoring the inserted
+// cartridge's region until RestoreRegion is called.
+func (b *Bus) SetRegion(r Region) {
+	b.forcedRegion = r
+	b.isRegionForced = true
+	b.applyRegion()
+}
+
+// RestoreRegion runs the NES as the TV system the inserted cartridge was made
+// for, NTSC if none.
+func (b *Bus) RestoreRegion() {
+	b.isRegionForced = false
+	b.applyRegion()
+}
+
+// Region returns the TV system the NES is running as.
+func (b *Bus) Region() Region {
+	return b.region
+}
+
+// Set the PPU and APU timing for the region in use. A target FPS left at the
+// old region's frame rate moves to the new region's.
+func (b *Bus) applyRegion() {
+	region := RegionNTSC
+	if b.isRegionForced {
+		region = b.forcedRegion
+	} else if b.Cart != nil {
+		region = b.Cart.region
+	}
+
+	if b.targetFPS == b.region.FrameRate() {
+		b.targetFPS = region.FrameRate()
+	}
+
+	b.region = region
+	b.Ppu.region = region
+	b.Apu.setRegion(region)
+}
@@ -0,0 +1,127 @@
+package nes
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegionTiming(t *testing.T) {
+	tests := []struct {
+		region       Region
+		dots         int // PPU cycles in 2 frames
+		cpuCycles    int // CPU cycles in 10 frames
+		vblankCycles int // CPU cycles from vblank to the pre-render scanline
+	}{
+		// Odd frames skip a dot on NTSC, as rendering is enabled.
+		{RegionNTSC, 2*341*262 - 1, 5 * (2*341*262 - 1) / 3, 20 * 341 / 3},
+		{RegionPAL, 2 * 341 * 312, 10 * 341 * 312 * 5 / 16, 70 * 341 * 5 / 16},
+	}
+
+	for _, tt := range tests {
+		rom := newTestRom(1, 1, 0x00, 0x00)
+		prg := rom[16:]
+		// $8000: enable rendering, then loop forever.
+		copy(prg, []byte{0xA9, 0x1E, 0x8D, 0x01, 0x20, 0x4C, 0x05, 0x80})
+		copy(prg[0x3FFC:], []byte{0x00, 0x80})
+
+		bus := NewBus(false, false)
+		bus.InsertCartridge(newTestCartridge(t, rom))
+		bus.SetRegion(tt.region)
+
+		// The first frame starts at scanline 0, so runs short.
+		bus.StepFrame()
+		bus.StepFrame()
+
+		clocks := bus.ClockCount
+		bus.StepFrame()
+		bus.StepFrame()
+		if got := bus.ClockCount - clocks; got != tt.dots {
+			t.Errorf("%v: 2 frames ran %d PPU cycles, want %d", tt.region, got, tt.dots)
+		}
+
+		cycles := bus.Cpu.CycleCount
+		for i := 0; i < 10; i++ {
+			bus.StepFrame()
+		}
+		if got := int(bus.Cpu.CycleCount - cycles); got < tt.cpuCycles-1 || got > tt.cpuCycles+1 {
+			t.Errorf("%v: 10 frames ran %d CPU cycles, want %d", tt.region, got, tt.cpuCycles)
+		}
+
+		bus.RunToVBlank()
+		cycles = bus.Cpu.CycleCount
+		for scanline, _ := bus.PpuPosition(); scanline != -1; scanline, _ = bus.PpuPosition() {
+			bus.StepDot()
+		}
+		if got := int(bus.Cpu.CycleCount - cycles); got < tt.vblankCycles-1 || got > tt.vblankCycles+1 {
+			t.Errorf("%v: vblank lasted %d CPU cycles, want %d", tt.region, got, tt.vblankCycles)
+		}
+	}
+}
+
+func TestRegionSettings(t *testing.T) {
+	if math.Abs(PalFrameRate-50.007) > 0.001 {
+		t.Errorf("PAL frame rate = %v, want 50.007", PalFrameRate)
+	}
+
+	// PAL header (flags 9 bit 0).
+	rom := newTestRom(1, 1, 0x00, 0x00)
+	rom[9] = 0x01
+
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, rom))
+	if got := bus.Region(); got != RegionPAL {
+		t.Errorf("region = %v, want PAL from the header", got)
+	}
+	if got := bus.TargetFPS(); got != PalFrameRate {
+		t.Errorf("target FPS = %v, want the PAL frame rate", got)
+	}
+	if got := bus.Apu.dmc.timerPeriod; got != apuDmcRateTable[RegionPAL][0] {
+		t.Errorf("DMC period = %d, want PAL rate %d", got, apuDmcRateTable[RegionPAL][0])
+	}
+
+	// Forcing the region keeps a target FPS set by hand.
+	bus.SetTargetFPS(100)
+	bus.SetRegion(RegionNTSC)
+	if got := bus.Region(); got != RegionNTSC {
+		t.Errorf("region = %v after forcing NTSC", got)
+	}
+	if got := bus.TargetFPS(); got != 100 {
+		t.Errorf("target FPS = %v after forcing NTSC, want 100", got)
+	}
+
+	bus.RestoreRegion()
+	if got := bus.Region(); got != RegionPAL {
+		t.Errorf("region = %v after restoring, want PAL", got)
+	}
+}
+
+func TestRegionFromFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want Region
+	}{
+		{"Super Mario Bros. (W).nes", RegionNTSC},
+		{"Elite (E).nes", RegionPAL},
+		{"Asterix (Europe) (En,Fr,De).nes", RegionPAL},
+		{"Game (PAL).nes", RegionPAL},
+		{"game.nes", RegionNTSC},
+	}
+
+	for _, tt := range tests {
+		// The header leaves the region at NTSC.
+		path := filepath.Join(t.TempDir(), tt.name)
+		if err := os.WriteFile(path, newTestRom(1, 1, 0x00, 0x00), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cart, err := NewCartridgeFromFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := cart.Info().Region; got != tt.want {
+			t.Errorf("%q: region = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+)
+
+// Renderer is where the PPU draws the game picture, pixel by pixel, and
+// presents each finished frame. Display renders to a PixelGL window, and
+// ImageRenderer only keeps the picture in memory.
+type Renderer interface {
+	// DrawPixel sets pixel (x, y) of the 256x240 game picture.
+	DrawPixel(x, y int, c color.RGBA)
+
+	// FillRow sets row y of the game picture to a color, from x to the end of
+	// the row. Used while rendering is disabled.
+	FillRow(x, y int, c color.RGBA)
+
+	// UpdateScreen is called each time the PPU finishes drawing a frame, to
+	// present it.
+	UpdateScreen()
+
+	// Frame returns the game picture being drawn. It holds the last whole
+	// frame between the PPU finishing a frame and starting the next.
+	Frame() *image.RGBA
+}
+
+// ImageRenderer draws the game picture into an image in memory. Nothing is
+// presented, so it can be used without a window, such as for tests or
+// screenshots.
+type ImageRenderer struct {
+	rgba *image.RGBA
+}
+
+func NewImageRenderer() *ImageRenderer {
+	return &ImageRenderer{
+		rgba: image.NewRGBA(image.Rect(0, 0, int(nesResW), int(nesResH))),
+	}
+}
+
+func (r *ImageRenderer) DrawPixel(x, y int, c color.RGBA) {
+	r.rgba.SetRGBA(x, y, c)
+}
+
+func (r *ImageRenderer) FillRow(x, y int, c color.RGBA) {
+	for ; x < int(nesResW); x++ {
+		r.rgba.SetRGBA(x, y, c)
+	}
+}
+
+func (r *ImageRenderer) UpdateScreen() {}
+
+func (r *ImageRenderer) Frame() *image.RGBA {
+	return r.rgba
+}
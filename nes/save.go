@@ -0,0 +1,98 @@
+package nes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Battery-backed PRG-RAM is saved to a .sav file named after the ROM, so games
+// keep their saves between sessions. Cartridges without a battery still have
+// PRG-RAM as work RAM, but it is never saved.
+//
+// The save is written when the game is closed or swapped, and every few
+// seconds while the game runs if PRG-RAM has changed, so a crash loses little.
+
+const (
+	defaultSaveDir = "./saves"
+
+	autoSaveInterval = 5 * time.Second
+)
+
+// defaultSavePath returns the save file path for the ROM at romPath:
+// ./saves/<rom name>.sav
+func defaultSavePath(romPath string) string {
+	name := strings.TrimSuffix(filepath.Base(romPath), filepath.Ext(romPath))
+	return filepath.Join(defaultSaveDir, name+".sav")
+}
+
+// SetSavePath sets the file battery-backed PRG-RAM is saved to and loaded
+// from. Defaults to ./saves/<rom name>.sav
+func (c *Cartridge) SetSavePath(path string) {
+	c.savePath = path
+}
+
+// LoadSave loads battery-backed PRG-RAM from the save file. It does nothing if
+// the cartridge has no battery or there is no save file yet.
+func (c *Cartridge) LoadSave() error {
+	if !c.hasBattery {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(c.savePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to load save file: %w", err)
+	}
+
+	copy(c.prgRam, data)
+
+	return nil
+}
+
+// WriteSave writes battery-backed PRG-RAM to the save file. It does nothing if
+// the cartridge has no battery.
+func (c *Cartridge) WriteSave() error {
+	if !c.hasBattery {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.savePath), 0775); err != nil {
+		return fmt.Errorf("unable to create save directory: %w", err)
+	}
+	if err := writeFileAtomic(c.savePath, c.prgRam); err != nil {
+		return fmt.Errorf("unable to write save file: %w", err)
+	}
+	c.saveDirty = false
+
+	return nil
+}
+
+// Write battery-backed PRG-RAM to the save file, if it changed since it was
+// last saved.
+func (c *Cartridge) autoSave() error {
+	if !c.saveDirty {
+		return nil
+	}
+	return c.WriteSave()
+}
+
+// Save the inserted game's battery-backed PRG-RAM, if it changed. Called
+// between frames by Run.
+func (b *Bus) autoSave() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Cart == nil {
+		return
+	}
+	if err := b.Cart.autoSave(); err != nil {
+		log.Println(err)
+	}
+}
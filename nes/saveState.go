@@ -0,0 +1,369 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Save states hold the whole machine: CPU, RAM, PPU, APU, and cartridge. They
+// are a versioned binary format:
+//
+//	"NESS"          magic
+//	uint16          version
+//	uint32          hash of the game's ROM
+//	...             each component's state, in the order of serializeState
+//
+// Settings, such as the palette or accuracy options, are not saved.
+
+var saveStateMagic = [4]byte{'N', 'E', 'S', 'S'}
+
+// Increase when the state saved by any component changes.
+const saveStateVersion uint16 = 3
+
+// SaveState returns a snapshot of the whole machine, which LoadState restores.
+// It can be taken at any point, including partway through a frame.
+func (b *Bus) SaveState() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.saveState()
+}
+
+// LoadState restores a snapshot taken by SaveState, for the same game. The
+// machine is left unchanged if the snapshot can't be loaded.
+func (b *Bus) LoadState(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	backup, err := b.saveState()
+	if err != nil {
+		return err
+	}
+
+	if err := b.loadState(data); err != nil {
+		if err := b.loadState(backup); err != nil {
+			panic(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bus) saveState() ([]byte, error) {
+	if b.Cart == nil {
+		return nil, errors.New("unable to save state: no cartridge inserted")
+	}
+
+	s := &stateSerializer{}
+	b.serializeState(s)
+	if s.err != nil {
+		return nil, fmt.Errorf("unable to save state: %w", s.err)
+	}
+
+	return s.w.Bytes(), nil
+}
+
+func (b *Bus) loadState(data []byte) error {
+	if b.Cart == nil {
+		return errors.New("unable to load state: no cartridge inserted")
+	}
+
+	s := &stateSerializer{loading: true, r: bytes.NewReader(data)}
+	b.serializeState(s)
+	if s.err == nil && s.r.Len() > 0 {
+		s.fail(fmt.Errorf("%d bytes left over", s.r.Len()))
+	}
+	if s.err != nil {
+		return fmt.Errorf("unable to load state: %w", s.err)
+	}
+
+	// The rest of the scanline is drawn again.
+	b.Ppu.blankFilled = false
+
+	// PRG-RAM came from the state, so the battery save needs writing.
+	b.Cart.saveDirty = b.Cart.hasBattery
+
+	return nil
+}
+
+// Save or load the header and every component.
+func (b *Bus) serializeState(s *stateSerializer) {
+	magic := saveStateMagic
+	s.value(&magic)
+	if magic != saveStateMagic {
+		s.fail(errors.New("not a save state"))
+	}
+
+	version := saveStateVersion
+	s.value(&version)
+	if version != saveStateVersion {
+		s.fail(fmt.Errorf("unsupported save state version %d", version))
+	}
+
+	hash := b.Cart.hash
+	s.value(&hash)
+	if hash != b.Cart.hash {
+		s.fail(errors.New("save state is for a different game"))
+	}
+
+	// Bus
+	s.value(&b.Ram)
+	s.value(&b.ControllerState)
+	s.value(&b.controllerStrobe)
+	s.int(&b.ClockCount)
+	s.int(&b.cpuClockCount)
+	s.value(&b.dmaPage)
+	s.value(&b.dmaAddr)
+	s.value(&b.dmaData)
+	s.value(&b.dmaTransfer)
+	s.value(&b.dmaNeedSync)
+	s.int(&b.dmcStall)
+	s.value(&b.openBus)
+	s.int(&b.clockAlignment)
+	s.int(&b.palClock)
+
+	b.Cpu.serializeState(s)
+	b.Ppu.serializeState(s)
+	b.Apu.serializeState(s)
+	b.Cart.serializeState(s)
+}
+
+func (cpu *Cpu6502) serializeState(s *stateSerializer) {
+	s.value(&cpu.Pc)
+	s.value(&cpu.Sp)
+	s.value(&cpu.A)
+	s.value(&cpu.X)
+	s.value(&cpu.Y)
+	s.value(&cpu.Status)
+	s.value(&cpu.Cycles)
+	s.value(&cpu.Opcode)
+	s.value(&cpu.AddrAbs)
+	s.value(&cpu.AddrRel)
+	s.value(&cpu.Fetched)
+	s.value(&cpu.CycleCount)
+}
+
+func (p *Ppu) serializeState(s *stateSerializer) {
+	s.value(&p.nameTable)
+	s.value(&p.paletteTable)
+	s.value(&p.patternTable)
+
+	s.value(p.ppuCtrl)
+	s.value(p.ppuMask)
+	s.value(p.ppuStatus)
+	s.value(&p.nmi)
+
+	s.int(&p.scanline)
+	s.int(&p.cycle)
+	s.value(&p.frameComplete)
+	s.int(&p.frames)
+
+	s.value(&p.dataBuffer)
+	s.value(&p.openBus)
+	s.value(&p.openBusRefreshed)
+	s.value(&p.dots)
+
+	// Background
+	s.value(p.vRam)
+	s.value(p.tRam)
+	s.value(&p.scrollFineX)
+	s.value(&p.addrLatch)
+	s.value(&p.nextBgTileId)
+	s.value(&p.nextBgAttr)
+	s.value(&p.nextBgTileLo)
+	s.value(&p.nextBgTileHi)
+	s.value(&p.bgPatternShifterLo)
+	s.value(&p.bgPatternShifterHi)
+	s.value(&p.bgAttribShifterLo)
+	s.value(&p.bgAttribShifterHi)
+
+	// Sprites
+	p.oam.serializeState(s)
+	s.value(&p.oamAddr)
+	p.spriteScanline.serializeState(s)
+	s.int(&p.spriteCount)
+	s.value(&p.spritePatternShifterLo)
+	s.value(&p.spritePatternShifterHi)
+	s.value(&p.spriteStartX)
+	s.value(&p.isSpriteZeroPossible)
+	s.value(&p.isSpriteZeroRendered)
+}
+
+func (oam objectAttributeMemory) serializeState(s *stateSerializer) {
+	for i := 0; i < len(oam)*4; i++ {
+		data := oam.read(byte(i))
+		s.value(&data)
+		oam.write(byte(i), data)
+	}
+}
+
+func (a *Apu) serializeState(s *stateSerializer) {
+	s.value(&a.cycles)
+
+	s.value(&a.frameFiveStep)
+	s.value(&a.frameIrqInhibit)
+	s.value(&a.frameIrq)
+	s.int(&a.frameCycle)
+
+	a.pulse1.serializeState(s)
+	a.pulse2.serializeState(s)
+	a.triangle.serializeState(s)
+	a.dmc.serializeState(s)
+}
+
+func (p *apuPulse) serializeState(s *stateSerializer) {
+	s.value(&p.duty)
+	s.value(&p.dutyStep)
+	s.value(&p.timer)
+	s.value(&p.timerPeriod)
+	p.length.serializeState(s)
+	p.envelope.serializeState(s)
+	s.value(&p.sweepEnabled)
+	s.value(&p.sweepPeriod)
+	s.value(&p.sweepNegate)
+	s.value(&p.sweepShift)
+	s.value(&p.sweepDivider)
+	s.value(&p.sweepReload)
+}
+
+func (t *apuTriangle) serializeState(s *stateSerializer) {
+	s.value(&t.step)
+	s.value(&t.timer)
+	s.value(&t.timerPeriod)
+	t.length.serializeState(s)
+	s.value(&t.linearControl)
+	s.value(&t.linearReload)
+	s.value(&t.linearPeriod)
+	s.value(&t.linearValue)
+}
+
+func (d *apuDmc) serializeState(s *stateSerializer) {
+	s.value(&d.irqEnabled)
+	s.value(&d.loop)
+	s.value(&d.irq)
+	s.value(&d.timer)
+	s.value(&d.timerPeriod)
+	s.value(&d.rate)
+	s.value(&d.level)
+	s.value(&d.sampleAddr)
+	s.value(&d.sampleLength)
+	s.value(&d.currentAddr)
+	s.value(&d.bytesRemaining)
+	s.value(&d.buffer)
+	s.value(&d.bufferFull)
+	s.value(&d.shifter)
+	s.value(&d.bitsRemaining)
+	s.value(&d.silence)
+}
+
+func (l *apuLengthCounter) serializeState(s *stateSerializer) {
+	s.value(&l.enabled)
+	s.value(&l.halt)
+	s.value(&l.value)
+}
+
+func (e *apuEnvelope) serializeState(s *stateSerializer) {
+	s.value(&e.start)
+	s.value(&e.loop)
+	s.value(&e.constant)
+	s.value(&e.period)
+	s.value(&e.divider)
+	s.value(&e.decay)
+}
+
+// The cartridge's RAM and mapper registers. ROM is never saved.
+func (c *Cartridge) serializeState(s *stateSerializer) {
+	s.bytes(c.prgRam)
+	if c.isChrRam {
+		s.bytes(c.chrMem)
+	}
+
+	if m, ok := c.mapper.(stateMapper); ok {
+		m.serializeState(s)
+	}
+}
+
+func (m *Mapper001) serializeState(s *stateSerializer) {
+	s.value(&m.shift)
+	s.value(&m.shiftCount)
+	s.value(&m.control)
+	s.value(&m.chrBank0)
+	s.value(&m.chrBank1)
+	s.value(&m.prgBank)
+}
+
+func (m *Mapper002) serializeState(s *stateSerializer) {
+	s.value(&m.prgBank)
+}
+
+func (m *Mapper003) serializeState(s *stateSerializer) {
+	s.value(&m.chrBank)
+}
+
+func (m *Mapper004) serializeState(s *stateSerializer) {
+	s.value(&m.bankSelect)
+	s.value(&m.registers)
+	s.mirrorMode(&m.mirroring)
+	s.value(&m.irqLatch)
+	s.value(&m.irqCounter)
+	s.value(&m.irqReload)
+	s.value(&m.irqEnabled)
+	s.value(&m.irqPending)
+}
+
+// stateSerializer saves or loads machine state. Each component lists its state
+// once, in a serializeState method used both ways, so saving and loading can't
+// get out of step. After the first error, nothing more is saved or loaded.
+type stateSerializer struct {
+	loading bool
+	w       bytes.Buffer  // Saved state, when saving
+	r       *bytes.Reader // State being loaded, when loading
+	err     error
+}
+
+func (s *stateSerializer) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Save or load a fixed size value, such as a byte, bool, or array of them,
+// through a pointer.
+func (s *stateSerializer) value(v interface{}) {
+	if s.err != nil {
+		return
+	}
+
+	if s.loading {
+		s.fail(binary.Read(s.r, binary.LittleEndian, v))
+	} else {
+		s.fail(binary.Write(&s.w, binary.LittleEndian, v))
+	}
+}
+
+// Save or load an int, as 64 bits.
+func (s *stateSerializer) int(v *int) {
+	n := int64(*v)
+	s.value(&n)
+	*v = int(n)
+}
+
+func (s *stateSerializer) mirrorMode(v *MirrorMode) {
+	n := int(*v)
+	s.int(&n)
+	*v = MirrorMode(n)
+}
+
+// Save or load memory whose size is set by the cartridge, such as PRG-RAM.
+// The size is saved too, and must match when loading.
+func (s *stateSerializer) bytes(b []byte) {
+	size := uint32(len(b))
+	s.value(&size)
+	if size != uint32(len(b)) {
+		s.fail(fmt.Errorf("memory size %d, want %d", size, len(b)))
+	}
+	s.value(b)
+}
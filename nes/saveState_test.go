@@ -0,0 +1,181 @@
+package nes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// newStateTestBus returns a NES running a program that keeps changing the
+// machine's state: it renders, plays a pulse, banks CHR on an MMC3, and writes
+// to RAM, PRG-RAM, and CHR RAM.
+func newStateTestBus(t *testing.T) *Bus {
+	rom := newTestRom(2, 0, 0x40, 0x00)
+	prg := rom[16:]
+
+	program := []byte{
+		0xA9, 0x1E, 0x8D, 0x01, 0x20, // LDA #$1E, STA $2001 (show background and sprites)
+		0xA9, 0x01, 0x8D, 0x15, 0x40, // LDA #$01, STA $4015
+		0xA9, 0xBF, 0x8D, 0x00, 0x40, // LDA #$BF, STA $4000
+		0xA9, 0x08, 0x8D, 0x03, 0x40, // LDA #$08, STA $4003
+		0xE6, 0x10, // loop: INC $10
+		0xA5, 0x10, 0x8D, 0x07, 0x20, // LDA $10, STA $2007
+		0x8D, 0x00, 0x60, // STA $6000
+		0x29, 0x07, 0x8D, 0x00, 0x80, // AND #$07, STA $8000 (bank select)
+		0x8D, 0x01, 0x80, // STA $8001
+		0x4C, 0x14, 0x80, // JMP loop
+	}
+	copy(prg, program)
+	copy(prg[0x7FFC:], []byte{0x00, 0x80})
+
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, rom))
+	bus.Ppu.ConnectDisplay(NewImageRenderer())
+
+	return bus
+}
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	bus := newStateTestBus(t)
+
+	// Stop partway through a frame.
+	bus.StepFrame()
+	for i := 0; i < 12345; i++ {
+		bus.Clock()
+	}
+
+	state, err := bus.SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run on to get the expected state, then go back and run again.
+	run := func() []byte {
+		for i := 0; i < 3; i++ {
+			bus.StepFrame()
+		}
+		after, err := bus.SaveState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return after
+	}
+
+	want := run()
+	wantPixels := append([]byte(nil), bus.Ppu.display.Frame().Pix...)
+
+	if err := bus.LoadState(state); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := bus.SaveState(); !bytes.Equal(got, state) {
+		t.Fatal("state changed by loading it")
+	}
+
+	if got := run(); !bytes.Equal(got, want) {
+		t.Error("state after running from a loaded state differs")
+	}
+	if !bytes.Equal(bus.Ppu.display.Frame().Pix, wantPixels) {
+		t.Error("frame drawn after loading a state differs")
+	}
+}
+
+func TestSaveStateAudio(t *testing.T) {
+	bus := newStateTestBus(t)
+
+	// Save partway through a held pulse note. The program leaves the timer
+	// period at 0, which is too short to be heard.
+	bus.CpuWrite(0x4002, 0xFD)
+	bus.StepFrame()
+	for i := 0; i < 12345; i++ {
+		bus.Clock()
+	}
+	state, err := bus.SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Returns the mixer output for each of the next n CPU cycles.
+	samples := func(bus *Bus, n int) []float32 {
+		var out []float32
+		for len(out) < n {
+			cycles := bus.Apu.cycles
+			bus.Clock()
+			if bus.Apu.cycles != cycles {
+				out = append(out, bus.Apu.mixerOutput())
+			}
+		}
+		return out
+	}
+
+	want := samples(bus, 20000)
+	silent := true
+	for _, sample := range want {
+		silent = silent && sample == want[0]
+	}
+	if silent {
+		t.Fatal("no note playing")
+	}
+
+	// Load into a freshly started NES, so nothing is left over from the run.
+	loaded := newStateTestBus(t)
+	if err := loaded.LoadState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	got := samples(loaded, len(want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %d after loading = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	bus := newStateTestBus(t)
+	bus.StepFrame()
+
+	state, err := bus.SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := NewBus(false, false)
+	other.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+
+	badVersion := append([]byte(nil), state...)
+	badVersion[4] = 0xFF
+
+	tests := []struct {
+		name string
+		bus  *Bus
+		data []byte
+		want string
+	}{
+		{"empty", bus, nil, "EOF"},
+		{"not a state", bus, []byte("NES\x1A...."), "not a save state"},
+		{"version", bus, badVersion, "version"},
+		{"truncated", bus, state[:len(state)-1], "EOF"},
+		{"trailing", bus, append(append([]byte(nil), state...), 0), "left over"},
+		{"other game", other, state, "different game"},
+		{"no cartridge", NewBus(false, false), state, "no cartridge"},
+	}
+
+	for _, test := range tests {
+		var before []byte
+		if test.bus.Cart != nil {
+			before, _ = test.bus.SaveState()
+		}
+
+		err := test.bus.LoadState(test.data)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: err = %v, want %q", test.name, err, test.want)
+		}
+
+		// Failed loads leave the machine as it was.
+		if before != nil {
+			if after, _ := test.bus.SaveState(); !bytes.Equal(after, before) {
+				t.Errorf("%s: state changed by failed load", test.name)
+			}
+		}
+	}
+}
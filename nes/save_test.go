@@ -0,0 +1,90 @@
+package nes
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPrgRamSave(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags6  byte
+		battery bool
+	}{
+		{"work RAM", 0x00, false},
+		{"battery-backed", 0x02, true},
+	}
+
+	for _, tt := range tests {
+		rom := newTestRom(1, 1, tt.flags6, 0x00)
+		cart := newTestCartridge(t, rom)
+
+		bus := NewBus(false, false)
+		bus.InsertCartridge(cart)
+
+		bus.CpuWrite(0x6000, 0x12)
+		bus.CpuWrite(0x7FFF, 0x34)
+		if got := bus.CpuRead(0x6000); got != 0x12 {
+			t.Errorf("%s: read $6000 = %#02x, want 0x12", tt.name, got)
+		}
+		if got := bus.CpuRead(0x7FFF); got != 0x34 {
+			t.Errorf("%s: read $7FFF = %#02x, want 0x34", tt.name, got)
+		}
+
+		bus.EjectCartridge()
+
+		_, err := os.Stat(cart.savePath)
+		if saved := err == nil; saved != tt.battery {
+			t.Errorf("%s: save file written = %v, want %v", tt.name, saved, tt.battery)
+		}
+		if !tt.battery {
+			continue
+		}
+
+		// The save is loaded into a fresh copy of the game.
+		reloaded := newTestCartridge(t, rom)
+		reloaded.SetSavePath(cart.savePath)
+		bus.InsertCartridge(reloaded)
+
+		if got := bus.CpuRead(0x6000); got != 0x12 {
+			t.Errorf("%s: read $6000 after reload = %#02x, want 0x12", tt.name, got)
+		}
+		if got := bus.CpuRead(0x7FFF); got != 0x34 {
+			t.Errorf("%s: read $7FFF after reload = %#02x, want 0x34", tt.name, got)
+		}
+	}
+}
+
+func TestAutoSave(t *testing.T) {
+	rom := newTestRom(1, 1, 0x02, 0x00)
+	cart := newTestCartridge(t, rom)
+
+	bus := NewBus(false, false)
+	bus.InsertCartridge(cart)
+
+	// Nothing to save until the game writes to PRG-RAM.
+	bus.autoSave()
+	if _, err := os.Stat(cart.savePath); !os.IsNotExist(err) {
+		t.Fatalf("save file written before PRG-RAM changed, stat error %v", err)
+	}
+
+	bus.CpuWrite(0x6000, 0x12)
+	bus.autoSave()
+	data, err := os.ReadFile(cart.savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != 0x12 {
+		t.Errorf("saved $6000 = %#02x, want 0x12", data[0])
+	}
+
+	// Writing the same value again leaves the save alone.
+	if err := os.Remove(cart.savePath); err != nil {
+		t.Fatal(err)
+	}
+	bus.CpuWrite(0x6000, 0x12)
+	bus.autoSave()
+	if _, err := os.Stat(cart.savePath); !os.IsNotExist(err) {
+		t.Errorf("save file written for unchanged PRG-RAM, stat error %v", err)
+	}
+}
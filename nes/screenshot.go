@@ -0,0 +1,80 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// Screenshots are PNGs of the game picture at the NES's resolution, 256x240,
+// without the debug panel. While running, the screenshot key saves one to
+// screenshotDir.
+
+// Directory screenshots taken with the screenshot key are written to.
+var screenshotDir = "./screenshots"
+
+const screenshotKey = pixelgl.KeyF12
+
+// Screenshot writes the game picture to a PNG file at path.
+func (b *Bus) Screenshot(path string) error {
+	frame, err := b.screenshotFrame()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to write screenshot: %w", err)
+	}
+	if err := png.Encode(f, frame); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write screenshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to write screenshot: %w", err)
+	}
+
+	return nil
+}
+
+// screenshotFrame returns a copy of the game picture, taken between frames.
+func (b *Bus) screenshotFrame() (*image.RGBA, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Ppu.display == nil {
+		return nil, errors.New("unable to take screenshot: no display connected")
+	}
+
+	drawn := b.Ppu.display.Frame()
+	frame := image.NewRGBA(drawn.Rect)
+	copy(frame.Pix, drawn.Pix)
+
+	return frame, nil
+}
+
+// Take a screenshot when the screenshot key is pressed, once per frame.
+func (b *Bus) updateScreenshotInput(win *pixelgl.Window) {
+	if !win.JustPressed(screenshotKey) {
+		return
+	}
+
+	if err := os.MkdirAll(screenshotDir, 0775); err != nil {
+		b.showMessage(fmt.Sprintf("Screenshot failed: %v", err))
+		return
+	}
+
+	path := filepath.Join(screenshotDir, "screenshot"+time.Now().Format("20060102-150405.000")+".png")
+	if err := b.Screenshot(path); err != nil {
+		b.showMessage(fmt.Sprintf("Screenshot failed: %v", err))
+		return
+	}
+
+	b.showMessage("Screenshot saved to " + path)
+}
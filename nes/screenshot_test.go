@@ -0,0 +1,49 @@
+package nes
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScreenshot(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newIntegrationRom()))
+
+	path := filepath.Join(t.TempDir(), "shot.png")
+	if err := bus.Screenshot(path); err == nil {
+		t.Error("took screenshot with no display, want error")
+	}
+
+	frame := bus.RunHeadless(10)
+	if err := bus.Screenshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds(); got != image.Rect(0, 0, 256, 240) {
+		t.Fatalf("screenshot bounds = %v, want 256x240", got)
+	}
+
+	got := image.NewRGBA(img.Bounds())
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 256; x++ {
+			got.Set(x, y, img.At(x, y))
+		}
+	}
+	if !bytes.Equal(got.Pix, frame.Pix) {
+		t.Error("screenshot differs from the game picture")
+	}
+}
@@ -0,0 +1,56 @@
+package nes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Script tokens and the controller buttons they press.
+var scriptButtons = map[string]Button{
+	"A":      ButtonA,
+	"B":      ButtonB,
+	"SELECT": ButtonSelect,
+	"START":  ButtonStart,
+	"UP":     ButtonUp,
+	"DOWN":   ButtonDown,
+	"LEFT":   ButtonLeft,
+	"RIGHT":  ButtonRight,
+}
+
+// RunScripted runs the NES without a display, reading controller 1 input from
+// r. Each line of input holds the buttons held for one frame, separated by
+// whitespace, e.g. "START" or "A RIGHT". A blank line advances one frame with
+// no buttons held, and lines starting with '#' are ignored. Running stops at
+// the end of input, or with an error if a breakpoint or watchpoint is hit.
+func (b *Bus) RunScripted(r io.Reader) error {
+	// Write a crash report if emulation panics.
+	defer b.recoverCrash()
+
+	scanner := bufio.NewScanner(r)
+	controller := b.Controller[0]
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		controller.releaseAll()
+		for _, token := range strings.Fields(line) {
+			button, ok := scriptButtons[strings.ToUpper(token)]
+			if !ok {
+				return fmt.Errorf("script line %d: unknown button %q", lineNum, token)
+			}
+			controller.SetButton(button, true)
+		}
+
+		b.StepFrame()
+		if !b.Ppu.frameComplete {
+			return fmt.Errorf("script line %d: stopped at a breakpoint or watchpoint", lineNum)
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,56 @@
+package nes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunScripted(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+	bus.Reset()
+
+	script := "START\n\n# comment\nA right\n"
+	if err := bus.RunScripted(strings.NewReader(script)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bus.Ppu.frames; got != 3 {
+		t.Errorf("frames = %d, want 3", got)
+	}
+
+	want := byte(1<<ButtonA | 1<<ButtonRight)
+	if got := bus.Controller[0].GetState(); got != want {
+		t.Errorf("controller state = %08b, want %08b", got, want)
+	}
+}
+
+func TestRunScriptedUnknownButton(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newTestRom(1, 1, 0x00, 0x00)))
+
+	err := bus.RunScripted(strings.NewReader("A\nJUMP\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("err = %v, want unknown button on line 2", err)
+	}
+}
+
+func TestRunScriptedBreakpoint(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.InsertCartridge(newTestCartridge(t, newIntegrationRom()))
+
+	// The NMI handler runs once the game has started up, in the third frame.
+	bus.Cpu.AddBreakpoint(0x8072)
+	err := bus.RunScripted(strings.NewReader("A\nB\nSTART\nSELECT\nUP\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("err = %v, want a breakpoint on line 3", err)
+	}
+
+	// The rest of the script is not run.
+	if got := bus.Ppu.frames; got != 2 {
+		t.Errorf("frames = %d, want 2", got)
+	}
+	if got, want := bus.Controller[0].GetState(), byte(1<<ButtonStart); got != want {
+		t.Errorf("controller state = %08b, want %08b", got, want)
+	}
+}
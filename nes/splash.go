@@ -0,0 +1,104 @@
+package nes
+
+// Splash screen shown while no cartridge is inserted. The PPU generates its own
+// tiles into its internal pattern table memory, which stands in for CHR memory
+// until a cartridge is inserted.
+
+const splashText = "NO CARTRIDGE"
+
+// 8x8 glyphs for the splash text. Each byte is a row, with the most significant
+// bit on the left.
+var splashFont = map[rune][8]byte{
+	'A': {0x18, 0x3C, 0x66, 0x66, 0x7E, 0x66, 0x66, 0x00},
+	'C': {0x3C, 0x66, 0x60, 0x60, 0x60, 0x66, 0x3C, 0x00},
+	'D': {0x78, 0x6C, 0x66, 0x66, 0x66, 0x6C, 0x78, 0x00},
+	'E': {0x7E, 0x60, 0x60, 0x7C, 0x60, 0x60, 0x7E, 0x00},
+	'G': {0x3C, 0x66, 0x60, 0x6E, 0x66, 0x66, 0x3E, 0x00},
+	'I': {0x3C, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C, 0x00},
+	'N': {0x66, 0x76, 0x7E, 0x7E, 0x6E, 0x66, 0x66, 0x00},
+	'O': {0x3C, 0x66, 0x66, 0x66, 0x66, 0x66, 0x3C, 0x00},
+	'R': {0x7C, 0x66, 0x66, 0x7C, 0x78, 0x6C, 0x66, 0x00},
+	'T': {0x7E, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x00},
+}
+
+// Splash screen tiles. Tile 0 is blank, tiles 1-3 are solid blocks of pixel
+// values 1-3, and glyphs follow from splashFontTile.
+const splashFontTile = 0x10
+
+// Splash screen palettes: backdrop, then 4 background palettes of color bars.
+// Palette 0 pixel 3 is also used for the text.
+var splashPalette = [16]byte{
+	0x0F, 0x16, 0x2A, 0x30,
+	0x0F, 0x12, 0x28, 0x14,
+	0x0F, 0x11, 0x1A, 0x27,
+	0x0F, 0x00, 0x10, 0x20,
+}
+
+// loadSplash draws the splash screen: 12 color bars, one for each background
+// palette color, above the splash text. Rendering is enabled so the pipeline
+// draws it like any other background.
+func (p *Ppu) loadSplash() {
+	p.patternTable = [2][4096]byte{}
+
+	// Solid tiles 1-3
+	for pixel := 1; pixel <= 3; pixel++ {
+		for row := 0; row < 8; row++ {
+			if pixel&1 > 0 {
+				p.patternTable[0][pixel*16+row] = 0xFF
+			}
+			if pixel&2 > 0 {
+				p.patternTable[0][pixel*16+row+8] = 0xFF
+			}
+		}
+	}
+
+	// Glyphs use pixel value 3.
+	glyphTile := map[rune]byte{' ': 0}
+	tile := splashFontTile
+	for _, r := range splashText {
+		if _, ok := glyphTile[r]; ok {
+			continue
+		}
+		for row, bits := range splashFont[r] {
+			p.patternTable[0][tile*16+row] = bits
+			p.patternTable[0][tile*16+row+8] = bits
+		}
+		glyphTile[r] = byte(tile)
+		tile++
+	}
+
+	p.nameTable = [4][1024]byte{}
+	nametable := &p.nameTable[0]
+
+	// Color bars, 2 tiles wide, on rows 6-19 of columns 4-27. Attribute
+	// quadrants are 2x2 tiles, so each bar can use its own palette.
+	for bar := 0; bar < 12; bar++ {
+		palette := byte(bar / 3)
+		for row := 6; row < 20; row++ {
+			for col := 4 + bar*2; col < 6+bar*2; col++ {
+				nametable[row*32+col] = byte(1 + bar%3)
+
+				attrAddr := 0x3C0 + (row/4)*8 + col/4
+				shift := uint((row&2)<<1 | col&2)
+				nametable[attrAddr] &^= 0x03 << shift
+				nametable[attrAddr] |= palette << shift
+			}
+		}
+	}
+
+	// Centered text on row 23.
+	col := (32 - len(splashText)) / 2
+	for i, r := range splashText {
+		nametable[23*32+col+i] = glyphTile[r]
+	}
+
+	copy(p.paletteTable[:], splashPalette[:])
+
+	*p.ppuCtrl = 0
+	*p.ppuMask = 0
+	p.ppuMask.setFlag(maskBgShow)
+	p.ppuMask.setFlag(maskBgLeft)
+	*p.vRam = 0
+	*p.tRam = 0
+	p.scrollFineX = 0
+}
@@ -0,0 +1,88 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+)
+
+// Tile usage tracking counts how many times each CHR tile is fetched while
+// rendering a frame. Tiles 0-255 are in pattern table 0, and 256-511 are in
+// pattern table 1.
+
+// Number of tiles in both pattern tables.
+const tileCount = 512
+
+// SetTileUsageTracking enables or disables counting tile fetches.
+func (p *Ppu) SetTileUsageTracking(enabled bool) {
+	p.trackTileUsage = enabled
+	p.tileUsage = [tileCount]int{}
+	p.lastTileUsage = [tileCount]int{}
+}
+
+// TileUsage returns how many times each tile was fetched during the last
+// complete frame. Each 8 pixel row of a tile drawn counts as one fetch. All
+// counts are zero unless tile usage tracking is enabled.
+func (p *Ppu) TileUsage() [tileCount]int {
+	return p.lastTileUsage
+}
+
+// countTileFetch counts a fetch from the given pattern table address.
+func (p *Ppu) countTileFetch(addr uint16) {
+	if p.trackTileUsage {
+		p.tileUsage[(addr>>4)%tileCount]++
+	}
+}
+
+// endTileUsageFrame saves the tile usage of the frame just completed.
+func (p *Ppu) endTileUsageFrame() {
+	if p.trackTileUsage {
+		p.lastTileUsage = p.tileUsage
+		p.tileUsage = [tileCount]int{}
+	}
+}
+
+// GetTileUsageHeatmap returns pattern table i tinted red by how often each
+// tile was fetched during the last frame. The most used tile is fully red.
+func (p *Ppu) GetTileUsageHeatmap(i int) *image.RGBA {
+	rgba := p.GetPatternTable(i)
+	usage := p.lastTileUsage[i*256 : (i+1)*256]
+
+	max := 0
+	for _, n := range usage {
+		if n > max {
+			max = n
+		}
+	}
+	if max == 0 {
+		return rgba
+	}
+
+	heat := color.RGBA{255, 0, 0, 255}
+	for tile, n := range usage {
+		if n == 0 {
+			continue
+		}
+
+		// Blend between 1/4 and fully red, so rarely used tiles still stand
+		// out from unused ones.
+		amount := 0.25 + 0.75*float64(n)/float64(max)
+
+		tileX, tileY := (tile%16)*8, (tile/16)*8
+		for y := tileY; y < tileY+8; y++ {
+			for x := tileX; x < tileX+8; x++ {
+				rgba.SetRGBA(x, y, blendRGBA(rgba.RGBAAt(x, y), heat, amount))
+			}
+		}
+	}
+
+	return rgba
+}
+
+// blendRGBA mixes amount (0-1) of color b into color a.
+func blendRGBA(a, b color.RGBA, amount float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x)*(1-amount) + float64(y)*amount)
+	}
+
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
@@ -0,0 +1,46 @@
+package nes
+
+import "testing"
+
+func TestTileUsage(t *testing.T) {
+	ppu, _ := newTestPpu(t, newTestRom(1, 1, 0x00, 0x00))
+	ppu.ppuCtrl.setFlag(ctrlBgPatternTbl)
+	ppu.ppuMask.setFlag(maskBgShow)
+	ppu.ppuMask.setFlag(maskSpriteShow)
+	ppu.SetTileUsageTracking(true)
+
+	// Background of tile 5 from pattern table 1.
+	for i := range ppu.nameTable {
+		for j := range ppu.nameTable[i] {
+			ppu.nameTable[i][j] = 0x05
+		}
+	}
+
+	// One 8x8 sprite using tile $42 from pattern table 0.
+	ppu.oam.clear()
+	ppu.oam[0].y, ppu.oam[0].id, ppu.oam[0].attribute, ppu.oam[0].x = 10, 0x42, 0x00, 0x80
+
+	for frame := 0; frame < 2; frame++ {
+		ppu.frameComplete = false
+		for !ppu.frameComplete {
+			ppu.Clock()
+		}
+	}
+
+	// 32 visible tiles and 2 prefetched tiles on scanlines -1 to 239.
+	want := map[int]int{
+		0x105: 34 * 241,
+		0x042: 8,
+	}
+
+	for tile, got := range ppu.TileUsage() {
+		if got != want[tile] {
+			t.Errorf("tile $%03X fetched %d times, want %d", tile, got, want[tile])
+		}
+	}
+
+	ppu.SetTileUsageTracking(false)
+	if got := ppu.TileUsage(); got != [tileCount]int{} {
+		t.Error("tile usage not cleared when tracking is disabled")
+	}
+}
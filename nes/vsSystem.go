@@ -0,0 +1,72 @@
+package nes
+
+import (
+	"image/color"
+)
+
+// VS System arcade boards run NES hardware with an RGB PPU and read a bank of
+// 8 DIP switches through the controller ports.
+//
+// $4016 read:
+//   bit 0     - controller 1 data
+//   bits 3-4  - DIP switches 1-2
+// $4017 read:
+//   bit 0     - controller 2 data
+//   bits 2-7  - DIP switches 3-8
+//
+// reference: https://wiki.nesdev.com/w/index.php/VS_System
+
+// RP2C03 (RGB PPU) palette. Each entry holds 3-bit red, green, and blue levels
+// as the hex digits 0xRGB.
+// reference: https://wiki.nesdev.com/w/index.php/PPU_palettes#2C03_and_2C05
+var vsPaletteLevels = [paletteSize]uint16{
+	0x333, 0x014, 0x006, 0x326, 0x403, 0x503, 0x510, 0x420, 0x320, 0x120, 0x031, 0x040, 0x022, 0x000, 0x000, 0x000,
+	0x555, 0x036, 0x027, 0x407, 0x507, 0x704, 0x700, 0x630, 0x430, 0x140, 0x040, 0x053, 0x044, 0x000, 0x000, 0x000,
+	0x777, 0x357, 0x447, 0x637, 0x707, 0x737, 0x740, 0x750, 0x660, 0x360, 0x070, 0x276, 0x077, 0x000, 0x000, 0x000,
+	0x777, 0x567, 0x657, 0x757, 0x747, 0x755, 0x764, 0x772, 0x773, 0x572, 0x473, 0x276, 0x467, 0x000, 0x000, 0x000,
+}
+
+// vsPalette returns the RGB PPU palette used by VS System boards.
+func vsPalette() [paletteSize]color.RGBA {
+	palette := [paletteSize]color.RGBA{}
+
+	// Scale each 3-bit level (0-7) to 8 bits.
+	level := func(v uint16) byte {
+		return byte((v & 0x7) * 255 / 7)
+	}
+
+	for i, rgb := range vsPaletteLevels {
+		palette[i] = color.RGBA{level(rgb >> 8), level(rgb >> 4), level(rgb), 255}
+	}
+
+	return palette
+}
+
+// SetVSSystem enables or disables VS System mode. VS System mode is enabled
+// automatically when a VS System cartridge is inserted.
+func (b *Bus) SetVSSystem(enabled bool) {
+	b.isVSSystem = enabled
+
+	if enabled {
+		b.Ppu.SetPalette(vsPalette())
+	} else {
+		b.Ppu.SetPalette(b.Ppu.defaultPalette)
+	}
+}
+
+// SetDIP sets the VS System DIP switches. Bit 0 is switch 1, bit 7 is switch 8.
+func (b *Bus) SetDIP(switches byte) {
+	b.dipSwitches = switches
+}
+
+// vsDipBits returns the DIP switch bits placed on the data bus when reading the
+// given controller port.
+func (b *Bus) vsDipBits(addr uint16) byte {
+	if addr == ctrlMinAddr {
+		// $4016: switches 1-2 on bits 3-4
+		return (b.dipSwitches & 0x03) << 3
+	}
+
+	// $4017: switches 3-8 on bits 2-7
+	return b.dipSwitches & 0xFC
+}
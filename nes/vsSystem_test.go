@@ -0,0 +1,61 @@
+package nes
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestVSDipSwitches(t *testing.T) {
+	tests := []struct {
+		vsSystem bool
+		addr     uint16
+		want     byte
+	}{
+		// Controller bit 0 set, switches 1-2 on bits 3-4.
+		{true, 0x4016, 0x01 | 0x10},
+		// Controller bit 0 clear, switches 3-8 on bits 2-7.
+		{true, 0x4017, 0xA4},
+		// Only the controllers outside VS System mode.
+		{false, 0x4016, 0x01},
+		{false, 0x4017, 0x00},
+	}
+
+	for _, tt := range tests {
+		nes := NewBus(false, false)
+		nes.SetVSSystem(tt.vsSystem)
+		nes.SetDIP(0b1010_0110) // Switches 2, 3, 6 and 8 on
+		nes.ControllerState[0] = 0x80
+		nes.ControllerState[1] = 0x00
+
+		if got := nes.CpuRead(tt.addr); got != tt.want {
+			t.Errorf("VS System %v: read $%04X = %08b, want %08b", tt.vsSystem, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestVSPalette(t *testing.T) {
+	nes := NewBus(false, false)
+	defaultPalette := nes.Ppu.paletteRGBA
+
+	// 3-bit levels are scaled to 8 bits.
+	nes.SetVSSystem(true)
+	tests := []struct {
+		index byte
+		want  color.RGBA
+	}{
+		{0x01, color.RGBA{0, 36, 145, 255}},    // 0x014
+		{0x0D, color.RGBA{0, 0, 0, 255}},       // 0x000
+		{0x16, color.RGBA{255, 0, 0, 255}},     // 0x700
+		{0x20, color.RGBA{255, 255, 255, 255}}, // 0x777
+	}
+	for _, tt := range tests {
+		if got := nes.Ppu.paletteRGBA[tt.index]; got != tt.want {
+			t.Errorf("VS palette $%02X = %v, want %v", tt.index, got, tt.want)
+		}
+	}
+
+	nes.SetVSSystem(false)
+	if nes.Ppu.paletteRGBA != defaultPalette {
+		t.Error("default palette not restored")
+	}
+}